@@ -2,41 +2,61 @@ package main
 
 import (
 	"context"
+	"flag"
 	"fmt"
 	"os"
 	"os/signal"
-	"sync"
+	"syscall"
+	_ "time/tzdata" // user time zones must resolve without system zoneinfo
 
 	"github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/application"
 	"github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/config"
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/tracing"
 	"github.com/MichaelGenchev/telegram-grouppay-miniapp/pkg/logger"
 )
 
 func main() {
-	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	// Container runtimes stop the bot with SIGTERM, terminals with SIGINT
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 	defer cancel()
 
+	cfg, printConfig, err := loadConfig(flag.CommandLine, os.Args[1:])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	if printConfig {
+		if err := cfg.Print(os.Stdout); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	// Initialize logger
-	log := logger.NewDefault()
+	log, err := logger.New(cfg.Logger)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
 	defer log.Sync()
 
-	log.Info("Starting GroupPay Bot", logger.String("version", "1.0.0"))
-
-	cfg := config.Config{
-		Logger: logger.Config{
-			Level:       getEnvOrDefault("LOG_LEVEL", "info"),
-			Environment: getEnvOrDefault("ENVIRONMENT", "development"),
-			OutputPath:  getEnvOrDefault("LOG_OUTPUT", "stdout"),
-		},
+	// Initialize tracing; spans are flushed on exit
+	shutdownTracing, err := tracing.Setup(cfg.Tracing, "grouppay-bot")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
 	}
+	defer func() {
+		if err := shutdownTracing(context.Background()); err != nil {
+			log.Error("Failed to flush traces", logger.Error(err))
+		}
+	}()
 
-	if v := os.Getenv("TG_BOT_TOKEN"); v != "" {
-		cfg.TgBotToken = v
-	} else {
-		log.Fatal("TG_BOT_TOKEN environment variable is required")
-	}
+	log.Info("Starting GroupPay Bot", logger.String("version", "1.0.0"))
+	go reloadOnHangup(ctx, log)
 
-	err := run(ctx, cancel, cfg, log)
+	err = run(ctx, cancel, cfg, log)
 	if err != nil {
 		log.Error("Application failed", logger.Error(err))
 		os.Exit(1)
@@ -45,30 +65,59 @@ func main() {
 	log.Info("GroupPay Bot shutdown complete")
 }
 
+// loadConfig defines the flags of the bot on fs and loads its configuration
+func loadConfig(fs *flag.FlagSet, args []string) (cfg config.Config, printConfig bool, err error) {
+	fs.BoolVar(&printConfig, "print-config", false, "print the configuration with secrets redacted and exit")
+	cfg, err = config.Load(fs, args, "telegram.token")
+	return cfg, printConfig, err
+}
+
+// reloadOnHangup reloads the configuration on SIGHUP and applies the log
+// level, so it can be changed without a restart. Other settings need one.
+func reloadOnHangup(ctx context.Context, log logger.Logger) {
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	defer signal.Stop(hangup)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hangup:
+		}
+		cfg, _, err := loadConfig(flag.NewFlagSet(os.Args[0], flag.ContinueOnError), os.Args[1:])
+		if err != nil {
+			log.Error("Failed to reload configuration", logger.Error(err))
+			continue
+		}
+		previous := log.Level()
+		if err := log.SetLevel(cfg.Logger.Level); err != nil {
+			log.Error("Failed to apply log level", logger.Error(err))
+			continue
+		}
+		log.Info("Configuration reloaded", logger.String("log_level_from", previous), logger.String("log_level", cfg.Logger.Level))
+	}
+}
+
 func run(ctx context.Context, cancel context.CancelFunc, cfg config.Config, log logger.Logger) error {
-	app, err := application.New(cfg.TgBotToken, log)
+	app, err := application.New(cfg, log)
 	if err != nil {
 		return fmt.Errorf("create application: %w", err)
 	}
 
 	log.Info("Application created successfully")
-	var wg sync.WaitGroup
 
-	wg.Add(1)
-	go app.Run(ctx, &wg)
+	// Once shutting down, a second signal kills the bot without draining
+	go func() {
+		<-ctx.Done()
+		cancel()
+		log.Info("Shutdown signal received, draining work in flight; signal again to force exit")
+	}()
 
-	<-ctx.Done()
-	log.Info("Shutdown signal received, waiting for graceful shutdown...")
-	wg.Wait()
+	if err := app.Run(ctx); err != nil {
+		return err
+	}
 
 	log.Info("Application shutdown complete")
 	return nil
 }
-
-// getEnvOrDefault returns environment variable value or default if not set
-func getEnvOrDefault(key, defaultValue string) string {
-	if value := os.Getenv(key); value != "" {
-		return value
-	}
-	return defaultValue
-}
@@ -0,0 +1,463 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/currency"
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/export"
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/importer"
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/models"
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/money"
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/service"
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/storage/memory"
+)
+
+// errVerifyFailed is returned when balances of a group are inconsistent
+var errVerifyFailed = errors.New("balance verification failed")
+
+// newFlags returns the flag set of a command
+func newFlags(name, synopsis string) *flag.FlagSet {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: grouppayctl %s %s\n", name, synopsis)
+		flags.PrintDefaults()
+	}
+	return flags
+}
+
+// parseArgs parses a command's flags and its ID arguments
+func parseArgs(flags *flag.FlagSet, args []string, min, max int) ([]int64, error) {
+	if err := flags.Parse(args); err != nil {
+		return nil, errUsage
+	}
+	if flags.NArg() < min || (max >= 0 && flags.NArg() > max) {
+		flags.Usage()
+		return nil, errUsage
+	}
+	ids := make([]int64, flags.NArg())
+	for i, arg := range flags.Args() {
+		id, err := strconv.ParseInt(arg, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid ID %q", arg)
+		}
+		ids[i] = id
+	}
+	return ids, nil
+}
+
+func runMigrate(ctx context.Context, e *env, args []string) (bool, error) {
+	if _, err := parseArgs(newFlags("migrate", ""), args, 0, 0); err != nil {
+		return false, err
+	}
+
+	version, err := memory.FileVersion(e.dataFile)
+	if errors.Is(err, fs.ErrNotExist) {
+		fmt.Printf("%s does not exist yet, nothing to migrate\n", e.dataFile)
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("read data file version: %w", err)
+	}
+	if version == memory.FormatVersion {
+		fmt.Printf("%s is at version %d, nothing to migrate\n", e.dataFile, version)
+		return false, nil
+	}
+
+	if e.store, err = memory.Open(e.dataFile); err != nil {
+		return false, fmt.Errorf("open data file: %w", err)
+	}
+	fmt.Printf("%s migrated from version %d to %d\n", e.dataFile, version, memory.FormatVersion)
+	return true, nil
+}
+
+func runGroupsList(ctx context.Context, e *env, args []string) (bool, error) {
+	if _, err := parseArgs(newFlags("groups list", ""), args, 0, 0); err != nil {
+		return false, err
+	}
+
+	groups, err := e.store.ListGroups(ctx)
+	if err != nil {
+		return false, err
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tNAME\tCHAT\tCURRENCY\tMEMBERS\tEXPENSES\tCREATED")
+	for _, g := range groups {
+		members, err := e.store.GetGroupMembers(ctx, g.ID)
+		if err != nil {
+			return false, err
+		}
+		expenses, err := e.store.GetGroupExpenses(ctx, g.ID)
+		if err != nil {
+			return false, err
+		}
+		fmt.Fprintf(w, "%d\t%s\t%d\t%s\t%d\t%d\t%s\n", g.ID, g.Name, g.ChatID, g.BaseCurrency,
+			len(members), len(expenses), g.CreatedAt.UTC().Format("2006-01-02 15:04"))
+	}
+	return false, w.Flush()
+}
+
+func runGroupsShow(ctx context.Context, e *env, args []string) (bool, error) {
+	ids, err := parseArgs(newFlags("groups show", "GROUP"), args, 1, 1)
+	if err != nil {
+		return false, err
+	}
+
+	g, err := e.store.GetGroup(ctx, ids[0])
+	if err != nil {
+		return false, fmt.Errorf("get group %d: %w", ids[0], err)
+	}
+	base, err := currency.Lookup(g.BaseCurrency)
+	if err != nil {
+		return false, err
+	}
+	check, err := e.services.Maintenance.CheckBalances(ctx, g.ID)
+	if err != nil {
+		return false, err
+	}
+	members, err := e.store.GetGroupMembers(ctx, g.ID)
+	if err != nil {
+		return false, err
+	}
+	expenses, err := e.store.GetGroupExpenses(ctx, g.ID)
+	if err != nil {
+		return false, err
+	}
+	settlements, err := e.store.GetGroupSettlements(ctx, g.ID)
+	if err != nil {
+		return false, err
+	}
+	events, err := e.store.GetGroupEvents(ctx, g.ID, 0)
+	if err != nil {
+		return false, err
+	}
+
+	fmt.Printf("Group %d: %s\n", g.ID, g.Name)
+	if g.Description != "" {
+		fmt.Printf("Description:   %s\n", g.Description)
+	}
+	fmt.Printf("Chat:          %d\n", g.ChatID)
+	fmt.Printf("Base currency: %s\n", g.BaseCurrency)
+	fmt.Printf("Created:       %s by %s\n", g.CreatedAt.UTC().Format("2006-01-02 15:04"), e.userName(ctx, g.CreatedBy))
+	fmt.Printf("Expenses:      %d\n", len(expenses))
+	fmt.Printf("Settlements:   %d\n", len(settlements))
+	fmt.Printf("Ledger events: %d\n\n", len(events))
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "MEMBER\tROLE\tJOINED\tBALANCE")
+	for _, m := range members {
+		balance, ok := check.Ledger[m.UserID]
+		if !ok {
+			balance = money.Zero(base)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", e.userName(ctx, m.UserID), m.Role,
+			m.JoinedAt.UTC().Format("2006-01-02"), balance)
+	}
+	if err := w.Flush(); err != nil {
+		return false, err
+	}
+	printProblems(check)
+	return false, nil
+}
+
+func runBalancesRecompute(ctx context.Context, e *env, args []string) (bool, error) {
+	ids, err := parseArgs(newFlags("balances recompute", "GROUP"), args, 1, 1)
+	if err != nil {
+		return false, err
+	}
+
+	balances, err := e.services.Maintenance.RecomputeBalances(ctx, ids[0])
+	if err != nil {
+		return false, err
+	}
+	printBalances(ctx, e, balances)
+
+	check, err := e.services.Maintenance.CheckBalances(ctx, ids[0])
+	if err != nil {
+		return true, err
+	}
+	if !check.OK() {
+		printProblems(check)
+		return true, errVerifyFailed
+	}
+	return true, nil
+}
+
+func runBalancesVerify(ctx context.Context, e *env, args []string) (bool, error) {
+	ids, err := parseArgs(newFlags("balances verify", "[GROUP...]"), args, 0, -1)
+	if err != nil {
+		return false, err
+	}
+	if len(ids) == 0 {
+		groups, err := e.store.ListGroups(ctx)
+		if err != nil {
+			return false, err
+		}
+		for _, g := range groups {
+			ids = append(ids, g.ID)
+		}
+	}
+
+	failed := 0
+	for _, id := range ids {
+		check, err := e.services.Maintenance.CheckBalances(ctx, id)
+		if err != nil {
+			return false, fmt.Errorf("group %d: %w", id, err)
+		}
+		if check.OK() {
+			fmt.Printf("group %d: ok\n", id)
+			continue
+		}
+		failed++
+		fmt.Printf("group %d: FAILED\n", id)
+		printProblems(check)
+	}
+	if failed > 0 {
+		return false, fmt.Errorf("%d of %d groups: %w", failed, len(ids), errVerifyFailed)
+	}
+	return false, nil
+}
+
+func runExport(ctx context.Context, e *env, args []string) (bool, error) {
+	flags := newFlags("export", "[flags] GROUP")
+	format := flags.String("format", export.FormatCSV, "output format, csv or json")
+	from := flags.String("from", "", "first date to export (YYYY-MM-DD)")
+	to := flags.String("to", "", "last date to export (YYYY-MM-DD)")
+	output := flags.String("o", "", "output file, stdout if empty")
+	as := flags.Int64("as", 0, "user to export as, the group's first admin if zero")
+	ids, err := parseArgs(flags, args, 1, 1)
+	if err != nil {
+		return false, err
+	}
+
+	period, err := service.ParseExportRange(*from, *to)
+	if err != nil {
+		return false, err
+	}
+	actorID, err := e.actor(ctx, ids[0], *as)
+	if err != nil {
+		return false, err
+	}
+
+	var w io.Writer = os.Stdout
+	if *output != "" {
+		f, err := os.Create(*output)
+		if err != nil {
+			return false, err
+		}
+		defer f.Close()
+		w = f
+	}
+	enc, err := export.NewEncoder(*format, w)
+	if err != nil {
+		return false, err
+	}
+	return false, e.services.Export.Export(ctx, actorID, ids[0], period, enc)
+}
+
+func runImport(ctx context.Context, e *env, args []string) (bool, error) {
+	flags := newFlags("import", "[flags] GROUP")
+	file := flags.String("file", "", "file to import")
+	source := flags.String("source", models.ImportSplitwise, "file format, splitwise or csv")
+	mapping := flags.String("map", "", "columns of a csv file as space separated key=value pairs, e.g. \"amount=Cost paid_by=Payer\"")
+	dryRun := flags.Bool("dry-run", false, "show the resulting balances without importing")
+	as := flags.Int64("as", 0, "admin to import as, the group's first admin if zero")
+	var matches matchFlag
+	flags.Var(&matches, "match", "match a person in the file to a user, NAME=USER; repeatable")
+	ids, err := parseArgs(flags, args, 1, 1)
+	if err != nil {
+		return false, err
+	}
+	if *file == "" {
+		flags.Usage()
+		return false, errUsage
+	}
+
+	in := service.StartImportInput{GroupID: ids[0], Source: *source}
+	if *source == models.ImportCSV {
+		if in.Mapping, err = importer.ParseMapping(strings.Fields(*mapping)); err != nil {
+			return false, err
+		}
+	}
+	actorID, err := e.actor(ctx, ids[0], *as)
+	if err != nil {
+		return false, err
+	}
+
+	f, err := os.Open(*file)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+	in.File = f
+
+	imp, err := e.services.Imports.Start(ctx, actorID, in)
+	if err != nil {
+		return false, err
+	}
+	for name, userID := range matches {
+		person := -1
+		for i, p := range imp.People {
+			if p == name {
+				person = i
+			}
+		}
+		if person < 0 {
+			return false, fmt.Errorf("%q does not appear in the file", name)
+		}
+		if imp, err = e.services.Imports.Match(ctx, actorID, imp.ID, person, userID); err != nil {
+			return false, err
+		}
+	}
+
+	fmt.Printf("%d expenses of %d people:\n", len(imp.Records), len(imp.People))
+	unmatched := 0
+	for i, person := range imp.People {
+		if imp.Matches[i] == 0 {
+			unmatched++
+			fmt.Printf("  %s → unmatched\n", person)
+			continue
+		}
+		fmt.Printf("  %s → %s\n", person, e.userName(ctx, imp.Matches[i]))
+	}
+	if unmatched > 0 {
+		// The import stays pending and is not saved; rerun with -match
+		return false, fmt.Errorf("%d people are not matched, pass -match NAME=USER for each", unmatched)
+	}
+
+	var result *service.ImportResult
+	if *dryRun {
+		result, err = e.services.Imports.Preview(ctx, actorID, imp.ID)
+	} else {
+		result, err = e.services.Imports.Commit(ctx, actorID, imp.ID)
+	}
+	if err != nil {
+		return false, err
+	}
+
+	fmt.Println("\nBalances after the import:")
+	printBalances(ctx, e, result.Balances)
+	if *dryRun {
+		fmt.Println("\nDry run, nothing was imported")
+		return false, nil
+	}
+	fmt.Printf("\nImported %d expenses\n", result.Expenses)
+	return true, nil
+}
+
+// matchFlag collects NAME=USER flags
+type matchFlag map[string]int64
+
+func (m *matchFlag) String() string {
+	return fmt.Sprint(map[string]int64(*m))
+}
+
+func (m *matchFlag) Set(value string) error {
+	name, user, ok := strings.Cut(value, "=")
+	if !ok || name == "" {
+		return errors.New("must be NAME=USER")
+	}
+	userID, err := strconv.ParseInt(user, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid user ID %q", user)
+	}
+	if *m == nil {
+		*m = make(matchFlag)
+	}
+	(*m)[name] = userID
+	return nil
+}
+
+func runUsersAnonymize(ctx context.Context, e *env, args []string) (bool, error) {
+	ids, err := parseArgs(newFlags("users anonymize", "USER"), args, 1, 1)
+	if err != nil {
+		return false, err
+	}
+
+	user, err := e.services.Users.Anonymize(ctx, ids[0])
+	if err != nil {
+		return false, err
+	}
+	fmt.Printf("user %d anonymized\n", user.ID)
+	return true, nil
+}
+
+func runBackup(ctx context.Context, e *env, args []string) (bool, error) {
+	flags := newFlags("backup", "[-o FILE]")
+	output := flags.String("o", "", "backup file, stdout if empty")
+	if _, err := parseArgs(flags, args, 0, 0); err != nil {
+		return false, err
+	}
+
+	if *output == "" {
+		return false, e.store.Dump(os.Stdout)
+	}
+	if err := e.store.Save(*output); err != nil {
+		return false, err
+	}
+	fmt.Fprintf(os.Stderr, "backup written to %s\n", *output)
+	return false, nil
+}
+
+func runRestore(ctx context.Context, e *env, args []string) (bool, error) {
+	flags := newFlags("restore", "[-force] -i FILE")
+	input := flags.String("i", "", "backup file to restore")
+	force := flags.Bool("force", false, "overwrite an existing data file")
+	if _, err := parseArgs(flags, args, 0, 0); err != nil {
+		return false, err
+	}
+	if *input == "" {
+		flags.Usage()
+		return false, errUsage
+	}
+	if _, err := os.Stat(e.dataFile); err == nil && !*force {
+		return false, fmt.Errorf("%s exists, pass -force to overwrite it", e.dataFile)
+	}
+
+	f, err := os.Open(*input)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	e.store = memory.New()
+	if err := e.store.Restore(f); err != nil {
+		return false, fmt.Errorf("read backup: %w", err)
+	}
+	fmt.Printf("%s restored from %s\n", e.dataFile, *input)
+	return true, nil
+}
+
+// printBalances prints non-zero balances, largest credit first
+func printBalances(ctx context.Context, e *env, balances map[int64]money.Money) {
+	userIDs := make([]int64, 0, len(balances))
+	for userID, balance := range balances {
+		if !balance.IsZero() {
+			userIDs = append(userIDs, userID)
+		}
+	}
+	sort.Slice(userIDs, func(i, j int) bool {
+		return balances[userIDs[i]].Amount() > balances[userIDs[j]].Amount()
+	})
+	if len(userIDs) == 0 {
+		fmt.Println("  all settled")
+	}
+	for _, userID := range userIDs {
+		fmt.Printf("  %s: %s\n", e.userName(ctx, userID), balances[userID])
+	}
+}
+
+func printProblems(check *service.BalanceCheck) {
+	for _, problem := range check.Problems {
+		fmt.Printf("  ! %s\n", problem)
+	}
+}
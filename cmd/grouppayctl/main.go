@@ -0,0 +1,204 @@
+// Command grouppayctl administers the data of the GroupPay bot. It works on
+// the bot's data file directly, so it should be run while the bot is stopped.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	_ "time/tzdata" // user time zones must resolve without system zoneinfo
+
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/config"
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/engine"
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/fx"
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/models"
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/receipt"
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/service"
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/storage/memory"
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/pkg/logger"
+)
+
+const usage = `Usage: grouppayctl [config flags] <command> [arguments]
+
+Commands:
+  migrate                        upgrade the data file to the current format
+  groups list                    list all groups
+  groups show GROUP              show a group with its members and balances
+  balances recompute GROUP       rebuild the balance snapshots of a group from its ledger
+  balances verify [GROUP...]     check that balances agree and sum to zero
+  export [flags] GROUP           export the history of a group
+  import [flags] GROUP           import a Splitwise or CSV file into a group
+  users anonymize USER           erase the personal data of a user
+  backup [-o FILE]               write a backup of all data
+  restore [-force] -i FILE       replace all data with a backup
+
+The data file is read from the bot's configuration: storage.dsn must be
+"file:PATH". Run "grouppayctl -help" for the config flags and
+"grouppayctl <command> -h" for the flags of a command.
+`
+
+// errUsage reports invalid arguments; the usage has already been printed
+var errUsage = errors.New("invalid arguments")
+
+// env is what commands work with
+type env struct {
+	cfg      config.Config
+	dataFile string
+	store    *memory.Store
+	services *service.Service
+	logger   logger.Logger
+}
+
+// command runs a subcommand. Commands that change data return changed so
+// the data file is saved afterwards.
+type command func(ctx context.Context, e *env, args []string) (changed bool, err error)
+
+var commands = map[string]command{
+	"migrate":            runMigrate,
+	"groups list":        runGroupsList,
+	"groups show":        runGroupsShow,
+	"balances recompute": runBalancesRecompute,
+	"balances verify":    runBalancesVerify,
+	"export":             runExport,
+	"import":             runImport,
+	"users anonymize":    runUsersAnonymize,
+	"backup":             runBackup,
+	"restore":            runRestore,
+}
+
+func main() {
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+
+	if err := run(ctx, os.Args[1:]); err != nil {
+		if !errors.Is(err, errUsage) {
+			fmt.Fprintln(os.Stderr, "grouppayctl:", err)
+		}
+		os.Exit(1)
+	}
+}
+
+func run(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("grouppayctl", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprint(flags.Output(), usage+"\nConfig flags:\n")
+		flags.PrintDefaults()
+	}
+	cfg, err := config.Load(flags, args)
+	if errors.Is(err, flag.ErrHelp) {
+		return errUsage
+	}
+	if err != nil {
+		return err
+	}
+	args = flags.Args()
+
+	name, cmd := lookup(args)
+	if cmd == nil {
+		flags.Usage()
+		return errUsage
+	}
+	dataFile := cfg.Storage.DataFile()
+	if dataFile == "" {
+		return errors.New(`no data file, set storage.dsn to "file:PATH"`)
+	}
+
+	// Command output goes to stdout, so logs must not
+	if cfg.Logger.OutputPath == "stdout" {
+		cfg.Logger.OutputPath = "stderr"
+	}
+	log, err := logger.New(cfg.Logger)
+	if err != nil {
+		return err
+	}
+	defer log.Sync()
+
+	e := &env{cfg: cfg, dataFile: dataFile, logger: log}
+	if name != "migrate" && name != "restore" {
+		if err := e.open(); err != nil {
+			return err
+		}
+	}
+
+	ctx = service.WithSource(ctx, models.SourceCLI)
+	changed, err := cmd(ctx, e, args[len(strings.Fields(name)):])
+	if changed {
+		if err := e.store.Save(dataFile); err != nil {
+			return fmt.Errorf("save data file: %w", err)
+		}
+	}
+	return err
+}
+
+// lookup finds the command named by the leading arguments
+func lookup(args []string) (string, command) {
+	for n := min(2, len(args)); n > 0; n-- {
+		name := args[0]
+		if n == 2 {
+			name += " " + args[1]
+		}
+		if cmd, ok := commands[name]; ok {
+			return name, cmd
+		}
+	}
+	return "", nil
+}
+
+// open loads the data file and creates the services on top of it
+func (e *env) open() error {
+	store, err := memory.Open(e.dataFile)
+	if err != nil {
+		return fmt.Errorf("open data file: %w", err)
+	}
+
+	rates := fx.NewStaticProvider()
+	if e.cfg.FX.RatesFile != "" {
+		if rates, err = fx.LoadStaticFile(e.cfg.FX.RatesFile); err != nil {
+			return fmt.Errorf("load exchange rates: %w", err)
+		}
+	}
+	ocr := receipt.NewTesseract(e.cfg.OCR.TesseractPath, e.cfg.OCR.Languages)
+	calc := engine.NewBalanceCalculator()
+	calc.SettlementThreshold = e.cfg.Engine.SettlementThreshold
+
+	e.store = store
+	e.services = service.New(store, calc, rates, service.DefaultReminderPolicy(), ocr, e.logger)
+	return nil
+}
+
+// actor returns the user a command acts as in a group: the given user, or
+// the group's longest-standing admin
+func (e *env) actor(ctx context.Context, groupID, as int64) (int64, error) {
+	if as != 0 {
+		return as, nil
+	}
+	members, err := e.store.GetGroupMembers(ctx, groupID)
+	if err != nil {
+		return 0, fmt.Errorf("get group members: %w", err)
+	}
+	sort.Slice(members, func(i, j int) bool { return members[i].JoinedAt.Before(members[j].JoinedAt) })
+	for _, m := range members {
+		if m.Role == models.RoleAdmin {
+			return m.UserID, nil
+		}
+	}
+	return 0, fmt.Errorf("group %d has no admin, pass -as", groupID)
+}
+
+// userName describes a user for command output
+func (e *env) userName(ctx context.Context, userID int64) string {
+	user, err := e.store.GetUser(ctx, userID)
+	switch {
+	case err != nil:
+		return fmt.Sprintf("#%d", userID)
+	case user.Username != "":
+		return fmt.Sprintf("#%d @%s", userID, user.Username)
+	default:
+		return fmt.Sprintf("#%d %s", userID, user.FirstName)
+	}
+}
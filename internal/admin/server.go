@@ -0,0 +1,153 @@
+// Package admin serves the operations endpoint of the bot. It is meant for
+// operators and should only be reachable from private networks.
+package admin
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/config"
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/pkg/logger"
+)
+
+// checkTimeout bounds how long all readiness checks may take together
+const checkTimeout = 5 * time.Second
+
+// CheckFunc checks whether a dependency of the bot is ready
+type CheckFunc func(ctx context.Context) error
+
+type check struct {
+	name string
+	fn   CheckFunc
+}
+
+// Server exposes operations such as changing the log level and health
+// checks over HTTP
+type Server struct {
+	server *http.Server
+	mux    *http.ServeMux
+	token  config.Secret
+	checks []check
+	logger logger.Logger
+}
+
+// New creates a new admin server listening on addr. If the token is set,
+// every request but health checks must carry it as a bearer token.
+func New(addr string, token config.Secret, log logger.Logger) *Server {
+	s := &Server{
+		mux:    http.NewServeMux(),
+		token:  token,
+		logger: log.With(logger.String("component", "admin")),
+	}
+	s.mux.Handle("/log/level", logger.LevelHandler(log))
+	s.mux.HandleFunc("GET /healthz", s.handleHealthz)
+	s.mux.HandleFunc("GET /readyz", s.handleReadyz)
+
+	s.server = &http.Server{
+		Addr:              addr,
+		Handler:           s.authorize(s.mux),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	return s
+}
+
+// Handle registers an additional operations handler
+func (s *Server) Handle(pattern string, handler http.Handler) {
+	s.mux.Handle(pattern, handler)
+}
+
+// AddCheck registers a readiness check. Checks must be added before Run is called.
+func (s *Server) AddCheck(name string, fn CheckFunc) {
+	s.checks = append(s.checks, check{name: name, fn: fn})
+}
+
+// handleHealthz reports that the process is alive
+func (s *Server) handleHealthz(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// handleReadyz runs every readiness check and reports the failed ones
+func (s *Server) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), checkTimeout)
+	defer cancel()
+
+	status, failures := http.StatusOK, map[string]string{}
+	for _, c := range s.checks {
+		if err := c.fn(ctx); err != nil {
+			status = http.StatusServiceUnavailable
+			failures[c.name] = err.Error()
+			s.logger.WarnContext(ctx, "Readiness check failed", logger.String("check", c.name), logger.Error(err))
+		}
+	}
+	if status != http.StatusOK {
+		writeJSON(w, status, map[string]any{"status": "unavailable", "failures": failures})
+		return
+	}
+	writeJSON(w, status, map[string]string{"status": "ok"})
+}
+
+// authorize rejects requests without the configured bearer token. Health
+// checks are left open for probes.
+func (s *Server) authorize(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !s.token.IsZero() && r.URL.Path != "/healthz" && r.URL.Path != "/readyz" {
+			token, _ := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if subtle.ConstantTimeCompare([]byte(token), []byte(s.token.Value())) != 1 {
+				writeError(w, http.StatusUnauthorized, "unauthorized")
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Run serves HTTP requests until the context is cancelled and then waits
+// for the requests in flight
+func (s *Server) Run(ctx context.Context) error {
+	errCh := make(chan error, 1)
+	go func() {
+		s.logger.Info("Starting admin endpoint", logger.String("addr", s.server.Addr))
+		errCh <- s.server.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errCh:
+		return err
+	case <-ctx.Done():
+	}
+
+	// Requests in flight are finished unless Close cuts them off
+	if err := s.server.Shutdown(context.Background()); err != nil {
+		return err
+	}
+	if err := <-errCh; !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+
+	s.logger.Info("Admin endpoint stopped")
+	return nil
+}
+
+// Close closes all connections, cutting off requests in flight, e.g. when
+// waiting for them on shutdown takes too long
+func (s *Server) Close() error {
+	return s.server.Close()
+}
+
+// writeJSON writes v as a JSON response with the given status code
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// writeError writes a JSON error response
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"error": message})
+}
@@ -0,0 +1,130 @@
+package api
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/models"
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/service"
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/pkg/logger"
+)
+
+// initDataMaxAge is how long Mini App init data is accepted after it was issued
+const initDataMaxAge = 24 * time.Hour
+
+type contextKey struct{ name string }
+
+var userContextKey = contextKey{"user"}
+
+// webAppUser is the user object embedded in Mini App init data
+type webAppUser struct {
+	ID           int64  `json:"id"`
+	FirstName    string `json:"first_name"`
+	LastName     string `json:"last_name"`
+	Username     string `json:"username"`
+	LanguageCode string `json:"language_code"`
+}
+
+// authenticate validates the Telegram Mini App init data sent in the
+// Authorization header ("tma <init data>") and stores the user in the context.
+func (s *Server) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		initData, ok := strings.CutPrefix(r.Header.Get("Authorization"), "tma ")
+		if !ok {
+			writeError(w, http.StatusUnauthorized, "missing init data")
+			return
+		}
+
+		profile, err := validateInitData(initData, s.botToken.Value(), time.Now())
+		if err != nil {
+			s.logger.DebugContext(r.Context(), "Rejected init data", logger.Error(err))
+			writeError(w, http.StatusUnauthorized, "invalid init data")
+			return
+		}
+		r = r.WithContext(logger.WithUserID(r.Context(), profile.ID))
+
+		user, err := s.services.Users.EnsureUser(r.Context(), models.User{
+			TelegramID:   profile.ID,
+			Username:     profile.Username,
+			FirstName:    profile.FirstName,
+			LastName:     profile.LastName,
+			LanguageCode: profile.LanguageCode,
+		})
+		if err != nil {
+			s.writeServiceError(w, r, err)
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), userContextKey, user)
+		ctx = service.WithSource(ctx, models.SourceMiniApp)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// currentUser returns the authenticated user of the request
+func currentUser(r *http.Request) *models.User {
+	user, _ := r.Context().Value(userContextKey).(*models.User)
+	return user
+}
+
+// validateInitData checks the signature and age of Mini App init data as described in
+// https://core.telegram.org/bots/webapps#validating-data-received-via-the-mini-app
+func validateInitData(initData, botToken string, now time.Time) (*webAppUser, error) {
+	values, err := url.ParseQuery(initData)
+	if err != nil {
+		return nil, fmt.Errorf("parse init data: %w", err)
+	}
+
+	hash := values.Get("hash")
+	if hash == "" {
+		return nil, errors.New("hash is missing")
+	}
+
+	pairs := make([]string, 0, len(values))
+	for key := range values {
+		if key == "hash" {
+			continue
+		}
+		pairs = append(pairs, key+"="+values.Get(key))
+	}
+	sort.Strings(pairs)
+
+	secret := hmac.New(sha256.New, []byte("WebAppData"))
+	secret.Write([]byte(botToken))
+	mac := hmac.New(sha256.New, secret.Sum(nil))
+	mac.Write([]byte(strings.Join(pairs, "\n")))
+
+	expected, err := hex.DecodeString(hash)
+	if err != nil || !hmac.Equal(mac.Sum(nil), expected) {
+		return nil, errors.New("signature mismatch")
+	}
+
+	authDate, err := strconv.ParseInt(values.Get("auth_date"), 10, 64)
+	if err != nil {
+		return nil, errors.New("auth_date is invalid")
+	}
+	if now.Sub(time.Unix(authDate, 0)) > initDataMaxAge {
+		return nil, errors.New("init data expired")
+	}
+
+	var user webAppUser
+	if err := json.Unmarshal([]byte(values.Get("user")), &user); err != nil {
+		return nil, fmt.Errorf("parse user: %w", err)
+	}
+	if user.ID == 0 {
+		return nil, errors.New("user is missing")
+	}
+
+	return &user, nil
+}
@@ -0,0 +1,366 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/export"
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/models"
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/money"
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/service"
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/pkg/logger"
+)
+
+// balanceResponse is a single user's balance in a group
+type balanceResponse struct {
+	UserID int64       `json:"user_id"`
+	Amount money.Money `json:"amount"`
+}
+
+// expenseResponse is an expense together with how it is split
+type expenseResponse struct {
+	models.Expense
+	Participants []models.Participant `json:"participants"`
+}
+
+// historyResponse is a page of a group's audit log
+type historyResponse struct {
+	Entries  []models.AuditEntry `json:"entries"`
+	Total    int                 `json:"total"`
+	Verified bool                `json:"verified"`
+	// BrokenAt is the ID of the first entry failing verification
+	BrokenAt int64 `json:"broken_at,omitempty"`
+}
+
+// createExpenseRequest is the body of an expense creation request
+type createExpenseRequest struct {
+	Description    string      `json:"description"`
+	Amount         money.Money `json:"amount"`
+	PaidBy         int64       `json:"paid_by"`
+	ParticipantIDs []int64     `json:"participant_ids"`
+}
+
+func (s *Server) handleListGroups(w http.ResponseWriter, r *http.Request) {
+	groups, err := s.services.Groups.ListGroups(r.Context(), currentUser(r).ID)
+	if err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, groups)
+}
+
+func (s *Server) handleGetGroup(w http.ResponseWriter, r *http.Request) {
+	groupID, ok := pathID(w, r, "groupID")
+	if !ok {
+		return
+	}
+
+	group, err := s.services.Groups.GetGroup(r.Context(), currentUser(r).ID, groupID)
+	if err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, group)
+}
+
+func (s *Server) handleListMembers(w http.ResponseWriter, r *http.Request) {
+	groupID, ok := pathID(w, r, "groupID")
+	if !ok {
+		return
+	}
+
+	members, err := s.services.Groups.Members(r.Context(), currentUser(r).ID, groupID)
+	if err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, members)
+}
+
+func (s *Server) handleListExpenses(w http.ResponseWriter, r *http.Request) {
+	groupID, ok := pathID(w, r, "groupID")
+	if !ok {
+		return
+	}
+
+	expenses, err := s.services.Expenses.ListExpenses(r.Context(), currentUser(r).ID, groupID)
+	if err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, expenses)
+}
+
+func (s *Server) handleCreateExpense(w http.ResponseWriter, r *http.Request) {
+	groupID, ok := pathID(w, r, "groupID")
+	if !ok {
+		return
+	}
+
+	var req createExpenseRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	expense, participants, err := s.services.Expenses.CreateExpense(r.Context(), currentUser(r).ID, service.CreateExpenseInput{
+		GroupID:        groupID,
+		PaidBy:         req.PaidBy,
+		Description:    req.Description,
+		Amount:         req.Amount,
+		ParticipantIDs: req.ParticipantIDs,
+	})
+	if err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, expenseResponse{Expense: *expense, Participants: participants})
+}
+
+// updateExpenseRequest is the body of an expense update request, omitted fields are unchanged
+type updateExpenseRequest struct {
+	Description    *string      `json:"description"`
+	Amount         *money.Money `json:"amount"`
+	ParticipantIDs []int64      `json:"participant_ids"`
+}
+
+// expenseChangeResponse describes the effect of an expense update or deletion
+type expenseChangeResponse struct {
+	Expense *models.Expense   `json:"expense,omitempty"`
+	Delta   []balanceResponse `json:"balance_delta"`
+}
+
+func (s *Server) handleGetExpense(w http.ResponseWriter, r *http.Request) {
+	expenseID, ok := pathID(w, r, "expenseID")
+	if !ok {
+		return
+	}
+
+	expense, participants, err := s.services.Expenses.GetExpense(r.Context(), currentUser(r).ID, expenseID)
+	if err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, expenseResponse{Expense: *expense, Participants: participants})
+}
+
+func (s *Server) handleUpdateExpense(w http.ResponseWriter, r *http.Request) {
+	expenseID, ok := pathID(w, r, "expenseID")
+	if !ok {
+		return
+	}
+
+	var req updateExpenseRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	change, err := s.services.Expenses.UpdateExpense(r.Context(), currentUser(r).ID, expenseID, service.UpdateExpenseInput{
+		Description:    req.Description,
+		Amount:         req.Amount,
+		ParticipantIDs: req.ParticipantIDs,
+	})
+	if err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, newExpenseChangeResponse(change))
+}
+
+func (s *Server) handleDeleteExpense(w http.ResponseWriter, r *http.Request) {
+	expenseID, ok := pathID(w, r, "expenseID")
+	if !ok {
+		return
+	}
+
+	change, err := s.services.Expenses.DeleteExpense(r.Context(), currentUser(r).ID, expenseID)
+	if err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, newExpenseChangeResponse(change))
+}
+
+func newExpenseChangeResponse(change *service.ExpenseChange) expenseChangeResponse {
+	resp := expenseChangeResponse{Expense: change.After, Delta: make([]balanceResponse, 0, len(change.Delta))}
+	for userID, amount := range change.Delta {
+		resp.Delta = append(resp.Delta, balanceResponse{UserID: userID, Amount: amount})
+	}
+	return resp
+}
+
+func (s *Server) handleGetBalances(w http.ResponseWriter, r *http.Request) {
+	groupID, ok := pathID(w, r, "groupID")
+	if !ok {
+		return
+	}
+
+	// ?at= replays the ledger up to an RFC 3339 time or the end of a day (UTC)
+	var balances map[int64]money.Money
+	var err error
+	if v := r.URL.Query().Get("at"); v != "" {
+		at, perr := time.Parse(time.RFC3339, v)
+		if perr != nil {
+			day, derr := time.Parse(time.DateOnly, v)
+			if derr != nil {
+				writeError(w, http.StatusBadRequest, "invalid at")
+				return
+			}
+			at = day.Add(24*time.Hour - time.Nanosecond)
+		}
+		balances, err = s.services.Settlements.BalancesAt(r.Context(), currentUser(r).ID, groupID, at)
+	} else {
+		balances, err = s.services.Settlements.Balances(r.Context(), currentUser(r).ID, groupID)
+	}
+	if err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+
+	resp := make([]balanceResponse, 0, len(balances))
+	for userID, amount := range balances {
+		resp = append(resp, balanceResponse{UserID: userID, Amount: amount})
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (s *Server) handleListSettlements(w http.ResponseWriter, r *http.Request) {
+	groupID, ok := pathID(w, r, "groupID")
+	if !ok {
+		return
+	}
+
+	settlements, err := s.services.Settlements.ListSettlements(r.Context(), currentUser(r).ID, groupID)
+	if err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, settlements)
+}
+
+func (s *Server) handlePlanSettlements(w http.ResponseWriter, r *http.Request) {
+	groupID, ok := pathID(w, r, "groupID")
+	if !ok {
+		return
+	}
+
+	settlements, err := s.services.Settlements.PlanSettlements(r.Context(), currentUser(r).ID, groupID)
+	if err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, settlements)
+}
+
+func (s *Server) handleCompleteSettlement(w http.ResponseWriter, r *http.Request) {
+	settlementID, ok := pathID(w, r, "settlementID")
+	if !ok {
+		return
+	}
+
+	settlement, err := s.services.Settlements.CompleteSettlement(r.Context(), currentUser(r).ID, settlementID)
+	if err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, settlement)
+}
+
+func (s *Server) handleGetHistory(w http.ResponseWriter, r *http.Request) {
+	groupID, ok := pathID(w, r, "groupID")
+	if !ok {
+		return
+	}
+
+	limit := 50
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			writeError(w, http.StatusBadRequest, "invalid limit")
+			return
+		}
+		limit = n
+	}
+
+	history, err := s.services.Audit.History(r.Context(), currentUser(r).ID, groupID, limit)
+	if err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+
+	resp := historyResponse{Entries: history.Entries, Total: history.Total, Verified: history.ChainError == nil}
+	if history.ChainError != nil {
+		resp.BrokenAt = history.ChainError.EntryID
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (s *Server) handleExport(w http.ResponseWriter, r *http.Request) {
+	groupID, ok := pathID(w, r, "groupID")
+	if !ok {
+		return
+	}
+
+	query := r.URL.Query()
+	format := query.Get("format")
+	if format == "" {
+		format = export.FormatCSV
+	}
+	period, err := service.ParseExportRange(query.Get("from"), query.Get("to"))
+	if err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+
+	out := &exportWriter{w: w, groupID: groupID, format: format}
+	enc, err := export.NewEncoder(format, out)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid format")
+		return
+	}
+
+	err = s.services.Export.Export(r.Context(), currentUser(r).ID, groupID, period, enc)
+	if err == nil {
+		return
+	}
+	if !out.started {
+		s.writeServiceError(w, r, err)
+		return
+	}
+	// The response is already under way, the client sees a truncated file
+	s.logger.ErrorContext(r.Context(), "Export failed", logger.Error(err), logger.Int64("group_id", groupID))
+}
+
+// exportWriter streams an export to the response, sending the file headers
+// with the first write so errors before it can still be reported as JSON
+type exportWriter struct {
+	w       http.ResponseWriter
+	groupID int64
+	format  string
+	started bool
+}
+
+func (e *exportWriter) Write(p []byte) (int, error) {
+	if !e.started {
+		e.started = true
+		header := e.w.Header()
+		header.Set("Content-Type", export.ContentType(e.format))
+		header.Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", export.FileName(e.groupID, e.format)))
+		e.w.WriteHeader(http.StatusOK)
+	}
+	return e.w.Write(p)
+}
+
+// pathID parses a numeric path parameter, writing an error response if it is invalid
+func pathID(w http.ResponseWriter, r *http.Request, name string) (int64, bool) {
+	id, err := strconv.ParseInt(r.PathValue(name), 10, 64)
+	if err != nil || id <= 0 {
+		writeError(w, http.StatusBadRequest, "invalid "+name)
+		return 0, false
+	}
+	return id, true
+}
@@ -0,0 +1,178 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/config"
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/service"
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/pkg/logger"
+)
+
+// Server exposes the domain services over HTTP for the Telegram Mini App
+type Server struct {
+	server   *http.Server
+	services *service.Service
+	botToken config.Secret
+	logger   logger.Logger
+}
+
+// New creates a new HTTP API server listening on addr
+func New(addr string, botToken config.Secret, services *service.Service, log logger.Logger) *Server {
+	s := &Server{
+		services: services,
+		botToken: botToken,
+		logger:   log.With(logger.String("component", "api")),
+	}
+
+	s.server = &http.Server{
+		Addr:              addr,
+		Handler:           s.routes(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	return s
+}
+
+// routes builds the request router
+func (s *Server) routes() http.Handler {
+	api := http.NewServeMux()
+	api.HandleFunc("GET /api/groups", s.handleListGroups)
+	api.HandleFunc("GET /api/groups/{groupID}", s.handleGetGroup)
+	api.HandleFunc("GET /api/groups/{groupID}/members", s.handleListMembers)
+	api.HandleFunc("GET /api/groups/{groupID}/expenses", s.handleListExpenses)
+	api.HandleFunc("POST /api/groups/{groupID}/expenses", s.handleCreateExpense)
+	api.HandleFunc("GET /api/expenses/{expenseID}", s.handleGetExpense)
+	api.HandleFunc("PATCH /api/expenses/{expenseID}", s.handleUpdateExpense)
+	api.HandleFunc("DELETE /api/expenses/{expenseID}", s.handleDeleteExpense)
+	api.HandleFunc("GET /api/groups/{groupID}/balances", s.handleGetBalances)
+	api.HandleFunc("GET /api/groups/{groupID}/settlements", s.handleListSettlements)
+	api.HandleFunc("POST /api/groups/{groupID}/settlements", s.handlePlanSettlements)
+	api.HandleFunc("POST /api/settlements/{settlementID}/complete", s.handleCompleteSettlement)
+	api.HandleFunc("GET /api/groups/{groupID}/history", s.handleGetHistory)
+	api.HandleFunc("GET /api/groups/{groupID}/export", s.handleExport)
+
+	mux := http.NewServeMux()
+	mux.Handle("/api/", s.authenticate(api))
+	return withRequestID(withIdempotencyKey(mux))
+}
+
+// requestIDHeader carries the request ID from proxies and back to clients
+const requestIDHeader = "X-Request-ID"
+
+// withRequestID stores the request ID in the request context for logging
+// and echoes it in the response. IDs sent by clients are kept if they are
+// short and printable, otherwise a fresh one is generated.
+func withRequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestID := r.Header.Get(requestIDHeader)
+		if !validRequestID(requestID) {
+			requestID = logger.NewRequestID()
+		}
+		w.Header().Set(requestIDHeader, requestID)
+		next.ServeHTTP(w, r.WithContext(logger.WithRequestID(r.Context(), requestID)))
+	})
+}
+
+// idempotencyKeyHeader makes retried writes, such as creating an expense,
+// return the result of the first attempt instead of repeating it
+const idempotencyKeyHeader = "Idempotency-Key"
+
+// withIdempotencyKey stores the idempotency key of a request, if any, in the
+// request context. Keys must be short and printable like request IDs.
+func withIdempotencyKey(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get(idempotencyKeyHeader)
+		if key == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if !validRequestID(key) {
+			writeError(w, http.StatusBadRequest, "invalid "+idempotencyKeyHeader+" header")
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(service.WithIdempotencyKey(r.Context(), "api:"+key)))
+	})
+}
+
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 64 {
+		return false
+	}
+	for _, c := range id {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_' || c == '.') {
+			return false
+		}
+	}
+	return true
+}
+
+// Run serves HTTP requests until the context is cancelled and then waits
+// for the requests in flight
+func (s *Server) Run(ctx context.Context) error {
+	errCh := make(chan error, 1)
+	go func() {
+		s.logger.Info("Starting HTTP API", logger.String("addr", s.server.Addr))
+		errCh <- s.server.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errCh:
+		return err
+	case <-ctx.Done():
+	}
+
+	// Requests in flight are finished unless Close cuts them off
+	if err := s.server.Shutdown(context.Background()); err != nil {
+		return err
+	}
+	if err := <-errCh; !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+
+	s.logger.Info("HTTP API stopped")
+	return nil
+}
+
+// Close closes all connections, cutting off requests in flight, e.g. when
+// waiting for them on shutdown takes too long
+func (s *Server) Close() error {
+	return s.server.Close()
+}
+
+// writeJSON writes v as a JSON response with the given status code
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// writeError writes a JSON error response
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"error": message})
+}
+
+// writeServiceError maps a service error to an HTTP error response
+func (s *Server) writeServiceError(w http.ResponseWriter, r *http.Request, err error) {
+	var ve *service.ValidationError
+	switch {
+	case errors.As(err, &ve):
+		writeError(w, http.StatusBadRequest, ve.Error())
+	case errors.Is(err, service.ErrForbidden):
+		writeError(w, http.StatusForbidden, "forbidden")
+	case errors.Is(err, service.ErrNotFound):
+		writeError(w, http.StatusNotFound, "not found")
+	case errors.Is(err, service.ErrConflict):
+		writeError(w, http.StatusConflict, "conflict")
+	default:
+		s.logger.ErrorContext(r.Context(), "Request failed",
+			logger.Error(err),
+			logger.String("method", r.Method),
+			logger.String("path", r.URL.Path),
+		)
+		writeError(w, http.StatusInternalServerError, "internal error")
+	}
+}
@@ -3,10 +3,25 @@ package application
 import (
 	"context"
 	"fmt"
-	"sync"
+	"time"
 
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/admin"
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/api"
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/clock"
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/config"
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/engine"
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/fx"
 	"github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/handlers"
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/i18n"
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/lock"
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/metrics"
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/receipt"
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/scheduler"
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/service"
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/storage/locking"
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/storage/memory"
 	"github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/telegram"
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/tracing"
 	"github.com/MichaelGenchev/telegram-grouppay-miniapp/pkg/logger"
 )
 
@@ -14,43 +29,230 @@ import (
 type Application struct {
 	telegramClient *telegram.Client
 	commandHandler *handlers.CommandHandler
+	apiServer      *api.Server
+	adminServer    *admin.Server
+	scheduler      *scheduler.Scheduler
+	store          *memory.Store
+	dataFile       string
+	webhook        config.WebhookConfig
+	lifecycle      *lifecycle
 	logger         logger.Logger
 }
 
 // New creates a new application instance
-func New(botToken string, log logger.Logger) (*Application, error) {
+func New(cfg config.Config, log logger.Logger) (*Application, error) {
 	log.Info("Initializing application", logger.String("component", "application"))
 
 	// Create telegram client
-	telegramClient, err := telegram.New(botToken, log)
+	m := metrics.New()
+	telegramClient, err := telegram.New(cfg.Telegram.Token, cfg.Webhook.SecretToken, m, log)
 	if err != nil {
 		return nil, fmt.Errorf("create telegram client: %w", err)
 	}
 
+	// Create exchange rate provider
+	rates := fx.NewStaticProvider()
+	if cfg.FX.RatesFile != "" {
+		rates, err = fx.LoadStaticFile(cfg.FX.RatesFile)
+		if err != nil {
+			return nil, fmt.Errorf("load exchange rates: %w", err)
+		}
+	}
+
+	// Create domain services
+	store := memory.New()
+	dataFile := cfg.Storage.DataFile()
+	if dataFile != "" {
+		store, err = memory.Open(dataFile)
+		if err != nil {
+			return nil, fmt.Errorf("open data file: %w", err)
+		}
+		log.Info("Data file loaded", logger.String("path", dataFile))
+	}
+	reminders := service.DefaultReminderPolicy()
+	if cfg.Scheduler.ReminderAfter > 0 {
+		reminders.After = cfg.Scheduler.ReminderAfter
+	}
+	if cfg.Scheduler.ReminderEvery > 0 {
+		reminders.Every = cfg.Scheduler.ReminderEvery
+	}
+	// The storage lives in this process, so the bot runs as a single replica
+	// and writes to a group take turns on locks kept in memory
+	locked := locking.New(store, lock.NewMemory(), cfg.Lock.Timeout, log)
+	calc := engine.NewBalanceCalculator()
+	calc.SettlementThreshold = cfg.Engine.SettlementThreshold
+	ocr := receipt.NewTesseract(cfg.OCR.TesseractPath, cfg.OCR.Languages)
+	services := service.New(tracing.InstrumentStorage(m.InstrumentStorage(locked)), calc, rates, reminders, ocr, log)
+	m.WatchSettlements(store)
+
+	// Load bot message catalogs; missing translations fall back to English
+	messages, err := i18n.Load()
+	if err != nil {
+		return nil, fmt.Errorf("load message catalogs: %w", err)
+	}
+	if err := messages.Validate(); err != nil {
+		log.Warn("Incomplete message catalogs", logger.Error(err))
+	}
+
 	// Create command handler
-	commandHandler := handlers.New(log)
+	commandHandler := handlers.New(services, messages, log)
 
 	// Register handlers with telegram client
 	commandHandler.RegisterHandlers(telegramClient.RegisterHandler)
+	telegramClient.Throttle(telegram.ThrottleLimits{
+		User:            telegram.Rate{Burst: cfg.Throttle.UserBurst, Per: cfg.Throttle.UserPer},
+		Chat:            telegram.Rate{Burst: cfg.Throttle.ChatBurst, Per: cfg.Throttle.ChatPer},
+		DuplicateWindow: cfg.Throttle.DuplicateWindow,
+	}, commandHandler.NotifyThrottled)
+	telegramClient.Deduplicate(services.Idempotency.MarkUpdate)
+
+	// Create HTTP API for the Mini App
+	var apiServer *api.Server
+	if cfg.HTTP.Addr != "" {
+		apiServer = api.New(cfg.HTTP.Addr, cfg.Telegram.Token, services, log)
+	}
+
+	// Create the operations endpoint; it reports not ready while the
+	// application stops
+	lc := &lifecycle{drainTimeout: cfg.Shutdown.DrainTimeout, logger: log.With(logger.String("component", "application"))}
+	var adminServer *admin.Server
+	if cfg.Admin.Addr != "" {
+		adminServer = admin.New(cfg.Admin.Addr, cfg.Admin.Token, log)
+		adminServer.Handle("GET /metrics", m.Handler())
+		adminServer.AddCheck("shutdown", lc.ready)
+		adminServer.AddCheck("storage", store.Ping)
+		adminServer.AddCheck("telegram", telegramClient.Ready)
+	}
+
+	// Create background jobs
+	sched := scheduler.New(cfg.Scheduler.Interval, clock.System(), log)
+	sched.Observe(m.ObserveJob)
+	sched.Add("recurring_expenses", func(ctx context.Context, now time.Time) error {
+		runs, err := services.Recurring.MaterializeDue(ctx, now)
+		commandHandler.NotifyRecurringRuns(ctx, telegramClient.Bot(), runs)
+		return err
+	})
+	sched.Add("payment_reminders", func(ctx context.Context, now time.Time) error {
+		due, err := services.Reminders.Due(ctx, now)
+		if err != nil {
+			return err
+		}
+		for _, reminder := range due {
+			commandHandler.SendReminder(ctx, telegramClient.Bot(), reminder)
+			if err := services.Reminders.MarkSent(ctx, reminder, now); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	sched.Add("item_claim_reminders", func(ctx context.Context, now time.Time) error {
+		due, err := services.Reminders.DueItemClaims(ctx, now)
+		if err != nil {
+			return err
+		}
+		for _, unclaimed := range due {
+			commandHandler.SendItemClaimReminder(ctx, telegramClient.Bot(), unclaimed)
+			if err := services.Reminders.MarkItemsReminded(ctx, unclaimed, now); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+
+	sched.Add("expire_idempotency_keys", func(ctx context.Context, now time.Time) error {
+		_, err := services.Idempotency.ExpireKeys(ctx, now.Add(-cfg.Idempotency.Window))
+		return err
+	})
+
+	if dataFile != "" {
+		sched.Add("save_data", func(ctx context.Context, now time.Time) error {
+			return store.Save(dataFile)
+		})
+	}
 
 	log.Info("Application initialized successfully")
 
 	return &Application{
 		telegramClient: telegramClient,
 		commandHandler: commandHandler,
+		apiServer:      apiServer,
+		adminServer:    adminServer,
+		scheduler:      sched,
+		store:          store,
+		dataFile:       dataFile,
+		webhook:        cfg.Webhook,
+		lifecycle:      lc,
 		logger:         log,
 	}, nil
 }
 
-// Run starts the application
-func (app *Application) Run(ctx context.Context, wg *sync.WaitGroup) {
-	defer wg.Done()
+// Run runs the application until ctx is cancelled or one of its components
+// fails. Components are started in order: the operations endpoint first so
+// it can report on the others, then the outbound queue, background jobs, the
+// HTTP API and last the bot. They are stopped in reverse order, each
+// finishing its work in flight while those it depends on still run.
+func (app *Application) Run(ctx context.Context) error {
 	defer app.logger.Sync() // Ensure logs are flushed
 
 	app.logger.Info("Starting application")
 
-	// Start the telegram bot
-	app.telegramClient.Start(ctx)
+	if app.adminServer != nil {
+		app.lifecycle.components = append(app.lifecycle.components, component{
+			name:  "admin",
+			run:   app.adminServer.Run,
+			abort: func() { _ = app.adminServer.Close() },
+		})
+	}
+	app.lifecycle.components = append(app.lifecycle.components,
+		component{
+			name: "outbox",
+			run: func(ctx context.Context) error {
+				app.telegramClient.RunOutbox(ctx)
+				return nil
+			},
+		},
+		// Messages of background jobs wait for replies to users
+		component{
+			name: "scheduler",
+			run: func(ctx context.Context) error {
+				app.scheduler.Run(telegram.WithPriority(ctx, telegram.PriorityBackground))
+				return nil
+			},
+			abort: app.scheduler.Abort,
+		},
+	)
+	if app.apiServer != nil {
+		app.lifecycle.components = append(app.lifecycle.components, component{
+			name:  "api",
+			run:   app.apiServer.Run,
+			abort: func() { _ = app.apiServer.Close() },
+		})
+	}
+	// Updates are taken from the webhook if one is configured
+	app.lifecycle.components = append(app.lifecycle.components, component{
+		name: "telegram",
+		run: func(ctx context.Context) error {
+			if app.webhook.URL != "" {
+				return app.telegramClient.StartWebhook(ctx, app.webhook.URL, app.webhook.Listen)
+			}
+			app.telegramClient.Start(ctx)
+			return nil
+		},
+		abort: app.telegramClient.AbortHandlers,
+	})
 
+	err := app.lifecycle.run(ctx)
+
+	// Persist what changed since the last scheduled save. The data file is
+	// locked by this process, so no other process writes it.
+	if app.dataFile != "" {
+		if err := app.store.Save(app.dataFile); err != nil {
+			app.logger.Error("Failed to save data file", logger.Error(err))
+		}
+		if err := app.store.Close(); err != nil {
+			app.logger.Error("Failed to unlock data file", logger.Error(err))
+		}
+	}
 	app.logger.Info("Application stopped")
+	return err
 }
@@ -0,0 +1,119 @@
+package application
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/pkg/logger"
+)
+
+// abortGrace is how long a component may take to return once its work in
+// flight was cut off
+const abortGrace = 5 * time.Second
+
+// component is a part of the application that is started and stopped in
+// order. run serves until its context is cancelled and then finishes the
+// work in flight before returning; abort, if set, cuts that work off.
+type component struct {
+	name  string
+	run   func(ctx context.Context) error
+	abort func()
+}
+
+// lifecycle starts components in order and stops them in reverse order,
+// so each component may rely on those started before it while it drains
+type lifecycle struct {
+	components   []component
+	drainTimeout time.Duration
+	// stopping is set once components are being stopped
+	stopping atomic.Bool
+	logger   logger.Logger
+}
+
+// errStopping fails the readiness check while the application stops
+var errStopping = errors.New("shutting down")
+
+// ready reports whether the application is running rather than stopping,
+// so load balancers stop sending requests while work in flight drains
+func (l *lifecycle) ready(ctx context.Context) error {
+	if l.stopping.Load() {
+		return errStopping
+	}
+	return nil
+}
+
+// running is a started component
+type running struct {
+	component
+	stop context.CancelFunc
+	done chan struct{}
+}
+
+// run starts all components and stops them once ctx is cancelled or one of
+// them fails, returning the first failure. Components get drainTimeout
+// together to finish their work in flight, after which they are aborted.
+func (l *lifecycle) run(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	failed := make(chan error, len(l.components))
+	started := make([]running, 0, len(l.components))
+	for _, c := range l.components {
+		// Components are stopped one by one rather than with ctx, but keep
+		// its values
+		componentCtx, stop := context.WithCancel(context.WithoutCancel(ctx))
+		r := running{component: c, stop: stop, done: make(chan struct{})}
+		go func() {
+			defer close(r.done)
+			if err := r.run(componentCtx); err != nil {
+				l.logger.Error("Component failed", logger.String("name", r.name), logger.Error(err))
+				failed <- fmt.Errorf("%s: %w", r.name, err)
+				cancel()
+			}
+		}()
+		started = append(started, r)
+		l.logger.Debug("Component started", logger.String("name", c.name))
+	}
+
+	<-ctx.Done()
+	l.stopping.Store(true)
+	l.logger.Info("Stopping application", logger.Duration("drain_timeout", l.drainTimeout))
+
+	drainCtx, cancelDrain := context.WithTimeout(context.Background(), l.drainTimeout)
+	defer cancelDrain()
+	for i := len(started) - 1; i >= 0; i-- {
+		l.stop(drainCtx, started[i])
+	}
+
+	select {
+	case err := <-failed:
+		return err
+	default:
+		return nil
+	}
+}
+
+// stop stops a component, aborting it if it does not finish before ctx is done
+func (l *lifecycle) stop(ctx context.Context, r running) {
+	start := time.Now()
+	r.stop()
+	select {
+	case <-r.done:
+		l.logger.Info("Component stopped", logger.String("name", r.name), logger.Duration("duration", time.Since(start)))
+		return
+	case <-ctx.Done():
+	}
+
+	l.logger.Warn("Component did not drain in time, aborting it", logger.String("name", r.name))
+	if r.abort != nil {
+		r.abort()
+	}
+	select {
+	case <-r.done:
+	case <-time.After(abortGrace):
+		l.logger.Error("Component did not stop after being aborted", logger.String("name", r.name))
+	}
+}
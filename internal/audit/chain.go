@@ -0,0 +1,71 @@
+package audit
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/models"
+)
+
+// ComputeHash returns the hash of an audit entry. It covers every field
+// except the storage-assigned ID and the hash itself, including the hash of
+// the previous entry, so changing or removing any entry breaks the chain.
+func ComputeHash(entry models.AuditEntry) string {
+	h := sha256.New()
+	for _, field := range [][]byte{
+		[]byte(entry.PrevHash),
+		[]byte(strconv.FormatInt(entry.GroupID, 10)),
+		[]byte(strconv.FormatInt(entry.ActorID, 10)),
+		[]byte(entry.Action),
+		[]byte(entry.EntityType),
+		[]byte(strconv.FormatInt(entry.EntityID, 10)),
+		entry.Before,
+		entry.After,
+		[]byte(entry.Source),
+		[]byte(entry.CreatedAt.UTC().Format(time.RFC3339Nano)),
+	} {
+		// Length-prefix every field so field boundaries cannot be shifted
+		h.Write([]byte(strconv.Itoa(len(field))))
+		h.Write([]byte{':'})
+		h.Write(field)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Seal links an entry to its predecessor and computes its hash.
+// prev is nil for the first entry of a chain.
+func Seal(entry *models.AuditEntry, prev *models.AuditEntry) {
+	entry.PrevHash = ""
+	if prev != nil {
+		entry.PrevHash = prev.Hash
+	}
+	entry.Hash = ComputeHash(*entry)
+}
+
+// ChainError reports the first entry at which an audit chain is broken
+type ChainError struct {
+	EntryID int64
+	Reason  string
+}
+
+func (e *ChainError) Error() string {
+	return fmt.Sprintf("audit chain broken at entry %d: %s", e.EntryID, e.Reason)
+}
+
+// Verify checks that entries, ordered from oldest to newest, form an intact chain
+func Verify(entries []models.AuditEntry) error {
+	prevHash := ""
+	for _, entry := range entries {
+		if entry.PrevHash != prevHash {
+			return &ChainError{EntryID: entry.ID, Reason: "previous hash mismatch"}
+		}
+		if ComputeHash(entry) != entry.Hash {
+			return &ChainError{EntryID: entry.ID, Reason: "content hash mismatch"}
+		}
+		prevHash = entry.Hash
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+package audit
+
+import (
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/models"
+)
+
+// chain returns n sealed entries
+func chain(n int) []models.AuditEntry {
+	created := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	entries := make([]models.AuditEntry, n)
+	for i := range entries {
+		entries[i] = models.AuditEntry{
+			ID:         int64(i + 1),
+			GroupID:    1,
+			ActorID:    int64(i%2 + 1),
+			Action:     models.AuditCreate,
+			EntityType: models.EntityExpense,
+			EntityID:   int64(i + 1),
+			After:      []byte(`{"amount":1000}`),
+			CreatedAt:  created.Add(time.Duration(i) * time.Minute),
+		}
+		var prev *models.AuditEntry
+		if i > 0 {
+			prev = &entries[i-1]
+		}
+		Seal(&entries[i], prev)
+	}
+	return entries
+}
+
+func TestVerify(t *testing.T) {
+	tests := []struct {
+		name      string
+		tamper    func([]models.AuditEntry) []models.AuditEntry
+		wantEntry int64 // 0 for an intact chain
+		reason    string
+	}{
+		{name: "intact", tamper: func(e []models.AuditEntry) []models.AuditEntry { return e }},
+		{name: "empty", tamper: func(e []models.AuditEntry) []models.AuditEntry { return nil }},
+		{
+			name:      "changed content",
+			tamper:    func(e []models.AuditEntry) []models.AuditEntry { e[1].After = []byte(`{"amount":1}`); return e },
+			wantEntry: 2, reason: "content hash mismatch",
+		},
+		{
+			name:      "changed actor",
+			tamper:    func(e []models.AuditEntry) []models.AuditEntry { e[2].ActorID = 99; return e },
+			wantEntry: 3, reason: "content hash mismatch",
+		},
+		{
+			name:      "resealed entry breaks its successor",
+			tamper:    func(e []models.AuditEntry) []models.AuditEntry { e[1].After = nil; Seal(&e[1], &e[0]); return e },
+			wantEntry: 3, reason: "previous hash mismatch",
+		},
+		{
+			name:      "removed entry",
+			tamper:    func(e []models.AuditEntry) []models.AuditEntry { return slices.Delete(e, 1, 2) },
+			wantEntry: 3, reason: "previous hash mismatch",
+		},
+		{
+			name:      "removed first entry",
+			tamper:    func(e []models.AuditEntry) []models.AuditEntry { return e[1:] },
+			wantEntry: 2, reason: "previous hash mismatch",
+		},
+		{
+			name:      "swapped entries",
+			tamper:    func(e []models.AuditEntry) []models.AuditEntry { e[1], e[2] = e[2], e[1]; return e },
+			wantEntry: 3, reason: "previous hash mismatch",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Verify(tt.tamper(chain(4)))
+			if tt.wantEntry == 0 {
+				if err != nil {
+					t.Fatalf("Verify() error = %v, want nil", err)
+				}
+				return
+			}
+			var ce *ChainError
+			if !errors.As(err, &ce) {
+				t.Fatalf("Verify() error = %v, want a ChainError", err)
+			}
+			if ce.EntryID != tt.wantEntry || ce.Reason != tt.reason {
+				t.Errorf("Verify() broken at %d (%s), want %d (%s)", ce.EntryID, ce.Reason, tt.wantEntry, tt.reason)
+			}
+		})
+	}
+}
+
+func TestComputeHashSeparatesFields(t *testing.T) {
+	a := models.AuditEntry{Action: "ab", EntityType: "c"}
+	b := models.AuditEntry{Action: "a", EntityType: "bc"}
+	if ComputeHash(a) == ComputeHash(b) {
+		t.Error("shifting a field boundary keeps the hash")
+	}
+}
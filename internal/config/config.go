@@ -1,8 +1,596 @@
+// Package config loads the configuration of the bot and its tools. Settings
+// are layered: defaults, then a YAML file, then environment variables, then
+// command line flags, each overriding the previous.
 package config
 
-import "github.com/MichaelGenchev/telegram-grouppay-miniapp/pkg/logger"
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/currency"
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/scheduler"
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/pkg/logger"
+)
+
+// redacted replaces secrets in printed configurations
+const redacted = "[REDACTED]"
+
+// Trace exporters
+const (
+	TracingNone   = "none"
+	TracingStdout = "stdout"
+	TracingFile   = "file"
+)
+
+// Storage DSN schemes
+const (
+	StorageMemory = "memory"
+	StorageFile   = "file"
+)
 
 type Config struct {
-	TgBotToken string
-	Logger     logger.Config
+	Telegram    TelegramConfig    `yaml:"telegram"`
+	HTTP        HTTPConfig        `yaml:"http"`
+	Admin       AdminConfig       `yaml:"admin"`
+	Webhook     WebhookConfig     `yaml:"webhook"`
+	Storage     StorageConfig     `yaml:"storage"`
+	Lock        LockConfig        `yaml:"lock"`
+	Payments    PaymentsConfig    `yaml:"payments"`
+	Scheduler   SchedulerConfig   `yaml:"scheduler"`
+	Engine      EngineConfig      `yaml:"engine"`
+	FX          FXConfig          `yaml:"fx"`
+	OCR         OCRConfig         `yaml:"ocr"`
+	Throttle    ThrottleConfig    `yaml:"throttle"`
+	Idempotency IdempotencyConfig `yaml:"idempotency"`
+	Shutdown    ShutdownConfig    `yaml:"shutdown"`
+	Tracing     TracingConfig     `yaml:"tracing"`
+	Logger      logger.Config     `yaml:"log"`
+}
+
+// TelegramConfig configures the Bot API client
+type TelegramConfig struct {
+	Token     Secret `yaml:"token"`
+	TokenFile string `yaml:"token_file"` // file the token is read from instead
+}
+
+// HTTPConfig configures the Mini App API
+type HTTPConfig struct {
+	Addr string `yaml:"addr"` // listen address, empty disables the API
+}
+
+// AdminConfig configures the operations endpoint serving metrics, health
+// checks and runtime log level changes. It should only be reachable from
+// private networks.
+type AdminConfig struct {
+	Addr      string `yaml:"addr"`  // listen address, empty disables the endpoint
+	Token     Secret `yaml:"token"` // bearer token required on every request, if set
+	TokenFile string `yaml:"token_file"`
+}
+
+// WebhookConfig makes Telegram push updates instead of the bot polling for them
+type WebhookConfig struct {
+	URL             string `yaml:"url"`          // public HTTPS URL, empty polls for updates
+	Listen          string `yaml:"listen"`       // address the webhook is served on
+	SecretToken     Secret `yaml:"secret_token"` // sent by Telegram with every update
+	SecretTokenFile string `yaml:"secret_token_file"`
+}
+
+// StorageConfig selects where data is kept
+type StorageConfig struct {
+	// DSN is "memory:" to keep data in memory only or "file:PATH" to persist
+	// it in a data file between restarts
+	DSN string `yaml:"dsn"`
+}
+
+// LockConfig configures the locks serializing writes to a group. The storage
+// lives in the bot's process, so the bot runs as a single replica and its
+// locks are kept in memory.
+type LockConfig struct {
+	// Timeout is how long a write waits for the lock of its group
+	Timeout time.Duration `yaml:"timeout"`
+}
+
+// PaymentsConfig configures Telegram Payments for settling debts
+type PaymentsConfig struct {
+	ProviderToken     Secret `yaml:"provider_token"` // empty disables payments
+	ProviderTokenFile string `yaml:"provider_token_file"`
+	Currency          string `yaml:"currency"` // ISO 4217 code invoices are issued in
+}
+
+// SchedulerConfig configures background jobs
+type SchedulerConfig struct {
+	// Interval is how often background jobs such as recurring expenses run
+	Interval time.Duration `yaml:"interval"`
+	// ReminderAfter is how old a pending settlement gets before its debtor is
+	// reminded, ReminderEvery the minimum time between reminders. Zero uses the default.
+	ReminderAfter time.Duration `yaml:"reminder_after"`
+	ReminderEvery time.Duration `yaml:"reminder_every"`
+}
+
+// EngineConfig tunes the balance engine
+type EngineConfig struct {
+	// SettlementThreshold (θ) is the largest balance in minor units that is
+	// considered settled when planning settlements
+	SettlementThreshold int64 `yaml:"settlement_threshold"`
+}
+
+// FXConfig configures currency conversion
+type FXConfig struct {
+	RatesFile string `yaml:"rates_file"` // static exchange rates, empty disables conversion
+}
+
+// OCRConfig configures reading receipt photos
+type OCRConfig struct {
+	// TesseractPath is the tesseract binary and Languages its language codes,
+	// e.g. "eng+deu". Empty uses the defaults.
+	TesseractPath string `yaml:"tesseract_path"`
+	Languages     string `yaml:"languages"`
+}
+
+// ThrottleConfig limits how many commands and button presses users and chats
+// may send. Over budget, the sender is told once to wait and further updates
+// are dropped until the cooldown ends.
+type ThrottleConfig struct {
+	UserBurst int           `yaml:"user_burst"` // commands per user, 0 disables the limit
+	UserPer   time.Duration `yaml:"user_per"`   // period the user budget refills over
+	ChatBurst int           `yaml:"chat_burst"` // commands per chat, 0 disables the limit
+	ChatPer   time.Duration `yaml:"chat_per"`   // period the chat budget refills over
+	// DuplicateWindow is how long repeats of a user's command in a chat are
+	// collapsed into the first, 0 disables it
+	DuplicateWindow time.Duration `yaml:"duplicate_window"`
+}
+
+// IdempotencyConfig configures how replays of updates and writes are detected
+type IdempotencyConfig struct {
+	// Window is how long handled Telegram updates and idempotency keys are
+	// kept. Telegram redelivers updates for up to a day.
+	Window time.Duration `yaml:"window"`
+}
+
+// ShutdownConfig configures how the bot stops
+type ShutdownConfig struct {
+	// DrainTimeout is how long handlers, HTTP requests and background jobs
+	// in flight may take to finish before they are cut off. It should be
+	// shorter than the grace period of the container runtime.
+	DrainTimeout time.Duration `yaml:"drain_timeout"`
+}
+
+// TracingConfig configures OpenTelemetry tracing
+type TracingConfig struct {
+	Exporter    string  `yaml:"exporter"`     // none, stdout or file
+	File        string  `yaml:"file"`         // file spans are appended to by the file exporter
+	SampleRatio float64 `yaml:"sample_ratio"` // share of traces recorded, from 0 to 1
+}
+
+// Default returns the configuration used for settings that are not set
+func Default() Config {
+	return Config{
+		Storage:   StorageConfig{DSN: StorageMemory + ":"},
+		Lock:      LockConfig{Timeout: 10 * time.Second},
+		Scheduler: SchedulerConfig{Interval: scheduler.DefaultInterval},
+		Throttle: ThrottleConfig{
+			UserBurst:       10,
+			UserPer:         time.Minute,
+			ChatBurst:       30,
+			ChatPer:         time.Minute,
+			DuplicateWindow: 3 * time.Second,
+		},
+		Idempotency: IdempotencyConfig{Window: 24 * time.Hour},
+		Shutdown:    ShutdownConfig{DrainTimeout: 20 * time.Second},
+		Tracing:     TracingConfig{Exporter: TracingNone, SampleRatio: 1},
+		Logger:      logger.DefaultConfig(),
+	}
+}
+
+// setting is a single configuration value that can be overridden by an
+// environment variable and a flag named after its key
+type setting struct {
+	key   string // path in the config file, e.g. "http.addr"
+	env   string
+	usage string
+	set   func(string) error
+	get   func() string
+}
+
+func (c *Config) settings() []setting {
+	return []setting{
+		secretSetting("telegram.token", "TG_BOT_TOKEN", "Telegram bot token", &c.Telegram.Token),
+		stringSetting("telegram.token_file", "TG_BOT_TOKEN_FILE", "file holding the Telegram bot token", &c.Telegram.TokenFile),
+		stringSetting("http.addr", "HTTP_ADDR", "Mini App API listen address, empty disables the API", &c.HTTP.Addr),
+		stringSetting("admin.addr", "ADMIN_ADDR", "operations endpoint listen address, empty disables it", &c.Admin.Addr),
+		secretSetting("admin.token", "ADMIN_TOKEN", "bearer token required by the operations endpoint", &c.Admin.Token),
+		stringSetting("admin.token_file", "ADMIN_TOKEN_FILE", "file holding the operations endpoint token", &c.Admin.TokenFile),
+		stringSetting("webhook.url", "WEBHOOK_URL", "public HTTPS URL Telegram sends updates to, empty polls", &c.Webhook.URL),
+		stringSetting("webhook.listen", "WEBHOOK_LISTEN", "address the webhook is served on", &c.Webhook.Listen),
+		secretSetting("webhook.secret_token", "WEBHOOK_SECRET_TOKEN", "secret Telegram sends with webhook updates", &c.Webhook.SecretToken),
+		stringSetting("webhook.secret_token_file", "WEBHOOK_SECRET_TOKEN_FILE", "file holding the webhook secret", &c.Webhook.SecretTokenFile),
+		stringSetting("storage.dsn", "STORAGE_DSN", `"memory:" or "file:PATH" of the data file`, &c.Storage.DSN),
+		durationSetting("lock.timeout", "LOCK_TIMEOUT", "how long a write waits for the lock of its group", &c.Lock.Timeout),
+		secretSetting("payments.provider_token", "PAYMENTS_PROVIDER_TOKEN", "Telegram Payments provider token, empty disables payments", &c.Payments.ProviderToken),
+		stringSetting("payments.provider_token_file", "PAYMENTS_PROVIDER_TOKEN_FILE", "file holding the payments provider token", &c.Payments.ProviderTokenFile),
+		stringSetting("payments.currency", "PAYMENTS_CURRENCY", "currency invoices are issued in", &c.Payments.Currency),
+		durationSetting("scheduler.interval", "SCHEDULER_INTERVAL", "how often background jobs run", &c.Scheduler.Interval),
+		durationSetting("scheduler.reminder_after", "REMINDER_AFTER", "age of a pending settlement before its debtor is reminded, 0 uses the default", &c.Scheduler.ReminderAfter),
+		durationSetting("scheduler.reminder_every", "REMINDER_EVERY", "minimum time between reminders, 0 uses the default", &c.Scheduler.ReminderEvery),
+		int64Setting("engine.settlement_threshold", "ENGINE_SETTLEMENT_THRESHOLD", "largest balance in minor units considered settled", &c.Engine.SettlementThreshold),
+		stringSetting("fx.rates_file", "FX_RATES_FILE", "static exchange rates file, empty disables conversion", &c.FX.RatesFile),
+		stringSetting("ocr.tesseract_path", "TESSERACT_PATH", "tesseract binary used to read receipts", &c.OCR.TesseractPath),
+		stringSetting("ocr.languages", "OCR_LANGUAGES", `tesseract language codes, e.g. "eng+deu"`, &c.OCR.Languages),
+		intSetting("throttle.user_burst", "THROTTLE_USER_BURST", "commands a user may send per throttle.user_per, 0 disables the limit", &c.Throttle.UserBurst),
+		durationSetting("throttle.user_per", "THROTTLE_USER_PER", "period the user command budget refills over", &c.Throttle.UserPer),
+		intSetting("throttle.chat_burst", "THROTTLE_CHAT_BURST", "commands a chat may send per throttle.chat_per, 0 disables the limit", &c.Throttle.ChatBurst),
+		durationSetting("throttle.chat_per", "THROTTLE_CHAT_PER", "period the chat command budget refills over", &c.Throttle.ChatPer),
+		durationSetting("throttle.duplicate_window", "THROTTLE_DUPLICATE_WINDOW", "how long repeated identical commands are collapsed, 0 disables it", &c.Throttle.DuplicateWindow),
+		durationSetting("idempotency.window", "IDEMPOTENCY_WINDOW", "how long handled updates and idempotency keys are kept", &c.Idempotency.Window),
+		durationSetting("shutdown.drain_timeout", "SHUTDOWN_DRAIN_TIMEOUT", "how long work in flight may take to finish on shutdown", &c.Shutdown.DrainTimeout),
+		stringSetting("tracing.exporter", "TRACING_EXPORTER", "none, stdout or file", &c.Tracing.Exporter),
+		stringSetting("tracing.file", "TRACING_FILE", "file spans are appended to by the file exporter", &c.Tracing.File),
+		float64Setting("tracing.sample_ratio", "TRACING_SAMPLE_RATIO", "share of traces recorded, from 0 to 1", &c.Tracing.SampleRatio),
+		stringSetting("log.level", "LOG_LEVEL", "debug, info, warn or error", &c.Logger.Level),
+		stringSetting("log.environment", "ENVIRONMENT", "development or production", &c.Logger.Environment),
+		stringSetting("log.output_path", "LOG_OUTPUT", "stdout, stderr or a file path", &c.Logger.OutputPath),
+		intSetting("log.rotation.max_size_mb", "LOG_MAX_SIZE_MB", "rotate the log file at this size, 0 uses 100", &c.Logger.Rotation.MaxSizeMB),
+		durationSetting("log.rotation.every", "LOG_ROTATE_EVERY", "also rotate the log file at this interval, e.g. 24h", &c.Logger.Rotation.Every),
+		intSetting("log.rotation.max_backups", "LOG_MAX_BACKUPS", "rotated log files kept, 0 keeps all", &c.Logger.Rotation.MaxBackups),
+		intSetting("log.rotation.max_age_days", "LOG_MAX_AGE_DAYS", "days rotated log files are kept, 0 keeps all", &c.Logger.Rotation.MaxAgeDays),
+		boolSetting("log.rotation.compress", "LOG_COMPRESS", "gzip rotated log files", &c.Logger.Rotation.Compress),
+		intSetting("log.sampling.initial", "LOG_SAMPLING_INITIAL", "entries with the same message logged per tick before sampling, 0 disables sampling", &c.Logger.Sampling.Initial),
+		intSetting("log.sampling.thereafter", "LOG_SAMPLING_THEREAFTER", "log every nth further entry with the same message", &c.Logger.Sampling.Thereafter),
+		durationSetting("log.sampling.tick", "LOG_SAMPLING_TICK", "sampling period, 0 uses 1s", &c.Logger.Sampling.Tick),
+	}
+}
+
+func stringSetting(key, env, usage string, p *string) setting {
+	return setting{key, env, usage,
+		func(v string) error { *p = v; return nil },
+		func() string { return *p },
+	}
+}
+
+func secretSetting(key, env, usage string, p *Secret) setting {
+	return setting{key, env, usage,
+		func(v string) error { *p = NewSecret(v); return nil },
+		func() string { return p.Value() },
+	}
+}
+
+func durationSetting(key, env, usage string, p *time.Duration) setting {
+	return setting{key, env, usage,
+		func(v string) error {
+			d, err := time.ParseDuration(v)
+			if err != nil {
+				return errors.New("invalid duration")
+			}
+			*p = d
+			return nil
+		},
+		func() string { return p.String() },
+	}
+}
+
+func int64Setting(key, env, usage string, p *int64) setting {
+	return setting{key, env, usage,
+		func(v string) error {
+			n, err := strconv.ParseInt(v, 10, 64)
+			if err != nil {
+				return errors.New("invalid integer")
+			}
+			*p = n
+			return nil
+		},
+		func() string { return strconv.FormatInt(*p, 10) },
+	}
+}
+
+func intSetting(key, env, usage string, p *int) setting {
+	return setting{key, env, usage,
+		func(v string) error {
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				return errors.New("invalid integer")
+			}
+			*p = n
+			return nil
+		},
+		func() string { return strconv.Itoa(*p) },
+	}
+}
+
+func float64Setting(key, env, usage string, p *float64) setting {
+	return setting{key, env, usage,
+		func(v string) error {
+			f, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				return errors.New("invalid number")
+			}
+			*p = f
+			return nil
+		},
+		func() string { return strconv.FormatFloat(*p, 'g', -1, 64) },
+	}
+}
+
+func boolSetting(key, env, usage string, p *bool) setting {
+	return setting{key, env, usage,
+		func(v string) error {
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				return errors.New("invalid boolean")
+			}
+			*p = b
+			return nil
+		},
+		func() string { return strconv.FormatBool(*p) },
+	}
+}
+
+// Load builds the configuration from defaults, the YAML file named by the
+// -config flag or CONFIG_FILE, environment variables and flags. Every setting
+// gets a flag named after its key on fs, e.g. -http.addr. The settings named
+// by required must not be empty. All invalid settings are reported at once.
+func Load(fs *flag.FlagSet, args []string, required ...string) (Config, error) {
+	cfg := Default()
+	settings := cfg.settings()
+
+	path := fs.String("config", os.Getenv("CONFIG_FILE"), "YAML configuration file")
+	type override struct{ key, value string }
+	var flags []override
+	for _, s := range settings {
+		key := s.key
+		fs.Func(key, s.usage+" ($"+s.env+")", func(v string) error {
+			flags = append(flags, override{key, v})
+			return nil
+		})
+	}
+	if err := fs.Parse(args); err != nil {
+		return Config{}, err
+	}
+
+	if *path != "" {
+		if err := cfg.loadFile(*path); err != nil {
+			return Config{}, err
+		}
+	}
+
+	var errs []error
+	for _, s := range settings {
+		if v, ok := os.LookupEnv(s.env); ok && v != "" {
+			if err := s.set(v); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", s.env, err))
+			}
+		}
+	}
+	for _, f := range flags {
+		for _, s := range settings {
+			if s.key == f.key {
+				if err := s.set(f.value); err != nil {
+					errs = append(errs, fmt.Errorf("-%s: %w", f.key, err))
+				}
+			}
+		}
+	}
+
+	errs = append(errs, cfg.readSecretFiles()...)
+	for _, key := range required {
+		for _, s := range settings {
+			if s.key == key && s.get() == "" {
+				errs = append(errs, fmt.Errorf("%s is required (set $%s or -%s)", key, s.env, key))
+			}
+		}
+	}
+	if err := cfg.Validate(); err != nil {
+		errs = append(errs, err)
+	}
+	if len(errs) > 0 {
+		return Config{}, fmt.Errorf("invalid configuration:\n%w", errors.Join(errs...))
+	}
+	return cfg, nil
+}
+
+// readSecretFiles reads the secrets given as files. A secret may be given
+// either directly or as a file, not both.
+func (c *Config) readSecretFiles() []error {
+	var errs []error
+	for _, secret := range []struct {
+		key   string
+		value *Secret
+		file  string
+	}{
+		{"telegram.token", &c.Telegram.Token, c.Telegram.TokenFile},
+		{"admin.token", &c.Admin.Token, c.Admin.TokenFile},
+		{"webhook.secret_token", &c.Webhook.SecretToken, c.Webhook.SecretTokenFile},
+		{"payments.provider_token", &c.Payments.ProviderToken, c.Payments.ProviderTokenFile},
+	} {
+		if secret.file == "" {
+			continue
+		}
+		if !secret.value.IsZero() {
+			errs = append(errs, fmt.Errorf("%s and %s_file are mutually exclusive", secret.key, secret.key))
+			continue
+		}
+		value, err := readSecretFile(secret.file)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s_file: %w", secret.key, err))
+			continue
+		}
+		*secret.value = value
+	}
+	return errs
+}
+
+// loadFile overrides the configuration with a YAML file. Unknown keys are
+// rejected so typos do not go unnoticed.
+func (c *Config) loadFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("open config file: %w", err)
+	}
+	defer f.Close()
+
+	dec := yaml.NewDecoder(f)
+	dec.KnownFields(true)
+	if err := dec.Decode(c); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("read config file %s: %w", path, err)
+	}
+	return nil
+}
+
+// webhookSecret is the charset Telegram allows in webhook secret tokens
+var webhookSecret = regexp.MustCompile(`^[A-Za-z0-9_-]{1,256}$`)
+
+// Validate reports every invalid setting and combination of settings
+func (c Config) Validate() error {
+	var errs []error
+	add := func(format string, args ...any) {
+		errs = append(errs, fmt.Errorf(format, args...))
+	}
+
+	if c.Admin.Addr != "" && (c.Admin.Addr == c.HTTP.Addr || c.Admin.Addr == c.Webhook.Listen) {
+		add("admin.addr must differ from http.addr and webhook.listen")
+	}
+
+	if c.Webhook.URL != "" {
+		u, err := url.Parse(c.Webhook.URL)
+		if err != nil || u.Scheme != "https" || u.Host == "" {
+			add("webhook.url must be an https URL")
+		}
+		if c.Webhook.Listen == "" {
+			add("webhook.listen is required with webhook.url")
+		}
+		if c.Webhook.Listen != "" && c.Webhook.Listen == c.HTTP.Addr {
+			add("webhook.listen and http.addr must differ")
+		}
+	} else if c.Webhook.Listen != "" || !c.Webhook.SecretToken.IsZero() {
+		add("webhook.listen and webhook.secret_token require webhook.url")
+	}
+	if !c.Webhook.SecretToken.IsZero() && !webhookSecret.MatchString(c.Webhook.SecretToken.Value()) {
+		add("webhook.secret_token must be 1-256 letters, digits, _ or -")
+	}
+
+	switch scheme, path, _ := strings.Cut(c.Storage.DSN, ":"); scheme {
+	case StorageMemory:
+	case StorageFile:
+		if path == "" {
+			add("storage.dsn %q has no file path", c.Storage.DSN)
+		}
+	default:
+		add("storage.dsn must start with %s: or %s:", StorageMemory, StorageFile)
+	}
+	if c.Lock.Timeout <= 0 {
+		add("lock.timeout must be positive")
+	}
+
+	if !c.Payments.ProviderToken.IsZero() && !currency.IsValid(c.Payments.Currency) {
+		add("payments.currency must be a supported ISO 4217 code with payments.provider_token")
+	}
+
+	if c.Scheduler.Interval <= 0 {
+		add("scheduler.interval must be positive")
+	}
+	if c.Scheduler.ReminderAfter < 0 || c.Scheduler.ReminderEvery < 0 {
+		add("scheduler.reminder_after and scheduler.reminder_every must not be negative")
+	}
+	if c.Scheduler.ReminderEvery > 0 && c.Scheduler.ReminderEvery < c.Scheduler.Interval {
+		add("scheduler.reminder_every must not be shorter than scheduler.interval")
+	}
+
+	if c.Engine.SettlementThreshold < 0 {
+		add("engine.settlement_threshold must not be negative")
+	}
+
+	if c.FX.RatesFile != "" {
+		if _, err := os.Stat(c.FX.RatesFile); err != nil {
+			add("fx.rates_file: %v", err)
+		}
+	}
+
+	throttle := c.Throttle
+	if throttle.UserBurst < 0 || throttle.ChatBurst < 0 || throttle.DuplicateWindow < 0 {
+		add("throttle.user_burst, throttle.chat_burst and throttle.duplicate_window must not be negative")
+	}
+	if (throttle.UserBurst > 0 && throttle.UserPer <= 0) || (throttle.ChatBurst > 0 && throttle.ChatPer <= 0) {
+		add("throttle.user_per and throttle.chat_per must be positive with their burst")
+	}
+
+	if c.Idempotency.Window <= 0 {
+		add("idempotency.window must be positive")
+	}
+
+	if c.Shutdown.DrainTimeout <= 0 {
+		add("shutdown.drain_timeout must be positive")
+	}
+
+	switch c.Tracing.Exporter {
+	case TracingNone, TracingStdout:
+	case TracingFile:
+		if c.Tracing.File == "" {
+			add("tracing.file is required with the file exporter")
+		}
+	default:
+		add("tracing.exporter must be %s, %s or %s", TracingNone, TracingStdout, TracingFile)
+	}
+	if c.Tracing.SampleRatio < 0 || c.Tracing.SampleRatio > 1 {
+		add("tracing.sample_ratio must be between 0 and 1")
+	}
+
+	switch c.Logger.Level {
+	case "debug", "info", "warn", "error":
+	default:
+		add("log.level must be debug, info, warn or error")
+	}
+	switch c.Logger.Environment {
+	case "development", "production":
+	default:
+		add("log.environment must be development or production")
+	}
+	rotation := c.Logger.Rotation
+	if rotation.MaxSizeMB < 0 || rotation.Every < 0 || rotation.MaxBackups < 0 || rotation.MaxAgeDays < 0 {
+		add("log.rotation settings must not be negative")
+	}
+	if rotation.Enabled() && (c.Logger.OutputPath == "" || c.Logger.OutputPath == "stdout" || c.Logger.OutputPath == "stderr") {
+		add("log.rotation requires log.output_path to be a file")
+	}
+	if c.Logger.Sampling.Initial < 0 || c.Logger.Sampling.Thereafter < 0 || c.Logger.Sampling.Tick < 0 {
+		add("log.sampling settings must not be negative")
+	}
+
+	return errors.Join(errs...)
+}
+
+// DataFile returns the data file of a file: storage DSN, or "" if data is
+// kept in memory only
+func (s StorageConfig) DataFile() string {
+	if scheme, path, _ := strings.Cut(s.DSN, ":"); scheme == StorageFile {
+		return path
+	}
+	return ""
+}
+
+// Redacted returns a copy of the configuration with the credentials of the
+// storage DSN replaced. Secrets redact themselves.
+func (c Config) Redacted() Config {
+	if u, err := url.Parse(c.Storage.DSN); err == nil && u.User != nil {
+		c.Storage.DSN = u.Redacted()
+	}
+	return c
+}
+
+// Print writes the configuration as YAML with its secrets redacted
+func (c Config) Print(w io.Writer) error {
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(c.Redacted()); err != nil {
+		return err
+	}
+	return enc.Close()
 }
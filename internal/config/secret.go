@@ -0,0 +1,73 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Secret holds a sensitive setting such as a token. It never prints its
+// value: formatting, logging and marshalling it all yield a placeholder.
+// Value must be called to use it.
+type Secret struct {
+	value string
+}
+
+// NewSecret wraps a sensitive value
+func NewSecret(value string) Secret {
+	return Secret{value: value}
+}
+
+// readSecretFile reads a secret from a file, such as a mounted Docker or
+// Kubernetes secret. Surrounding whitespace is dropped.
+func readSecretFile(path string) (Secret, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Secret{}, err
+	}
+	value := strings.TrimSpace(string(data))
+	if value == "" {
+		return Secret{}, fmt.Errorf("%s is empty", path)
+	}
+	return NewSecret(value), nil
+}
+
+// Value returns the secret itself
+func (s Secret) Value() string {
+	return s.value
+}
+
+// IsZero reports whether the secret is unset
+func (s Secret) IsZero() bool {
+	return s.value == ""
+}
+
+// String returns a placeholder, or "" if the secret is unset
+func (s Secret) String() string {
+	if s.value == "" {
+		return ""
+	}
+	return redacted
+}
+
+// GoString keeps the value out of %#v
+func (s Secret) GoString() string {
+	return fmt.Sprintf("config.Secret(%q)", s.String())
+}
+
+// MarshalText keeps the value out of JSON and other text encodings
+func (s Secret) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// MarshalYAML keeps the value out of printed configurations
+func (s Secret) MarshalYAML() (any, error) {
+	return s.String(), nil
+}
+
+// UnmarshalYAML reads a secret from a config file
+func (s *Secret) UnmarshalYAML(node *yaml.Node) error {
+	return node.Decode(&s.value)
+}
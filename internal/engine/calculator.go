@@ -1,25 +1,214 @@
 package engine
 
-import "github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/models"
+import (
+	"fmt"
+	"sort"
+
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/currency"
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/models"
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/money"
+)
 
 // BalanceCalculator handles balance calculations for expense groups
-type BalanceCalculator struct{}
+type BalanceCalculator struct {
+	// SettlementThreshold (θ) is the largest balance in minor units that
+	// OptimizeSettlements considers settled. Zero settles every balance.
+	SettlementThreshold int64
+}
 
 // NewBalanceCalculator creates a new balance calculator
 func NewBalanceCalculator() *BalanceCalculator {
 	return &BalanceCalculator{}
 }
 
-// CalculateBalances calculates the balances for all users in a group
-func (bc *BalanceCalculator) CalculateBalances(expenses []models.Expense, participants []models.Participant) map[int64]int64 {
-	// TODO: Implement balance calculation algorithm
-	balances := make(map[int64]int64)
-	return balances
+// CalculateBalances calculates the balances for all users in a group in the
+// group base currency. A positive balance means the user is owed money, a
+// negative balance means the user owes money. Balances always sum to zero.
+//
+// Participant shares are recorded in the expense currency; they are converted
+// by allocating the expense's base amount proportionally to the shares, so no
+// minor units are lost to rounding.
+func (bc *BalanceCalculator) CalculateBalances(base currency.Currency, expenses []models.Expense, participants []models.Participant) (map[int64]money.Money, error) {
+	balances := make(map[int64]money.Money)
+	add := func(userID int64, amount money.Money) error {
+		current, ok := balances[userID]
+		if !ok {
+			current = money.Zero(base)
+		}
+		sum, err := current.Add(amount)
+		if err != nil {
+			return err
+		}
+		balances[userID] = sum
+		return nil
+	}
+
+	byExpense := make(map[int64][]models.Participant, len(expenses))
+	for _, participant := range participants {
+		byExpense[participant.ExpenseID] = append(byExpense[participant.ExpenseID], participant)
+	}
+
+	for _, expense := range expenses {
+		shares := byExpense[expense.ID]
+		if len(shares) == 0 {
+			continue
+		}
+
+		weights := make([]int64, len(shares))
+		for i, p := range shares {
+			weights[i] = p.Share.Amount()
+		}
+
+		if err := add(expense.PaidBy, expense.BaseAmount); err != nil {
+			return nil, fmt.Errorf("expense %d: %w", expense.ID, err)
+		}
+		for i, amount := range expense.BaseAmount.Allocate(weights...) {
+			if err := add(shares[i].UserID, amount.Neg()); err != nil {
+				return nil, fmt.Errorf("expense %d: %w", expense.ID, err)
+			}
+		}
+	}
+
+	return balances, nil
 }
 
-// OptimizeSettlements calculates the optimal settlements to minimize transactions
-func (bc *BalanceCalculator) OptimizeSettlements(balances map[int64]int64) []models.Settlement {
-	// TODO: Implement settlement optimization algorithm
+// ApplySettlements adjusts balances by the completed settlements.
+// Pending and cancelled settlements are ignored.
+func (bc *BalanceCalculator) ApplySettlements(balances map[int64]money.Money, settlements []models.Settlement) (map[int64]money.Money, error) {
+	for _, settlement := range settlements {
+		if settlement.Status != models.SettlementCompleted {
+			continue
+		}
+
+		cur := settlement.Amount.Currency()
+		from, ok := balances[settlement.FromUser]
+		if !ok {
+			from = money.Zero(cur)
+		}
+		to, ok := balances[settlement.ToUser]
+		if !ok {
+			to = money.Zero(cur)
+		}
+
+		var err error
+		if balances[settlement.FromUser], err = from.Add(settlement.Amount); err != nil {
+			return nil, fmt.Errorf("settlement %d: %w", settlement.ID, err)
+		}
+		if balances[settlement.ToUser], err = to.Sub(settlement.Amount); err != nil {
+			return nil, fmt.Errorf("settlement %d: %w", settlement.ID, err)
+		}
+	}
+	return balances, nil
+}
+
+// OptimizeSettlements calculates the optimal settlements to minimize transactions.
+// It greedily matches the largest creditor with the largest debtor until all
+// balances are cleared. Balances up to the settlement threshold are left
+// alone. All balances must be in the same currency.
+func (bc *BalanceCalculator) OptimizeSettlements(balances map[int64]money.Money) []models.Settlement {
+	type entry struct {
+		userID int64
+		amount int64
+	}
+
+	var cur currency.Currency
+	var creditors, debtors []entry
+	for userID, balance := range balances {
+		cur = balance.Currency()
+		switch {
+		case balance.Abs().Amount() <= bc.SettlementThreshold:
+			continue
+		case balance.IsPositive():
+			creditors = append(creditors, entry{userID, balance.Amount()})
+		case balance.IsNegative():
+			debtors = append(debtors, entry{userID, -balance.Amount()})
+		}
+	}
+
 	var settlements []models.Settlement
+	for len(creditors) > 0 && len(debtors) > 0 {
+		// Sort descending by amount, ties broken by user ID for deterministic output
+		byAmount := func(s []entry) func(i, j int) bool {
+			return func(i, j int) bool {
+				if s[i].amount == s[j].amount {
+					return s[i].userID < s[j].userID
+				}
+				return s[i].amount > s[j].amount
+			}
+		}
+		sort.Slice(creditors, byAmount(creditors))
+		sort.Slice(debtors, byAmount(debtors))
+
+		amount := min(creditors[0].amount, debtors[0].amount)
+		settlements = append(settlements, models.Settlement{
+			FromUser: debtors[0].userID,
+			ToUser:   creditors[0].userID,
+			Amount:   money.New(amount, cur),
+			Status:   models.SettlementPending,
+		})
+
+		creditors[0].amount -= amount
+		debtors[0].amount -= amount
+		if creditors[0].amount == 0 {
+			creditors = creditors[1:]
+		}
+		if debtors[0].amount == 0 {
+			debtors = debtors[1:]
+		}
+	}
+
 	return settlements
 }
+
+// SplitEqual splits an amount equally between users (Algorithm A).
+// Minor units that cannot be divided evenly are assigned one by one to the
+// first users, so the shares always sum to the amount.
+func (bc *BalanceCalculator) SplitEqual(amount money.Money, userIDs []int64) []models.Participant {
+	shares := amount.Split(len(userIDs))
+
+	participants := make([]models.Participant, 0, len(userIDs))
+	for i, userID := range userIDs {
+		participants = append(participants, models.Participant{UserID: userID, Share: shares[i]})
+	}
+
+	return participants
+}
+
+// SplitItems splits an amount by the items each user had (Algorithm B). An
+// item is shared equally by the users who claimed it, an unclaimed item by
+// all users. The amount, which may include tax and tip on top of the items,
+// is allocated proportionally to the resulting subtotals, so extra charges
+// follow consumption. Users who claimed items but are not among userIDs are
+// added after them.
+func (bc *BalanceCalculator) SplitItems(amount money.Money, items []models.ExpenseItem, userIDs []int64) []models.Participant {
+	order := append([]int64(nil), userIDs...)
+	subtotals := make(map[int64]int64, len(userIDs))
+	for _, userID := range userIDs {
+		subtotals[userID] = 0
+	}
+
+	for _, item := range items {
+		sharedBy := item.ClaimedBy
+		if len(sharedBy) == 0 {
+			sharedBy = userIDs
+		}
+		for i, part := range item.Price.Split(len(sharedBy)) {
+			userID := sharedBy[i]
+			if _, ok := subtotals[userID]; !ok {
+				order = append(order, userID)
+			}
+			subtotals[userID] += part.Amount()
+		}
+	}
+
+	weights := make([]int64, len(order))
+	for i, userID := range order {
+		weights[i] = subtotals[userID]
+	}
+
+	participants := make([]models.Participant, 0, len(order))
+	for i, share := range amount.Allocate(weights...) {
+		participants = append(participants, models.Participant{UserID: order[i], Share: share})
+	}
+	return participants
+}
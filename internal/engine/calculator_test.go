@@ -0,0 +1,217 @@
+package engine
+
+import (
+	"maps"
+	"math/rand"
+	"testing"
+
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/currency"
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/models"
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/money"
+)
+
+var eur = currency.MustLookup("EUR")
+
+func eurs(minor int64) money.Money {
+	return money.New(minor, eur)
+}
+
+// sharesOf maps the participants to their shares in minor units
+func sharesOf(participants []models.Participant) map[int64]int64 {
+	shares := make(map[int64]int64, len(participants))
+	for _, p := range participants {
+		shares[p.UserID] += p.Share.Amount()
+	}
+	return shares
+}
+
+func TestSplitEqual(t *testing.T) {
+	tests := []struct {
+		name    string
+		amount  int64
+		userIDs []int64
+		want    map[int64]int64
+	}{
+		{name: "even", amount: 900, userIDs: []int64{1, 2, 3}, want: map[int64]int64{1: 300, 2: 300, 3: 300}},
+		{name: "leftover to first users", amount: 1000, userIDs: []int64{1, 2, 3}, want: map[int64]int64{1: 334, 2: 333, 3: 333}},
+		{name: "single user", amount: 1000, userIDs: []int64{7}, want: map[int64]int64{7: 1000}},
+		{name: "fewer minor units than users", amount: 2, userIDs: []int64{1, 2, 3}, want: map[int64]int64{1: 1, 2: 1, 3: 0}},
+		{name: "no users", amount: 1000, userIDs: nil, want: map[int64]int64{}},
+	}
+
+	bc := NewBalanceCalculator()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := bc.SplitEqual(eurs(tt.amount), tt.userIDs)
+			if shares := sharesOf(got); !maps.Equal(shares, tt.want) {
+				t.Errorf("SplitEqual() = %v, want %v", shares, tt.want)
+			}
+		})
+	}
+}
+
+func TestSplitItems(t *testing.T) {
+	item := func(price int64, claimedBy ...int64) models.ExpenseItem {
+		return models.ExpenseItem{Name: "item", Price: eurs(price), Quantity: 1, ClaimedBy: claimedBy}
+	}
+
+	tests := []struct {
+		name    string
+		amount  int64
+		items   []models.ExpenseItem
+		userIDs []int64
+		want    map[int64]int64
+	}{
+		{
+			name:    "each claims own item",
+			amount:  1500,
+			items:   []models.ExpenseItem{item(1000, 1), item(500, 2)},
+			userIDs: []int64{1, 2},
+			want:    map[int64]int64{1: 1000, 2: 500},
+		},
+		{
+			name:    "shared item split between claimers",
+			amount:  1000,
+			items:   []models.ExpenseItem{item(1000, 1, 2)},
+			userIDs: []int64{1, 2, 3},
+			want:    map[int64]int64{1: 500, 2: 500, 3: 0},
+		},
+		{
+			name:    "unclaimed item shared by all",
+			amount:  900,
+			items:   []models.ExpenseItem{item(900)},
+			userIDs: []int64{1, 2, 3},
+			want:    map[int64]int64{1: 300, 2: 300, 3: 300},
+		},
+		{
+			name:    "tip follows consumption",
+			amount:  1650,
+			items:   []models.ExpenseItem{item(1000, 1), item(500, 2)},
+			userIDs: []int64{1, 2},
+			want:    map[int64]int64{1: 1100, 2: 550},
+		},
+		{
+			name:    "claimer outside participants is added",
+			amount:  1000,
+			items:   []models.ExpenseItem{item(600, 1), item(400, 9)},
+			userIDs: []int64{1},
+			want:    map[int64]int64{1: 600, 9: 400},
+		},
+	}
+
+	bc := NewBalanceCalculator()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := bc.SplitItems(eurs(tt.amount), tt.items, tt.userIDs)
+			shares := sharesOf(got)
+			if !maps.Equal(shares, tt.want) {
+				t.Errorf("SplitItems() = %v, want %v", shares, tt.want)
+			}
+			var sum int64
+			for _, share := range shares {
+				sum += share
+			}
+			if sum != tt.amount {
+				t.Errorf("shares sum to %d, want %d", sum, tt.amount)
+			}
+		})
+	}
+}
+
+// optimizeCase are balances in minor units that must be settled by at most
+// maxCount settlements
+type optimizeCase struct {
+	name      string
+	balances  map[int64]int64
+	threshold int64
+	maxCount  int
+}
+
+func TestOptimizeSettlementsClearsBalances(t *testing.T) {
+	tests := []optimizeCase{
+		{name: "settled", balances: map[int64]int64{}, maxCount: 0},
+		{name: "one debtor", balances: map[int64]int64{1: 1000, 2: -1000}, maxCount: 1},
+		{name: "one creditor", balances: map[int64]int64{1: 2000, 2: -500, 3: -1500}, maxCount: 2},
+		{name: "chain", balances: map[int64]int64{1: 700, 2: 300, 3: -400, 4: -600}, maxCount: 3},
+		{name: "below threshold left alone", balances: map[int64]int64{1: 5, 2: -5}, threshold: 10, maxCount: 0},
+		{name: "threshold", balances: map[int64]int64{1: 1003, 2: -1000, 3: -3}, threshold: 5, maxCount: 1},
+	}
+
+	// Random zero-sum balances
+	rng := rand.New(rand.NewSource(1))
+	for i := 0; i < 20; i++ {
+		balances := make(map[int64]int64)
+		var sum int64
+		n := 2 + rng.Intn(8)
+		for userID := int64(1); userID < int64(n); userID++ {
+			balances[userID] = rng.Int63n(100000) - 50000
+			sum += balances[userID]
+		}
+		balances[int64(n)] = -sum
+		tests = append(tests, optimizeCase{name: "random", balances: balances, maxCount: n - 1})
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bc := &BalanceCalculator{SettlementThreshold: tt.threshold}
+			balances := make(map[int64]money.Money, len(tt.balances))
+			for userID, amount := range tt.balances {
+				balances[userID] = eurs(amount)
+			}
+
+			settlements := bc.OptimizeSettlements(balances)
+			if len(settlements) > tt.maxCount {
+				t.Errorf("OptimizeSettlements() made %d settlements, want at most %d", len(settlements), tt.maxCount)
+			}
+
+			remaining := maps.Clone(tt.balances)
+			for _, s := range settlements {
+				if !s.Amount.IsPositive() {
+					t.Errorf("settlement of %v is not positive", s.Amount)
+				}
+				remaining[s.FromUser] += s.Amount.Amount()
+				remaining[s.ToUser] -= s.Amount.Amount()
+			}
+			var sum int64
+			for userID, amount := range remaining {
+				sum += amount
+				if amount > tt.threshold || -amount > tt.threshold {
+					t.Errorf("user %d keeps a balance of %d after settling", userID, amount)
+				}
+			}
+			if sum != 0 {
+				t.Errorf("remaining balances sum to %d, want 0", sum)
+			}
+		})
+	}
+}
+
+func TestCalculateBalancesSumToZero(t *testing.T) {
+	expenses := []models.Expense{
+		{ID: 1, PaidBy: 1, Amount: eurs(1000), BaseAmount: eurs(1000)},
+		// Converted expense whose shares are in the foreign currency
+		{ID: 2, PaidBy: 2, Amount: money.New(1000, currency.MustLookup("USD")), BaseAmount: eurs(923)},
+	}
+	participants := append(
+		NewBalanceCalculator().SplitEqual(eurs(1000), []int64{1, 2, 3}),
+		NewBalanceCalculator().SplitEqual(money.New(1000, currency.MustLookup("USD")), []int64{1, 2, 3})...,
+	)
+	for i := range participants {
+		participants[i].ExpenseID = int64(i/3 + 1)
+	}
+
+	balances, err := NewBalanceCalculator().CalculateBalances(eur, expenses, participants)
+	if err != nil {
+		t.Fatalf("CalculateBalances() error = %v", err)
+	}
+	var sum int64
+	for _, balance := range balances {
+		if balance.Currency() != eur {
+			t.Errorf("balance %v is not in the base currency", balance)
+		}
+		sum += balance.Amount()
+	}
+	if sum != 0 {
+		t.Errorf("balances sum to %d, want 0", sum)
+	}
+}
@@ -0,0 +1,143 @@
+package engine
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/models"
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/money"
+)
+
+// Replay derives the balances of a group from its ledger. Replaying starts
+// from the snapshot, or from zero balances if snapshot is nil, and applies the
+// events in order. Users whose balance is zero are left out of the result.
+func (bc *BalanceCalculator) Replay(snapshot *models.BalanceSnapshot, events []models.LedgerEvent) (map[int64]money.Money, error) {
+	balances := make(map[int64]money.Money)
+	if snapshot != nil {
+		for userID, balance := range snapshot.Balances {
+			if !balance.IsZero() {
+				balances[userID] = balance
+			}
+		}
+	}
+
+	for _, event := range events {
+		if err := bc.ApplyEvent(balances, event); err != nil {
+			return nil, err
+		}
+	}
+	return balances, nil
+}
+
+// ReplayAsOf derives the balances of a group as of the given time from its
+// whole ledger. Expenses count from the date they were incurred, which for
+// imported or backdated expenses is before they were recorded, and
+// settlements from when they were completed. Edits and deletions take effect
+// for the expense versions dated at or before at, whenever they were made.
+func (bc *BalanceCalculator) ReplayAsOf(events []models.LedgerEvent, at time.Time) (map[int64]money.Money, error) {
+	balances := make(map[int64]money.Money)
+	for _, event := range events {
+		if err := bc.applyEvent(balances, event, at); err != nil {
+			return nil, err
+		}
+	}
+	return balances, nil
+}
+
+// ApplyEvent applies a single ledger event to the balances
+func (bc *BalanceCalculator) ApplyEvent(balances map[int64]money.Money, event models.LedgerEvent) error {
+	return bc.applyEvent(balances, event, time.Time{})
+}
+
+// applyEvent applies the part of an event effective at or before at, or the
+// whole event if at is zero
+func (bc *BalanceCalculator) applyEvent(balances map[int64]money.Money, event models.LedgerEvent, at time.Time) error {
+	effective := func(t time.Time) bool { return at.IsZero() || !t.After(at) }
+
+	var err error
+	switch event.Type {
+	case models.EventExpenseAdded:
+		var p models.ExpenseAddedPayload
+		if err = json.Unmarshal(event.Payload, &p); err == nil && effective(p.Expense.CreatedAt) {
+			err = applyExpense(balances, p.Expense, p.Participants, false)
+		}
+	case models.EventExpenseEdited:
+		var p models.ExpenseEditedPayload
+		if err = json.Unmarshal(event.Payload, &p); err == nil && effective(p.Before.CreatedAt) {
+			err = applyExpense(balances, p.Before, p.BeforeParticipants, true)
+		}
+		if err == nil && effective(p.After.CreatedAt) {
+			err = applyExpense(balances, p.After, p.AfterParticipants, false)
+		}
+	case models.EventExpenseDeleted:
+		var p models.ExpenseDeletedPayload
+		if err = json.Unmarshal(event.Payload, &p); err == nil && effective(p.Expense.CreatedAt) {
+			err = applyExpense(balances, p.Expense, p.Participants, true)
+		}
+	case models.EventSettlementCompleted:
+		var p models.SettlementCompletedPayload
+		if err = json.Unmarshal(event.Payload, &p); err == nil && effective(event.OccurredAt) {
+			if err = addBalance(balances, p.Settlement.FromUser, p.Settlement.Amount); err == nil {
+				err = addBalance(balances, p.Settlement.ToUser, p.Settlement.Amount.Neg())
+			}
+		}
+	case models.EventMemberLeft:
+		// Members can only leave with a settled balance, nothing to apply
+	default:
+		err = fmt.Errorf("unknown event type %q", event.Type)
+	}
+	if err != nil {
+		return fmt.Errorf("apply event %d (%s): %w", event.Sequence, event.Type, err)
+	}
+	return nil
+}
+
+// applyExpense credits the payer with the expense's base amount and debits
+// the participants their shares of it. If reverse is set the expense is
+// taken back out of the balances instead.
+func applyExpense(balances map[int64]money.Money, expense models.Expense, participants []models.Participant, reverse bool) error {
+	if len(participants) == 0 {
+		return nil
+	}
+
+	weights := make([]int64, len(participants))
+	for i, p := range participants {
+		weights[i] = p.Share.Amount()
+	}
+	sign := func(m money.Money) money.Money {
+		if reverse {
+			return m.Neg()
+		}
+		return m
+	}
+
+	// Allocate the unsigned amount so reversing yields exactly the original shares
+	if err := addBalance(balances, expense.PaidBy, sign(expense.BaseAmount)); err != nil {
+		return fmt.Errorf("expense %d: %w", expense.ID, err)
+	}
+	for i, amount := range expense.BaseAmount.Allocate(weights...) {
+		if err := addBalance(balances, participants[i].UserID, sign(amount.Neg())); err != nil {
+			return fmt.Errorf("expense %d: %w", expense.ID, err)
+		}
+	}
+	return nil
+}
+
+// addBalance adds an amount to a user's balance, removing balances that reach zero
+func addBalance(balances map[int64]money.Money, userID int64, amount money.Money) error {
+	current, ok := balances[userID]
+	if !ok {
+		current = money.Zero(amount.Currency())
+	}
+	sum, err := current.Add(amount)
+	if err != nil {
+		return err
+	}
+	if sum.IsZero() {
+		delete(balances, userID)
+	} else {
+		balances[userID] = sum
+	}
+	return nil
+}
@@ -0,0 +1,263 @@
+// Package export writes a group's expenses, participant shares and
+// settlements as CSV or JSON for reconciliation in a spreadsheet. Rows are
+// encoded one at a time so exports of long histories are streamed.
+package export
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/money"
+)
+
+// Supported export formats
+const (
+	FormatCSV  = "csv"
+	FormatJSON = "json"
+)
+
+// Record types of export rows
+const (
+	RecordExpense    = "expense"
+	RecordShare      = "share"
+	RecordSettlement = "settlement"
+)
+
+// Columns is the column layout of CSV exports and the key order of JSON
+// exports. Columns may be appended in the future but never reordered.
+var Columns = []string{
+	"record",
+	"date",
+	"expense_id",
+	"settlement_id",
+	"description",
+	"user_id",
+	"user_name",
+	"counterparty_id",
+	"counterparty_name",
+	"amount",
+	"amount_cents",
+	"currency",
+	"exchange_rate",
+	"base_amount",
+	"base_amount_cents",
+	"base_currency",
+	"status",
+}
+
+// Row is a single line of an export.
+//
+// An expense row has the payer as user and the expense total as amount. Each
+// of its share rows has a participant as user, the payer as counterparty and
+// the participant's share as amount. A settlement row has the debtor as user
+// and the creditor as counterparty.
+type Row struct {
+	Record           string
+	Date             time.Time
+	ExpenseID        int64
+	SettlementID     int64
+	Description      string
+	UserID           int64
+	UserName         string
+	CounterpartyID   int64
+	CounterpartyName string
+	Amount           money.Money
+	ExchangeRate     string
+	BaseAmount       money.Money // Amount in the group base currency
+	Status           string
+}
+
+// Encoder writes export rows in a specific format
+type Encoder interface {
+	// Write encodes a row
+	Write(row Row) error
+	// Close finishes the export and flushes buffered output. It does not
+	// close the underlying writer.
+	Close() error
+}
+
+// NewEncoder returns an encoder for the given format writing to w
+func NewEncoder(format string, w io.Writer) (Encoder, error) {
+	switch format {
+	case FormatCSV:
+		return NewCSVEncoder(w), nil
+	case FormatJSON:
+		return NewJSONEncoder(w), nil
+	default:
+		return nil, fmt.Errorf("unsupported export format %q", format)
+	}
+}
+
+// ContentType returns the MIME type of a format
+func ContentType(format string) string {
+	if format == FormatJSON {
+		return "application/json"
+	}
+	return "text/csv; charset=utf-8"
+}
+
+// FileName returns the file name of a group's export in the given format
+func FileName(groupID int64, format string) string {
+	return fmt.Sprintf("group-%d-export.%s", groupID, format)
+}
+
+// CSVEncoder writes rows as CSV with a header line of Columns
+type CSVEncoder struct {
+	w      *csv.Writer
+	header bool
+}
+
+// NewCSVEncoder creates a CSV encoder writing to w
+func NewCSVEncoder(w io.Writer) *CSVEncoder {
+	return &CSVEncoder{w: csv.NewWriter(w)}
+}
+
+// Write encodes a row, preceded by the header on the first call
+func (e *CSVEncoder) Write(row Row) error {
+	if err := e.writeHeader(); err != nil {
+		return err
+	}
+	return e.w.Write(row.fields())
+}
+
+// Close writes the header of an empty export and flushes the output
+func (e *CSVEncoder) Close() error {
+	if err := e.writeHeader(); err != nil {
+		return err
+	}
+	e.w.Flush()
+	return e.w.Error()
+}
+
+func (e *CSVEncoder) writeHeader() error {
+	if e.header {
+		return nil
+	}
+	e.header = true
+	return e.w.Write(Columns)
+}
+
+// JSONEncoder writes rows as a JSON array of objects keyed by Columns
+type JSONEncoder struct {
+	w     io.Writer
+	count int
+}
+
+// NewJSONEncoder creates a JSON encoder writing to w
+func NewJSONEncoder(w io.Writer) *JSONEncoder {
+	return &JSONEncoder{w: w}
+}
+
+// Write encodes a row as the next element of the array
+func (e *JSONEncoder) Write(row Row) error {
+	data, err := json.Marshal(row.object())
+	if err != nil {
+		return fmt.Errorf("encode row: %w", err)
+	}
+
+	sep := ",\n"
+	if e.count == 0 {
+		sep = "[\n"
+	}
+	e.count++
+	if _, err := io.WriteString(e.w, sep); err != nil {
+		return err
+	}
+	_, err = e.w.Write(data)
+	return err
+}
+
+// Close terminates the array
+func (e *JSONEncoder) Close() error {
+	end := "\n]\n"
+	if e.count == 0 {
+		end = "[]\n"
+	}
+	_, err := io.WriteString(e.w, end)
+	return err
+}
+
+// fields returns the row's values in the order of Columns
+func (r Row) fields() []string {
+	return []string{
+		r.Record,
+		r.Date.UTC().Format(time.RFC3339),
+		optionalID(r.ExpenseID),
+		optionalID(r.SettlementID),
+		r.Description,
+		optionalID(r.UserID),
+		r.UserName,
+		optionalID(r.CounterpartyID),
+		r.CounterpartyName,
+		r.Amount.Decimal(),
+		strconv.FormatInt(r.Amount.Amount(), 10),
+		r.Amount.Currency().Code,
+		r.ExchangeRate,
+		r.BaseAmount.Decimal(),
+		strconv.FormatInt(r.BaseAmount.Amount(), 10),
+		r.BaseAmount.Currency().Code,
+		r.Status,
+	}
+}
+
+// jsonRow is the JSON form of a row. Its fields follow the order of Columns.
+type jsonRow struct {
+	Record           string    `json:"record"`
+	Date             time.Time `json:"date"`
+	ExpenseID        *int64    `json:"expense_id"`
+	SettlementID     *int64    `json:"settlement_id"`
+	Description      string    `json:"description"`
+	UserID           *int64    `json:"user_id"`
+	UserName         string    `json:"user_name"`
+	CounterpartyID   *int64    `json:"counterparty_id"`
+	CounterpartyName string    `json:"counterparty_name"`
+	Amount           string    `json:"amount"`
+	AmountCents      int64     `json:"amount_cents"`
+	Currency         string    `json:"currency"`
+	ExchangeRate     string    `json:"exchange_rate"`
+	BaseAmount       string    `json:"base_amount"`
+	BaseAmountCents  int64     `json:"base_amount_cents"`
+	BaseCurrency     string    `json:"base_currency"`
+	Status           string    `json:"status"`
+}
+
+func (r Row) object() jsonRow {
+	return jsonRow{
+		Record:           r.Record,
+		Date:             r.Date.UTC().Truncate(time.Second),
+		ExpenseID:        optionalIDPtr(r.ExpenseID),
+		SettlementID:     optionalIDPtr(r.SettlementID),
+		Description:      r.Description,
+		UserID:           optionalIDPtr(r.UserID),
+		UserName:         r.UserName,
+		CounterpartyID:   optionalIDPtr(r.CounterpartyID),
+		CounterpartyName: r.CounterpartyName,
+		Amount:           r.Amount.Decimal(),
+		AmountCents:      r.Amount.Amount(),
+		Currency:         r.Amount.Currency().Code,
+		ExchangeRate:     r.ExchangeRate,
+		BaseAmount:       r.BaseAmount.Decimal(),
+		BaseAmountCents:  r.BaseAmount.Amount(),
+		BaseCurrency:     r.BaseAmount.Currency().Code,
+		Status:           r.Status,
+	}
+}
+
+// optionalID formats an ID, leaving unset IDs empty
+func optionalID(id int64) string {
+	if id == 0 {
+		return ""
+	}
+	return strconv.FormatInt(id, 10)
+}
+
+func optionalIDPtr(id int64) *int64 {
+	if id == 0 {
+		return nil
+	}
+	return &id
+}
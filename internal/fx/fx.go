@@ -0,0 +1,64 @@
+package fx
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/currency"
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/money"
+)
+
+// ErrRateUnavailable is returned when no exchange rate is known for a currency pair
+var ErrRateUnavailable = errors.New("exchange rate unavailable")
+
+// RateProvider provides exchange rates between currencies
+type RateProvider interface {
+	// Rate returns how many units of the to currency one unit of the from
+	// currency was worth at the given time
+	Rate(ctx context.Context, from, to string, at time.Time) (*big.Rat, error)
+}
+
+// Convert converts an amount into another currency using the given rate.
+// The result is rounded half away from zero to the target's minor units.
+func Convert(amount money.Money, to currency.Currency, rate *big.Rat) money.Money {
+	r := new(big.Rat).SetInt64(amount.Amount())
+	r.Mul(r, rate)
+	r.Mul(r, new(big.Rat).SetInt64(to.Factor()))
+	r.Quo(r, new(big.Rat).SetInt64(amount.Currency().Factor()))
+	return money.New(round(r), to)
+}
+
+// round rounds a rational number half away from zero
+func round(r *big.Rat) int64 {
+	num := new(big.Int).Abs(r.Num())
+	den := r.Denom()
+
+	q, m := new(big.Int).QuoRem(num, den, new(big.Int))
+	if m.Mul(m, big.NewInt(2)).Cmp(den) >= 0 {
+		q.Add(q, big.NewInt(1))
+	}
+	if r.Sign() < 0 {
+		q.Neg(q)
+	}
+	return q.Int64()
+}
+
+// ParseRate parses a positive decimal exchange rate such as "1.0832"
+func ParseRate(s string) (*big.Rat, error) {
+	r, ok := new(big.Rat).SetString(strings.TrimSpace(s))
+	if !ok || r.Sign() <= 0 {
+		return nil, fmt.Errorf("invalid exchange rate %q", s)
+	}
+	return r, nil
+}
+
+// FormatRate formats an exchange rate as a decimal string without trailing zeros
+func FormatRate(rate *big.Rat) string {
+	s := rate.FloatString(10)
+	s = strings.TrimRight(s, "0")
+	return strings.TrimSuffix(s, ".")
+}
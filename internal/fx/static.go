@@ -0,0 +1,119 @@
+package fx
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Snapshot holds the exchange rates of a base currency on a given date
+type Snapshot struct {
+	Date  time.Time
+	Base  string
+	Rates map[string]*big.Rat // currency code -> units per one unit of Base
+}
+
+// StaticProvider serves exchange rates from a fixed set of snapshots.
+// It needs no network access and is suitable for offline use and tests.
+type StaticProvider struct {
+	snapshots []Snapshot // ordered by date
+}
+
+// NewStaticProvider creates a provider serving the given snapshots
+func NewStaticProvider(snapshots ...Snapshot) *StaticProvider {
+	sorted := append([]Snapshot(nil), snapshots...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Date.Before(sorted[j].Date) })
+	return &StaticProvider{snapshots: sorted}
+}
+
+// staticFile is the JSON layout of a rates file:
+//
+//	[
+//	  {"date": "2025-03-01", "base": "EUR", "rates": {"USD": "1.0405", "JPY": "156.72"}}
+//	]
+type staticFile []struct {
+	Date  string            `json:"date"`
+	Base  string            `json:"base"`
+	Rates map[string]string `json:"rates"`
+}
+
+// LoadStaticFile creates a provider from a JSON rates file
+func LoadStaticFile(path string) (*StaticProvider, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read rates file: %w", err)
+	}
+
+	var file staticFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("parse rates file: %w", err)
+	}
+
+	snapshots := make([]Snapshot, 0, len(file))
+	for _, entry := range file {
+		date, err := time.Parse(time.DateOnly, entry.Date)
+		if err != nil {
+			return nil, fmt.Errorf("parse date %q: %w", entry.Date, err)
+		}
+
+		snapshot := Snapshot{
+			Date:  date,
+			Base:  strings.ToUpper(entry.Base),
+			Rates: make(map[string]*big.Rat, len(entry.Rates)),
+		}
+		for code, value := range entry.Rates {
+			rate, err := ParseRate(value)
+			if err != nil {
+				return nil, fmt.Errorf("snapshot %s: %s: %w", entry.Date, code, err)
+			}
+			snapshot.Rates[strings.ToUpper(code)] = rate
+		}
+		snapshots = append(snapshots, snapshot)
+	}
+
+	return NewStaticProvider(snapshots...), nil
+}
+
+// Rate returns the rate from the latest snapshot taken at or before the given
+// time that has both currencies.
+// Cross rates are derived through the snapshot's base currency.
+func (p *StaticProvider) Rate(ctx context.Context, from, to string, at time.Time) (*big.Rat, error) {
+	from, to = strings.ToUpper(from), strings.ToUpper(to)
+	if from == to {
+		return big.NewRat(1, 1), nil
+	}
+
+	for i := len(p.snapshots) - 1; i >= 0; i-- {
+		snapshot := p.snapshots[i]
+		if snapshot.Date.After(at) {
+			continue
+		}
+
+		// Older snapshots may still have a currency the newer ones lack
+		fromRate, ok := snapshot.rate(from)
+		if !ok {
+			continue
+		}
+		toRate, ok := snapshot.rate(to)
+		if !ok {
+			continue
+		}
+		return new(big.Rat).Quo(toRate, fromRate), nil
+	}
+
+	return nil, fmt.Errorf("%s/%s at %s: %w", from, to, at.Format(time.DateOnly), ErrRateUnavailable)
+}
+
+// rate returns the units of code per one unit of the snapshot's base
+func (s Snapshot) rate(code string) (*big.Rat, bool) {
+	if code == s.Base {
+		return big.NewRat(1, 1), true
+	}
+	r, ok := s.Rates[code]
+	return r, ok
+}
@@ -0,0 +1,98 @@
+package fx
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/currency"
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/money"
+)
+
+func date(s string) time.Time {
+	t, err := time.Parse(time.DateOnly, s)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+func TestStaticProviderRate(t *testing.T) {
+	p := NewStaticProvider(
+		Snapshot{Date: date("2025-03-01"), Base: "EUR", Rates: map[string]*big.Rat{
+			"USD": big.NewRat(104, 100),
+			"BGN": big.NewRat(19558, 10000),
+		}},
+		// Newer snapshot without BGN
+		Snapshot{Date: date("2025-03-02"), Base: "EUR", Rates: map[string]*big.Rat{
+			"USD": big.NewRat(105, 100),
+			"JPY": big.NewRat(157, 1),
+		}},
+	)
+
+	tests := []struct {
+		name     string
+		from, to string
+		at       time.Time
+		want     *big.Rat
+		wantErr  error
+	}{
+		{name: "same currency", from: "usd", to: "USD", at: date("2020-01-01"), want: big.NewRat(1, 1)},
+		{name: "direct", from: "EUR", to: "USD", at: date("2025-03-02"), want: big.NewRat(105, 100)},
+		{name: "inverse", from: "USD", to: "EUR", at: date("2025-03-02"), want: big.NewRat(100, 105)},
+		{name: "cross", from: "USD", to: "JPY", at: date("2025-03-05"), want: big.NewRat(15700, 105)},
+		{name: "older snapshot by date", from: "EUR", to: "USD", at: date("2025-03-01"), want: big.NewRat(104, 100)},
+		{name: "falls back to older snapshot with currency", from: "EUR", to: "BGN", at: date("2025-03-05"), want: big.NewRat(19558, 10000)},
+		{name: "before first snapshot", from: "EUR", to: "USD", at: date("2025-02-28"), wantErr: ErrRateUnavailable},
+		{name: "unknown currency", from: "EUR", to: "GBP", at: date("2025-03-05"), wantErr: ErrRateUnavailable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := p.Rate(context.Background(), tt.from, tt.to, tt.at)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("Rate() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Rate() error = %v", err)
+			}
+			if got.Cmp(tt.want) != 0 {
+				t.Errorf("Rate() = %s, want %s", got.RatString(), tt.want.RatString())
+			}
+		})
+	}
+}
+
+func TestConvert(t *testing.T) {
+	eur := currency.MustLookup("EUR")
+	jpy := currency.MustLookup("JPY")
+	bhd := currency.MustLookup("BHD")
+
+	tests := []struct {
+		name   string
+		amount money.Money
+		to     currency.Currency
+		rate   *big.Rat
+		want   int64
+	}{
+		{name: "to zero decimals", amount: money.New(1000, eur), to: jpy, rate: big.NewRat(15672, 100), want: 1567},
+		{name: "from zero decimals", amount: money.New(1567, jpy), to: eur, rate: big.NewRat(100, 15672), want: 1000},
+		{name: "to three decimals", amount: money.New(1000, eur), to: bhd, rate: big.NewRat(41, 100), want: 4100},
+		{name: "rounds half away from zero", amount: money.New(1, eur), to: eur, rate: big.NewRat(1, 2), want: 1},
+		{name: "negative", amount: money.New(-1, eur), to: eur, rate: big.NewRat(1, 2), want: -1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Convert(tt.amount, tt.to, tt.rate)
+			if got.Amount() != tt.want || got.Currency().Code != tt.to.Code {
+				t.Errorf("Convert() = %d %s, want %d %s", got.Amount(), got.Currency().Code, tt.want, tt.to.Code)
+			}
+		})
+	}
+}
@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/service"
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/pkg/logger"
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+)
+
+// Callback data prefixes of inline keyboard buttons
+const (
+	settleDonePrefix           = "settle_done:"
+	expenseEditPrefix          = "expense_edit:"
+	expenseDeletePrefix        = "expense_delete:"
+	expenseDeleteConfirmPrefix = "expense_delete_confirm:"
+	itemClaimPrefix            = "item_claim:"
+	importMatchPrefix          = "import_match:"
+	importCommitPrefix         = "import_commit:"
+	importCancelPrefix         = "import_cancel:"
+	receiptItemPrefix          = "receipt_item:"
+	receiptTotalPrefix         = "receipt_total:"
+	receiptConfirmPrefix       = "receipt_confirm:"
+	receiptCancelPrefix        = "receipt_cancel:"
+)
+
+// HandleSettleDone handles the "Paid" button of a settlement
+func (h *CommandHandler) HandleSettleDone(ctx context.Context, b *bot.Bot, update *models.Update) {
+	query := update.CallbackQuery
+	h.logger.InfoContext(ctx, "Received settle done callback",
+		logger.Int64("user_id", query.From.ID),
+		logger.String("data", query.Data),
+	)
+
+	loc := h.localizer(ctx)
+	settlementID, err := strconv.ParseInt(strings.TrimPrefix(query.Data, settleDonePrefix), 10, 64)
+	if err != nil {
+		h.answer(ctx, b, query.ID, loc.T("callback.invalid_button"))
+		return
+	}
+
+	actor, err := h.actor(ctx, &query.From)
+	if err != nil {
+		h.logger.ErrorContext(ctx, "Failed to resolve user", logger.Error(err))
+		h.answer(ctx, b, query.ID, loc.T("callback.failed"))
+		return
+	}
+
+	settlement, err := h.services.Settlements.CompleteSettlement(ctx, actor.ID, settlementID)
+	switch {
+	case errors.Is(err, service.ErrForbidden):
+		h.answer(ctx, b, query.ID, loc.T("settle.forbidden"))
+		return
+	case errors.Is(err, service.ErrConflict):
+		h.answer(ctx, b, query.ID, loc.T("settle.not_pending"))
+		return
+	case err != nil:
+		h.logger.ErrorContext(ctx, "Failed to complete settlement", logger.Error(err))
+		h.answer(ctx, b, query.ID, loc.T("callback.failed"))
+		return
+	}
+
+	h.answer(ctx, b, query.ID, loc.T("settle.paid_answer"))
+	if msg := query.Message.Message; msg != nil {
+		h.reply(ctx, b, msg.Chat.ID, loc.T("settle.paid",
+			h.displayName(ctx, settlement.FromUser), h.displayName(ctx, settlement.ToUser),
+			loc.Money(settlement.Amount)))
+	}
+}
+
+// answer answers a callback query with a short notification
+func (h *CommandHandler) answer(ctx context.Context, b *bot.Bot, queryID, text string) {
+	_, err := b.AnswerCallbackQuery(ctx, &bot.AnswerCallbackQueryParams{
+		CallbackQueryID: queryID,
+		Text:            text,
+	})
+	if err != nil {
+		h.logger.ErrorContext(ctx, "Failed to answer callback query", logger.Error(err))
+	}
+}
+
+// answerError translates a service error into a callback query notification
+func (h *CommandHandler) answerError(ctx context.Context, b *bot.Bot, queryID string, err error) {
+	loc := h.localizer(ctx)
+	var ve *service.ValidationError
+	switch {
+	case errors.As(err, &ve):
+		h.answer(ctx, b, queryID, loc.T("error.invalid", ve.Error()))
+	case errors.Is(err, service.ErrForbidden):
+		h.answer(ctx, b, queryID, loc.T("callback.forbidden"))
+	case errors.Is(err, service.ErrNotFound):
+		h.answer(ctx, b, queryID, loc.T("callback.not_found"))
+	case errors.Is(err, service.ErrConflict):
+		h.answer(ctx, b, queryID, loc.T("callback.conflict"))
+	default:
+		h.logger.ErrorContext(ctx, "Callback failed", logger.Error(err))
+		h.answer(ctx, b, queryID, loc.T("callback.internal"))
+	}
+}
@@ -2,22 +2,40 @@ package handlers
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/currency"
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/i18n"
+	domain "github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/models"
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/money"
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/service"
 	"github.com/MichaelGenchev/telegram-grouppay-miniapp/pkg/logger"
 	"github.com/go-telegram/bot"
 	"github.com/go-telegram/bot/models"
+	"go.opentelemetry.io/otel"
 )
 
+// tracer starts a span for every handled command and callback
+var tracer = otel.Tracer("github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/handlers")
+
 // CommandHandler handles telegram bot commands
 type CommandHandler struct {
-	logger logger.Logger
-	// Add dependencies here (database, services, etc.)
+	logger   logger.Logger
+	services *service.Service
+	messages *i18n.Bundle
 }
 
-// New creates a new command handler
-func New(log logger.Logger) *CommandHandler {
+// New creates a new command handler rendering replies from the given message catalogs
+func New(services *service.Service, messages *i18n.Bundle, log logger.Logger) *CommandHandler {
 	return &CommandHandler{
-		logger: log.With(logger.String("component", "handlers")),
+		logger:   log.With(logger.String("component", "handlers")),
+		services: services,
+		messages: messages,
 	}
 }
 
@@ -25,13 +43,53 @@ func New(log logger.Logger) *CommandHandler {
 func (h *CommandHandler) RegisterHandlers(registerFunc func(handlerType bot.HandlerType, pattern string, matchType bot.MatchType, handler bot.HandlerFunc)) {
 	h.logger.Info("Registering command handlers")
 
+	// Changes made through the bot are audited with the bot as their source
+	// and keyed by update so redeliveries don't repeat them, and replies are
+	// rendered in the sender's language
+	register := func(handlerType bot.HandlerType, pattern string, matchType bot.MatchType, handler bot.HandlerFunc) {
+		spanName := "handler." + strings.TrimSuffix(pattern, ":")
+		registerFunc(handlerType, pattern, matchType, func(ctx context.Context, b *bot.Bot, update *models.Update) {
+			ctx, span := tracer.Start(ctx, spanName)
+			defer span.End()
+
+			ctx = i18n.WithLocalizer(ctx, h.messages.For(senderLanguage(update)))
+			ctx = service.WithIdempotencyKey(ctx, "update:"+strconv.FormatInt(update.ID, 10))
+			handler(service.WithSource(ctx, domain.SourceBot), b, update)
+		})
+	}
+
 	// Register all command handlers
-	registerFunc(bot.HandlerTypeMessageText, "/start", bot.MatchTypeExact, h.HandleStart)
-	registerFunc(bot.HandlerTypeMessageText, "/help", bot.MatchTypeExact, h.HandleHelp)
-	registerFunc(bot.HandlerTypeMessageText, "/create_group", bot.MatchTypeExact, h.HandleCreateGroup)
-	registerFunc(bot.HandlerTypeMessageText, "/add_expense", bot.MatchTypeExact, h.HandleAddExpense)
-	registerFunc(bot.HandlerTypeMessageText, "/balance", bot.MatchTypeExact, h.HandleBalance)
-	registerFunc(bot.HandlerTypeMessageText, "/settle", bot.MatchTypeExact, h.HandleSettle)
+	register(bot.HandlerTypeMessageText, "start", bot.MatchTypeCommandStartOnly, h.HandleStart)
+	register(bot.HandlerTypeMessageText, "help", bot.MatchTypeCommandStartOnly, h.HandleHelp)
+	register(bot.HandlerTypeMessageText, "create_group", bot.MatchTypeCommandStartOnly, h.HandleCreateGroup)
+	register(bot.HandlerTypeMessageText, "join", bot.MatchTypeCommandStartOnly, h.HandleJoin)
+	register(bot.HandlerTypeMessageText, "leave", bot.MatchTypeCommandStartOnly, h.HandleLeave)
+	register(bot.HandlerTypeMessageText, "currency", bot.MatchTypeCommandStartOnly, h.HandleCurrency)
+	register(bot.HandlerTypeMessageText, "add_expense", bot.MatchTypeCommandStartOnly, h.HandleAddExpense)
+	register(bot.HandlerTypePhotoCaption, "add_expense", bot.MatchTypeCommandStartOnly, h.HandleReceipt)
+	register(bot.HandlerTypeMessageText, "edit_expense", bot.MatchTypeCommandStartOnly, h.HandleEditExpense)
+	register(bot.HandlerTypeMessageText, "delete_expense", bot.MatchTypeCommandStartOnly, h.HandleDeleteExpense)
+	register(bot.HandlerTypeMessageText, "balance", bot.MatchTypeCommandStartOnly, h.HandleBalance)
+	register(bot.HandlerTypeMessageText, "settle", bot.MatchTypeCommandStartOnly, h.HandleSettle)
+	register(bot.HandlerTypeMessageText, "recurring", bot.MatchTypeCommandStartOnly, h.HandleRecurring)
+	register(bot.HandlerTypeMessageText, "reminders", bot.MatchTypeCommandStartOnly, h.HandleReminders)
+	register(bot.HandlerTypeMessageText, "history", bot.MatchTypeCommandStartOnly, h.HandleHistory)
+	register(bot.HandlerTypeMessageText, "export", bot.MatchTypeCommandStartOnly, h.HandleExport)
+	register(bot.HandlerTypePhotoCaption, "import", bot.MatchTypeCommandStartOnly, h.HandleImport)
+
+	// Register callback query handlers
+	register(bot.HandlerTypeCallbackQueryData, settleDonePrefix, bot.MatchTypePrefix, h.HandleSettleDone)
+	register(bot.HandlerTypeCallbackQueryData, expenseEditPrefix, bot.MatchTypePrefix, h.HandleExpenseEdit)
+	register(bot.HandlerTypeCallbackQueryData, expenseDeleteConfirmPrefix, bot.MatchTypePrefix, h.HandleExpenseDeleteConfirm)
+	register(bot.HandlerTypeCallbackQueryData, expenseDeletePrefix, bot.MatchTypePrefix, h.HandleExpenseDelete)
+	register(bot.HandlerTypeCallbackQueryData, itemClaimPrefix, bot.MatchTypePrefix, h.HandleItemClaim)
+	register(bot.HandlerTypeCallbackQueryData, importMatchPrefix, bot.MatchTypePrefix, h.HandleImportMatch)
+	register(bot.HandlerTypeCallbackQueryData, importCommitPrefix, bot.MatchTypePrefix, h.HandleImportCommit)
+	register(bot.HandlerTypeCallbackQueryData, importCancelPrefix, bot.MatchTypePrefix, h.HandleImportCancel)
+	register(bot.HandlerTypeCallbackQueryData, receiptItemPrefix, bot.MatchTypePrefix, h.HandleReceiptItem)
+	register(bot.HandlerTypeCallbackQueryData, receiptTotalPrefix, bot.MatchTypePrefix, h.HandleReceiptTotal)
+	register(bot.HandlerTypeCallbackQueryData, receiptConfirmPrefix, bot.MatchTypePrefix, h.HandleReceiptConfirm)
+	register(bot.HandlerTypeCallbackQueryData, receiptCancelPrefix, bot.MatchTypePrefix, h.HandleReceiptCancel)
 
 	h.logger.Info("Command handlers registered successfully")
 }
@@ -47,7 +105,7 @@ func (h *CommandHandler) HandleStart(ctx context.Context, b *bot.Bot, update *mo
 
 	_, err := b.SendMessage(ctx, &bot.SendMessageParams{
 		ChatID: update.Message.Chat.ID,
-		Text:   "Welcome to GroupPay! 🎉\n\nI'll help you manage shared expenses with your friends.\n\nUse /help to see available commands.",
+		Text:   h.localizer(ctx).T("start.welcome"),
 	})
 	if err != nil {
 		h.logger.ErrorContext(ctx, "Failed to send start message",
@@ -68,18 +126,9 @@ func (h *CommandHandler) HandleHelp(ctx context.Context, b *bot.Bot, update *mod
 		logger.Int64("chat_id", update.Message.Chat.ID),
 	)
 
-	helpText := `Available commands:
-
-/start - Welcome message
-/help - Show this help
-/create_group - Create a new expense group
-/add_expense - Add an expense
-/balance - Show current balances
-/settle - Settle up expenses`
-
 	_, err := b.SendMessage(ctx, &bot.SendMessageParams{
 		ChatID: update.Message.Chat.ID,
-		Text:   helpText,
+		Text:   h.localizer(ctx).T("help.text"),
 	})
 	if err != nil {
 		h.logger.ErrorContext(ctx, "Failed to send help message", logger.Error(err))
@@ -93,13 +142,133 @@ func (h *CommandHandler) HandleCreateGroup(ctx context.Context, b *bot.Bot, upda
 		logger.Int64("chat_id", update.Message.Chat.ID),
 	)
 
-	_, err := b.SendMessage(ctx, &bot.SendMessageParams{
-		ChatID: update.Message.Chat.ID,
-		Text:   "Creating expense groups is coming soon! 🚧",
+	loc := h.localizer(ctx)
+	chat := update.Message.Chat
+	if chat.Type == models.ChatTypePrivate {
+		h.reply(ctx, b, chat.ID, loc.T("group.private_chat"))
+		return
+	}
+
+	actor, err := h.actor(ctx, update.Message.From)
+	if err != nil {
+		h.replyError(ctx, b, chat.ID, err)
+		return
+	}
+
+	name := commandArgs(update.Message.Text)
+	if name == "" {
+		name = chat.Title
+	}
+
+	group, err := h.services.Groups.CreateGroup(ctx, actor.ID, service.CreateGroupInput{
+		Name:   name,
+		ChatID: chat.ID,
 	})
 	if err != nil {
-		h.logger.ErrorContext(ctx, "Failed to send create group message", logger.Error(err))
+		h.replyError(ctx, b, chat.ID, err)
+		return
+	}
+
+	h.reply(ctx, b, chat.ID, loc.T("group.created", group.Name))
+}
+
+// HandleJoin handles the /join command
+func (h *CommandHandler) HandleJoin(ctx context.Context, b *bot.Bot, update *models.Update) {
+	h.logger.InfoContext(ctx, "Received /join command",
+		logger.Int64("user_id", update.Message.From.ID),
+		logger.Int64("chat_id", update.Message.Chat.ID),
+	)
+
+	chatID := update.Message.Chat.ID
+
+	actor, err := h.actor(ctx, update.Message.From)
+	if err != nil {
+		h.replyError(ctx, b, chatID, err)
+		return
+	}
+
+	group, err := h.chatGroup(ctx, update.Message.Chat)
+	if err != nil {
+		h.replyError(ctx, b, chatID, err)
+		return
+	}
+
+	if _, err := h.services.Groups.Join(ctx, actor.ID, group.ID); err != nil {
+		h.replyError(ctx, b, chatID, err)
+		return
+	}
+
+	h.reply(ctx, b, chatID, h.localizer(ctx).T("group.joined", h.displayName(ctx, actor.ID), group.Name))
+}
+
+// HandleLeave handles the /leave command
+func (h *CommandHandler) HandleLeave(ctx context.Context, b *bot.Bot, update *models.Update) {
+	h.logger.InfoContext(ctx, "Received /leave command",
+		logger.Int64("user_id", update.Message.From.ID),
+		logger.Int64("chat_id", update.Message.Chat.ID),
+	)
+
+	chatID := update.Message.Chat.ID
+
+	actor, err := h.actor(ctx, update.Message.From)
+	if err != nil {
+		h.replyError(ctx, b, chatID, err)
+		return
+	}
+
+	group, err := h.chatGroup(ctx, update.Message.Chat)
+	if err != nil {
+		h.replyError(ctx, b, chatID, err)
+		return
+	}
+
+	err = h.services.Groups.Leave(ctx, actor.ID, group.ID)
+	if errors.Is(err, service.ErrConflict) {
+		h.reply(ctx, b, chatID, h.localizer(ctx).T("group.leave_conflict"))
+		return
+	}
+	if err != nil {
+		h.replyError(ctx, b, chatID, err)
+		return
+	}
+
+	h.reply(ctx, b, chatID, h.localizer(ctx).T("group.left", h.displayName(ctx, actor.ID), group.Name))
+}
+
+// HandleCurrency handles the /currency command
+func (h *CommandHandler) HandleCurrency(ctx context.Context, b *bot.Bot, update *models.Update) {
+	h.logger.InfoContext(ctx, "Received /currency command",
+		logger.Int64("user_id", update.Message.From.ID),
+		logger.Int64("chat_id", update.Message.Chat.ID),
+	)
+
+	chatID := update.Message.Chat.ID
+
+	actor, err := h.actor(ctx, update.Message.From)
+	if err != nil {
+		h.replyError(ctx, b, chatID, err)
+		return
+	}
+
+	group, err := h.chatGroup(ctx, update.Message.Chat)
+	if err != nil {
+		h.replyError(ctx, b, chatID, err)
+		return
+	}
+
+	code := commandArgs(update.Message.Text)
+	if code == "" {
+		h.reply(ctx, b, chatID, h.localizer(ctx).T("currency.show", group.Name, group.BaseCurrency))
+		return
+	}
+
+	group, err = h.services.Groups.SetBaseCurrency(ctx, actor.ID, group.ID, code)
+	if err != nil {
+		h.replyError(ctx, b, chatID, err)
+		return
 	}
+
+	h.reply(ctx, b, chatID, h.localizer(ctx).T("currency.set", group.Name, group.BaseCurrency))
 }
 
 // HandleAddExpense handles the /add_expense command
@@ -109,9 +278,55 @@ func (h *CommandHandler) HandleAddExpense(ctx context.Context, b *bot.Bot, updat
 		logger.Int64("chat_id", update.Message.Chat.ID),
 	)
 
-	_, err := b.SendMessage(ctx, &bot.SendMessageParams{
-		ChatID: update.Message.Chat.ID,
-		Text:   "Adding expenses is coming soon! 💰",
+	chatID := update.Message.Chat.ID
+	loc := h.localizer(ctx)
+
+	amountArg, rest, _ := strings.Cut(commandArgs(update.Message.Text), " ")
+	rest = strings.TrimSpace(rest)
+
+	actor, err := h.actor(ctx, update.Message.From)
+	if err != nil {
+		h.replyError(ctx, b, chatID, err)
+		return
+	}
+
+	group, err := h.chatGroup(ctx, update.Message.Chat)
+	if err != nil {
+		h.replyError(ctx, b, chatID, err)
+		return
+	}
+
+	// An optional upper case ISO 4217 code may follow the amount
+	code := group.BaseCurrency
+	if first, description, ok := strings.Cut(rest, " "); ok && first == strings.ToUpper(first) && currency.IsValid(first) {
+		code, rest = first, strings.TrimSpace(description)
+	}
+	cur, err := currency.Lookup(code)
+	if err != nil {
+		h.replyError(ctx, b, chatID, err)
+		return
+	}
+
+	amount, err := money.Parse(amountArg, cur)
+	if err != nil || rest == "" || !amount.IsPositive() {
+		h.reply(ctx, b, chatID, loc.T("expense.add_usage"))
+		return
+	}
+
+	expense, participants, err := h.services.Expenses.CreateExpense(ctx, actor.ID, service.CreateExpenseInput{
+		GroupID:     group.ID,
+		Description: rest,
+		Amount:      amount,
+	})
+	if err != nil {
+		h.replyError(ctx, b, chatID, err)
+		return
+	}
+
+	_, err = b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID:      chatID,
+		Text:        h.expenseSummary(ctx, expense, participants, ""),
+		ReplyMarkup: expenseKeyboard(loc, expense.ID),
 	})
 	if err != nil {
 		h.logger.ErrorContext(ctx, "Failed to send add expense message", logger.Error(err))
@@ -125,13 +340,63 @@ func (h *CommandHandler) HandleBalance(ctx context.Context, b *bot.Bot, update *
 		logger.Int64("chat_id", update.Message.Chat.ID),
 	)
 
-	_, err := b.SendMessage(ctx, &bot.SendMessageParams{
-		ChatID: update.Message.Chat.ID,
-		Text:   "Balance checking is coming soon! 📊",
-	})
+	chatID := update.Message.Chat.ID
+
+	actor, err := h.actor(ctx, update.Message.From)
+	if err != nil {
+		h.replyError(ctx, b, chatID, err)
+		return
+	}
+
+	group, err := h.chatGroup(ctx, update.Message.Chat)
 	if err != nil {
-		h.logger.ErrorContext(ctx, "Failed to send balance message", logger.Error(err))
+		h.replyError(ctx, b, chatID, err)
+		return
 	}
+
+	// An optional date shows the balances as of the end of that day (UTC)
+	loc := h.localizer(ctx)
+	title := loc.T("balance.title")
+	var balances map[int64]money.Money
+	if arg := commandArgs(update.Message.Text); arg != "" {
+		day, err := time.Parse(time.DateOnly, arg)
+		if err != nil {
+			h.reply(ctx, b, chatID, loc.T("balance.usage"))
+			return
+		}
+		title = loc.T("balance.title_at", loc.Date(day))
+		balances, err = h.services.Settlements.BalancesAt(ctx, actor.ID, group.ID, day.Add(24*time.Hour-time.Nanosecond))
+	} else {
+		balances, err = h.services.Settlements.Balances(ctx, actor.ID, group.ID)
+	}
+	if err != nil {
+		h.replyError(ctx, b, chatID, err)
+		return
+	}
+
+	userIDs := make([]int64, 0, len(balances))
+	for userID, balance := range balances {
+		if !balance.IsZero() {
+			userIDs = append(userIDs, userID)
+		}
+	}
+	if len(userIDs) == 0 {
+		h.reply(ctx, b, chatID, loc.T("balance.settled"))
+		return
+	}
+	sort.Slice(userIDs, func(i, j int) bool { return balances[userIDs[i]].Amount() > balances[userIDs[j]].Amount() })
+
+	var sb strings.Builder
+	sb.WriteString(title + "\n\n")
+	for _, userID := range userIDs {
+		icon := "🟢"
+		if balances[userID].IsNegative() {
+			icon = "🔴"
+		}
+		fmt.Fprintf(&sb, "%s %s: %s\n", icon, h.displayName(ctx, userID), loc.Money(balances[userID]))
+	}
+
+	h.reply(ctx, b, chatID, sb.String())
 }
 
 // HandleSettle handles the /settle command
@@ -141,9 +406,47 @@ func (h *CommandHandler) HandleSettle(ctx context.Context, b *bot.Bot, update *m
 		logger.Int64("chat_id", update.Message.Chat.ID),
 	)
 
-	_, err := b.SendMessage(ctx, &bot.SendMessageParams{
-		ChatID: update.Message.Chat.ID,
-		Text:   "Settlement is coming soon! 🤝",
+	chatID := update.Message.Chat.ID
+
+	actor, err := h.actor(ctx, update.Message.From)
+	if err != nil {
+		h.replyError(ctx, b, chatID, err)
+		return
+	}
+
+	group, err := h.chatGroup(ctx, update.Message.Chat)
+	if err != nil {
+		h.replyError(ctx, b, chatID, err)
+		return
+	}
+
+	settlements, err := h.services.Settlements.PlanSettlements(ctx, actor.ID, group.ID)
+	if err != nil {
+		h.replyError(ctx, b, chatID, err)
+		return
+	}
+	loc := h.localizer(ctx)
+	if len(settlements) == 0 {
+		h.reply(ctx, b, chatID, loc.T("settle.nothing"))
+		return
+	}
+
+	var sb strings.Builder
+	sb.WriteString(loc.T("settle.title") + "\n\n")
+	keyboard := make([][]models.InlineKeyboardButton, 0, len(settlements))
+	for i, s := range settlements {
+		fmt.Fprintf(&sb, "%d. %s → %s: %s\n", i+1,
+			h.displayName(ctx, s.FromUser), h.displayName(ctx, s.ToUser), loc.Money(s.Amount))
+		keyboard = append(keyboard, []models.InlineKeyboardButton{{
+			Text:         loc.T("settle.button", i+1),
+			CallbackData: fmt.Sprintf("%s%d", settleDonePrefix, s.ID),
+		}})
+	}
+
+	_, err = b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID:      chatID,
+		Text:        sb.String(),
+		ReplyMarkup: &models.InlineKeyboardMarkup{InlineKeyboard: keyboard},
 	})
 	if err != nil {
 		h.logger.ErrorContext(ctx, "Failed to send settle message", logger.Error(err))
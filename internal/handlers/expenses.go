@@ -0,0 +1,297 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/currency"
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/i18n"
+	domain "github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/models"
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/money"
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/service"
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/pkg/logger"
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+)
+
+// HandleEditExpense handles the /edit_expense command
+func (h *CommandHandler) HandleEditExpense(ctx context.Context, b *bot.Bot, update *models.Update) {
+	h.logger.InfoContext(ctx, "Received /edit_expense command",
+		logger.Int64("user_id", update.Message.From.ID),
+		logger.Int64("chat_id", update.Message.Chat.ID),
+	)
+
+	chatID := update.Message.Chat.ID
+	usage := h.localizer(ctx).T("expense.edit_usage")
+
+	idArg, rest, _ := strings.Cut(commandArgs(update.Message.Text), " ")
+	expenseID, err := strconv.ParseInt(idArg, 10, 64)
+	rest = strings.TrimSpace(rest)
+	if err != nil || rest == "" {
+		h.reply(ctx, b, chatID, usage)
+		return
+	}
+
+	actor, err := h.actor(ctx, update.Message.From)
+	if err != nil {
+		h.replyError(ctx, b, chatID, err)
+		return
+	}
+
+	expense, err := h.chatExpense(ctx, actor.ID, update.Message.Chat, expenseID)
+	if err != nil {
+		h.replyError(ctx, b, chatID, err)
+		return
+	}
+
+	// The first argument is the new amount if it parses as one, otherwise
+	// everything is the new description
+	var in service.UpdateExpenseInput
+	amountArg, tail, _ := strings.Cut(rest, " ")
+	tail = strings.TrimSpace(tail)
+	cur := expense.Amount.Currency()
+	if first, description, _ := strings.Cut(tail, " "); first != "" && first == strings.ToUpper(first) && currency.IsValid(first) {
+		cur = currency.MustLookup(first)
+		tail = strings.TrimSpace(description)
+	}
+	if amount, err := money.Parse(amountArg, cur); err == nil {
+		if !amount.IsPositive() {
+			h.reply(ctx, b, chatID, usage)
+			return
+		}
+		in.Amount = &amount
+		if tail != "" {
+			in.Description = &tail
+		}
+	} else {
+		in.Description = &rest
+	}
+
+	change, err := h.services.Expenses.UpdateExpense(ctx, actor.ID, expenseID, in)
+	if err != nil {
+		h.replyError(ctx, b, chatID, err)
+		return
+	}
+
+	h.notifyExpenseChange(ctx, b, chatID, actor, change)
+}
+
+// HandleDeleteExpense handles the /delete_expense command
+func (h *CommandHandler) HandleDeleteExpense(ctx context.Context, b *bot.Bot, update *models.Update) {
+	h.logger.InfoContext(ctx, "Received /delete_expense command",
+		logger.Int64("user_id", update.Message.From.ID),
+		logger.Int64("chat_id", update.Message.Chat.ID),
+	)
+
+	chatID := update.Message.Chat.ID
+
+	expenseID, err := strconv.ParseInt(commandArgs(update.Message.Text), 10, 64)
+	if err != nil {
+		h.reply(ctx, b, chatID, h.localizer(ctx).T("expense.delete_usage"))
+		return
+	}
+
+	actor, err := h.actor(ctx, update.Message.From)
+	if err != nil {
+		h.replyError(ctx, b, chatID, err)
+		return
+	}
+
+	if _, err := h.chatExpense(ctx, actor.ID, update.Message.Chat, expenseID); err != nil {
+		h.replyError(ctx, b, chatID, err)
+		return
+	}
+
+	change, err := h.services.Expenses.DeleteExpense(ctx, actor.ID, expenseID)
+	if err != nil {
+		h.replyError(ctx, b, chatID, err)
+		return
+	}
+
+	h.notifyExpenseChange(ctx, b, chatID, actor, change)
+}
+
+// HandleExpenseEdit handles the "Edit" button of an expense
+func (h *CommandHandler) HandleExpenseEdit(ctx context.Context, b *bot.Bot, update *models.Update) {
+	query := update.CallbackQuery
+	h.logger.InfoContext(ctx, "Received expense edit callback",
+		logger.Int64("user_id", query.From.ID),
+		logger.String("data", query.Data),
+	)
+
+	loc := h.localizer(ctx)
+	expenseID, err := strconv.ParseInt(strings.TrimPrefix(query.Data, expenseEditPrefix), 10, 64)
+	if err != nil || query.Message.Message == nil {
+		h.answer(ctx, b, query.ID, loc.T("callback.invalid_button"))
+		return
+	}
+
+	actor, err := h.actor(ctx, &query.From)
+	if err != nil {
+		h.logger.ErrorContext(ctx, "Failed to resolve user", logger.Error(err))
+		h.answer(ctx, b, query.ID, loc.T("callback.failed"))
+		return
+	}
+
+	expense, _, err := h.services.Expenses.GetExpense(ctx, actor.ID, expenseID)
+	if err != nil {
+		h.answer(ctx, b, query.ID, loc.T("expense.gone"))
+		return
+	}
+	h.answer(ctx, b, query.ID, "")
+
+	command := fmt.Sprintf("/edit_expense %d %s %s %s", expense.ID, expense.Amount.Decimal(), expense.Amount.Currency(), expense.Description)
+	_, err = b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID: query.Message.Message.Chat.ID,
+		Text:   loc.T("expense.edit_instructions", expense.ID, command),
+		ReplyMarkup: &models.InlineKeyboardMarkup{InlineKeyboard: [][]models.InlineKeyboardButton{{
+			{Text: loc.T("expense.copy_command"), CopyText: models.CopyTextButton{Text: command}},
+		}}},
+	})
+	if err != nil {
+		h.logger.ErrorContext(ctx, "Failed to send edit instructions", logger.Error(err))
+	}
+}
+
+// HandleExpenseDelete handles the "Delete" button of an expense by asking for confirmation
+func (h *CommandHandler) HandleExpenseDelete(ctx context.Context, b *bot.Bot, update *models.Update) {
+	query := update.CallbackQuery
+	h.logger.InfoContext(ctx, "Received expense delete callback",
+		logger.Int64("user_id", query.From.ID),
+		logger.String("data", query.Data),
+	)
+
+	loc := h.localizer(ctx)
+	expenseID, err := strconv.ParseInt(strings.TrimPrefix(query.Data, expenseDeletePrefix), 10, 64)
+	if err != nil || query.Message.Message == nil {
+		h.answer(ctx, b, query.ID, loc.T("callback.invalid_button"))
+		return
+	}
+	h.answer(ctx, b, query.ID, "")
+
+	_, err = b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID: query.Message.Message.Chat.ID,
+		Text:   loc.T("expense.delete_confirm", expenseID),
+		ReplyMarkup: &models.InlineKeyboardMarkup{InlineKeyboard: [][]models.InlineKeyboardButton{{
+			{Text: loc.T("expense.delete_yes"), CallbackData: fmt.Sprintf("%s%d", expenseDeleteConfirmPrefix, expenseID)},
+		}}},
+	})
+	if err != nil {
+		h.logger.ErrorContext(ctx, "Failed to send delete confirmation", logger.Error(err))
+	}
+}
+
+// HandleExpenseDeleteConfirm handles the confirmation button of an expense deletion
+func (h *CommandHandler) HandleExpenseDeleteConfirm(ctx context.Context, b *bot.Bot, update *models.Update) {
+	query := update.CallbackQuery
+	h.logger.InfoContext(ctx, "Received expense delete confirmation",
+		logger.Int64("user_id", query.From.ID),
+		logger.String("data", query.Data),
+	)
+
+	loc := h.localizer(ctx)
+	expenseID, err := strconv.ParseInt(strings.TrimPrefix(query.Data, expenseDeleteConfirmPrefix), 10, 64)
+	if err != nil || query.Message.Message == nil {
+		h.answer(ctx, b, query.ID, loc.T("callback.invalid_button"))
+		return
+	}
+	chatID := query.Message.Message.Chat.ID
+
+	actor, err := h.actor(ctx, &query.From)
+	if err != nil {
+		h.logger.ErrorContext(ctx, "Failed to resolve user", logger.Error(err))
+		h.answer(ctx, b, query.ID, loc.T("callback.failed"))
+		return
+	}
+
+	if _, err := h.chatExpense(ctx, actor.ID, query.Message.Message.Chat, expenseID); err != nil {
+		h.answerError(ctx, b, query.ID, err)
+		return
+	}
+
+	change, err := h.services.Expenses.DeleteExpense(ctx, actor.ID, expenseID)
+	if err != nil {
+		h.answerError(ctx, b, query.ID, err)
+		return
+	}
+	h.answer(ctx, b, query.ID, loc.T("expense.deleted_answer"))
+
+	h.notifyExpenseChange(ctx, b, chatID, actor, change)
+}
+
+// expenseKeyboard returns the inline keyboard attached to expense messages
+func expenseKeyboard(loc *i18n.Localizer, expenseID int64) *models.InlineKeyboardMarkup {
+	return &models.InlineKeyboardMarkup{InlineKeyboard: [][]models.InlineKeyboardButton{{
+		{Text: loc.T("expense.button_edit"), CallbackData: fmt.Sprintf("%s%d", expenseEditPrefix, expenseID)},
+		{Text: loc.T("expense.button_delete"), CallbackData: fmt.Sprintf("%s%d", expenseDeletePrefix, expenseID)},
+	}}}
+}
+
+// expenseSummary describes a new expense and how it is split. Details, such as
+// the items of a receipt, are inserted before the split.
+func (h *CommandHandler) expenseSummary(ctx context.Context, expense *domain.Expense, participants []domain.Participant, details string) string {
+	loc := h.localizer(ctx)
+
+	var sb strings.Builder
+	sb.WriteString(loc.T("expense.added", expense.ID,
+		h.displayName(ctx, expense.PaidBy), loc.Money(expense.Amount), expense.Description) + "\n")
+	if !expense.Amount.SameCurrency(expense.BaseAmount) {
+		sb.WriteString(loc.T("expense.converted",
+			loc.Money(expense.BaseAmount), expense.Amount.Currency(), expense.ExchangeRate, expense.BaseAmount.Currency()) + "\n")
+	}
+	if details != "" {
+		sb.WriteString("\n" + details)
+	}
+	sb.WriteString("\n" + loc.N("expense.split", len(participants)) + "\n")
+	for _, p := range participants {
+		fmt.Fprintf(&sb, "• %s: %s\n", h.displayName(ctx, p.UserID), loc.Money(p.Share))
+	}
+	return sb.String()
+}
+
+// notifyExpenseChange tells the group about an edited or deleted expense and
+// how it changed everyone's balance. chatID must be the group's chat, see
+// chatExpense.
+func (h *CommandHandler) notifyExpenseChange(ctx context.Context, b *bot.Bot, chatID int64, actor *domain.User, change *service.ExpenseChange) {
+	loc := h.localizer(ctx)
+	before := change.Before
+
+	var sb strings.Builder
+	if change.After == nil {
+		sb.WriteString(loc.T("expense.deleted",
+			h.displayName(ctx, actor.ID), before.ID, before.Description, loc.Money(before.Amount)) + "\n")
+	} else {
+		after := change.After
+		sb.WriteString(loc.T("expense.edited", h.displayName(ctx, actor.ID), after.ID) + "\n")
+		if before.Description != after.Description {
+			sb.WriteString(loc.T("expense.changed_description", before.Description, after.Description) + "\n")
+		}
+		if before.Amount != after.Amount {
+			sb.WriteString(loc.T("expense.changed_amount", loc.Money(before.Amount), loc.Money(after.Amount)) + "\n")
+		}
+	}
+
+	if len(change.Delta) == 0 {
+		sb.WriteString("\n" + loc.T("expense.no_balance_changes"))
+	} else {
+		sb.WriteString("\n" + loc.T("expense.balance_changes") + "\n")
+		userIDs := make([]int64, 0, len(change.Delta))
+		for userID := range change.Delta {
+			userIDs = append(userIDs, userID)
+		}
+		sort.Slice(userIDs, func(i, j int) bool { return change.Delta[userIDs[i]].Amount() > change.Delta[userIDs[j]].Amount() })
+		for _, userID := range userIDs {
+			delta := change.Delta[userID]
+			sign := ""
+			if delta.IsPositive() {
+				sign = "+"
+			}
+			fmt.Fprintf(&sb, "• %s: %s%s\n", h.displayName(ctx, userID), sign, loc.Money(delta))
+		}
+	}
+
+	h.reply(ctx, b, chatID, sb.String())
+}
@@ -0,0 +1,172 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/currency"
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/engine"
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/fx"
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/i18n"
+	domain "github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/models"
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/money"
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/receipt"
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/service"
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/storage/memory"
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/pkg/logger"
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+)
+
+// sentMessage is a message the bot sent through the fake Bot API
+type sentMessage struct {
+	chatID string
+	text   string
+}
+
+// fakeAPI is a Bot API server recording the messages sent through it
+type fakeAPI struct {
+	mu   sync.Mutex
+	sent []sentMessage
+}
+
+func (f *fakeAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseMultipartForm(1 << 20); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	chatID := r.FormValue("chat_id")
+	if strings.HasSuffix(r.URL.Path, "/sendMessage") {
+		f.mu.Lock()
+		f.sent = append(f.sent, sentMessage{chatID: chatID, text: r.FormValue("text")})
+		f.mu.Unlock()
+	}
+	json.NewEncoder(w).Encode(map[string]any{
+		"ok":     true,
+		"result": map[string]any{"message_id": 1, "date": 0, "chat": map[string]any{"id": json.Number(chatID), "type": "group"}},
+	})
+}
+
+// messages returns the messages sent to a chat
+func (f *fakeAPI) messages(chatID int64) []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var texts []string
+	for _, m := range f.sent {
+		if m.chatID == fmt.Sprint(chatID) {
+			texts = append(texts, m.text)
+		}
+	}
+	return texts
+}
+
+func TestExpenseChangesOnlyFromTheGroupsChat(t *testing.T) {
+	const tripChat, flatChat, privateChat = -100, -200, 1
+	eur := currency.MustLookup("EUR")
+
+	tests := []struct {
+		name        string
+		chatID      int64
+		text        string
+		wantChanged bool
+	}{
+		{name: "edit from the group's chat", chatID: tripChat, text: "/edit_expense %d 30", wantChanged: true},
+		{name: "edit from another group's chat", chatID: flatChat, text: "/edit_expense %d 30"},
+		{name: "edit from a private chat", chatID: privateChat, text: "/edit_expense %d 30"},
+		{name: "delete from the group's chat", chatID: tripChat, text: "/delete_expense %d", wantChanged: true},
+		{name: "delete from another group's chat", chatID: flatChat, text: "/delete_expense %d"},
+		{name: "delete from a private chat", chatID: privateChat, text: "/delete_expense %d"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			log, err := logger.New(logger.Config{Level: "error", Environment: "production", OutputPath: "stderr"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			messages, err := i18n.Load()
+			if err != nil {
+				t.Fatal(err)
+			}
+			store := memory.New()
+			services := service.New(store, engine.NewBalanceCalculator(), fx.NewStaticProvider(), service.DefaultReminderPolicy(), &receipt.Fake{}, log)
+			h := New(services, messages, log)
+
+			api := &fakeAPI{}
+			server := httptest.NewServer(api)
+			defer server.Close()
+			b, err := bot.New("1:token", bot.WithServerURL(server.URL), bot.WithSkipGetMe())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// alice and bob share a trip, alice also has a flat in another chat
+			alice, err := services.Users.EnsureUser(ctx, domain.User{TelegramID: 1, Username: "alice"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			bob, err := services.Users.EnsureUser(ctx, domain.User{TelegramID: 2, Username: "bob"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			trip, err := services.Groups.CreateGroup(ctx, alice.ID, service.CreateGroupInput{Name: "trip", ChatID: tripChat})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := services.Groups.Join(ctx, bob.ID, trip.ID); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := services.Groups.CreateGroup(ctx, alice.ID, service.CreateGroupInput{Name: "flat", ChatID: flatChat}); err != nil {
+				t.Fatal(err)
+			}
+			expense, _, err := services.Expenses.CreateExpense(ctx, alice.ID, service.CreateExpenseInput{
+				GroupID:     trip.ID,
+				Description: "dinner",
+				Amount:      money.New(2000, eur),
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			chatType := models.ChatTypeGroup
+			if tt.chatID == privateChat {
+				chatType = models.ChatTypePrivate
+			}
+			update := &models.Update{Message: &models.Message{
+				Text: fmt.Sprintf(tt.text, expense.ID),
+				From: &models.User{ID: 1, Username: "alice"},
+				Chat: models.Chat{ID: tt.chatID, Type: chatType},
+			}}
+			if strings.HasPrefix(tt.text, "/edit_expense") {
+				h.HandleEditExpense(ctx, b, update)
+			} else {
+				h.HandleDeleteExpense(ctx, b, update)
+			}
+
+			stored, err := store.GetExpense(ctx, expense.ID)
+			changed := err != nil || stored.Amount != expense.Amount
+			if changed != tt.wantChanged {
+				t.Errorf("expense changed = %v, want %v", changed, tt.wantChanged)
+			}
+
+			// The change is announced to the trip's chat and nowhere else
+			announced := len(api.messages(tripChat)) > 0
+			if announced != tt.wantChanged {
+				t.Errorf("trip chat messages = %q, want an announcement: %v", api.messages(tripChat), tt.wantChanged)
+			}
+			if tt.chatID != tripChat {
+				replies := api.messages(tt.chatID)
+				if len(replies) != 1 || replies[0] != messages.For("en").T("error.not_found") {
+					t.Errorf("replies = %q, want the expense not to be found", replies)
+				}
+			}
+		})
+	}
+}
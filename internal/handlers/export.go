@@ -0,0 +1,89 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/export"
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/service"
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/pkg/logger"
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+)
+
+// HandleExport handles the /export [csv|json] [from] [to] command by sending
+// the group's expenses, shares and settlements as a document
+func (h *CommandHandler) HandleExport(ctx context.Context, b *bot.Bot, update *models.Update) {
+	h.logger.InfoContext(ctx, "Received /export command",
+		logger.Int64("user_id", update.Message.From.ID),
+		logger.Int64("chat_id", update.Message.Chat.ID),
+	)
+
+	chatID := update.Message.Chat.ID
+	loc := h.localizer(ctx)
+
+	args := strings.Fields(commandArgs(update.Message.Text))
+	format := export.FormatCSV
+	if len(args) > 0 && (strings.EqualFold(args[0], export.FormatCSV) || strings.EqualFold(args[0], export.FormatJSON)) {
+		format, args = strings.ToLower(args[0]), args[1:]
+	}
+	if len(args) > 2 {
+		h.reply(ctx, b, chatID, loc.T("export.usage"))
+		return
+	}
+	var from, to string
+	if len(args) > 0 {
+		from = args[0]
+	}
+	if len(args) > 1 {
+		to = args[1]
+	}
+	period, err := service.ParseExportRange(from, to)
+	if err != nil {
+		h.reply(ctx, b, chatID, loc.T("export.usage"))
+		return
+	}
+
+	actor, err := h.actor(ctx, update.Message.From)
+	if err != nil {
+		h.replyError(ctx, b, chatID, err)
+		return
+	}
+
+	group, err := h.chatGroup(ctx, update.Message.Chat)
+	if err != nil {
+		h.replyError(ctx, b, chatID, err)
+		return
+	}
+
+	// The export is piped into the upload so it is never held in memory
+	pr, pw := io.Pipe()
+	exported := make(chan error, 1)
+	go func() {
+		enc, err := export.NewEncoder(format, pw)
+		if err == nil {
+			err = h.services.Export.Export(ctx, actor.ID, group.ID, period, enc)
+		}
+		pw.CloseWithError(err)
+		exported <- err
+	}()
+
+	_, sendErr := b.SendDocument(ctx, &bot.SendDocumentParams{
+		ChatID:   chatID,
+		Document: &models.InputFileUpload{Filename: export.FileName(group.ID, format), Data: pr},
+		Caption:  loc.T("export.caption", group.Name),
+	})
+	// Unblock the export if the upload stopped reading early
+	pr.Close()
+
+	if err := <-exported; err != nil && !errors.Is(err, io.ErrClosedPipe) {
+		h.replyError(ctx, b, chatID, err)
+		return
+	}
+	if sendErr != nil {
+		h.logger.ErrorContext(ctx, "Failed to send export", logger.Error(sendErr), logger.Int64("chat_id", chatID))
+		h.reply(ctx, b, chatID, loc.T("export.failed"))
+	}
+}
@@ -0,0 +1,123 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/i18n"
+	domain "github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/models"
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/service"
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/pkg/logger"
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+)
+
+// actor resolves the Telegram sender to an application user
+func (h *CommandHandler) actor(ctx context.Context, from *models.User) (*domain.User, error) {
+	if from == nil {
+		return nil, fmt.Errorf("update has no sender")
+	}
+
+	return h.services.Users.EnsureUser(ctx, domain.User{
+		TelegramID:   from.ID,
+		Username:     from.Username,
+		FirstName:    from.FirstName,
+		LastName:     from.LastName,
+		LanguageCode: from.LanguageCode,
+	})
+}
+
+// chatGroup returns the expense group bound to the message's chat
+func (h *CommandHandler) chatGroup(ctx context.Context, chat models.Chat) (*domain.Group, error) {
+	return h.services.Groups.GetGroupByChatID(ctx, chat.ID)
+}
+
+// chatExpense returns an expense of the group bound to the chat. Expenses of
+// other groups are not found, so that changing one from an unrelated chat
+// cannot announce it there.
+func (h *CommandHandler) chatExpense(ctx context.Context, actorID int64, chat models.Chat, expenseID int64) (*domain.Expense, error) {
+	group, err := h.chatGroup(ctx, chat)
+	if err != nil {
+		return nil, err
+	}
+	expense, _, err := h.services.Expenses.GetExpense(ctx, actorID, expenseID)
+	if err != nil {
+		return nil, err
+	}
+	if expense.GroupID != group.ID {
+		return nil, fmt.Errorf("expense %d is not in the chat's group: %w", expenseID, service.ErrNotFound)
+	}
+	return expense, nil
+}
+
+// localizer returns the localizer of the user whose update is being handled
+func (h *CommandHandler) localizer(ctx context.Context) *i18n.Localizer {
+	if l := i18n.FromContext(ctx); l != nil {
+		return l
+	}
+	return h.messages.For(i18n.DefaultLanguage)
+}
+
+// senderLanguage returns the Telegram language code of an update's sender
+func senderLanguage(update *models.Update) string {
+	switch {
+	case update.Message != nil && update.Message.From != nil:
+		return update.Message.From.LanguageCode
+	case update.CallbackQuery != nil:
+		return update.CallbackQuery.From.LanguageCode
+	}
+	return ""
+}
+
+// reply sends a plain text message to a chat
+func (h *CommandHandler) reply(ctx context.Context, b *bot.Bot, chatID int64, text string) {
+	_, err := b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID: chatID,
+		Text:   text,
+	})
+	if err != nil {
+		h.logger.ErrorContext(ctx, "Failed to send message",
+			logger.Error(err),
+			logger.Int64("chat_id", chatID),
+		)
+	}
+}
+
+// replyError translates a service error into a user-facing message
+func (h *CommandHandler) replyError(ctx context.Context, b *bot.Bot, chatID int64, err error) {
+	loc := h.localizer(ctx)
+	var ve *service.ValidationError
+	switch {
+	case errors.As(err, &ve):
+		h.reply(ctx, b, chatID, loc.T("error.invalid", ve.Error()))
+	case errors.Is(err, service.ErrForbidden):
+		h.reply(ctx, b, chatID, loc.T("error.forbidden"))
+	case errors.Is(err, service.ErrNotFound):
+		h.reply(ctx, b, chatID, loc.T("error.not_found"))
+	case errors.Is(err, service.ErrConflict):
+		h.reply(ctx, b, chatID, loc.T("error.conflict"))
+	default:
+		h.logger.ErrorContext(ctx, "Command failed", logger.Error(err), logger.Int64("chat_id", chatID))
+		h.reply(ctx, b, chatID, loc.T("error.internal"))
+	}
+}
+
+// displayName returns a human readable name for a user
+func (h *CommandHandler) displayName(ctx context.Context, userID int64) string {
+	user, err := h.services.Users.GetUser(ctx, userID)
+	if err != nil {
+		return fmt.Sprintf("user #%d", userID)
+	}
+	if user.Username != "" {
+		return "@" + user.Username
+	}
+	return strings.TrimSpace(user.FirstName + " " + user.LastName)
+}
+
+// commandArgs returns the text following the command in a message
+func commandArgs(text string) string {
+	_, args, _ := strings.Cut(strings.TrimSpace(text), " ")
+	return strings.TrimSpace(args)
+}
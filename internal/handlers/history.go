@@ -0,0 +1,111 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/i18n"
+	domain "github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/models"
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/pkg/logger"
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+)
+
+const (
+	defaultHistoryEntries = 10
+	maxHistoryEntries     = 50
+)
+
+// HandleHistory handles the /history command
+func (h *CommandHandler) HandleHistory(ctx context.Context, b *bot.Bot, update *models.Update) {
+	h.logger.InfoContext(ctx, "Received /history command",
+		logger.Int64("user_id", update.Message.From.ID),
+		logger.Int64("chat_id", update.Message.Chat.ID),
+	)
+
+	chatID := update.Message.Chat.ID
+	loc := h.localizer(ctx)
+
+	limit := defaultHistoryEntries
+	if arg := commandArgs(update.Message.Text); arg != "" {
+		n, err := strconv.Atoi(arg)
+		if err != nil || n <= 0 {
+			h.reply(ctx, b, chatID, loc.T("history.usage", maxHistoryEntries))
+			return
+		}
+		limit = min(n, maxHistoryEntries)
+	}
+
+	actor, err := h.actor(ctx, update.Message.From)
+	if err != nil {
+		h.replyError(ctx, b, chatID, err)
+		return
+	}
+
+	group, err := h.chatGroup(ctx, update.Message.Chat)
+	if err != nil {
+		h.replyError(ctx, b, chatID, err)
+		return
+	}
+
+	history, err := h.services.Audit.History(ctx, actor.ID, group.ID, limit)
+	if err != nil {
+		h.replyError(ctx, b, chatID, err)
+		return
+	}
+	if history.Total == 0 {
+		h.reply(ctx, b, chatID, loc.T("history.empty"))
+		return
+	}
+
+	var sb strings.Builder
+	sb.WriteString(loc.N("history.title", history.Total, loc.Int(len(history.Entries))) + "\n\n")
+	for _, entry := range history.Entries {
+		actorName := loc.T("history.system")
+		if entry.ActorID != 0 {
+			actorName = h.displayName(ctx, entry.ActorID)
+		}
+		fmt.Fprintf(&sb, "%s %s %s (%s)\n",
+			loc.DateTime(entry.CreatedAt.UTC()), actorName, describeAuditEntry(loc, entry), loc.T("history.source."+entry.Source))
+	}
+
+	if history.ChainError != nil {
+		sb.WriteString("\n" + loc.T("history.tampered", history.ChainError.EntryID))
+	} else {
+		sb.WriteString("\n" + loc.T("history.verified"))
+	}
+	h.reply(ctx, b, chatID, sb.String())
+}
+
+// describeAuditEntry returns a short description of an audited change
+func describeAuditEntry(loc *i18n.Localizer, entry domain.AuditEntry) string {
+	text := loc.T("history."+entry.Action, loc.T("history.entity."+entry.EntityType), entry.EntityID)
+
+	snapshot := entry.After
+	if snapshot == nil {
+		snapshot = entry.Before
+	}
+	switch entry.EntityType {
+	case domain.EntityExpense:
+		var expense domain.Expense
+		if json.Unmarshal(snapshot, &expense) == nil {
+			text += fmt.Sprintf(" %q %s", expense.Description, loc.Money(expense.Amount))
+		}
+	case domain.EntityExpenseItem:
+		var item domain.ExpenseItem
+		if json.Unmarshal(snapshot, &item) == nil {
+			text += fmt.Sprintf(" %q %s", item.Name, loc.Money(item.Price))
+		}
+	case domain.EntitySettlement:
+		var before, after domain.Settlement
+		if json.Unmarshal(entry.Before, &before) == nil && json.Unmarshal(entry.After, &after) == nil && before.Status != after.Status {
+			text += fmt.Sprintf(" %s → %s", loc.T("history.status."+before.Status), loc.T("history.status."+after.Status))
+		} else if json.Unmarshal(snapshot, &after) == nil {
+			text += " " + loc.Money(after.Amount)
+		}
+	}
+	return text
+}
@@ -0,0 +1,273 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/importer"
+	domain "github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/models"
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/service"
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/pkg/logger"
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+)
+
+// HandleImport handles a CSV file sent with /import [splitwise|csv] [column=name...]
+// as its caption. The people in the file are matched to members one at a
+// time before a preview of the resulting balances is shown for confirmation.
+func (h *CommandHandler) HandleImport(ctx context.Context, b *bot.Bot, update *models.Update) {
+	h.logger.InfoContext(ctx, "Received /import command",
+		logger.Int64("user_id", update.Message.From.ID),
+		logger.Int64("chat_id", update.Message.Chat.ID),
+	)
+
+	chatID := update.Message.Chat.ID
+	loc := h.localizer(ctx)
+
+	document := update.Message.Document
+	if document == nil {
+		h.reply(ctx, b, chatID, loc.T("import.usage"))
+		return
+	}
+
+	args := strings.Fields(commandArgs(update.Message.Caption))
+	in := service.StartImportInput{Source: domain.ImportSplitwise}
+	if len(args) > 0 && (args[0] == domain.ImportSplitwise || args[0] == domain.ImportCSV) {
+		in.Source, args = args[0], args[1:]
+	}
+	if in.Source == domain.ImportCSV {
+		mapping, err := importer.ParseMapping(args)
+		if err != nil {
+			h.reply(ctx, b, chatID, loc.T("import.usage"))
+			return
+		}
+		in.Mapping = mapping
+	} else if len(args) > 0 {
+		h.reply(ctx, b, chatID, loc.T("import.usage"))
+		return
+	}
+
+	actor, err := h.actor(ctx, update.Message.From)
+	if err != nil {
+		h.replyError(ctx, b, chatID, err)
+		return
+	}
+
+	group, err := h.chatGroup(ctx, update.Message.Chat)
+	if err != nil {
+		h.replyError(ctx, b, chatID, err)
+		return
+	}
+	in.GroupID = group.ID
+
+	file, err := h.download(ctx, b, document.FileID)
+	if err != nil {
+		h.logger.ErrorContext(ctx, "Failed to download import file", logger.Error(err))
+		h.reply(ctx, b, chatID, loc.T("import.download_failed"))
+		return
+	}
+	defer file.Close()
+	in.File = file
+
+	imp, err := h.services.Imports.Start(ctx, actor.ID, in)
+	if err != nil {
+		h.replyError(ctx, b, chatID, err)
+		return
+	}
+
+	text, keyboard, err := h.importStep(ctx, actor.ID, imp)
+	if err != nil {
+		h.replyError(ctx, b, chatID, err)
+		return
+	}
+	_, err = b.SendMessage(ctx, &bot.SendMessageParams{ChatID: chatID, Text: text, ReplyMarkup: keyboard})
+	if err != nil {
+		h.logger.ErrorContext(ctx, "Failed to send import message", logger.Error(err))
+	}
+}
+
+// importStep renders the next step of a pending import: matching the next
+// unmatched person, or the preview of the import once everybody is matched
+func (h *CommandHandler) importStep(ctx context.Context, actorID int64, imp *domain.Import) (string, *models.InlineKeyboardMarkup, error) {
+	loc := h.localizer(ctx)
+	cancel := []models.InlineKeyboardButton{{
+		Text:         loc.T("import.cancel_button"),
+		CallbackData: fmt.Sprintf("%s%d", importCancelPrefix, imp.ID),
+	}}
+
+	if n := imp.Unmatched(); n >= 0 {
+		members, err := h.services.Groups.Members(ctx, actorID, imp.GroupID)
+		if err != nil {
+			return "", nil, err
+		}
+		keyboard := make([][]models.InlineKeyboardButton, 0, len(members)+1)
+		for _, m := range members {
+			keyboard = append(keyboard, []models.InlineKeyboardButton{{
+				Text:         h.displayName(ctx, m.UserID),
+				CallbackData: fmt.Sprintf("%s%d:%d:%d", importMatchPrefix, imp.ID, n, m.UserID),
+			}})
+		}
+		keyboard = append(keyboard, cancel)
+		text := loc.T("import.match", n+1, len(imp.People), imp.People[n])
+		return text, &models.InlineKeyboardMarkup{InlineKeyboard: keyboard}, nil
+	}
+
+	result, err := h.services.Imports.Preview(ctx, actorID, imp.ID)
+	if err != nil {
+		return "", nil, err
+	}
+
+	var sb strings.Builder
+	sb.WriteString(loc.N("import.preview", result.Expenses) + "\n\n")
+	for i, person := range imp.People {
+		fmt.Fprintf(&sb, "%s → %s\n", person, h.displayName(ctx, imp.Matches[i]))
+	}
+	sb.WriteString("\n" + loc.T("import.balances") + "\n")
+	userIDs := make([]int64, 0, len(result.Balances))
+	for userID, balance := range result.Balances {
+		if !balance.IsZero() {
+			userIDs = append(userIDs, userID)
+		}
+	}
+	sort.Slice(userIDs, func(i, j int) bool {
+		return result.Balances[userIDs[i]].Amount() > result.Balances[userIDs[j]].Amount()
+	})
+	for _, userID := range userIDs {
+		icon := "🟢"
+		if result.Balances[userID].IsNegative() {
+			icon = "🔴"
+		}
+		fmt.Fprintf(&sb, "%s %s: %s\n", icon, h.displayName(ctx, userID), loc.Money(result.Balances[userID]))
+	}
+
+	keyboard := [][]models.InlineKeyboardButton{{{
+		Text:         loc.T("import.commit_button"),
+		CallbackData: fmt.Sprintf("%s%d", importCommitPrefix, imp.ID),
+	}}, cancel}
+	return sb.String(), &models.InlineKeyboardMarkup{InlineKeyboard: keyboard}, nil
+}
+
+// HandleImportMatch handles the member buttons matching a person of an import
+func (h *CommandHandler) HandleImportMatch(ctx context.Context, b *bot.Bot, update *models.Update) {
+	query := update.CallbackQuery
+	h.logger.InfoContext(ctx, "Received import match callback",
+		logger.Int64("user_id", query.From.ID),
+		logger.String("data", query.Data),
+	)
+
+	loc := h.localizer(ctx)
+	var importID, userID int64
+	var person int
+	parts := strings.Split(strings.TrimPrefix(query.Data, importMatchPrefix), ":")
+	ok := len(parts) == 3
+	if ok {
+		var errs [3]error
+		importID, errs[0] = strconv.ParseInt(parts[0], 10, 64)
+		person, errs[1] = strconv.Atoi(parts[1])
+		userID, errs[2] = strconv.ParseInt(parts[2], 10, 64)
+		ok = errs[0] == nil && errs[1] == nil && errs[2] == nil
+	}
+	if !ok {
+		h.answer(ctx, b, query.ID, loc.T("callback.invalid_button"))
+		return
+	}
+
+	actor, err := h.actor(ctx, &query.From)
+	if err != nil {
+		h.logger.ErrorContext(ctx, "Failed to resolve user", logger.Error(err))
+		h.answer(ctx, b, query.ID, loc.T("callback.failed"))
+		return
+	}
+
+	imp, err := h.services.Imports.Match(ctx, actor.ID, importID, person, userID)
+	if err != nil {
+		h.answerError(ctx, b, query.ID, err)
+		return
+	}
+	text, keyboard, err := h.importStep(ctx, actor.ID, imp)
+	if err != nil {
+		h.answerError(ctx, b, query.ID, err)
+		return
+	}
+	h.answer(ctx, b, query.ID, loc.T("import.matched", imp.People[person], h.displayName(ctx, userID)))
+	h.editImportMessage(ctx, b, query, text, keyboard)
+}
+
+// HandleImportCommit handles the button confirming an import
+func (h *CommandHandler) HandleImportCommit(ctx context.Context, b *bot.Bot, update *models.Update) {
+	query := update.CallbackQuery
+	h.logger.InfoContext(ctx, "Received import commit callback",
+		logger.Int64("user_id", query.From.ID),
+		logger.String("data", query.Data),
+	)
+
+	loc := h.localizer(ctx)
+	importID, err := strconv.ParseInt(strings.TrimPrefix(query.Data, importCommitPrefix), 10, 64)
+	if err != nil {
+		h.answer(ctx, b, query.ID, loc.T("callback.invalid_button"))
+		return
+	}
+
+	actor, err := h.actor(ctx, &query.From)
+	if err != nil {
+		h.logger.ErrorContext(ctx, "Failed to resolve user", logger.Error(err))
+		h.answer(ctx, b, query.ID, loc.T("callback.failed"))
+		return
+	}
+
+	result, err := h.services.Imports.Commit(ctx, actor.ID, importID)
+	if err != nil {
+		h.answerError(ctx, b, query.ID, err)
+		return
+	}
+	h.answer(ctx, b, query.ID, "")
+	h.editImportMessage(ctx, b, query, loc.N("import.done", result.Expenses), nil)
+}
+
+// HandleImportCancel handles the button discarding an import
+func (h *CommandHandler) HandleImportCancel(ctx context.Context, b *bot.Bot, update *models.Update) {
+	query := update.CallbackQuery
+	h.logger.InfoContext(ctx, "Received import cancel callback",
+		logger.Int64("user_id", query.From.ID),
+		logger.String("data", query.Data),
+	)
+
+	loc := h.localizer(ctx)
+	importID, err := strconv.ParseInt(strings.TrimPrefix(query.Data, importCancelPrefix), 10, 64)
+	if err != nil {
+		h.answer(ctx, b, query.ID, loc.T("callback.invalid_button"))
+		return
+	}
+
+	actor, err := h.actor(ctx, &query.From)
+	if err != nil {
+		h.logger.ErrorContext(ctx, "Failed to resolve user", logger.Error(err))
+		h.answer(ctx, b, query.ID, loc.T("callback.failed"))
+		return
+	}
+
+	if err := h.services.Imports.Cancel(ctx, actor.ID, importID); err != nil {
+		h.answerError(ctx, b, query.ID, err)
+		return
+	}
+	h.answer(ctx, b, query.ID, "")
+	h.editImportMessage(ctx, b, query, loc.T("import.cancelled"), nil)
+}
+
+// editImportMessage replaces the import message a button belongs to
+func (h *CommandHandler) editImportMessage(ctx context.Context, b *bot.Bot, query *models.CallbackQuery, text string, keyboard *models.InlineKeyboardMarkup) {
+	msg := query.Message.Message
+	if msg == nil {
+		return
+	}
+	params := &bot.EditMessageTextParams{ChatID: msg.Chat.ID, MessageID: msg.ID, Text: text}
+	if keyboard != nil {
+		params.ReplyMarkup = keyboard
+	}
+	if _, err := b.EditMessageText(ctx, params); err != nil {
+		h.logger.ErrorContext(ctx, "Failed to update import message", logger.Error(err))
+	}
+}
@@ -0,0 +1,157 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/i18n"
+	domain "github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/models"
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/service"
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/pkg/logger"
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+)
+
+// HandleItemClaim handles the "I had this" button of an expense item
+func (h *CommandHandler) HandleItemClaim(ctx context.Context, b *bot.Bot, update *models.Update) {
+	query := update.CallbackQuery
+	h.logger.InfoContext(ctx, "Received item claim callback",
+		logger.Int64("user_id", query.From.ID),
+		logger.String("data", query.Data),
+	)
+
+	loc := h.localizer(ctx)
+	itemID, err := strconv.ParseInt(strings.TrimPrefix(query.Data, itemClaimPrefix), 10, 64)
+	if err != nil {
+		h.answer(ctx, b, query.ID, loc.T("callback.invalid_button"))
+		return
+	}
+
+	actor, err := h.actor(ctx, &query.From)
+	if err != nil {
+		h.logger.ErrorContext(ctx, "Failed to resolve user", logger.Error(err))
+		h.answer(ctx, b, query.ID, loc.T("callback.failed"))
+		return
+	}
+
+	claim, err := h.services.Expenses.ToggleItemClaim(ctx, actor.ID, itemID)
+	if err != nil {
+		h.answerError(ctx, b, query.ID, err)
+		return
+	}
+	if claim.Claimed {
+		h.answer(ctx, b, query.ID, loc.T("items.claimed", claim.Item.Name))
+	} else {
+		h.answer(ctx, b, query.ID, loc.T("items.unclaimed", claim.Item.Name))
+	}
+
+	// Show the new split in the message the button belongs to
+	msg := query.Message.Message
+	if msg == nil {
+		return
+	}
+	expense, items, participants, err := h.services.Expenses.GetExpenseItems(ctx, actor.ID, claim.Item.ExpenseID)
+	if err != nil {
+		h.logger.ErrorContext(ctx, "Failed to get expense items", logger.Error(err))
+		return
+	}
+	_, err = b.EditMessageText(ctx, &bot.EditMessageTextParams{
+		ChatID:      msg.Chat.ID,
+		MessageID:   msg.ID,
+		Text:        h.expenseSummary(ctx, expense, participants, h.describeItems(ctx, expense, items)),
+		ReplyMarkup: itemsKeyboard(loc, expense.ID, items),
+	})
+	if err != nil {
+		h.logger.ErrorContext(ctx, "Failed to update itemized expense message", logger.Error(err))
+	}
+}
+
+// SendItemClaimReminder asks a group to claim the items of an expense nobody
+// claimed yet, in the language of whoever added the expense
+func (h *CommandHandler) SendItemClaimReminder(ctx context.Context, b *bot.Bot, due service.UnclaimedItems) {
+	if due.Group.ChatID == 0 {
+		return
+	}
+
+	loc := h.messages.For(i18n.DefaultLanguage)
+	if creator, err := h.services.Users.GetUser(ctx, due.Expense.CreatedBy); err == nil {
+		loc = h.messages.For(creator.LanguageCode)
+	}
+
+	var sb strings.Builder
+	sb.WriteString(loc.N("items.reminder", len(due.Items), due.Expense.ID, due.Expense.Description) + "\n\n")
+	for _, item := range due.Items {
+		sb.WriteString(describeItem(loc, item) + "\n")
+	}
+
+	_, err := b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID:      due.Group.ChatID,
+		Text:        sb.String(),
+		ReplyMarkup: itemsKeyboard(loc, 0, due.Items),
+	})
+	if err != nil {
+		h.logger.ErrorContext(ctx, "Failed to send item claim reminder",
+			logger.Error(err),
+			logger.Int64("expense_id", due.Expense.ID),
+		)
+	}
+}
+
+// describeItems lists the items of an expense with who had them, followed by
+// the charges such as tax and tip that are split proportionally
+func (h *CommandHandler) describeItems(ctx context.Context, expense *domain.Expense, items []domain.ExpenseItem) string {
+	loc := h.localizer(ctx)
+
+	var sb strings.Builder
+	sb.WriteString(loc.N("items.title", len(items)) + "\n")
+	// Whatever the items do not add up to is charged on top of them
+	extras, ok := expense.Amount, true
+	for _, item := range items {
+		sb.WriteString(describeItem(loc, item))
+		if len(item.ClaimedBy) == 0 {
+			sb.WriteString(" — " + loc.T("items.nobody"))
+		} else {
+			names := make([]string, len(item.ClaimedBy))
+			for i, userID := range item.ClaimedBy {
+				names[i] = h.displayName(ctx, userID)
+			}
+			sb.WriteString(" — " + strings.Join(names, ", "))
+		}
+		sb.WriteString("\n")
+		if rest, err := extras.Sub(item.Price); err == nil {
+			extras = rest
+		} else {
+			ok = false
+		}
+	}
+	if ok && !extras.IsZero() {
+		sb.WriteString(loc.T("items.extras", loc.Money(extras)) + "\n")
+	}
+	return sb.String()
+}
+
+// describeItem returns an item's quantity, name and price
+func describeItem(loc *i18n.Localizer, item domain.ExpenseItem) string {
+	if item.Quantity > 1 {
+		return fmt.Sprintf("• %d× %s: %s", item.Quantity, item.Name, loc.Money(item.Price))
+	}
+	return fmt.Sprintf("• %s: %s", item.Name, loc.Money(item.Price))
+}
+
+// itemsKeyboard returns an "I had this" button per item, followed by the
+// expense buttons unless expenseID is zero
+func itemsKeyboard(loc *i18n.Localizer, expenseID int64, items []domain.ExpenseItem) *models.InlineKeyboardMarkup {
+	keyboard := make([][]models.InlineKeyboardButton, 0, len(items)+1)
+	for _, item := range items {
+		keyboard = append(keyboard, []models.InlineKeyboardButton{{
+			Text:         loc.T("items.claim_button", item.Name),
+			CallbackData: fmt.Sprintf("%s%d", itemClaimPrefix, item.ID),
+		}})
+	}
+	if expenseID != 0 {
+		keyboard = append(keyboard, expenseKeyboard(loc, expenseID).InlineKeyboard...)
+	}
+	return &models.InlineKeyboardMarkup{InlineKeyboard: keyboard}
+}
@@ -0,0 +1,319 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/currency"
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/i18n"
+	domain "github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/models"
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/service"
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/pkg/logger"
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+)
+
+// maxDownloadSize is the largest receipt photo or import file downloaded, in bytes
+const maxDownloadSize = 10 << 20
+
+// HandleReceipt handles a photo sent with /add_expense [currency] [description]
+// as its caption by reading the receipt and showing what was read to its
+// sender, who confirms or corrects it before it is added as an expense
+func (h *CommandHandler) HandleReceipt(ctx context.Context, b *bot.Bot, update *models.Update) {
+	h.logger.InfoContext(ctx, "Received receipt photo",
+		logger.Int64("user_id", update.Message.From.ID),
+		logger.Int64("chat_id", update.Message.Chat.ID),
+	)
+
+	chatID := update.Message.Chat.ID
+	loc := h.localizer(ctx)
+
+	photos := update.Message.Photo
+	if len(photos) == 0 {
+		h.reply(ctx, b, chatID, loc.T("expense.add_usage"))
+		return
+	}
+
+	actor, err := h.actor(ctx, update.Message.From)
+	if err != nil {
+		h.replyError(ctx, b, chatID, err)
+		return
+	}
+
+	group, err := h.chatGroup(ctx, update.Message.Chat)
+	if err != nil {
+		h.replyError(ctx, b, chatID, err)
+		return
+	}
+
+	// An optional upper case ISO 4217 code may precede the description
+	in := service.StartReceiptInput{GroupID: group.ID, Description: commandArgs(update.Message.Caption)}
+	if first, rest, _ := strings.Cut(in.Description, " "); first != "" && first == strings.ToUpper(first) && currency.IsValid(first) {
+		in.Currency, in.Description = first, strings.TrimSpace(rest)
+	}
+	if in.Description == "" {
+		in.Description = loc.T("receipt.description")
+	}
+
+	// Telegram sends several sizes of a photo, the largest last
+	photo, err := h.download(ctx, b, photos[len(photos)-1].FileID)
+	if err != nil {
+		h.logger.ErrorContext(ctx, "Failed to download receipt photo", logger.Error(err))
+		h.reply(ctx, b, chatID, loc.T("receipt.download_failed"))
+		return
+	}
+	defer photo.Close()
+	in.Image = photo
+
+	pending, err := h.services.Receipts.Start(ctx, actor.ID, in)
+	if err != nil {
+		h.replyError(ctx, b, chatID, err)
+		return
+	}
+
+	_, err = b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID:      chatID,
+		Text:        describeReceipt(loc, pending),
+		ReplyMarkup: receiptKeyboard(loc, pending),
+	})
+	if err != nil {
+		h.logger.ErrorContext(ctx, "Failed to send receipt message", logger.Error(err))
+	}
+}
+
+// describeReceipt lists what was read from a pending receipt, warning if the
+// items do not add up to the total
+func describeReceipt(loc *i18n.Localizer, pending *domain.Receipt) string {
+	var sb strings.Builder
+	sb.WriteString(loc.T("receipt.check", pending.Description) + "\n\n")
+	for _, item := range pending.Items {
+		line := describeItem(loc, domain.ExpenseItem{Name: item.Name, Quantity: item.Quantity, Price: item.Price})
+		if item.Excluded {
+			line += " — " + loc.T("receipt.excluded")
+		}
+		sb.WriteString(line + "\n")
+	}
+	if !pending.Tax.IsZero() {
+		sb.WriteString(loc.T("receipt.tax", loc.Money(pending.Tax)) + "\n")
+	}
+	if !pending.Tip.IsZero() {
+		sb.WriteString(loc.T("receipt.tip", loc.Money(pending.Tip)) + "\n")
+	}
+	sb.WriteString(loc.T("receipt.total", loc.Money(pending.Total)) + "\n")
+	if pending.Mismatch() {
+		sb.WriteString("\n" + loc.T("receipt.mismatch", loc.Money(pending.Charges()), loc.Money(pending.Total)) + "\n")
+	}
+	return sb.String()
+}
+
+// receiptKeyboard returns a button per item of a pending receipt leaving it
+// out or keeping it, followed by the confirm button, or the button using the
+// items' sum as the total while they do not add up to it
+func receiptKeyboard(loc *i18n.Localizer, pending *domain.Receipt) *models.InlineKeyboardMarkup {
+	keyboard := make([][]models.InlineKeyboardButton, 0, len(pending.Items)+2)
+	for i, item := range pending.Items {
+		text := loc.T("receipt.exclude_button", item.Name)
+		if item.Excluded {
+			text = loc.T("receipt.include_button", item.Name)
+		}
+		keyboard = append(keyboard, []models.InlineKeyboardButton{{
+			Text:         text,
+			CallbackData: fmt.Sprintf("%s%d:%d", receiptItemPrefix, pending.ID, i),
+		}})
+	}
+	if pending.Mismatch() {
+		keyboard = append(keyboard, []models.InlineKeyboardButton{{
+			Text:         loc.T("receipt.use_charges_button", loc.Money(pending.Charges())),
+			CallbackData: fmt.Sprintf("%s%d", receiptTotalPrefix, pending.ID),
+		}})
+	} else {
+		keyboard = append(keyboard, []models.InlineKeyboardButton{{
+			Text:         loc.T("receipt.confirm_button"),
+			CallbackData: fmt.Sprintf("%s%d", receiptConfirmPrefix, pending.ID),
+		}})
+	}
+	keyboard = append(keyboard, []models.InlineKeyboardButton{{
+		Text:         loc.T("receipt.cancel_button"),
+		CallbackData: fmt.Sprintf("%s%d", receiptCancelPrefix, pending.ID),
+	}})
+	return &models.InlineKeyboardMarkup{InlineKeyboard: keyboard}
+}
+
+// HandleReceiptItem handles the buttons leaving an item of a pending receipt
+// out of the expense or keeping it
+func (h *CommandHandler) HandleReceiptItem(ctx context.Context, b *bot.Bot, update *models.Update) {
+	query := update.CallbackQuery
+	h.logger.InfoContext(ctx, "Received receipt item callback",
+		logger.Int64("user_id", query.From.ID),
+		logger.String("data", query.Data),
+	)
+
+	loc := h.localizer(ctx)
+	id, index, ok := strings.Cut(strings.TrimPrefix(query.Data, receiptItemPrefix), ":")
+	receiptID, err := strconv.ParseInt(id, 10, 64)
+	n, nErr := strconv.Atoi(index)
+	if !ok || err != nil || nErr != nil {
+		h.answer(ctx, b, query.ID, loc.T("callback.invalid_button"))
+		return
+	}
+
+	actor, err := h.actor(ctx, &query.From)
+	if err != nil {
+		h.logger.ErrorContext(ctx, "Failed to resolve user", logger.Error(err))
+		h.answer(ctx, b, query.ID, loc.T("callback.failed"))
+		return
+	}
+
+	pending, err := h.services.Receipts.ToggleItem(ctx, actor.ID, receiptID, n)
+	if err != nil {
+		h.answerError(ctx, b, query.ID, err)
+		return
+	}
+	h.answer(ctx, b, query.ID, "")
+	h.editReceiptMessage(ctx, b, query, describeReceipt(loc, pending), receiptKeyboard(loc, pending))
+}
+
+// HandleReceiptTotal handles the button using the sum of a pending receipt's
+// items, tax and tip as its total
+func (h *CommandHandler) HandleReceiptTotal(ctx context.Context, b *bot.Bot, update *models.Update) {
+	query := update.CallbackQuery
+	h.logger.InfoContext(ctx, "Received receipt total callback",
+		logger.Int64("user_id", query.From.ID),
+		logger.String("data", query.Data),
+	)
+
+	loc := h.localizer(ctx)
+	receiptID, err := strconv.ParseInt(strings.TrimPrefix(query.Data, receiptTotalPrefix), 10, 64)
+	if err != nil {
+		h.answer(ctx, b, query.ID, loc.T("callback.invalid_button"))
+		return
+	}
+
+	actor, err := h.actor(ctx, &query.From)
+	if err != nil {
+		h.logger.ErrorContext(ctx, "Failed to resolve user", logger.Error(err))
+		h.answer(ctx, b, query.ID, loc.T("callback.failed"))
+		return
+	}
+
+	pending, err := h.services.Receipts.UseCharges(ctx, actor.ID, receiptID)
+	if err != nil {
+		h.answerError(ctx, b, query.ID, err)
+		return
+	}
+	h.answer(ctx, b, query.ID, "")
+	h.editReceiptMessage(ctx, b, query, describeReceipt(loc, pending), receiptKeyboard(loc, pending))
+}
+
+// HandleReceiptConfirm handles the button adding a pending receipt as an expense
+func (h *CommandHandler) HandleReceiptConfirm(ctx context.Context, b *bot.Bot, update *models.Update) {
+	query := update.CallbackQuery
+	h.logger.InfoContext(ctx, "Received receipt confirm callback",
+		logger.Int64("user_id", query.From.ID),
+		logger.String("data", query.Data),
+	)
+
+	loc := h.localizer(ctx)
+	receiptID, err := strconv.ParseInt(strings.TrimPrefix(query.Data, receiptConfirmPrefix), 10, 64)
+	if err != nil {
+		h.answer(ctx, b, query.ID, loc.T("callback.invalid_button"))
+		return
+	}
+
+	actor, err := h.actor(ctx, &query.From)
+	if err != nil {
+		h.logger.ErrorContext(ctx, "Failed to resolve user", logger.Error(err))
+		h.answer(ctx, b, query.ID, loc.T("callback.failed"))
+		return
+	}
+
+	expense, _, err := h.services.Receipts.Confirm(ctx, actor.ID, receiptID)
+	if err != nil {
+		h.answerError(ctx, b, query.ID, err)
+		return
+	}
+	h.answer(ctx, b, query.ID, "")
+
+	_, items, participants, err := h.services.Expenses.GetExpenseItems(ctx, actor.ID, expense.ID)
+	if err != nil {
+		h.logger.ErrorContext(ctx, "Failed to get expense items", logger.Error(err))
+		return
+	}
+	h.editReceiptMessage(ctx, b, query,
+		h.expenseSummary(ctx, expense, participants, h.describeItems(ctx, expense, items)),
+		itemsKeyboard(loc, expense.ID, items))
+}
+
+// HandleReceiptCancel handles the button discarding a pending receipt
+func (h *CommandHandler) HandleReceiptCancel(ctx context.Context, b *bot.Bot, update *models.Update) {
+	query := update.CallbackQuery
+	h.logger.InfoContext(ctx, "Received receipt cancel callback",
+		logger.Int64("user_id", query.From.ID),
+		logger.String("data", query.Data),
+	)
+
+	loc := h.localizer(ctx)
+	receiptID, err := strconv.ParseInt(strings.TrimPrefix(query.Data, receiptCancelPrefix), 10, 64)
+	if err != nil {
+		h.answer(ctx, b, query.ID, loc.T("callback.invalid_button"))
+		return
+	}
+
+	actor, err := h.actor(ctx, &query.From)
+	if err != nil {
+		h.logger.ErrorContext(ctx, "Failed to resolve user", logger.Error(err))
+		h.answer(ctx, b, query.ID, loc.T("callback.failed"))
+		return
+	}
+
+	if err := h.services.Receipts.Cancel(ctx, actor.ID, receiptID); err != nil {
+		h.answerError(ctx, b, query.ID, err)
+		return
+	}
+	h.answer(ctx, b, query.ID, "")
+	h.editReceiptMessage(ctx, b, query, loc.T("receipt.cancelled"), nil)
+}
+
+// editReceiptMessage replaces the receipt message a button belongs to
+func (h *CommandHandler) editReceiptMessage(ctx context.Context, b *bot.Bot, query *models.CallbackQuery, text string, keyboard *models.InlineKeyboardMarkup) {
+	msg := query.Message.Message
+	if msg == nil {
+		return
+	}
+	params := &bot.EditMessageTextParams{ChatID: msg.Chat.ID, MessageID: msg.ID, Text: text}
+	if keyboard != nil {
+		params.ReplyMarkup = keyboard
+	}
+	if _, err := b.EditMessageText(ctx, params); err != nil {
+		h.logger.ErrorContext(ctx, "Failed to update receipt message", logger.Error(err))
+	}
+}
+
+// download opens a file sent to the bot
+func (h *CommandHandler) download(ctx context.Context, b *bot.Bot, fileID string) (io.ReadCloser, error) {
+	file, err := b.GetFile(ctx, &bot.GetFileParams{FileID: fileID})
+	if err != nil {
+		return nil, fmt.Errorf("get file: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, b.FileDownloadLink(file), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("download file: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("download file: status %s", resp.Status)
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{io.LimitReader(resp.Body, maxDownloadSize), resp.Body}, nil
+}
@@ -0,0 +1,151 @@
+package handlers
+
+import (
+	"context"
+	"strconv"
+	"strings"
+
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/currency"
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/i18n"
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/money"
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/service"
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/pkg/logger"
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+)
+
+// HandleRecurring handles the /recurring command
+func (h *CommandHandler) HandleRecurring(ctx context.Context, b *bot.Bot, update *models.Update) {
+	h.logger.InfoContext(ctx, "Received /recurring command",
+		logger.Int64("user_id", update.Message.From.ID),
+		logger.Int64("chat_id", update.Message.Chat.ID),
+	)
+
+	chatID := update.Message.Chat.ID
+	loc := h.localizer(ctx)
+
+	actor, err := h.actor(ctx, update.Message.From)
+	if err != nil {
+		h.replyError(ctx, b, chatID, err)
+		return
+	}
+
+	group, err := h.chatGroup(ctx, update.Message.Chat)
+	if err != nil {
+		h.replyError(ctx, b, chatID, err)
+		return
+	}
+
+	subcommand, args, _ := strings.Cut(commandArgs(update.Message.Text), " ")
+	args = strings.TrimSpace(args)
+
+	switch subcommand {
+	case "":
+		h.listRecurring(ctx, b, chatID, actor.ID, group.ID)
+	case "add":
+		// <schedule> <amount> [currency] <description>
+		fields := strings.SplitN(args, " ", 3)
+		if len(fields) < 3 {
+			h.reply(ctx, b, chatID, loc.T("recurring.usage"))
+			return
+		}
+		schedule, amountArg, rest := fields[0], fields[1], strings.TrimSpace(fields[2])
+
+		code := group.BaseCurrency
+		if first, description, ok := strings.Cut(rest, " "); ok && first == strings.ToUpper(first) && currency.IsValid(first) {
+			code, rest = first, strings.TrimSpace(description)
+		}
+		cur, err := currency.Lookup(code)
+		if err != nil {
+			h.replyError(ctx, b, chatID, err)
+			return
+		}
+		amount, err := money.Parse(amountArg, cur)
+		if err != nil || rest == "" || !amount.IsPositive() {
+			h.reply(ctx, b, chatID, loc.T("recurring.usage"))
+			return
+		}
+
+		recurring, err := h.services.Recurring.Create(ctx, actor.ID, service.CreateRecurringInput{
+			GroupID:     group.ID,
+			Description: rest,
+			Amount:      amount,
+			Rule:        schedule,
+		})
+		if err != nil {
+			h.replyError(ctx, b, chatID, err)
+			return
+		}
+		h.reply(ctx, b, chatID, loc.T("recurring.created",
+			recurring.ID, loc.Money(recurring.Amount), h.displayName(ctx, recurring.PaidBy),
+			recurring.Description, recurring.Rule, loc.Date(recurring.NextRunAt)))
+	case "cancel":
+		recurringID, err := strconv.ParseInt(args, 10, 64)
+		if err != nil {
+			h.reply(ctx, b, chatID, loc.T("recurring.usage"))
+			return
+		}
+		recurring, err := h.services.Recurring.Cancel(ctx, actor.ID, recurringID)
+		if err != nil {
+			h.replyError(ctx, b, chatID, err)
+			return
+		}
+		h.reply(ctx, b, chatID, loc.T("recurring.cancelled", recurring.ID, recurring.Description))
+	default:
+		h.reply(ctx, b, chatID, loc.T("recurring.usage"))
+	}
+}
+
+// listRecurring replies with the recurring expenses of a group
+func (h *CommandHandler) listRecurring(ctx context.Context, b *bot.Bot, chatID, actorID, groupID int64) {
+	recurring, err := h.services.Recurring.List(ctx, actorID, groupID)
+	if err != nil {
+		h.replyError(ctx, b, chatID, err)
+		return
+	}
+
+	loc := h.localizer(ctx)
+	var sb strings.Builder
+	for _, r := range recurring {
+		if !r.Active {
+			continue
+		}
+		sb.WriteString(loc.T("recurring.item", r.ID, r.Description, loc.Money(r.Amount), r.Rule, loc.Date(r.NextRunAt)) + "\n")
+	}
+	if sb.Len() == 0 {
+		h.reply(ctx, b, chatID, loc.T("recurring.empty")+"\n\n"+loc.T("recurring.usage"))
+		return
+	}
+	h.reply(ctx, b, chatID, loc.T("recurring.title")+"\n\n"+sb.String())
+}
+
+// NotifyRecurringRuns tells groups about expenses created from their
+// recurring expenses and about recurring expenses that were stopped, in the
+// language of whoever set up the recurring expense
+func (h *CommandHandler) NotifyRecurringRuns(ctx context.Context, b *bot.Bot, runs []service.RecurringRun) {
+	for _, run := range runs {
+		if run.Group.ChatID == 0 {
+			continue
+		}
+
+		loc := h.messages.For(i18n.DefaultLanguage)
+		if creator, err := h.services.Users.GetUser(ctx, run.Recurring.CreatedBy); err == nil {
+			loc = h.messages.For(creator.LanguageCode)
+		}
+
+		var sb strings.Builder
+		for _, expense := range run.Expenses {
+			sb.WriteString(loc.T("recurring.expense_added",
+				expense.ID, h.displayName(ctx, expense.PaidBy), loc.Money(expense.Amount), expense.Description, run.Recurring.ID) + "\n")
+		}
+		if run.Stopped != nil {
+			sb.WriteString(loc.T("recurring.stopped", run.Recurring.ID, run.Recurring.Description, run.Stopped) + "\n")
+		} else if !run.Recurring.Active {
+			sb.WriteString(loc.T("recurring.ended", run.Recurring.ID, run.Recurring.Description) + "\n")
+		}
+		if sb.Len() == 0 {
+			continue
+		}
+		h.reply(ctx, b, run.Group.ChatID, sb.String())
+	}
+}
@@ -0,0 +1,102 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	domain "github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/models"
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/service"
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/pkg/logger"
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+)
+
+// SendReminder sends a payment reminder to the debtor of a pending settlement
+// in their language, with a button to mark the settlement as paid
+func (h *CommandHandler) SendReminder(ctx context.Context, b *bot.Bot, due service.DueReminder) {
+	loc := h.messages.For(due.Debtor.LanguageCode)
+
+	key := "reminder.gentle"
+	if due.Level >= domain.ReminderFirm {
+		key = "reminder.firm"
+	}
+	since := loc.Date(due.Settlement.CreatedAt.In(service.Location(&due.Debtor)))
+	message := loc.T(key, loc.Money(due.Settlement.Amount), h.displayName(ctx, due.Creditor.ID), due.Group.Name, since)
+
+	// Private chats with a user share the user's Telegram ID
+	_, err := b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID: due.Debtor.TelegramID,
+		Text:   message + "\n\n" + loc.T("reminder.footer"),
+		ReplyMarkup: &models.InlineKeyboardMarkup{InlineKeyboard: [][]models.InlineKeyboardButton{{
+			{Text: loc.T("settle.paid_button"), CallbackData: fmt.Sprintf("%s%d", settleDonePrefix, due.Settlement.ID)},
+		}}},
+	})
+	if err != nil {
+		// Users who never started a private chat with the bot cannot be messaged
+		h.logger.WarnContext(ctx, "Failed to send payment reminder",
+			logger.Error(err),
+			logger.Int64("user_id", due.Debtor.ID),
+			logger.Int64("settlement_id", due.Settlement.ID),
+		)
+	}
+}
+
+// HandleReminders handles the /reminders command
+func (h *CommandHandler) HandleReminders(ctx context.Context, b *bot.Bot, update *models.Update) {
+	h.logger.InfoContext(ctx, "Received /reminders command",
+		logger.Int64("user_id", update.Message.From.ID),
+		logger.Int64("chat_id", update.Message.Chat.ID),
+	)
+
+	chatID := update.Message.Chat.ID
+	loc := h.localizer(ctx)
+
+	actor, err := h.actor(ctx, update.Message.From)
+	if err != nil {
+		h.replyError(ctx, b, chatID, err)
+		return
+	}
+
+	subcommand, arg, _ := strings.Cut(commandArgs(update.Message.Text), " ")
+	arg = strings.TrimSpace(arg)
+
+	switch subcommand {
+	case "":
+	case "on", "off":
+		actor, err = h.services.Users.SetRemindersOff(ctx, actor.ID, subcommand == "off")
+	case "quiet":
+		start, end := 0, 0
+		if arg != "off" {
+			from, to, ok := strings.Cut(arg, "-")
+			var ferr, terr error
+			start, ferr = strconv.Atoi(strings.TrimSpace(from))
+			end, terr = strconv.Atoi(strings.TrimSpace(to))
+			if !ok || ferr != nil || terr != nil {
+				h.reply(ctx, b, chatID, loc.T("reminders.usage"))
+				return
+			}
+		}
+		actor, err = h.services.Users.SetQuietHours(ctx, actor.ID, start, end)
+	case "timezone":
+		actor, err = h.services.Users.SetTimezone(ctx, actor.ID, arg)
+	default:
+		h.reply(ctx, b, chatID, loc.T("reminders.usage"))
+		return
+	}
+	if err != nil {
+		h.replyError(ctx, b, chatID, err)
+		return
+	}
+
+	status := loc.T("reminders.on")
+	if actor.RemindersOff {
+		status = loc.T("reminders.off")
+	}
+	quiet := loc.T("reminders.quiet_none")
+	if start, end := h.services.Reminders.QuietHours(actor); start != end {
+		quiet = fmt.Sprintf("%02d:00–%02d:00", start, end)
+	}
+	h.reply(ctx, b, chatID, loc.T("reminders.settings", status, quiet, service.Location(actor))+"\n\n"+loc.T("reminders.usage"))
+}
@@ -0,0 +1,24 @@
+package handlers
+
+import (
+	"context"
+	"math"
+	"time"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+)
+
+// NotifyThrottled tells the sender of a throttled command or button press
+// how long to wait before trying again. It runs before the localizer is put
+// in the context, so it picks the language itself.
+func (h *CommandHandler) NotifyThrottled(ctx context.Context, b *bot.Bot, update *models.Update, wait time.Duration) {
+	loc := h.messages.For(senderLanguage(update))
+	text := loc.N("throttle.cooldown", int(math.Ceil(wait.Seconds())))
+	switch {
+	case update.CallbackQuery != nil:
+		h.answer(ctx, b, update.CallbackQuery.ID, text)
+	case update.Message != nil:
+		h.reply(ctx, b, update.Message.Chat.ID, text)
+	}
+}
@@ -0,0 +1,248 @@
+// Package i18n renders user-facing bot messages from translated message
+// catalogs embedded in the binary, with plural rules and locale-aware
+// formatting of numbers, money and dates.
+package i18n
+
+import (
+	"context"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/money"
+)
+
+// DefaultLanguage is the language every other catalog falls back to
+const DefaultLanguage = "en"
+
+//go:embed locales/*.json
+var locales embed.FS
+
+// message is a catalog entry, either a plain text or a set of plural forms.
+// Texts are fmt format strings; plural texts receive the count first.
+type message struct {
+	text   string
+	plural map[PluralCategory]string
+}
+
+func (m *message) UnmarshalJSON(data []byte) error {
+	if err := json.Unmarshal(data, &m.text); err == nil {
+		return nil
+	}
+	if err := json.Unmarshal(data, &m.plural); err != nil {
+		return fmt.Errorf("message must be a string or an object of plural forms")
+	}
+	return nil
+}
+
+// Bundle holds the message catalogs of all languages
+type Bundle struct {
+	catalogs map[string]map[string]message
+}
+
+// Load loads the catalogs embedded in the binary
+func Load() (*Bundle, error) {
+	return LoadFS(locales, "locales")
+}
+
+// LoadFS loads one catalog per <language>.json file in dir
+func LoadFS(fsys fs.FS, dir string) (*Bundle, error) {
+	files, err := fs.Glob(fsys, path.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	b := &Bundle{catalogs: make(map[string]map[string]message, len(files))}
+	for _, file := range files {
+		data, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			return nil, err
+		}
+		var catalog map[string]message
+		if err := json.Unmarshal(data, &catalog); err != nil {
+			return nil, fmt.Errorf("parse %s: %w", file, err)
+		}
+		b.catalogs[strings.TrimSuffix(path.Base(file), ".json")] = catalog
+	}
+	if _, ok := b.catalogs[DefaultLanguage]; !ok {
+		return nil, fmt.Errorf("missing %s catalog", DefaultLanguage)
+	}
+	return b, nil
+}
+
+// MustLoad is like Load but panics if the embedded catalogs are invalid
+func MustLoad() *Bundle {
+	b, err := Load()
+	if err != nil {
+		panic(fmt.Sprintf("i18n: %v", err))
+	}
+	return b
+}
+
+// Languages returns the languages with a catalog
+func (b *Bundle) Languages() []string {
+	langs := make([]string, 0, len(b.catalogs))
+	for lang := range b.catalogs {
+		langs = append(langs, lang)
+	}
+	sort.Strings(langs)
+	return langs
+}
+
+// MissingKeys returns, per language, the keys of the default catalog that
+// the language does not translate, including plural forms its rule needs.
+// Missing keys fall back to English at runtime.
+func (b *Bundle) MissingKeys() map[string][]string {
+	missing := make(map[string][]string)
+	for lang, catalog := range b.catalogs {
+		for key, def := range b.catalogs[DefaultLanguage] {
+			msg, ok := catalog[key]
+			switch {
+			case !ok:
+				missing[lang] = append(missing[lang], key)
+			case def.plural != nil:
+				for _, form := range ruleFor(lang).forms {
+					if _, ok := msg.plural[form]; !ok {
+						missing[lang] = append(missing[lang], key+"."+string(form))
+					}
+				}
+			}
+		}
+		sort.Strings(missing[lang])
+	}
+	return missing
+}
+
+// Validate returns an error listing every missing translation
+func (b *Bundle) Validate() error {
+	missing := b.MissingKeys()
+	if len(missing) == 0 {
+		return nil
+	}
+
+	var problems []string
+	for _, lang := range b.Languages() {
+		if keys := missing[lang]; len(keys) > 0 {
+			problems = append(problems, fmt.Sprintf("%s: %s", lang, strings.Join(keys, ", ")))
+		}
+	}
+	return fmt.Errorf("missing translations: %s", strings.Join(problems, "; "))
+}
+
+// For returns the localizer of a Telegram language code such as "de" or
+// "pt-br". Languages without a catalog use English.
+func (b *Bundle) For(languageCode string) *Localizer {
+	locale := strings.ToLower(languageCode)
+	lang, _, _ := strings.Cut(strings.ReplaceAll(locale, "_", "-"), "-")
+	if _, ok := b.catalogs[lang]; !ok {
+		lang = DefaultLanguage
+	}
+	if locale == "" {
+		locale = DefaultLanguage
+	}
+	return &Localizer{bundle: b, lang: lang, locale: locale}
+}
+
+// Localizer renders messages and values for one user's language
+type Localizer struct {
+	bundle *Bundle
+	lang   string // language of the catalog used
+	locale string // requested locale, used for number formatting
+}
+
+// Language returns the language of the catalog the localizer renders from
+func (l *Localizer) Language() string {
+	return l.lang
+}
+
+// lookup returns a message of the localizer's language or English
+func (l *Localizer) lookup(key string) (message, string, bool) {
+	if msg, ok := l.bundle.catalogs[l.lang][key]; ok {
+		return msg, l.lang, true
+	}
+	msg, ok := l.bundle.catalogs[DefaultLanguage][key]
+	return msg, DefaultLanguage, ok
+}
+
+// T renders a message. Unknown keys render as the key itself.
+func (l *Localizer) T(key string, args ...any) string {
+	msg, _, ok := l.lookup(key)
+	if !ok {
+		return key
+	}
+	if msg.plural != nil {
+		return l.N(key, 1, args...)
+	}
+	if len(args) == 0 {
+		return msg.text
+	}
+	return fmt.Sprintf(msg.text, args...)
+}
+
+// N renders the plural form of a message for count n. The count is passed
+// to the message as its first argument, followed by args.
+func (l *Localizer) N(key string, n int, args ...any) string {
+	msg, lang, ok := l.lookup(key)
+	if !ok {
+		return key
+	}
+	if msg.plural == nil {
+		return fmt.Sprintf(msg.text, append([]any{n}, args...)...)
+	}
+
+	text, ok := msg.plural[ruleFor(lang).choose(n)]
+	if !ok {
+		text = msg.plural[PluralOther]
+	}
+	return fmt.Sprintf(text, append([]any{l.Int(n)}, args...)...)
+}
+
+// Money formats an amount with the locale's separators and currency symbol
+func (l *Localizer) Money(m money.Money) string {
+	return m.Format(l.locale)
+}
+
+// Int formats an integer with the locale's digit grouping
+func (l *Localizer) Int(n int) string {
+	return money.FormatInt(int64(n), l.locale)
+}
+
+// dateLayouts holds the short date layout of languages not using day.month.year
+var dateLayouts = map[string]string{
+	"en": "Jan 2, 2006",
+	"nl": "02-01-2006",
+	"fr": "02/01/2006",
+	"es": "02/01/2006",
+	"it": "02/01/2006",
+}
+
+// Date formats the date of t in the locale's short format
+func (l *Localizer) Date(t time.Time) string {
+	if layout, ok := dateLayouts[l.lang]; ok {
+		return t.Format(layout)
+	}
+	return t.Format("02.01.2006")
+}
+
+// DateTime formats t as a short date followed by a 24-hour time
+func (l *Localizer) DateTime(t time.Time) string {
+	return l.Date(t) + " " + t.Format("15:04")
+}
+
+type localizerKey struct{}
+
+// WithLocalizer returns a context carrying the localizer of the current user
+func WithLocalizer(ctx context.Context, l *Localizer) context.Context {
+	return context.WithValue(ctx, localizerKey{}, l)
+}
+
+// FromContext returns the localizer stored in the context, or nil
+func FromContext(ctx context.Context) *Localizer {
+	l, _ := ctx.Value(localizerKey{}).(*Localizer)
+	return l
+}
@@ -0,0 +1,124 @@
+package i18n
+
+import (
+	"slices"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestCatalogsAreComplete(t *testing.T) {
+	b, err := Load()
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if err := b.Validate(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCatalogFormsMatchPluralRules(t *testing.T) {
+	b, err := Load()
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	for _, lang := range b.Languages() {
+		if _, ok := pluralRules[lang]; !ok {
+			t.Errorf("%s: no plural rule", lang)
+		}
+		forms := ruleFor(lang).forms
+		for key, msg := range b.catalogs[lang] {
+			for form := range msg.plural {
+				if form != PluralOther && !slices.Contains(forms, form) {
+					t.Errorf("%s: %s has form %q the language does not use", lang, key, form)
+				}
+			}
+		}
+	}
+}
+
+func TestPluralRules(t *testing.T) {
+	tests := []struct {
+		lang string
+		want map[int]PluralCategory
+	}{
+		{lang: "en", want: map[int]PluralCategory{0: PluralOther, 1: PluralOne, 2: PluralOther, 11: PluralOther, 21: PluralOther}},
+		{lang: "de", want: map[int]PluralCategory{0: PluralOther, 1: PluralOne, 2: PluralOther, 101: PluralOther}},
+		{lang: "ru", want: map[int]PluralCategory{
+			0: PluralMany, 1: PluralOne, 2: PluralFew, 4: PluralFew, 5: PluralMany,
+			11: PluralMany, 12: PluralMany, 14: PluralMany, 21: PluralOne, 22: PluralFew,
+			25: PluralMany, 101: PluralOne, 111: PluralMany, 112: PluralMany, 122: PluralFew,
+		}},
+		{lang: "fr", want: map[int]PluralCategory{0: PluralOne, 1: PluralOne, 2: PluralOther}},
+		{lang: "pl", want: map[int]PluralCategory{1: PluralOne, 2: PluralFew, 5: PluralMany, 12: PluralMany, 21: PluralMany, 22: PluralFew}},
+		{lang: "xx", want: map[int]PluralCategory{1: PluralOne, 2: PluralOther}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.lang, func(t *testing.T) {
+			rule := ruleFor(tt.lang)
+			for n, want := range tt.want {
+				got := rule.choose(n)
+				if got != want {
+					t.Errorf("choose(%d) = %s, want %s", n, got, want)
+				}
+				if got != PluralOther && !slices.Contains(rule.forms, got) {
+					t.Errorf("choose(%d) = %s, not one of the rule's forms %v", n, got, rule.forms)
+				}
+			}
+		})
+	}
+}
+
+func TestLocalizerN(t *testing.T) {
+	b, err := Load()
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	tests := []struct {
+		lang string
+		n    int
+		want string
+	}{
+		{lang: "en", n: 1, want: "wait 1 second "},
+		{lang: "en", n: 5, want: "wait 5 seconds "},
+		{lang: "ru", n: 1, want: "Подождите 1 секунду "},
+		{lang: "ru", n: 3, want: "Подождите 3 секунды "},
+		{lang: "ru", n: 5, want: "Подождите 5 секунд "},
+		{lang: "ru", n: 21, want: "Подождите 21 секунду "},
+		{lang: "pt-br", n: 2, want: "wait 2 seconds "},
+	}
+
+	for _, tt := range tests {
+		got := b.For(tt.lang).N("throttle.cooldown", tt.n)
+		if !strings.Contains(got, tt.want) {
+			t.Errorf("For(%q).N(%d) = %q, want it to contain %q", tt.lang, tt.n, got, tt.want)
+		}
+	}
+}
+
+func TestValidateReportsMissingTranslations(t *testing.T) {
+	fsys := fstest.MapFS{
+		"locales/en.json": {Data: []byte(`{"a": "A", "b": {"one": "%s b", "other": "%s bs"}}`)},
+		"locales/ru.json": {Data: []byte(`{"b": {"one": "%s b", "many": "%s bs"}}`)},
+	}
+	b, err := LoadFS(fsys, "locales")
+	if err != nil {
+		t.Fatalf("LoadFS() error = %v", err)
+	}
+
+	err = b.Validate()
+	if err == nil {
+		t.Fatal("Validate() error = nil, want missing translations")
+	}
+	for _, key := range []string{"ru: a", "b.few"} {
+		if !strings.Contains(err.Error(), key) {
+			t.Errorf("Validate() error = %q, want it to mention %q", err, key)
+		}
+	}
+	// Missing keys fall back to English
+	if got := b.For("ru").T("a"); got != "A" {
+		t.Errorf("T(a) = %q, want the English text", got)
+	}
+}
@@ -0,0 +1,91 @@
+package i18n
+
+// PluralCategory is a CLDR plural category
+type PluralCategory string
+
+// Plural categories
+const (
+	PluralZero  PluralCategory = "zero"
+	PluralOne   PluralCategory = "one"
+	PluralTwo   PluralCategory = "two"
+	PluralFew   PluralCategory = "few"
+	PluralMany  PluralCategory = "many"
+	PluralOther PluralCategory = "other"
+)
+
+// pluralRule selects the plural category of an integer count
+type pluralRule struct {
+	forms  []PluralCategory // categories a translation must provide
+	choose func(n int) PluralCategory
+}
+
+// oneOther is the rule of English and most Western European languages
+var oneOther = pluralRule{
+	forms: []PluralCategory{PluralOne, PluralOther},
+	choose: func(n int) PluralCategory {
+		if n == 1 {
+			return PluralOne
+		}
+		return PluralOther
+	},
+}
+
+// eastSlavic is the rule of Russian and Ukrainian
+var eastSlavic = pluralRule{
+	forms: []PluralCategory{PluralOne, PluralFew, PluralMany},
+	choose: func(n int) PluralCategory {
+		mod10, mod100 := n%10, n%100
+		switch {
+		case mod10 == 1 && mod100 != 11:
+			return PluralOne
+		case mod10 >= 2 && mod10 <= 4 && (mod100 < 12 || mod100 > 14):
+			return PluralFew
+		default:
+			return PluralMany
+		}
+	},
+}
+
+// pluralRules maps language codes to their plural rule, see
+// https://www.unicode.org/cldr/charts/latest/supplemental/language_plural_rules.html
+var pluralRules = map[string]pluralRule{
+	"en": oneOther,
+	"de": oneOther,
+	"nl": oneOther,
+	"it": oneOther,
+	"es": oneOther,
+	"bg": oneOther,
+	"ru": eastSlavic,
+	"uk": eastSlavic,
+	"fr": {
+		forms: []PluralCategory{PluralOne, PluralOther},
+		choose: func(n int) PluralCategory {
+			if n == 0 || n == 1 {
+				return PluralOne
+			}
+			return PluralOther
+		},
+	},
+	"pl": {
+		forms: []PluralCategory{PluralOne, PluralFew, PluralMany},
+		choose: func(n int) PluralCategory {
+			mod10, mod100 := n%10, n%100
+			switch {
+			case n == 1:
+				return PluralOne
+			case mod10 >= 2 && mod10 <= 4 && (mod100 < 12 || mod100 > 14):
+				return PluralFew
+			default:
+				return PluralMany
+			}
+		},
+	},
+}
+
+// ruleFor returns the plural rule of a language, English's if unknown
+func ruleFor(lang string) pluralRule {
+	if rule, ok := pluralRules[lang]; ok {
+		return rule
+	}
+	return oneOther
+}
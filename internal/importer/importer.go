@@ -0,0 +1,387 @@
+// Package importer reads the expense history of groups exported from other
+// apps, such as Splitwise, so it can be migrated into a group.
+package importer
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/currency"
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/models"
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/money"
+)
+
+// MaxRecords is the largest number of records read from a file
+const MaxRecords = 10000
+
+// ErrEmpty is returned when a file contains no records
+var ErrEmpty = errors.New("file has no expenses")
+
+// File is the parsed content of an export
+type File struct {
+	People  []string // names used in the file in order of appearance
+	Records []models.ImportRecord
+}
+
+// addPerson records a person's name if it is new
+func (f *File) addPerson(name string) {
+	for _, p := range f.People {
+		if p == name {
+			return
+		}
+	}
+	f.People = append(f.People, name)
+}
+
+// splitwiseColumns are the leading columns of a Splitwise export. Every
+// further column holds the net effect of a row on one person's balance.
+var splitwiseColumns = []string{"date", "description", "category", "cost", "currency"}
+
+// splitwiseTotal is the description of the summary row closing an export
+const splitwiseTotal = "total balance"
+
+// ParseSplitwise reads a Splitwise CSV export. Payments between people are
+// read as expenses paid by the sender with the recipient as sole participant,
+// which has the same effect on balances. Rows paid by several people are
+// rejected as expenses have a single payer.
+func ParseSplitwise(r io.Reader) (*File, error) {
+	cr := newReader(r)
+	header, err := cr.Read()
+	if err != nil {
+		return nil, fmt.Errorf("read header: %w", err)
+	}
+	header = normalizeHeader(header)
+	if len(header) <= len(splitwiseColumns) {
+		return nil, errors.New("not a Splitwise export: no people columns")
+	}
+	for i, name := range splitwiseColumns {
+		if !strings.EqualFold(header[i], name) {
+			return nil, fmt.Errorf("not a Splitwise export: column %d is %q, want %q", i+1, header[i], name)
+		}
+	}
+	people := header[len(splitwiseColumns):]
+
+	f := &File{}
+	for _, name := range people {
+		if name == "" {
+			return nil, errors.New("not a Splitwise export: unnamed people column")
+		}
+		f.addPerson(name)
+	}
+
+	for {
+		row, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		line, _ := cr.FieldPos(0)
+		if len(row) != len(header) {
+			return nil, fmt.Errorf("line %d: has %d columns instead of %d", line, len(row), len(header))
+		}
+		if strings.TrimSpace(row[0]) == "" || strings.EqualFold(strings.TrimSpace(row[1]), splitwiseTotal) {
+			continue
+		}
+
+		record, err := splitwiseRecord(row, people)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		if record == nil {
+			continue
+		}
+		record.Line = line
+		if err := f.add(*record); err != nil {
+			return nil, err
+		}
+	}
+	return f.result()
+}
+
+// splitwiseRecord converts a Splitwise row. The payer is the only person with
+// a positive net amount; everybody else's share is their negative net amount.
+// Rows without any amount are skipped.
+func splitwiseRecord(row, people []string) (*models.ImportRecord, error) {
+	date, err := parseDate(row[0], time.DateOnly)
+	if err != nil {
+		return nil, err
+	}
+	cur, err := currency.Lookup(strings.TrimSpace(row[4]))
+	if err != nil {
+		return nil, err
+	}
+	cost, err := money.Parse(row[3], cur)
+	if err != nil {
+		return nil, err
+	}
+	if !cost.IsPositive() {
+		return nil, nil
+	}
+
+	record := &models.ImportRecord{Date: date, Description: strings.TrimSpace(row[1]), Amount: cost}
+	if record.Description == "" {
+		record.Description = strings.TrimSpace(row[2])
+	}
+
+	sum := money.Zero(cur)
+	var payerNet money.Money
+	for i, person := range people {
+		value := strings.TrimSpace(row[len(splitwiseColumns)+i])
+		if value == "" {
+			continue
+		}
+		net, err := money.Parse(value, cur)
+		if err != nil {
+			return nil, err
+		}
+		if sum, err = sum.Add(net); err != nil {
+			return nil, err
+		}
+		switch {
+		case net.IsPositive():
+			if record.PaidBy != "" {
+				return nil, errors.New("paid by several people, split it into one row per payer")
+			}
+			record.PaidBy, payerNet = person, net
+		case net.IsNegative():
+			record.Shares = append(record.Shares, models.ImportShare{Person: person, Amount: net.Neg()})
+		}
+	}
+	if !sum.IsZero() {
+		return nil, fmt.Errorf("amounts of people add up to %s instead of zero", sum)
+	}
+	if record.PaidBy == "" {
+		return nil, nil
+	}
+
+	// The payer's own share is whatever they paid beyond what the others owe
+	own, err := cost.Sub(payerNet)
+	if err != nil {
+		return nil, err
+	}
+	if own.IsNegative() {
+		return nil, fmt.Errorf("%s is owed more than the cost of %s", record.PaidBy, cost)
+	}
+	if own.IsPositive() {
+		record.Shares = append([]models.ImportShare{{Person: record.PaidBy, Amount: own}}, record.Shares...)
+	}
+	return record, nil
+}
+
+// Mapping names the columns of a generic CSV export. Participants are listed
+// in a single column separated by semicolons and share an expense equally.
+type Mapping struct {
+	Date         string
+	Description  string
+	Amount       string
+	Currency     string // optional, DefaultCurrency is used without it
+	PaidBy       string
+	Participants string
+	DateLayout   string // time layout of dates
+	// DefaultCurrency is the ISO 4217 code of amounts without a currency column
+	DefaultCurrency string
+}
+
+// DefaultMapping returns the mapping of a CSV with the columns date,
+// description, amount, currency, paid_by and participants
+func DefaultMapping() Mapping {
+	return Mapping{
+		Date:         "date",
+		Description:  "description",
+		Amount:       "amount",
+		Currency:     "currency",
+		PaidBy:       "paid_by",
+		Participants: "participants",
+		DateLayout:   time.DateOnly,
+	}
+}
+
+// ParseMapping returns the default mapping changed by key=value arguments,
+// e.g. "amount=Cost paid_by=Payer date_format=02.01.2006"
+func ParseMapping(args []string) (Mapping, error) {
+	m := DefaultMapping()
+	fields := map[string]*string{
+		"date":         &m.Date,
+		"description":  &m.Description,
+		"amount":       &m.Amount,
+		"currency":     &m.Currency,
+		"paid_by":      &m.PaidBy,
+		"participants": &m.Participants,
+		"date_format":  &m.DateLayout,
+	}
+	for _, arg := range args {
+		key, value, ok := strings.Cut(arg, "=")
+		field, known := fields[strings.ToLower(key)]
+		if !ok || !known || value == "" {
+			return Mapping{}, fmt.Errorf("invalid mapping %q", arg)
+		}
+		*field = value
+	}
+	return m, nil
+}
+
+// ParseCSV reads a CSV export with columns named by the mapping
+func ParseCSV(r io.Reader, m Mapping) (*File, error) {
+	cr := newReader(r)
+	header, err := cr.Read()
+	if err != nil {
+		return nil, fmt.Errorf("read header: %w", err)
+	}
+	header = normalizeHeader(header)
+
+	index := func(name string, required bool) (int, error) {
+		for i, column := range header {
+			if strings.EqualFold(column, name) {
+				return i, nil
+			}
+		}
+		if required {
+			return -1, fmt.Errorf("column %q is missing", name)
+		}
+		return -1, nil
+	}
+	var cols struct{ date, description, amount, currency, paidBy, participants int }
+	for _, c := range []struct {
+		dst      *int
+		name     string
+		required bool
+	}{
+		{&cols.date, m.Date, true},
+		{&cols.description, m.Description, true},
+		{&cols.amount, m.Amount, true},
+		{&cols.currency, m.Currency, m.DefaultCurrency == ""},
+		{&cols.paidBy, m.PaidBy, true},
+		{&cols.participants, m.Participants, true},
+	} {
+		if *c.dst, err = index(c.name, c.required); err != nil {
+			return nil, err
+		}
+	}
+
+	f := &File{}
+	for {
+		row, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		line, _ := cr.FieldPos(0)
+		if len(row) != len(header) {
+			return nil, fmt.Errorf("line %d: has %d columns instead of %d", line, len(row), len(header))
+		}
+
+		code := m.DefaultCurrency
+		if cols.currency >= 0 && strings.TrimSpace(row[cols.currency]) != "" {
+			code = strings.TrimSpace(row[cols.currency])
+		}
+		record, err := csvRecord(row[cols.date], row[cols.description], row[cols.amount], code,
+			row[cols.paidBy], row[cols.participants], m.DateLayout)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		record.Line = line
+		if err := f.add(*record); err != nil {
+			return nil, err
+		}
+	}
+	return f.result()
+}
+
+// csvRecord converts a generic CSV row into an expense split equally
+func csvRecord(date, description, amount, code, paidBy, participants, layout string) (*models.ImportRecord, error) {
+	d, err := parseDate(date, layout)
+	if err != nil {
+		return nil, err
+	}
+	cur, err := currency.Lookup(code)
+	if err != nil {
+		return nil, err
+	}
+	total, err := money.Parse(amount, cur)
+	if err != nil {
+		return nil, err
+	}
+	if !total.IsPositive() {
+		return nil, fmt.Errorf("amount %s must be positive", total)
+	}
+	record := &models.ImportRecord{
+		Date:        d,
+		Description: strings.TrimSpace(description),
+		Amount:      total,
+		PaidBy:      strings.TrimSpace(paidBy),
+	}
+	if record.PaidBy == "" {
+		return nil, errors.New("payer is missing")
+	}
+
+	var names []string
+	for _, name := range strings.Split(participants, ";") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return nil, errors.New("participants are missing")
+	}
+	for i, share := range total.Split(len(names)) {
+		record.Shares = append(record.Shares, models.ImportShare{Person: names[i], Amount: share})
+	}
+	return record, nil
+}
+
+// add appends a record and the people it names
+func (f *File) add(record models.ImportRecord) error {
+	if len(f.Records) == MaxRecords {
+		return fmt.Errorf("file has more than %d expenses", MaxRecords)
+	}
+	f.addPerson(record.PaidBy)
+	for _, share := range record.Shares {
+		f.addPerson(share.Person)
+	}
+	f.Records = append(f.Records, record)
+	return nil
+}
+
+// result returns the file unless it has no records
+func (f *File) result() (*File, error) {
+	if len(f.Records) == 0 {
+		return nil, ErrEmpty
+	}
+	return f, nil
+}
+
+func newReader(r io.Reader) *csv.Reader {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+	return cr
+}
+
+// normalizeHeader trims column names and the byte order mark some apps write
+func normalizeHeader(header []string) []string {
+	normalized := make([]string, len(header))
+	for i, name := range header {
+		normalized[i] = strings.TrimSpace(strings.TrimPrefix(name, "\ufeff"))
+	}
+	return normalized
+}
+
+// parseDate parses a date in the given layout, falling back to RFC 3339
+func parseDate(value, layout string) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	if t, err := time.Parse(layout, value); err == nil {
+		return t, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("invalid date %q", value)
+}
@@ -0,0 +1,32 @@
+// Package lock provides named locks, so that writes to a group are
+// serialized.
+package lock
+
+import (
+	"context"
+	"errors"
+)
+
+var (
+	// ErrLocked is returned by TryLock when another holder has the lock
+	ErrLocked = errors.New("lock is held by another holder")
+	// ErrNotHeld is returned when a lock is used after it was released or lost
+	ErrNotHeld = errors.New("lock is not held")
+)
+
+// Locker hands out named locks. A lock is exclusive: while it is held,
+// no one, its holder included, can acquire it again.
+type Locker interface {
+	// Lock blocks until the lock is acquired or ctx is done
+	Lock(ctx context.Context, name string) (Lock, error)
+	// TryLock acquires the lock if it is free and returns ErrLocked otherwise
+	TryLock(ctx context.Context, name string) (Lock, error)
+}
+
+// Lock is an acquired lock
+type Lock interface {
+	// Check returns an error if the lock was released
+	Check(ctx context.Context) error
+	// Unlock releases the lock
+	Unlock(ctx context.Context) error
+}
@@ -0,0 +1,84 @@
+package lock
+
+import (
+	"context"
+	"sync"
+)
+
+// Memory is a Locker whose locks are shared within the process
+type Memory struct {
+	mu sync.Mutex
+	// held maps the held locks to a channel closed when they are released
+	held map[string]chan struct{}
+}
+
+// NewMemory creates a Locker for a single process
+func NewMemory() *Memory {
+	return &Memory{held: make(map[string]chan struct{})}
+}
+
+// Lock blocks until the lock is released by its holder or ctx is done
+func (m *Memory) Lock(ctx context.Context, name string) (Lock, error) {
+	for {
+		l, released := m.acquire(name)
+		if l != nil {
+			return l, nil
+		}
+		select {
+		case <-released:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// TryLock acquires the lock unless it is held
+func (m *Memory) TryLock(ctx context.Context, name string) (Lock, error) {
+	l, _ := m.acquire(name)
+	if l == nil {
+		return nil, ErrLocked
+	}
+	return l, nil
+}
+
+// acquire returns the lock if it is free, or else the channel closed when
+// its holder releases it
+func (m *Memory) acquire(name string) (*memoryLock, <-chan struct{}) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if released, ok := m.held[name]; ok {
+		return nil, released
+	}
+	released := make(chan struct{})
+	m.held[name] = released
+	return &memoryLock{locker: m, name: name, released: released}, nil
+}
+
+type memoryLock struct {
+	locker   *Memory
+	name     string
+	released chan struct{}
+}
+
+// Check fails only once the lock was released
+func (l *memoryLock) Check(ctx context.Context) error {
+	select {
+	case <-l.released:
+		return ErrNotHeld
+	default:
+		return nil
+	}
+}
+
+func (l *memoryLock) Unlock(ctx context.Context) error {
+	l.locker.mu.Lock()
+	defer l.locker.mu.Unlock()
+
+	if l.locker.held[l.name] != l.released {
+		return ErrNotHeld
+	}
+	delete(l.locker.held, l.name)
+	close(l.released)
+	return nil
+}
@@ -0,0 +1,183 @@
+// Package metrics collects operational metrics of the bot and exposes them
+// in the Prometheus text format.
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// namespace prefixes the names of all metrics
+const namespace = "grouppay"
+
+// Metrics records what the bot does. A nil *Metrics records nothing, so
+// components can be used without metrics.
+type Metrics struct {
+	registry *prometheus.Registry
+
+	updates         *prometheus.CounterVec
+	dropped         *prometheus.CounterVec
+	handlerDuration *prometheus.HistogramVec
+	apiRequests     *prometheus.CounterVec
+	apiErrors       *prometheus.CounterVec
+	apiRetries      *prometheus.CounterVec
+	outboxDepth     *prometheus.GaugeVec
+	storageDuration *prometheus.HistogramVec
+	jobRuns         *prometheus.CounterVec
+	jobDuration     *prometheus.HistogramVec
+}
+
+// New creates the metrics of the bot along with the Go runtime and process metrics
+func New() *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		updates: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "updates_total",
+			Help:      "Telegram updates received by type and command.",
+		}, []string{"type", "command"}),
+		dropped: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "dropped_updates_total",
+			Help:      "Telegram updates dropped by reason: throttled, duplicate or redelivered.",
+		}, []string{"reason"}),
+		handlerDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "handler_duration_seconds",
+			Help:      "Time taken to handle a Telegram update by type and command.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"type", "command"}),
+		apiRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "telegram_api_requests_total",
+			Help:      "Requests made to the Telegram Bot API by method.",
+		}, []string{"method"}),
+		apiErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "telegram_api_errors_total",
+			Help:      "Failed Telegram Bot API requests by method and HTTP status, 0 for network errors.",
+		}, []string{"method", "code"}),
+		apiRetries: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "telegram_api_retries_total",
+			Help:      "Telegram Bot API requests retried by method, after rate limiting or server errors.",
+		}, []string{"method"}),
+		outboxDepth: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "telegram_outbox_depth",
+			Help:      "Outbound Telegram requests waiting for the rate limits by priority.",
+		}, []string{"priority"}),
+		storageDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "storage_operation_duration_seconds",
+			Help:      "Time taken by storage operations.",
+			Buckets:   []float64{.0001, .0005, .001, .005, .01, .05, .1, .5, 1},
+		}, []string{"operation"}),
+		jobRuns: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "scheduler_job_runs_total",
+			Help:      "Runs of scheduled jobs by outcome, success or failure.",
+		}, []string{"job", "outcome"}),
+		jobDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "scheduler_job_duration_seconds",
+			Help:      "Time taken by scheduled jobs.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"job"}),
+	}
+
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.updates,
+		m.dropped,
+		m.handlerDuration,
+		m.apiRequests,
+		m.apiErrors,
+		m.apiRetries,
+		m.outboxDepth,
+		m.storageDuration,
+		m.jobRuns,
+		m.jobDuration,
+	)
+	return m
+}
+
+// Handler serves the metrics in the Prometheus text format
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+// ObserveUpdate records a handled Telegram update. command is the bot
+// command of a message or the action of a callback query, if any.
+func (m *Metrics) ObserveUpdate(updateType, command string, duration time.Duration) {
+	if m == nil {
+		return
+	}
+	m.updates.WithLabelValues(updateType, command).Inc()
+	m.handlerDuration.WithLabelValues(updateType, command).Observe(duration.Seconds())
+}
+
+// ObserveDropped records an update dropped before it was handled
+func (m *Metrics) ObserveDropped(reason string) {
+	if m == nil {
+		return
+	}
+	m.dropped.WithLabelValues(reason).Inc()
+}
+
+// ObserveAPIRequest records a request to the Telegram Bot API. code is the
+// HTTP status of a failed request, 0 if it did not get a response, and
+// ignored if it succeeded.
+func (m *Metrics) ObserveAPIRequest(method string, failed bool, code int) {
+	if m == nil {
+		return
+	}
+	m.apiRequests.WithLabelValues(method).Inc()
+	if failed {
+		m.apiErrors.WithLabelValues(method, strconv.Itoa(code)).Inc()
+	}
+}
+
+// ObserveAPIRetry records a retried request to the Telegram Bot API
+func (m *Metrics) ObserveAPIRetry(method string) {
+	if m == nil {
+		return
+	}
+	m.apiRetries.WithLabelValues(method).Inc()
+}
+
+// SetOutboxDepth records how many outbound requests of a priority wait for
+// the rate limits
+func (m *Metrics) SetOutboxDepth(priority string, depth int) {
+	if m == nil {
+		return
+	}
+	m.outboxDepth.WithLabelValues(priority).Set(float64(depth))
+}
+
+// ObserveStorage records the duration of a storage operation
+func (m *Metrics) ObserveStorage(operation string, duration time.Duration) {
+	if m == nil {
+		return
+	}
+	m.storageDuration.WithLabelValues(operation).Observe(duration.Seconds())
+}
+
+// ObserveJob records a run of a scheduled job
+func (m *Metrics) ObserveJob(job string, duration time.Duration, err error) {
+	if m == nil {
+		return
+	}
+	outcome := "success"
+	if err != nil {
+		outcome = "failure"
+	}
+	m.jobRuns.WithLabelValues(job, outcome).Inc()
+	m.jobDuration.WithLabelValues(job).Observe(duration.Seconds())
+}
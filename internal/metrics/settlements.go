@@ -0,0 +1,74 @@
+package metrics
+
+import (
+	"context"
+	"time"
+
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/models"
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/storage"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// settlementScrapeTimeout bounds how long counting settlements may delay a scrape
+const settlementScrapeTimeout = 5 * time.Second
+
+// WatchSettlements exports the number of settlements in each state. They are
+// counted from the store on every scrape.
+func (m *Metrics) WatchSettlements(store storage.Storage) {
+	if m == nil {
+		return
+	}
+	m.registry.MustRegister(&settlementCollector{
+		store: store,
+		desc: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "settlements"),
+			"Settlements of all groups by status.",
+			[]string{"status"}, nil,
+		),
+	})
+}
+
+type settlementCollector struct {
+	store storage.Storage
+	desc  *prometheus.Desc
+}
+
+func (c *settlementCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.desc
+}
+
+func (c *settlementCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), settlementScrapeTimeout)
+	defer cancel()
+
+	counts, err := c.count(ctx)
+	if err != nil {
+		ch <- prometheus.NewInvalidMetric(c.desc, err)
+		return
+	}
+	for status, n := range counts {
+		ch <- prometheus.MustNewConstMetric(c.desc, prometheus.GaugeValue, float64(n), status)
+	}
+}
+
+func (c *settlementCollector) count(ctx context.Context) (map[string]int, error) {
+	counts := map[string]int{
+		models.SettlementPending:   0,
+		models.SettlementCompleted: 0,
+		models.SettlementCancelled: 0,
+	}
+	groups, err := c.store.ListGroups(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, group := range groups {
+		settlements, err := c.store.GetGroupSettlements(ctx, group.ID)
+		if err != nil {
+			return nil, err
+		}
+		for _, settlement := range settlements {
+			counts[settlement.Status]++
+		}
+	}
+	return counts, nil
+}
@@ -0,0 +1,21 @@
+package metrics
+
+import (
+	"context"
+	"time"
+
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/storage"
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/storage/instrument"
+)
+
+// InstrumentStorage returns a storage recording the duration of every
+// operation of s, including those run in transactions
+func (m *Metrics) InstrumentStorage(s storage.Storage) storage.Storage {
+	if m == nil {
+		return s
+	}
+	return instrument.New(s, func(ctx context.Context, operation string) (context.Context, func()) {
+		start := time.Now()
+		return ctx, func() { m.ObserveStorage(operation, time.Since(start)) }
+	})
+}
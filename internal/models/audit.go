@@ -0,0 +1,46 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Audit actions
+const (
+	AuditCreate = "create"
+	AuditUpdate = "update"
+	AuditDelete = "delete"
+)
+
+// Audited entity types
+const (
+	EntityExpense     = "expense"
+	EntityParticipant = "participant"
+	EntityExpenseItem = "expense_item"
+	EntitySettlement  = "settlement"
+)
+
+// Sources of a change
+const (
+	SourceBot     = "bot"
+	SourceMiniApp = "mini_app"
+	SourceSystem  = "system"
+	SourceCLI     = "cli"
+)
+
+// AuditEntry records a single financial mutation. Entries of a group form a
+// hash chain: each entry's hash covers its content and the previous entry's hash.
+type AuditEntry struct {
+	ID         int64           `json:"id" db:"id"`
+	GroupID    int64           `json:"group_id" db:"group_id"`
+	ActorID    int64           `json:"actor_id" db:"actor_id"` // 0 for system changes
+	Action     string          `json:"action" db:"action"`     // create, update, delete
+	EntityType string          `json:"entity_type" db:"entity_type"`
+	EntityID   int64           `json:"entity_id" db:"entity_id"`
+	Before     json.RawMessage `json:"before,omitempty" db:"before"`
+	After      json.RawMessage `json:"after,omitempty" db:"after"`
+	Source     string          `json:"source" db:"source"` // bot, mini_app, system, cli
+	PrevHash   string          `json:"prev_hash" db:"prev_hash"`
+	Hash       string          `json:"hash" db:"hash"`
+	CreatedAt  time.Time       `json:"created_at" db:"created_at"`
+}
@@ -0,0 +1,19 @@
+package models
+
+import "time"
+
+// Idempotent operations, recorded with the keys they were run with
+const (
+	OperationUpdate             = "update"
+	OperationCreateExpense      = "create_expense"
+	OperationCompleteSettlement = "complete_settlement"
+)
+
+// IdempotencyKey records that an operation ran, so replays of it return its
+// original result instead of running it again
+type IdempotencyKey struct {
+	Key       string    `json:"key" db:"key"` // unique per operation and caller
+	Operation string    `json:"operation" db:"operation"`
+	ResultID  int64     `json:"result_id" db:"result_id"` // ID of the record the operation created or changed
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
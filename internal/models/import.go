@@ -0,0 +1,62 @@
+package models
+
+import (
+	"time"
+
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/money"
+)
+
+// Import sources
+const (
+	ImportSplitwise = "splitwise" // Splitwise CSV export
+	ImportCSV       = "csv"       // CSV with mapped columns
+)
+
+// Import statuses
+const (
+	ImportPending   = "pending"
+	ImportCommitted = "committed"
+	ImportCancelled = "cancelled"
+)
+
+// Import is a file of expenses exported from another app. The people named
+// in it are matched to group members before its records are committed as
+// expenses.
+type Import struct {
+	ID        int64          `json:"id" db:"id"`
+	GroupID   int64          `json:"group_id" db:"group_id"`
+	CreatedBy int64          `json:"created_by" db:"created_by"`
+	Source    string         `json:"source" db:"source"`   // ImportSplitwise or ImportCSV
+	People    []string       `json:"people" db:"people"`   // names used in the file in order of appearance
+	Matches   []int64        `json:"matches" db:"matches"` // user ID of each person, 0 while unmatched
+	Records   []ImportRecord `json:"records" db:"records"`
+	Status    string         `json:"status" db:"status"` // pending, committed, cancelled
+	CreatedAt time.Time      `json:"created_at" db:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at" db:"updated_at"`
+}
+
+// Unmatched returns the index of the first person not matched to a user, or -1
+func (i *Import) Unmatched() int {
+	for n, userID := range i.Matches {
+		if userID == 0 {
+			return n
+		}
+	}
+	return -1
+}
+
+// ImportRecord is a single expense or payment of an import
+type ImportRecord struct {
+	Line        int           `json:"line"` // line of the record in the file
+	Date        time.Time     `json:"date"`
+	Description string        `json:"description"`
+	Amount      money.Money   `json:"amount"`
+	PaidBy      string        `json:"paid_by"` // person who paid
+	Shares      []ImportShare `json:"shares"`  // add up to Amount
+}
+
+// ImportShare is a person's share of an import record
+type ImportShare struct {
+	Person string      `json:"person"`
+	Amount money.Money `json:"amount"`
+}
@@ -0,0 +1,69 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/money"
+)
+
+// Ledger event types
+const (
+	EventExpenseAdded        = "expense_added"
+	EventExpenseEdited       = "expense_edited"
+	EventExpenseDeleted      = "expense_deleted"
+	EventSettlementCompleted = "settlement_completed"
+	EventMemberLeft          = "member_left"
+)
+
+// LedgerEvent is an immutable domain event in a group's ledger.
+// Balances are derived by replaying the events in sequence order.
+type LedgerEvent struct {
+	ID         int64           `json:"id" db:"id"`
+	GroupID    int64           `json:"group_id" db:"group_id"`
+	Sequence   int64           `json:"sequence" db:"sequence"` // 1-based position within the group
+	Type       string          `json:"type" db:"type"`
+	Payload    json.RawMessage `json:"payload" db:"payload"`
+	ActorID    int64           `json:"actor_id" db:"actor_id"`
+	OccurredAt time.Time       `json:"occurred_at" db:"occurred_at"`
+}
+
+// ExpenseAddedPayload is the payload of an EventExpenseAdded event
+type ExpenseAddedPayload struct {
+	Expense      Expense       `json:"expense"`
+	Participants []Participant `json:"participants"`
+}
+
+// ExpenseEditedPayload is the payload of an EventExpenseEdited event.
+// It carries both versions so the edit can be applied without other state.
+type ExpenseEditedPayload struct {
+	Before             Expense       `json:"before"`
+	BeforeParticipants []Participant `json:"before_participants"`
+	After              Expense       `json:"after"`
+	AfterParticipants  []Participant `json:"after_participants"`
+}
+
+// ExpenseDeletedPayload is the payload of an EventExpenseDeleted event
+type ExpenseDeletedPayload struct {
+	Expense      Expense       `json:"expense"`
+	Participants []Participant `json:"participants"`
+}
+
+// SettlementCompletedPayload is the payload of an EventSettlementCompleted event
+type SettlementCompletedPayload struct {
+	Settlement Settlement `json:"settlement"`
+}
+
+// MemberLeftPayload is the payload of an EventMemberLeft event
+type MemberLeftPayload struct {
+	UserID int64 `json:"user_id"`
+}
+
+// BalanceSnapshot stores the balances of a group after a ledger event so
+// replays can start from it instead of the beginning of the ledger
+type BalanceSnapshot struct {
+	GroupID  int64                 `json:"group_id" db:"group_id"`
+	Sequence int64                 `json:"sequence" db:"sequence"` // last event included
+	At       time.Time             `json:"at" db:"at"`             // time of the last event included
+	Balances map[int64]money.Money `json:"balances" db:"balances"`
+}
@@ -0,0 +1,66 @@
+package models
+
+import (
+	"time"
+
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/money"
+)
+
+// Receipt statuses
+const (
+	ReceiptPending   = "pending"
+	ReceiptConfirmed = "confirmed"
+	ReceiptCancelled = "cancelled"
+)
+
+// Receipt is a scanned receipt photo. What was read from it is shown to the
+// member who sent it, who may correct it before it is added as an expense.
+type Receipt struct {
+	ID          int64         `json:"id" db:"id"`
+	GroupID     int64         `json:"group_id" db:"group_id"`
+	CreatedBy   int64         `json:"created_by" db:"created_by"`
+	Description string        `json:"description" db:"description"`
+	Items       []ReceiptItem `json:"items" db:"items"`
+	Tax         money.Money   `json:"tax" db:"tax"` // tax added on top of the item prices
+	Tip         money.Money   `json:"tip" db:"tip"`
+	Total       money.Money   `json:"total" db:"total"`
+	Status      string        `json:"status" db:"status"`         // pending, confirmed, cancelled
+	ExpenseID   int64         `json:"expense_id" db:"expense_id"` // expense added on confirmation
+	CreatedAt   time.Time     `json:"created_at" db:"created_at"`
+	UpdatedAt   time.Time     `json:"updated_at" db:"updated_at"`
+}
+
+// ReceiptItem is a line item read from a receipt
+type ReceiptItem struct {
+	Name     string      `json:"name"`
+	Quantity int         `json:"quantity"`
+	Price    money.Money `json:"price"`              // price of the whole line
+	Excluded bool        `json:"excluded,omitempty"` // misread line left out of the expense
+}
+
+// IncludedItems returns the items that are not excluded
+func (r *Receipt) IncludedItems() []ReceiptItem {
+	var items []ReceiptItem
+	for _, item := range r.Items {
+		if !item.Excluded {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// Charges returns the prices of the included items, tax and tip added up
+func (r *Receipt) Charges() money.Money {
+	sum, _ := r.Tax.Add(r.Tip)
+	for _, item := range r.IncludedItems() {
+		sum, _ = sum.Add(item.Price)
+	}
+	return sum
+}
+
+// Mismatch reports whether the included items, tax and tip do not add up to
+// the total, e.g. because a line was misread or missed. Receipts without
+// items only have a total and never mismatch.
+func (r *Receipt) Mismatch() bool {
+	return len(r.IncludedItems()) > 0 && r.Charges() != r.Total
+}
@@ -0,0 +1,22 @@
+package models
+
+import (
+	"time"
+
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/money"
+)
+
+// RecurringExpense is a template from which expenses are created on a schedule
+type RecurringExpense struct {
+	ID          int64       `json:"id" db:"id"`
+	GroupID     int64       `json:"group_id" db:"group_id"`
+	Description string      `json:"description" db:"description"`
+	Amount      money.Money `json:"amount" db:"amount"`
+	PaidBy      int64       `json:"paid_by" db:"paid_by"`
+	Rule        string      `json:"rule" db:"rule"`               // RRULE-like schedule, e.g. "FREQ=MONTHLY;BYMONTHDAY=1"
+	NextRunAt   time.Time   `json:"next_run_at" db:"next_run_at"` // next occurrence to materialize
+	Active      bool        `json:"active" db:"active"`           // false once cancelled or the rule has ended
+	CreatedBy   int64       `json:"created_by" db:"created_by"`
+	CreatedAt   time.Time   `json:"created_at" db:"created_at"`
+	UpdatedAt   time.Time   `json:"updated_at" db:"updated_at"`
+}
@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+// Reminder escalation levels
+const (
+	ReminderGentle = 1
+	ReminderFirm   = 2
+)
+
+// Reminder records a payment reminder sent to the debtor of a pending settlement
+type Reminder struct {
+	ID           int64     `json:"id" db:"id"`
+	SettlementID int64     `json:"settlement_id" db:"settlement_id"`
+	UserID       int64     `json:"user_id" db:"user_id"`
+	Level        int       `json:"level" db:"level"` // ReminderGentle or ReminderFirm
+	SentAt       time.Time `json:"sent_at" db:"sent_at"`
+}
@@ -1,58 +1,106 @@
 package models
 
-import "time"
+import (
+	"time"
+
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/money"
+)
 
 // User represents a user in the system
 type User struct {
+	ID           int64  `json:"id" db:"id"`
+	TelegramID   int64  `json:"telegram_id" db:"telegram_id"`
+	Username     string `json:"username" db:"username"`
+	FirstName    string `json:"first_name" db:"first_name"`
+	LastName     string `json:"last_name" db:"last_name"`
+	LanguageCode string `json:"language_code" db:"language_code"`
+	Timezone     string `json:"timezone" db:"timezone"`           // IANA time zone name, empty for UTC
+	RemindersOff bool   `json:"reminders_off" db:"reminders_off"` // opted out of payment reminders
+	// QuietHoursStart and QuietHoursEnd are local hours (0-23) during which no
+	// reminders are sent. Nil uses the default, equal hours disable quiet hours.
+	QuietHoursStart *int      `json:"quiet_hours_start,omitempty" db:"quiet_hours_start"`
+	QuietHoursEnd   *int      `json:"quiet_hours_end,omitempty" db:"quiet_hours_end"`
+	CreatedAt       time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt       time.Time `json:"updated_at" db:"updated_at"`
+}
+
+// Group represents an expense group
+type Group struct {
 	ID           int64     `json:"id" db:"id"`
-	TelegramID   int64     `json:"telegram_id" db:"telegram_id"`
-	Username     string    `json:"username" db:"username"`
-	FirstName    string    `json:"first_name" db:"first_name"`
-	LastName     string    `json:"last_name" db:"last_name"`
-	LanguageCode string    `json:"language_code" db:"language_code"`
+	Name         string    `json:"name" db:"name"`
+	Description  string    `json:"description" db:"description"`
+	ChatID       int64     `json:"chat_id" db:"chat_id"`             // Telegram chat the group is bound to
+	BaseCurrency string    `json:"base_currency" db:"base_currency"` // ISO 4217 code balances are computed in
+	CreatedBy    int64     `json:"created_by" db:"created_by"`
 	CreatedAt    time.Time `json:"created_at" db:"created_at"`
 	UpdatedAt    time.Time `json:"updated_at" db:"updated_at"`
 }
 
-// Group represents an expense group
-type Group struct {
-	ID          int64     `json:"id" db:"id"`
-	Name        string    `json:"name" db:"name"`
-	Description string    `json:"description" db:"description"`
-	CreatedBy   int64     `json:"created_by" db:"created_by"`
-	CreatedAt   time.Time `json:"created_at" db:"created_at"`
-	UpdatedAt   time.Time `json:"updated_at" db:"updated_at"`
+// Group member roles
+const (
+	RoleAdmin  = "admin"
+	RoleMember = "member"
+)
+
+// GroupMember represents a user's membership in an expense group
+type GroupMember struct {
+	GroupID  int64     `json:"group_id" db:"group_id"`
+	UserID   int64     `json:"user_id" db:"user_id"`
+	Role     string    `json:"role" db:"role"` // admin, member
+	JoinedAt time.Time `json:"joined_at" db:"joined_at"`
 }
 
 // Expense represents a shared expense
 type Expense struct {
-	ID          int64     `json:"id" db:"id"`
-	GroupID     int64     `json:"group_id" db:"group_id"`
-	Description string    `json:"description" db:"description"`
-	Amount      int64     `json:"amount" db:"amount"` // Amount in cents
-	Currency    string    `json:"currency" db:"currency"`
-	PaidBy      int64     `json:"paid_by" db:"paid_by"`
-	CreatedAt   time.Time `json:"created_at" db:"created_at"`
-	UpdatedAt   time.Time `json:"updated_at" db:"updated_at"`
+	ID           int64       `json:"id" db:"id"`
+	GroupID      int64       `json:"group_id" db:"group_id"`
+	Description  string      `json:"description" db:"description"`
+	Amount       money.Money `json:"amount" db:"amount"`
+	ExchangeRate string      `json:"exchange_rate" db:"exchange_rate"` // Amount currency to group base currency rate at entry time
+	BaseAmount   money.Money `json:"base_amount" db:"base_amount"`     // Amount converted to the group base currency
+	PaidBy       int64       `json:"paid_by" db:"paid_by"`
+	CreatedBy    int64       `json:"created_by" db:"created_by"`
+	CreatedAt    time.Time   `json:"created_at" db:"created_at"`
+	UpdatedAt    time.Time   `json:"updated_at" db:"updated_at"`
+}
+
+// ExpenseItem is a line item of an itemized expense. Members claim the items
+// they had and the expense is split by their claimed subtotals (Algorithm B).
+type ExpenseItem struct {
+	ID         int64       `json:"id" db:"id"`
+	ExpenseID  int64       `json:"expense_id" db:"expense_id"`
+	Name       string      `json:"name" db:"name"`
+	Price      money.Money `json:"price" db:"price"` // price of the whole line in the expense currency
+	Quantity   int         `json:"quantity" db:"quantity"`
+	ClaimedBy  []int64     `json:"claimed_by" db:"claimed_by"`             // users who had the item and share it equally
+	RemindedAt *time.Time  `json:"reminded_at,omitempty" db:"reminded_at"` // when the group was last reminded to claim it
+	CreatedAt  time.Time   `json:"created_at" db:"created_at"`
+	UpdatedAt  time.Time   `json:"updated_at" db:"updated_at"`
 }
 
 // Participant represents a user's participation in an expense
 type Participant struct {
-	ID        int64 `json:"id" db:"id"`
-	ExpenseID int64 `json:"expense_id" db:"expense_id"`
-	UserID    int64 `json:"user_id" db:"user_id"`
-	Share     int64 `json:"share" db:"share"` // Share in cents
+	ID        int64       `json:"id" db:"id"`
+	ExpenseID int64       `json:"expense_id" db:"expense_id"`
+	UserID    int64       `json:"user_id" db:"user_id"`
+	Share     money.Money `json:"share" db:"share"` // Share in the expense currency
 }
 
 // Settlement represents a settlement between users
 type Settlement struct {
-	ID        int64     `json:"id" db:"id"`
-	GroupID   int64     `json:"group_id" db:"group_id"`
-	FromUser  int64     `json:"from_user" db:"from_user"`
-	ToUser    int64     `json:"to_user" db:"to_user"`
-	Amount    int64     `json:"amount" db:"amount"` // Amount in cents
-	Currency  string    `json:"currency" db:"currency"`
-	Status    string    `json:"status" db:"status"` // pending, completed, cancelled
-	CreatedAt time.Time `json:"created_at" db:"created_at"`
-	UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
+	ID        int64       `json:"id" db:"id"`
+	GroupID   int64       `json:"group_id" db:"group_id"`
+	FromUser  int64       `json:"from_user" db:"from_user"`
+	ToUser    int64       `json:"to_user" db:"to_user"`
+	Amount    money.Money `json:"amount" db:"amount"`
+	Status    string      `json:"status" db:"status"` // pending, completed, cancelled
+	CreatedAt time.Time   `json:"created_at" db:"created_at"`
+	UpdatedAt time.Time   `json:"updated_at" db:"updated_at"`
 }
+
+// Settlement statuses
+const (
+	SettlementPending   = "pending"
+	SettlementCompleted = "completed"
+	SettlementCancelled = "cancelled"
+)
@@ -0,0 +1,75 @@
+package money
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/currency"
+)
+
+// jsonMoney is the JSON representation of Money
+type jsonMoney struct {
+	Amount   int64  `json:"amount"` // Amount in minor units
+	Currency string `json:"currency"`
+	Decimal  string `json:"decimal,omitempty"` // Human readable amount, ignored when decoding
+}
+
+// MarshalJSON encodes the amount as {"amount": 1250, "currency": "EUR", "decimal": "12.50"}
+func (m Money) MarshalJSON() ([]byte, error) {
+	if m.currency.Code == "" {
+		return []byte("null"), nil
+	}
+	return json.Marshal(jsonMoney{Amount: m.amount, Currency: m.currency.Code, Decimal: m.Decimal()})
+}
+
+// UnmarshalJSON decodes an amount encoded by MarshalJSON
+func (m *Money) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		*m = Money{}
+		return nil
+	}
+
+	var v jsonMoney
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+
+	cur, err := currency.Lookup(v.Currency)
+	if err != nil {
+		return err
+	}
+	*m = New(v.Amount, cur)
+	return nil
+}
+
+// Value stores the amount in a database as text, e.g. "12.50 EUR"
+func (m Money) Value() (driver.Value, error) {
+	if m.currency.Code == "" {
+		return nil, nil
+	}
+	return m.String(), nil
+}
+
+// Scan reads an amount stored by Value
+func (m *Money) Scan(src any) error {
+	var s string
+	switch v := src.(type) {
+	case nil:
+		*m = Money{}
+		return nil
+	case string:
+		s = v
+	case []byte:
+		s = string(v)
+	default:
+		return fmt.Errorf("scan money: unsupported type %T", src)
+	}
+
+	parsed, err := ParseWithCurrency(s)
+	if err != nil {
+		return fmt.Errorf("scan money: %w", err)
+	}
+	*m = parsed
+	return nil
+}
@@ -0,0 +1,38 @@
+package money
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestJSONRoundTrip(t *testing.T) {
+	for _, m := range []Money{New(1250, eur), New(-7, jpy), New(1005, bhd), {}} {
+		data, err := json.Marshal(m)
+		if err != nil {
+			t.Fatalf("Marshal(%v) error = %v", m, err)
+		}
+		var got Money
+		if err := json.Unmarshal(data, &got); err != nil {
+			t.Fatalf("Unmarshal(%s) error = %v", data, err)
+		}
+		if got != m {
+			t.Errorf("round trip of %v = %v", m, got)
+		}
+	}
+}
+
+func TestValueScanRoundTrip(t *testing.T) {
+	for _, m := range []Money{New(1250, eur), New(-7, jpy), {}} {
+		v, err := m.Value()
+		if err != nil {
+			t.Fatalf("Value(%v) error = %v", m, err)
+		}
+		var got Money
+		if err := got.Scan(v); err != nil {
+			t.Fatalf("Scan(%v) error = %v", v, err)
+		}
+		if got != m {
+			t.Errorf("round trip of %v = %v", m, got)
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package money
+
+import (
+	"strconv"
+	"strings"
+)
+
+// numberFormat describes how a locale writes currency amounts
+type numberFormat struct {
+	decimal     string
+	group       string
+	symbolFirst bool // symbol before the number
+	spaced      bool // space between symbol and number
+}
+
+// formats maps language codes to their currency format
+var formats = map[string]numberFormat{
+	"en": {decimal: ".", group: ",", symbolFirst: true},
+	"ja": {decimal: ".", group: ",", symbolFirst: true},
+	"zh": {decimal: ".", group: ",", symbolFirst: true},
+	"tr": {decimal: ",", group: ".", symbolFirst: true},
+	"nl": {decimal: ",", group: ".", symbolFirst: true, spaced: true},
+	"pt": {decimal: ",", group: ".", symbolFirst: true, spaced: true},
+	"de": {decimal: ",", group: ".", spaced: true},
+	"es": {decimal: ",", group: ".", spaced: true},
+	"it": {decimal: ",", group: ".", spaced: true},
+	"fr": {decimal: ",", group: "\u202f", spaced: true},
+	"ru": {decimal: ",", group: "\u00a0", spaced: true},
+	"uk": {decimal: ",", group: "\u00a0", spaced: true},
+	"bg": {decimal: ",", group: "\u00a0", spaced: true},
+	"pl": {decimal: ",", group: "\u00a0", spaced: true},
+}
+
+// symbols maps currency codes to their commonly used symbol
+var symbols = map[string]string{
+	"USD": "$", "EUR": "€", "GBP": "£", "JPY": "¥", "CNY": "¥", "INR": "₹",
+	"RUB": "₽", "UAH": "₴", "KRW": "₩", "TRY": "₺", "ILS": "₪", "PLN": "zł",
+	"BGN": "лв", "BRL": "R$", "CHF": "CHF", "VND": "₫", "THB": "฿", "PHP": "₱",
+}
+
+// Format formats the amount for the given locale (e.g. "en", "de-DE", "pt_BR"),
+// using the locale's decimal and grouping separators and the currency symbol.
+// Unknown locales fall back to English.
+func (m Money) Format(locale string) string {
+	f := formatFor(locale)
+
+	symbol, ok := symbols[m.currency.Code]
+	if !ok {
+		symbol, f.spaced = m.currency.Code, true
+	}
+
+	digits := m.Abs().Decimal()
+	whole, frac, _ := strings.Cut(digits, ".")
+	number := groupDigits(whole, f.group)
+	if frac != "" {
+		number += f.decimal + frac
+	}
+
+	space := ""
+	if f.spaced {
+		space = "\u00a0"
+	}
+
+	var s string
+	if f.symbolFirst {
+		s = symbol + space + number
+	} else {
+		s = number + space + symbol
+	}
+	if m.amount < 0 {
+		s = "-" + s
+	}
+	return s
+}
+
+// formatFor returns the number format of a locale's language, English's if unknown
+func formatFor(locale string) numberFormat {
+	lang := strings.ToLower(locale)
+	if i := strings.IndexAny(lang, "-_"); i >= 0 {
+		lang = lang[:i]
+	}
+	if f, ok := formats[lang]; ok {
+		return f
+	}
+	return formats["en"]
+}
+
+// groupDigits inserts a separator between groups of three digits
+func groupDigits(digits, sep string) string {
+	if len(digits) <= 3 {
+		return digits
+	}
+
+	var sb strings.Builder
+	head := len(digits) % 3
+	if head > 0 {
+		sb.WriteString(digits[:head])
+	}
+	for i := head; i < len(digits); i += 3 {
+		if sb.Len() > 0 {
+			sb.WriteString(sep)
+		}
+		sb.WriteString(digits[i : i+3])
+	}
+	return sb.String()
+}
+
+// FormatInt formats an integer with the digit grouping of the given locale
+func FormatInt(n int64, locale string) string {
+	f := formatFor(locale)
+	if n < 0 {
+		return "-" + groupDigits(strconv.FormatUint(uint64(-n), 10), f.group)
+	}
+	return groupDigits(strconv.FormatInt(n, 10), f.group)
+}
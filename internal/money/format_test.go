@@ -0,0 +1,47 @@
+package money
+
+import "testing"
+
+func TestFormat(t *testing.T) {
+	tests := []struct {
+		m      Money
+		locale string
+		want   string
+	}{
+		{New(123450, eur), "en", "€1,234.50"},
+		{New(123450, eur), "de-DE", "1.234,50 €"},
+		{New(123450, eur), "pt_BR", "€ 1.234,50"},
+		{New(123450, eur), "fr", "1 234,50 €"},
+		{New(-500, eur), "en", "-€5.00"},
+		{New(1234567, jpy), "en", "¥1,234,567"},
+		{New(1005, bhd), "en", "BHD 1.005"},
+		{New(100, eur), "xx", "€1.00"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.locale+" "+tt.m.String(), func(t *testing.T) {
+			if got := tt.m.Format(tt.locale); got != tt.want {
+				t.Errorf("Format(%q) = %q, want %q", tt.locale, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFormatInt(t *testing.T) {
+	tests := []struct {
+		n      int64
+		locale string
+		want   string
+	}{
+		{999, "en", "999"},
+		{1000, "en", "1,000"},
+		{-1234567, "de", "-1.234.567"},
+		{1000, "ru", "1 000"},
+	}
+
+	for _, tt := range tests {
+		if got := FormatInt(tt.n, tt.locale); got != tt.want {
+			t.Errorf("FormatInt(%d, %q) = %q, want %q", tt.n, tt.locale, got, tt.want)
+		}
+	}
+}
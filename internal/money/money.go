@@ -0,0 +1,203 @@
+package money
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/currency"
+)
+
+// ErrCurrencyMismatch is returned when combining amounts in different currencies
+var ErrCurrencyMismatch = errors.New("currency mismatch")
+
+// Money is an amount of a currency stored as an integer number of minor units.
+// The zero value has no currency and is only useful as a placeholder.
+type Money struct {
+	amount   int64
+	currency currency.Currency
+}
+
+// New creates an amount of minor units of the currency
+func New(amount int64, cur currency.Currency) Money {
+	return Money{amount: amount, currency: cur}
+}
+
+// FromMinor creates an amount of minor units of the currency with the given ISO 4217 code
+func FromMinor(amount int64, code string) (Money, error) {
+	cur, err := currency.Lookup(code)
+	if err != nil {
+		return Money{}, err
+	}
+	return New(amount, cur), nil
+}
+
+// Zero returns a zero amount of the currency
+func Zero(cur currency.Currency) Money {
+	return New(0, cur)
+}
+
+// Amount returns the amount in minor units
+func (m Money) Amount() int64 {
+	return m.amount
+}
+
+// Currency returns the currency of the amount
+func (m Money) Currency() currency.Currency {
+	return m.currency
+}
+
+// IsZero reports whether the amount is zero
+func (m Money) IsZero() bool {
+	return m.amount == 0
+}
+
+// IsPositive reports whether the amount is greater than zero
+func (m Money) IsPositive() bool {
+	return m.amount > 0
+}
+
+// IsNegative reports whether the amount is less than zero
+func (m Money) IsNegative() bool {
+	return m.amount < 0
+}
+
+// SameCurrency reports whether both amounts are in the same currency
+func (m Money) SameCurrency(o Money) bool {
+	return m.currency == o.currency
+}
+
+// Add returns m + o
+func (m Money) Add(o Money) (Money, error) {
+	if !m.SameCurrency(o) {
+		return Money{}, fmt.Errorf("add %s to %s: %w", o.currency, m.currency, ErrCurrencyMismatch)
+	}
+	return New(m.amount+o.amount, m.currency), nil
+}
+
+// Sub returns m - o
+func (m Money) Sub(o Money) (Money, error) {
+	if !m.SameCurrency(o) {
+		return Money{}, fmt.Errorf("subtract %s from %s: %w", o.currency, m.currency, ErrCurrencyMismatch)
+	}
+	return New(m.amount-o.amount, m.currency), nil
+}
+
+// Cmp compares m and o and returns -1, 0 or +1
+func (m Money) Cmp(o Money) (int, error) {
+	if !m.SameCurrency(o) {
+		return 0, fmt.Errorf("compare %s with %s: %w", o.currency, m.currency, ErrCurrencyMismatch)
+	}
+	switch {
+	case m.amount < o.amount:
+		return -1, nil
+	case m.amount > o.amount:
+		return 1, nil
+	default:
+		return 0, nil
+	}
+}
+
+// Neg returns -m
+func (m Money) Neg() Money {
+	return New(-m.amount, m.currency)
+}
+
+// Abs returns |m|
+func (m Money) Abs() Money {
+	if m.amount < 0 {
+		return m.Neg()
+	}
+	return m
+}
+
+// Split splits the amount into n parts that differ by at most one minor unit.
+// Leftover minor units go to the first parts.
+func (m Money) Split(n int) []Money {
+	if n <= 0 {
+		return nil
+	}
+	ratios := make([]int64, n)
+	for i := range ratios {
+		ratios[i] = 1
+	}
+	return m.Allocate(ratios...)
+}
+
+// Allocate splits the amount proportionally to the ratios using the largest
+// remainder method, so no minor units are lost. Negative ratios are treated
+// as zero; if all ratios are zero the amount is split equally.
+func (m Money) Allocate(ratios ...int64) []Money {
+	parts := make([]Money, len(ratios))
+	if len(ratios) == 0 {
+		return parts
+	}
+
+	weights := make([]int64, len(ratios))
+	var total int64
+	for i, r := range ratios {
+		weights[i] = max(r, 0)
+		total += weights[i]
+	}
+	if total == 0 {
+		for i := range weights {
+			weights[i] = 1
+		}
+		total = int64(len(weights))
+	}
+
+	type remainder struct {
+		index int
+		value int64
+	}
+	remainders := make([]remainder, len(weights))
+
+	var allocated int64
+	for i, w := range weights {
+		// amount*w may overflow int64 for very large amounts, use big integers
+		q, r := new(big.Int).QuoRem(
+			new(big.Int).Mul(big.NewInt(m.amount), big.NewInt(w)),
+			big.NewInt(total),
+			new(big.Int),
+		)
+		parts[i] = New(q.Int64(), m.currency)
+		remainders[i] = remainder{index: i, value: r.Abs(r).Int64()}
+		allocated += q.Int64()
+	}
+
+	sort.SliceStable(remainders, func(i, j int) bool {
+		return remainders[i].value > remainders[j].value
+	})
+
+	step := int64(1)
+	if m.amount < 0 {
+		step = -1
+	}
+	for i := 0; allocated != m.amount; i++ {
+		parts[remainders[i%len(remainders)].index].amount += step
+		allocated += step
+	}
+
+	return parts
+}
+
+// Decimal returns the amount as a plain decimal string such as "-12.50"
+func (m Money) Decimal() string {
+	amount := m.amount
+	sign := ""
+	if amount < 0 {
+		sign, amount = "-", -amount
+	}
+	if m.currency.MinorUnits == 0 {
+		return fmt.Sprintf("%s%d", sign, amount)
+	}
+	factor := m.currency.Factor()
+	return fmt.Sprintf("%s%d.%0*d", sign, amount/factor, m.currency.MinorUnits, amount%factor)
+}
+
+// String returns the amount with its currency code, e.g. "12.50 EUR"
+func (m Money) String() string {
+	return strings.TrimSpace(m.Decimal() + " " + m.currency.Code)
+}
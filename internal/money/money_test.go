@@ -0,0 +1,100 @@
+package money
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/currency"
+)
+
+var (
+	eur = currency.MustLookup("EUR")
+	jpy = currency.MustLookup("JPY")
+	bhd = currency.MustLookup("BHD")
+)
+
+func amounts(parts []Money) []int64 {
+	out := make([]int64, len(parts))
+	for i, p := range parts {
+		out[i] = p.Amount()
+	}
+	return out
+}
+
+func TestAllocate(t *testing.T) {
+	tests := []struct {
+		name   string
+		amount int64
+		ratios []int64
+		want   []int64
+	}{
+		{name: "even", amount: 900, ratios: []int64{1, 1, 1}, want: []int64{300, 300, 300}},
+		{name: "leftover to largest remainders", amount: 1000, ratios: []int64{1, 1, 1}, want: []int64{334, 333, 333}},
+		{name: "proportional", amount: 1000, ratios: []int64{1, 3}, want: []int64{250, 750}},
+		{name: "largest remainder wins", amount: 100, ratios: []int64{1, 2, 3}, want: []int64{17, 33, 50}},
+		{name: "negative amount", amount: -1000, ratios: []int64{1, 1, 1}, want: []int64{-334, -333, -333}},
+		{name: "negative ratio counts as zero", amount: 100, ratios: []int64{-5, 1}, want: []int64{0, 100}},
+		{name: "all zero ratios split equally", amount: 5, ratios: []int64{0, 0}, want: []int64{3, 2}},
+		{name: "more parts than minor units", amount: 2, ratios: []int64{1, 1, 1}, want: []int64{1, 1, 0}},
+		{name: "no ratios", amount: 100, ratios: nil, want: []int64{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parts := New(tt.amount, eur).Allocate(tt.ratios...)
+			got := amounts(parts)
+			if !slices.Equal(got, tt.want) {
+				t.Fatalf("Allocate(%v) = %v, want %v", tt.ratios, got, tt.want)
+			}
+			var sum int64
+			for _, p := range parts {
+				sum += p.Amount()
+				if p.Currency() != eur {
+					t.Errorf("part currency = %s, want EUR", p.Currency().Code)
+				}
+			}
+			if len(parts) > 0 && sum != tt.amount {
+				t.Errorf("parts sum to %d, want %d", sum, tt.amount)
+			}
+		})
+	}
+}
+
+func TestSplit(t *testing.T) {
+	if got := amounts(New(100, jpy).Split(3)); !slices.Equal(got, []int64{34, 33, 33}) {
+		t.Errorf("Split(3) = %v", got)
+	}
+	if got := New(100, jpy).Split(0); got != nil {
+		t.Errorf("Split(0) = %v, want nil", got)
+	}
+}
+
+func TestArithmeticRequiresSameCurrency(t *testing.T) {
+	if _, err := New(100, eur).Add(New(100, jpy)); err == nil {
+		t.Error("Add() of different currencies succeeded")
+	}
+	if _, err := New(100, eur).Sub(New(100, jpy)); err == nil {
+		t.Error("Sub() of different currencies succeeded")
+	}
+	sum, err := New(100, eur).Add(New(-150, eur))
+	if err != nil || sum.Amount() != -50 {
+		t.Errorf("Add() = %v, %v, want -0.50 EUR", sum, err)
+	}
+}
+
+func TestDecimal(t *testing.T) {
+	tests := []struct {
+		m    Money
+		want string
+	}{
+		{New(1250, eur), "12.50"},
+		{New(-5, eur), "-0.05"},
+		{New(1234, jpy), "1234"},
+		{New(1005, bhd), "1.005"},
+	}
+	for _, tt := range tests {
+		if got := tt.m.Decimal(); got != tt.want {
+			t.Errorf("Decimal() = %q, want %q", got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package money
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/currency"
+)
+
+// Parse parses a user-entered amount of the given currency. It accepts both
+// "." and "," as decimal separator and ignores grouping separators, so
+// "1234.5", "1,234.50", "1.234,50" and "1 234,5" are all understood.
+// Grouping separators must separate groups of three digits, and amounts with
+// more decimals than the currency has are rejected, so "1.234.5" and "0.125"
+// are not amounts of euros.
+func Parse(s string, cur currency.Currency) (Money, error) {
+	input := s
+	s = strings.Map(func(r rune) rune {
+		switch r {
+		case ' ', '\u00a0', '\u202f', '\'', '_':
+			return -1
+		}
+		return r
+	}, strings.TrimSpace(s))
+
+	negative := strings.HasPrefix(s, "-")
+	if negative || strings.HasPrefix(s, "+") {
+		s = s[1:]
+	}
+	// Only a single leading sign is allowed, e.g. "--5" is rejected
+	if !strings.ContainsAny(s, "0123456789") || strings.IndexFunc(s, notNumeric) >= 0 {
+		return Money{}, fmt.Errorf("invalid amount %q", input)
+	}
+
+	whole, frac, ok := splitDecimal(s, cur.MinorUnits)
+	if !ok {
+		return Money{}, fmt.Errorf("invalid amount %q", input)
+	}
+	if len(frac) > cur.MinorUnits {
+		return Money{}, fmt.Errorf("invalid amount %q: %s has %d decimals", input, cur.Code, cur.MinorUnits)
+	}
+	if whole == "" {
+		whole = "0"
+	}
+
+	units, err := strconv.ParseInt(whole, 10, 64)
+	if err != nil {
+		return Money{}, fmt.Errorf("invalid amount %q", input)
+	}
+
+	var minor int64
+	if frac != "" {
+		minor, err = strconv.ParseInt(frac+strings.Repeat("0", cur.MinorUnits-len(frac)), 10, 64)
+		if err != nil {
+			return Money{}, fmt.Errorf("invalid amount %q", input)
+		}
+	}
+
+	amount := units*cur.Factor() + minor
+	if amount/cur.Factor() != units {
+		return Money{}, fmt.Errorf("invalid amount %q: too large", input)
+	}
+	if negative {
+		amount = -amount
+	}
+	return New(amount, cur), nil
+}
+
+// splitDecimal splits a number into its whole and fractional digits,
+// removing grouping separators. It fails if the separators do not group the
+// whole digits by three.
+func splitDecimal(s string, minorUnits int) (whole, frac string, ok bool) {
+	lastDot, lastComma := strings.LastIndex(s, "."), strings.LastIndex(s, ",")
+
+	sep := -1
+	switch {
+	case lastDot >= 0 && lastComma >= 0:
+		// Both present: whichever comes last is the decimal separator
+		sep = max(lastDot, lastComma)
+	case lastDot >= 0 || lastComma >= 0:
+		idx := max(lastDot, lastComma)
+		char := s[idx : idx+1]
+		// A separator that repeats, or that follows a leading group and is
+		// followed by exactly three digits in a currency with fewer decimals,
+		// is a grouping separator
+		grouping := len(s)-idx-1 == 3 && minorUnits < 3 && leadingGroup(s[:idx])
+		if strings.Count(s, char) == 1 && !grouping {
+			sep = idx
+		}
+	}
+
+	if sep < 0 {
+		whole, ok = ungroup(s)
+		return whole, "", ok
+	}
+	whole, ok = ungroup(s[:sep])
+	return whole, s[sep+1:], ok
+}
+
+// ungroup removes the grouping separators of whole digits, which must be a
+// leading group followed by groups of three, such as "1,234,567"
+func ungroup(s string) (string, bool) {
+	idx := strings.IndexAny(s, ".,")
+	if idx < 0 {
+		return s, true
+	}
+	groups := strings.Split(s, s[idx:idx+1])
+	if !leadingGroup(groups[0]) {
+		return "", false
+	}
+	for _, group := range groups[1:] {
+		if len(group) != 3 || strings.ContainsAny(group, ".,") {
+			return "", false
+		}
+	}
+	return strings.Join(groups, ""), true
+}
+
+// leadingGroup reports whether s can be the first group of grouped digits:
+// one to three digits, not starting with zero
+func leadingGroup(s string) bool {
+	return len(s) >= 1 && len(s) <= 3 && s[0] != '0' && !strings.ContainsAny(s, ".,")
+}
+
+// notNumeric reports whether r is neither a digit nor a separator
+func notNumeric(r rune) bool {
+	return (r < '0' || r > '9') && r != '.' && r != ','
+}
+
+// ParseWithCurrency parses an amount followed or preceded by an ISO 4217 code,
+// such as "12.50 EUR" or "EUR 12.50"
+func ParseWithCurrency(s string) (Money, error) {
+	fields := strings.Fields(s)
+	if len(fields) != 2 {
+		return Money{}, fmt.Errorf("invalid money %q", s)
+	}
+
+	amount, code := fields[0], fields[1]
+	if currency.IsValid(amount) {
+		amount, code = code, amount
+	}
+
+	cur, err := currency.Lookup(code)
+	if err != nil {
+		return Money{}, fmt.Errorf("invalid money %q: %w", s, err)
+	}
+	return Parse(amount, cur)
+}
@@ -0,0 +1,105 @@
+package money
+
+import (
+	"testing"
+
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/currency"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		input   string
+		cur     currency.Currency
+		want    int64
+		wantErr bool
+	}{
+		{input: "12", cur: eur, want: 1200},
+		{input: "12.5", cur: eur, want: 1250},
+		{input: "12,50", cur: eur, want: 1250},
+		{input: "1,234.50", cur: eur, want: 123450},
+		{input: "1.234,50", cur: eur, want: 123450},
+		{input: "1 234,5", cur: eur, want: 123450},
+		{input: "1.234", cur: eur, want: 123400},
+		{input: ".5", cur: eur, want: 50},
+		{input: "-3.20", cur: eur, want: -320},
+		{input: "+3.20", cur: eur, want: 320},
+		{input: "1,000", cur: jpy, want: 1000},
+		{input: "1.005", cur: bhd, want: 1005},
+		{input: "", cur: eur, wantErr: true},
+		{input: "-", cur: eur, wantErr: true},
+		{input: ".", cur: eur, wantErr: true},
+		{input: "--5", cur: eur, wantErr: true},
+		{input: "-+5", cur: eur, wantErr: true},
+		{input: "+-5", cur: eur, wantErr: true},
+		{input: "1.+5", cur: eur, wantErr: true},
+		{input: "5-", cur: eur, wantErr: true},
+		{input: "12.345", cur: eur, want: 1234500},
+		{input: "1.234.567", cur: eur, want: 123456700},
+		{input: "1.234.567,8", cur: eur, want: 123456780},
+		{input: "0.5", cur: eur, want: 50},
+		{input: "0.125", cur: eur, wantErr: true},
+		{input: ".125", cur: eur, wantErr: true},
+		{input: "1234.567", cur: eur, wantErr: true},
+		{input: "1.234.5", cur: eur, wantErr: true},
+		{input: "1,23,456", cur: eur, wantErr: true},
+		{input: "01.234", cur: eur, wantErr: true},
+		{input: "1.2345,00", cur: eur, wantErr: true},
+		{input: "1,234,5.00", cur: eur, wantErr: true},
+		{input: "0,100", cur: jpy, wantErr: true},
+		{input: "12.3456", cur: eur, wantErr: true},
+		{input: "1.5", cur: jpy, wantErr: true},
+		{input: "abc", cur: eur, wantErr: true},
+		{input: "1e3", cur: eur, wantErr: true},
+		{input: "99999999999999999999", cur: eur, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := Parse(tt.input, tt.cur)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("Parse(%q) = %v, want error", tt.input, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Parse(%q) error = %v", tt.input, err)
+			}
+			if got.Amount() != tt.want || got.Currency() != tt.cur {
+				t.Errorf("Parse(%q) = %v, want %d %s", tt.input, got, tt.want, tt.cur.Code)
+			}
+		})
+	}
+}
+
+func TestParseWithCurrency(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    string
+		wantErr bool
+	}{
+		{input: "12.50 EUR", want: "12.50 EUR"},
+		{input: "EUR 12.50", want: "12.50 EUR"},
+		{input: "1000 jpy", want: "1000 JPY"},
+		{input: "12.50", wantErr: true},
+		{input: "12.50 XXX", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := ParseWithCurrency(tt.input)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("ParseWithCurrency(%q) = %v, want error", tt.input, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseWithCurrency(%q) error = %v", tt.input, err)
+			}
+			if got.String() != tt.want {
+				t.Errorf("ParseWithCurrency(%q) = %v, want %s", tt.input, got, tt.want)
+			}
+		})
+	}
+}
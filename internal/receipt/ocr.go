@@ -0,0 +1,67 @@
+package receipt
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+)
+
+// OCR extracts the text of a receipt photo
+type OCR interface {
+	// Recognize returns the text recognized in an image, one receipt line per line
+	Recognize(ctx context.Context, image io.Reader) (string, error)
+}
+
+// Tesseract recognizes text with a local tesseract installation. It needs no
+// network access; images never leave the machine.
+type Tesseract struct {
+	Path      string // tesseract binary, defaults to "tesseract" on the PATH
+	Languages string // tesseract language codes such as "eng+deu", defaults to "eng"
+}
+
+// NewTesseract creates a tesseract adapter using the given binary and languages
+func NewTesseract(path, languages string) *Tesseract {
+	return &Tesseract{Path: path, Languages: languages}
+}
+
+// Recognize runs tesseract on the image, reading it from stdin
+func (t *Tesseract) Recognize(ctx context.Context, image io.Reader) (string, error) {
+	path := t.Path
+	if path == "" {
+		path = "tesseract"
+	}
+	languages := t.Languages
+	if languages == "" {
+		languages = "eng"
+	}
+
+	// Page segmentation mode 4 treats the image as a single column of text of
+	// variable sizes, which keeps item names and prices on the same line
+	cmd := exec.CommandContext(ctx, path, "stdin", "stdout", "-l", languages, "--psm", "4")
+	cmd.Stdin = image
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("run tesseract: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.String(), nil
+}
+
+// Fake returns a fixed text for every image. It is meant for tests and for
+// running the bot without an OCR engine installed.
+type Fake struct {
+	Text string
+	Err  error
+}
+
+// Recognize returns the fake's text or error
+func (f *Fake) Recognize(ctx context.Context, image io.Reader) (string, error) {
+	if f.Err != nil {
+		return "", f.Err
+	}
+	return f.Text, nil
+}
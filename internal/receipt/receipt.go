@@ -0,0 +1,178 @@
+// Package receipt turns photos of bills into line items and totals that can
+// be attributed to group members (the whitepaper's Algorithm B).
+package receipt
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/currency"
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/money"
+)
+
+// ErrUnreadable is returned when no line items or total can be found in a receipt text
+var ErrUnreadable = errors.New("receipt has no readable items or total")
+
+// Item is a line of a receipt
+type Item struct {
+	Name     string
+	Quantity int
+	Price    money.Money // price of the whole line, i.e. unit price times quantity
+}
+
+// Receipt holds the line items and totals read from a receipt
+type Receipt struct {
+	Items []Item
+	Tax   money.Money // tax added on top of the item prices, zero if included in them
+	Tip   money.Money
+	Total money.Money
+}
+
+// Subtotal returns the sum of the item prices
+func (r *Receipt) Subtotal() money.Money {
+	sum := money.Zero(r.Total.Currency())
+	for _, item := range r.Items {
+		sum, _ = sum.Add(item.Price)
+	}
+	return sum
+}
+
+// Line keywords in the languages of the bot's message catalogs, matched
+// against the lower cased label of a line. Subtotals are checked before totals.
+var (
+	subtotalWords = []string{"subtotal", "sub total", "zwischensumme", "промежуточный итог", "подытог"}
+	totalWords    = []string{"total", "summe", "gesamt", "zu zahlen", "amount due", "balance due", "итого", "к оплате", "сумма"}
+	taxWords      = []string{"tax", "vat", "mwst", "ust", "ндс", "налог"}
+	tipWords      = []string{"tip", "gratuity", "service charge", "trinkgeld", "чаевые", "обслуживание"}
+	paymentWords  = []string{"cash", "change", "card", "visa", "mastercard", "paid", "tendered", "bar", "rückgeld", "gegeben", "наличные", "сдача", "карта"}
+)
+
+var (
+	// priceLine matches a label followed by an amount, optionally followed by
+	// a currency symbol and a one letter tax class as printed on many receipts
+	priceLine = regexp.MustCompile(`^(.*?)[\s:]*[€$£]?\s*(-?\d[\d.,']*)\s*(?:€|\$|£|[A-Z]{3})?\s*[A-Z]?$`)
+	// quantityPrefix matches item labels such as "2 x Beer" or "2x Beer"
+	quantityPrefix = regexp.MustCompile(`^(\d{1,3})\s*[xX×*]\s*(.+)$`)
+)
+
+// Parse reads the line items, tax, tip and total of a receipt text in the
+// given currency. Lines after the total, such as payment details, are ignored.
+// A missing total is computed from the items, tax and tip.
+func Parse(text string, cur currency.Currency) (*Receipt, error) {
+	r := &Receipt{Tax: money.Zero(cur), Tip: money.Zero(cur), Total: money.Zero(cur)}
+	hasTotal := false
+
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		m := priceLine.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+		label := strings.TrimSpace(m[1])
+		amount, ok := parseAmount(m[2], cur)
+		if !ok || label == "" {
+			continue
+		}
+
+		lower := strings.ToLower(label)
+		switch {
+		case containsAny(lower, subtotalWords):
+			// Recomputed from the items
+		case containsAny(lower, totalWords):
+			r.Total, hasTotal = amount, true
+		case containsAny(lower, taxWords):
+			r.Tax, _ = r.Tax.Add(amount)
+		case containsAny(lower, tipWords):
+			r.Tip, _ = r.Tip.Add(amount)
+		case containsAny(lower, paymentWords), amount.IsNegative():
+			// Payments are not part of the bill and discounts are already
+			// reflected in the total
+		default:
+			r.Items = append(r.Items, parseItem(label, amount))
+		}
+		if hasTotal {
+			break
+		}
+	}
+
+	if len(r.Items) == 0 && !hasTotal {
+		return nil, ErrUnreadable
+	}
+
+	subtotal := r.Subtotal()
+	withTax, _ := subtotal.Add(r.Tax)
+	withTip, _ := withTax.Add(r.Tip)
+	switch {
+	case !hasTotal:
+		r.Total = withTip
+	case r.Tax.IsPositive() && withTip != r.Total:
+		// Tax printed for information only, such as VAT included in the prices
+		if withoutTax, _ := subtotal.Add(r.Tip); withoutTax == r.Total {
+			r.Tax = money.Zero(cur)
+		}
+	}
+	if !r.Total.IsPositive() {
+		return nil, fmt.Errorf("%w: total must be positive", ErrUnreadable)
+	}
+	return r, nil
+}
+
+// parseItem splits an optional quantity off an item label
+func parseItem(label string, price money.Money) Item {
+	item := Item{Name: label, Quantity: 1, Price: price}
+	if m := quantityPrefix.FindStringSubmatch(label); m != nil {
+		if n, err := strconv.Atoi(m[1]); err == nil && n > 0 {
+			item.Name, item.Quantity = strings.TrimSpace(m[2]), n
+		}
+	}
+	return item
+}
+
+// parseAmount parses a printed amount such as "1.234,50" or "1,234.50".
+// Amounts of currencies with minor units must show them, which keeps
+// quantities, dates and table numbers from being read as prices.
+func parseAmount(s string, cur currency.Currency) (money.Money, bool) {
+	s = strings.ReplaceAll(s, "'", "")
+	var digits string
+	if cur.MinorUnits > 0 {
+		i := strings.LastIndexAny(s, ".,")
+		if i < 0 || len(s)-i-1 != cur.MinorUnits {
+			return money.Money{}, false
+		}
+		digits = strings.NewReplacer(".", "", ",", "").Replace(s[:i]) + "." + s[i+1:]
+	} else {
+		digits = strings.NewReplacer(".", "", ",", "").Replace(s)
+	}
+
+	amount, err := money.Parse(digits, cur)
+	if err != nil {
+		return money.Money{}, false
+	}
+	return amount, true
+}
+
+// containsAny reports whether s contains any of the words as whole words
+func containsAny(s string, words []string) bool {
+	isLetter := func(r rune) bool { return unicode.IsLetter(r) }
+	for _, w := range words {
+		for i := 0; i < len(s); {
+			j := strings.Index(s[i:], w)
+			if j < 0 {
+				break
+			}
+			start, end := i+j, i+j+len(w)
+			before, _ := utf8.DecodeLastRuneInString(s[:start])
+			after, _ := utf8.DecodeRuneInString(s[end:])
+			if !isLetter(before) && !isLetter(after) {
+				return true
+			}
+			i = end
+		}
+	}
+	return false
+}
@@ -0,0 +1,155 @@
+package receipt
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/currency"
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/money"
+)
+
+func TestParse(t *testing.T) {
+	eur := currency.MustLookup("EUR")
+	usd := currency.MustLookup("USD")
+	jpy := currency.MustLookup("JPY")
+
+	tests := []struct {
+		name      string
+		text      string
+		cur       currency.Currency
+		wantItems []Item
+		wantTax   int64
+		wantTip   int64
+		wantTotal int64
+		wantErr   error
+	}{
+		{
+			name: "items and total",
+			text: "PIZZERIA ROMA\nTable 12\n2 x Beer 9.00\nMargherita 11.50\nTiramisu 6.50\nTotal 27.00\nCard 27.00\nThank you!",
+			cur:  eur,
+			wantItems: []Item{
+				{Name: "Beer", Quantity: 2, Price: money.New(900, eur)},
+				{Name: "Margherita", Quantity: 1, Price: money.New(1150, eur)},
+				{Name: "Tiramisu", Quantity: 1, Price: money.New(650, eur)},
+			},
+			wantTotal: 2700,
+		},
+		{
+			name: "tax and tip on top",
+			text: "Burger $12.00\nFries $4.00\nSubtotal $16.00\nTax $1.40\nTip $3.00\nTotal $20.40",
+			cur:  usd,
+			wantItems: []Item{
+				{Name: "Burger", Quantity: 1, Price: money.New(1200, usd)},
+				{Name: "Fries", Quantity: 1, Price: money.New(400, usd)},
+			},
+			wantTax:   140,
+			wantTip:   300,
+			wantTotal: 2040,
+		},
+		{
+			name: "tax included in prices",
+			text: "Schnitzel 14,90 A\nRadler 4,20 A\nMwSt 3,05\nSumme 19,10 €",
+			cur:  eur,
+			wantItems: []Item{
+				{Name: "Schnitzel", Quantity: 1, Price: money.New(1490, eur)},
+				{Name: "Radler", Quantity: 1, Price: money.New(420, eur)},
+			},
+			wantTotal: 1910,
+		},
+		{
+			name: "discounts are in the total",
+			text: "Pasta 10.00\nDiscount -2.00\nTotal 8.00",
+			cur:  eur,
+			wantItems: []Item{
+				{Name: "Pasta", Quantity: 1, Price: money.New(1000, eur)},
+			},
+			wantTotal: 800,
+		},
+		{
+			name: "total computed from items",
+			text: "Coffee 3.20\nCroissant 2.10",
+			cur:  eur,
+			wantItems: []Item{
+				{Name: "Coffee", Quantity: 1, Price: money.New(320, eur)},
+				{Name: "Croissant", Quantity: 1, Price: money.New(210, eur)},
+			},
+			wantTotal: 530,
+		},
+		{
+			name:      "total only",
+			text:      "ИТОГО: 1.234,50",
+			cur:       eur,
+			wantTotal: 123450,
+		},
+		{
+			name: "no minor units",
+			text: "Ramen 980\n2x Gyoza 1,200\nTotal 2,180",
+			cur:  jpy,
+			wantItems: []Item{
+				{Name: "Ramen", Quantity: 1, Price: money.New(980, jpy)},
+				{Name: "Gyoza", Quantity: 2, Price: money.New(1200, jpy)},
+			},
+			wantTotal: 2180,
+		},
+		{
+			name:    "unreadable",
+			text:    "blurry\nphoto",
+			cur:     eur,
+			wantErr: ErrUnreadable,
+		},
+		{
+			name:    "no positive total",
+			text:    "Total 0.00",
+			cur:     eur,
+			wantErr: ErrUnreadable,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The text is read through the fake OCR like a photo would be
+			ocr := &Fake{Text: tt.text}
+			text, err := ocr.Recognize(context.Background(), strings.NewReader("photo"))
+			if err != nil {
+				t.Fatalf("Recognize() error = %v", err)
+			}
+
+			r, err := Parse(text, tt.cur)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("Parse() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+
+			if len(r.Items) != len(tt.wantItems) {
+				t.Fatalf("Parse() items = %+v, want %+v", r.Items, tt.wantItems)
+			}
+			for i, want := range tt.wantItems {
+				if r.Items[i] != want {
+					t.Errorf("item %d = %+v, want %+v", i, r.Items[i], want)
+				}
+			}
+			if r.Tax.Amount() != tt.wantTax || r.Tip.Amount() != tt.wantTip || r.Total.Amount() != tt.wantTotal {
+				t.Errorf("tax, tip, total = %d, %d, %d, want %d, %d, %d",
+					r.Tax.Amount(), r.Tip.Amount(), r.Total.Amount(), tt.wantTax, tt.wantTip, tt.wantTotal)
+			}
+			if r.Total.Currency().Code != tt.cur.Code {
+				t.Errorf("total currency = %s, want %s", r.Total.Currency().Code, tt.cur.Code)
+			}
+		})
+	}
+}
+
+func TestFakeError(t *testing.T) {
+	want := errors.New("camera shy")
+	ocr := &Fake{Text: "Total 1.00", Err: want}
+	if _, err := ocr.Recognize(context.Background(), strings.NewReader("photo")); !errors.Is(err, want) {
+		t.Fatalf("Recognize() error = %v, want %v", err, want)
+	}
+}
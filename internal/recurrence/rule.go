@@ -0,0 +1,177 @@
+// Package recurrence implements the RRULE-like schedules of recurring expenses.
+package recurrence
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Frequency is how often a rule repeats
+type Frequency string
+
+// Supported frequencies
+const (
+	Daily   Frequency = "DAILY"
+	Weekly  Frequency = "WEEKLY"
+	Monthly Frequency = "MONTHLY"
+	Yearly  Frequency = "YEARLY"
+)
+
+// Rule is a subset of an iCalendar RRULE. Occurrences are whole days in UTC.
+type Rule struct {
+	Freq     Frequency
+	Interval int // repeat every Interval periods, at least 1
+	// ByMonthDay is the day of the month of monthly and yearly rules.
+	// Months without that day use their last day instead.
+	ByMonthDay int
+	Until      time.Time // last possible occurrence date, zero for none
+}
+
+// Parse parses a rule in RRULE syntax ("FREQ=MONTHLY;BYMONTHDAY=1;UNTIL=2026-12-31")
+// or as a bare frequency ("monthly"). Keys are case-insensitive.
+func Parse(s string) (Rule, error) {
+	s = strings.TrimPrefix(strings.TrimSpace(s), "RRULE:")
+	if s == "" {
+		return Rule{}, fmt.Errorf("empty rule")
+	}
+	if !strings.Contains(s, "=") {
+		s = "FREQ=" + s
+	}
+
+	r := Rule{Interval: 1}
+	for _, part := range strings.Split(s, ";") {
+		key, value, ok := strings.Cut(part, "=")
+		if !ok {
+			return Rule{}, fmt.Errorf("invalid rule part %q", part)
+		}
+		value = strings.TrimSpace(value)
+
+		switch strings.ToUpper(strings.TrimSpace(key)) {
+		case "FREQ":
+			r.Freq = Frequency(strings.ToUpper(value))
+		case "INTERVAL":
+			n, err := strconv.Atoi(value)
+			if err != nil {
+				return Rule{}, fmt.Errorf("invalid INTERVAL %q", value)
+			}
+			r.Interval = n
+		case "BYMONTHDAY":
+			n, err := strconv.Atoi(value)
+			if err != nil {
+				return Rule{}, fmt.Errorf("invalid BYMONTHDAY %q", value)
+			}
+			r.ByMonthDay = n
+		case "UNTIL":
+			until, err := parseDate(value)
+			if err != nil {
+				return Rule{}, fmt.Errorf("invalid UNTIL %q", value)
+			}
+			r.Until = until
+		default:
+			return Rule{}, fmt.Errorf("unsupported rule part %q", key)
+		}
+	}
+	return r, r.Validate()
+}
+
+// parseDate accepts 2006-01-02 and the RRULE forms 20060102 and 20060102T150405Z
+func parseDate(s string) (time.Time, error) {
+	for _, layout := range []string{time.DateOnly, "20060102", "20060102T150405Z"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return day(t), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid date %q", s)
+}
+
+// Validate reports whether the rule is well formed
+func (r Rule) Validate() error {
+	switch r.Freq {
+	case Daily, Weekly, Monthly, Yearly:
+	case "":
+		return fmt.Errorf("FREQ is required")
+	default:
+		return fmt.Errorf("unsupported FREQ %q", r.Freq)
+	}
+	if r.Interval < 1 {
+		return fmt.Errorf("INTERVAL must be at least 1")
+	}
+	if r.ByMonthDay < 0 || r.ByMonthDay > 31 {
+		return fmt.Errorf("BYMONTHDAY must be between 1 and 31")
+	}
+	if r.ByMonthDay != 0 && r.Freq != Monthly && r.Freq != Yearly {
+		return fmt.Errorf("BYMONTHDAY is only supported for MONTHLY and YEARLY rules")
+	}
+	return nil
+}
+
+// String returns the rule in RRULE syntax
+func (r Rule) String() string {
+	parts := []string{"FREQ=" + string(r.Freq)}
+	if r.Interval > 1 {
+		parts = append(parts, "INTERVAL="+strconv.Itoa(r.Interval))
+	}
+	if r.ByMonthDay != 0 {
+		parts = append(parts, "BYMONTHDAY="+strconv.Itoa(r.ByMonthDay))
+	}
+	if !r.Until.IsZero() {
+		parts = append(parts, "UNTIL="+r.Until.Format("20060102"))
+	}
+	return strings.Join(parts, ";")
+}
+
+// First returns the first occurrence on or after from. Monthly and yearly
+// rules without a day of the month are anchored to from's day.
+// It returns false if the rule ends before its first occurrence.
+func (r Rule) First(from time.Time) (Rule, time.Time, bool) {
+	from = day(from)
+	if (r.Freq == Monthly || r.Freq == Yearly) && r.ByMonthDay == 0 {
+		r.ByMonthDay = from.Day()
+	}
+
+	first := from
+	if r.Freq == Monthly || r.Freq == Yearly {
+		first = onMonthDay(from.Year(), from.Month(), r.ByMonthDay)
+		if first.Before(from) {
+			first = r.advance(first)
+		}
+	}
+	return r, first, r.Until.IsZero() || !first.After(r.Until)
+}
+
+// Next returns the occurrence following prev, or false if the rule has ended
+func (r Rule) Next(prev time.Time) (time.Time, bool) {
+	next := r.advance(day(prev))
+	return next, r.Until.IsZero() || !next.After(r.Until)
+}
+
+// advance moves an occurrence forward by one interval
+func (r Rule) advance(t time.Time) time.Time {
+	switch r.Freq {
+	case Daily:
+		return t.AddDate(0, 0, r.Interval)
+	case Weekly:
+		return t.AddDate(0, 0, 7*r.Interval)
+	case Monthly:
+		// Step from the first of the month so short months don't overflow
+		m := time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC).AddDate(0, r.Interval, 0)
+		return onMonthDay(m.Year(), m.Month(), r.ByMonthDay)
+	case Yearly:
+		return onMonthDay(t.Year()+r.Interval, t.Month(), r.ByMonthDay)
+	}
+	return t
+}
+
+// onMonthDay returns the given day of a month, clamped to the month's last day
+func onMonthDay(year int, month time.Month, dayOfMonth int) time.Time {
+	last := time.Date(year, month+1, 0, 0, 0, 0, 0, time.UTC).Day()
+	return time.Date(year, month, min(dayOfMonth, last), 0, 0, 0, 0, time.UTC)
+}
+
+// day truncates a time to midnight UTC of its date
+func day(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
@@ -0,0 +1,127 @@
+// Package scheduler runs periodic background jobs such as creating recurring expenses.
+package scheduler
+
+import (
+	"context"
+	"time"
+
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/clock"
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/pkg/logger"
+)
+
+// DefaultInterval is how often jobs run if no interval is configured
+const DefaultInterval = time.Minute
+
+// JobFunc is a periodic job. now is the time of the current tick; jobs must
+// be idempotent since a tick may be retried after a failure.
+type JobFunc func(ctx context.Context, now time.Time) error
+
+type job struct {
+	name string
+	fn   JobFunc
+}
+
+// Scheduler runs its jobs one after another on every tick
+type Scheduler struct {
+	interval time.Duration
+	clock    clock.Clock
+	jobs     []job
+	observe  func(job string, duration time.Duration, err error)
+	// jobCtx is cancelled by Abort to cut off the running job
+	jobCtx   context.Context
+	abortJob context.CancelFunc
+	logger   logger.Logger
+}
+
+// New creates a scheduler ticking at the given interval. Jobs are passed the
+// time of the clock rather than the ticker so they can run against a fake clock.
+func New(interval time.Duration, clk clock.Clock, log logger.Logger) *Scheduler {
+	if interval <= 0 {
+		interval = DefaultInterval
+	}
+	s := &Scheduler{
+		interval: interval,
+		clock:    clk,
+		logger:   log.With(logger.String("component", "scheduler")),
+	}
+	s.jobCtx, s.abortJob = context.WithCancel(context.Background())
+	return s
+}
+
+// Add registers a job. Jobs must be added before Run is called.
+func (s *Scheduler) Add(name string, fn JobFunc) {
+	s.jobs = append(s.jobs, job{name: name, fn: fn})
+}
+
+// Observe sets a function called after every job run, e.g. to record
+// metrics. It must be set before Run is called.
+func (s *Scheduler) Observe(fn func(job string, duration time.Duration, err error)) {
+	s.observe = fn
+}
+
+// Run runs all jobs immediately and then on every tick until ctx is
+// cancelled. A job running then is finished before Run returns.
+func (s *Scheduler) Run(ctx context.Context) {
+	s.logger.Info("Starting scheduler",
+		logger.Duration("interval", s.interval),
+		logger.Int("jobs", len(s.jobs)),
+	)
+
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	s.Tick(ctx)
+	for {
+		select {
+		case <-ctx.Done():
+			s.logger.Info("Scheduler stopped")
+			return
+		case <-ticker.C:
+			s.Tick(ctx)
+		}
+	}
+}
+
+// Abort cancels the context of the running job, e.g. when waiting for it on
+// shutdown takes too long
+func (s *Scheduler) Abort() {
+	s.abortJob()
+}
+
+// Tick runs every job once at the clock's current time.
+// A failing job does not prevent the others from running. Once ctx is
+// cancelled no further job is started, but the running one may finish.
+func (s *Scheduler) Tick(ctx context.Context) {
+	now := s.clock.Now()
+	for _, j := range s.jobs {
+		if ctx.Err() != nil {
+			return
+		}
+
+		start := time.Now()
+		err := s.runJob(ctx, j, now)
+		if s.observe != nil {
+			s.observe(j.name, time.Since(start), err)
+		}
+		if err != nil {
+			s.logger.ErrorContext(ctx, "Scheduled job failed",
+				logger.String("job", j.name),
+				logger.Error(err),
+			)
+			continue
+		}
+		s.logger.DebugContext(ctx, "Scheduled job finished",
+			logger.String("job", j.name),
+			logger.Duration("duration", time.Since(start)),
+		)
+	}
+}
+
+// runJob runs a job with a context that is not cancelled with ctx, only by Abort
+func (s *Scheduler) runJob(ctx context.Context, j job, now time.Time) error {
+	ctx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	defer cancel()
+	stop := context.AfterFunc(s.jobCtx, cancel)
+	defer stop()
+	return j.fn(ctx, now)
+}
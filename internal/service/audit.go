@@ -0,0 +1,166 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/audit"
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/models"
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/storage"
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/pkg/logger"
+)
+
+type sourceKey struct{}
+
+// WithSource returns a context recording where a change originates from
+// (models.SourceBot, models.SourceMiniApp). Changes made with a context
+// without a source are audited as models.SourceSystem.
+func WithSource(ctx context.Context, source string) context.Context {
+	return context.WithValue(ctx, sourceKey{}, source)
+}
+
+// sourceFrom returns the change source stored in the context
+func sourceFrom(ctx context.Context) string {
+	if source, ok := ctx.Value(sourceKey{}).(string); ok && source != "" {
+		return source
+	}
+	return models.SourceSystem
+}
+
+// auditRecord describes a single audited mutation
+type auditRecord struct {
+	groupID    int64
+	actorID    int64
+	action     string
+	entityType string
+	entityID   int64
+	before     any // nil for creations
+	after      any // nil for deletions
+}
+
+// recordAudit appends entries to the group's audit chain. It must be called
+// inside the transaction that performs the mutation so the log and the data
+// never diverge.
+func recordAudit(ctx context.Context, tx storage.Storage, records ...auditRecord) error {
+	now := time.Now().UTC()
+	for _, r := range records {
+		entry := &models.AuditEntry{
+			GroupID:    r.groupID,
+			ActorID:    r.actorID,
+			Action:     r.action,
+			EntityType: r.entityType,
+			EntityID:   r.entityID,
+			Source:     sourceFrom(ctx),
+			CreatedAt:  now,
+		}
+
+		var err error
+		if entry.Before, err = marshalSnapshot(r.before); err != nil {
+			return fmt.Errorf("audit %s %d: %w", r.entityType, r.entityID, err)
+		}
+		if entry.After, err = marshalSnapshot(r.after); err != nil {
+			return fmt.Errorf("audit %s %d: %w", r.entityType, r.entityID, err)
+		}
+
+		prev, err := tx.GetLastAuditEntry(ctx, r.groupID)
+		if errors.Is(err, storage.ErrNotFound) {
+			prev = nil
+		} else if err != nil {
+			return fmt.Errorf("get last audit entry: %w", err)
+		}
+
+		audit.Seal(entry, prev)
+		if err := tx.AppendAuditEntry(ctx, entry); err != nil {
+			return fmt.Errorf("append audit entry: %w", err)
+		}
+	}
+	return nil
+}
+
+// marshalSnapshot encodes an entity snapshot, nil stays empty
+func marshalSnapshot(v any) (json.RawMessage, error) {
+	if v == nil {
+		return nil, nil
+	}
+	return json.Marshal(v)
+}
+
+// participantRecords returns audit records for created or deleted participants
+func participantRecords(groupID, actorID int64, action string, participants []models.Participant) []auditRecord {
+	records := make([]auditRecord, 0, len(participants))
+	for _, p := range participants {
+		r := auditRecord{
+			groupID:    groupID,
+			actorID:    actorID,
+			action:     action,
+			entityType: models.EntityParticipant,
+			entityID:   p.ID,
+		}
+		if action == models.AuditDelete {
+			r.before = p
+		} else {
+			r.after = p
+		}
+		records = append(records, r)
+	}
+	return records
+}
+
+// AuditService gives read access to the audit log of groups
+type AuditService struct {
+	store  storage.Storage
+	logger logger.Logger
+}
+
+// NewAuditService creates a new audit service
+func NewAuditService(store storage.Storage, log logger.Logger) *AuditService {
+	return &AuditService{store: store, logger: log}
+}
+
+// History is a page of a group's audit log together with the result of
+// verifying the whole chain
+type History struct {
+	Entries []models.AuditEntry // newest first
+	Total   int
+	// ChainError is set if the chain fails verification
+	ChainError *audit.ChainError
+}
+
+// History returns the newest limit entries of a group's audit log.
+// A limit of zero or less returns all entries.
+func (s *AuditService) History(ctx context.Context, actorID, groupID int64, limit int) (*History, error) {
+	ctx, span := tracer.Start(ctx, "AuditService.History")
+	defer span.End()
+
+	if _, err := requireMember(ctx, s.store, groupID, actorID); err != nil {
+		return nil, err
+	}
+
+	entries, err := s.store.GetGroupAuditEntries(ctx, groupID)
+	if err != nil {
+		return nil, fmt.Errorf("get group audit entries: %w", err)
+	}
+
+	history := &History{Total: len(entries)}
+	if err := audit.Verify(entries); err != nil {
+		if !errors.As(err, &history.ChainError) {
+			return nil, fmt.Errorf("verify audit chain: %w", err)
+		}
+		s.logger.ErrorContext(ctx, "Audit chain verification failed",
+			logger.Int64("group_id", groupID),
+			logger.Error(err),
+		)
+	}
+
+	if limit > 0 && len(entries) > limit {
+		entries = entries[len(entries)-limit:]
+	}
+	history.Entries = make([]models.AuditEntry, 0, len(entries))
+	for i := len(entries) - 1; i >= 0; i-- {
+		history.Entries = append(history.Entries, entries[i])
+	}
+	return history, nil
+}
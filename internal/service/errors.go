@@ -0,0 +1,36 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrNotFound is returned when a requested entity does not exist
+	ErrNotFound = errors.New("not found")
+	// ErrForbidden is returned when the actor is not allowed to perform an action
+	ErrForbidden = errors.New("forbidden")
+	// ErrConflict is returned when an action conflicts with the current state
+	ErrConflict = errors.New("conflict")
+)
+
+// ValidationError describes invalid input passed to a service
+type ValidationError struct {
+	Field   string
+	Message string
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("invalid %s: %s", e.Field, e.Message)
+}
+
+// invalid creates a new validation error
+func invalid(field, format string, args ...any) error {
+	return &ValidationError{Field: field, Message: fmt.Sprintf(format, args...)}
+}
+
+// IsValidationError reports whether err is a validation error
+func IsValidationError(err error) bool {
+	var ve *ValidationError
+	return errors.As(err, &ve)
+}
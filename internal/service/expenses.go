@@ -0,0 +1,663 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/currency"
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/engine"
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/fx"
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/models"
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/money"
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/storage"
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/pkg/logger"
+)
+
+const maxDescriptionLength = 255
+
+// ExpenseService manages group expenses and how they are split
+type ExpenseService struct {
+	store  storage.Storage
+	calc   *engine.BalanceCalculator
+	rates  fx.RateProvider
+	logger logger.Logger
+}
+
+// NewExpenseService creates a new expense service
+func NewExpenseService(store storage.Storage, calc *engine.BalanceCalculator, rates fx.RateProvider, log logger.Logger) *ExpenseService {
+	return &ExpenseService{store: store, calc: calc, rates: rates, logger: log}
+}
+
+// CreateExpenseInput holds the data needed to create an expense
+type CreateExpenseInput struct {
+	GroupID        int64
+	PaidBy         int64 // defaults to the actor
+	Description    string
+	Amount         money.Money
+	ParticipantIDs []int64 // defaults to all group members
+	// Items make the expense itemized: it is split by the items each
+	// participant claims, unclaimed items are shared by all participants
+	Items []models.ExpenseItem
+	// Shares split the expense explicitly instead of equally. They must add
+	// up to Amount and replace ParticipantIDs; itemized expenses can't have them.
+	Shares []models.Participant
+	// Date is when the expense was incurred, zero for now
+	Date time.Time
+}
+
+// CreateExpense creates an expense split equally between its participants,
+// or by their claimed items if it is itemized.
+// Expenses in a currency other than the group base currency are converted
+// with the exchange rate at entry time, which is recorded on the expense.
+// Replays with the idempotency key of an earlier call return its expense.
+func (s *ExpenseService) CreateExpense(ctx context.Context, actorID int64, in CreateExpenseInput) (*models.Expense, []models.Participant, error) {
+	ctx, span := tracer.Start(ctx, "ExpenseService.CreateExpense")
+	defer span.End()
+
+	var expense *models.Expense
+	var participants []models.Participant
+	var replayed bool
+
+	err := withGroupTx(ctx, s.store, in.GroupID, func(ctx context.Context, tx storage.Storage) error {
+		expenseID, err := replayOf(ctx, tx, models.OperationCreateExpense, actorID)
+		if err != nil {
+			return err
+		}
+		if expenseID != 0 {
+			replayed = true
+			if expense, err = tx.GetExpense(ctx, expenseID); err != nil {
+				return wrapStorage(err, "get expense")
+			}
+			if participants, err = tx.GetExpenseParticipants(ctx, expenseID); err != nil {
+				return fmt.Errorf("get participants: %w", err)
+			}
+			return nil
+		}
+
+		expense, participants, err = s.createExpense(ctx, tx, actorID, in)
+		if err != nil {
+			return err
+		}
+		return remember(ctx, tx, models.OperationCreateExpense, actorID, expense.ID)
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	if replayed {
+		s.logger.InfoContext(ctx, "Expense creation replayed", logger.Int64("expense_id", expense.ID))
+		return expense, participants, nil
+	}
+
+	s.logger.InfoContext(ctx, "Expense created",
+		logger.Int64("expense_id", expense.ID),
+		logger.Int64("group_id", expense.GroupID),
+		logger.Stringer("amount", expense.Amount),
+		logger.Int("participants", len(participants)),
+	)
+	return expense, participants, nil
+}
+
+// createExpense validates and creates an expense within the given
+// transaction, which must hold the lock of the expense's group
+func (s *ExpenseService) createExpense(ctx context.Context, tx storage.Storage, actorID int64, in CreateExpenseInput) (*models.Expense, []models.Participant, error) {
+	var err error
+	if in.Description, err = validateDescription(in.Description); err != nil {
+		return nil, nil, err
+	}
+	if err := validateAmount(in.Amount); err != nil {
+		return nil, nil, err
+	}
+	if in.PaidBy == 0 {
+		in.PaidBy = actorID
+	}
+	if err := validateItems(in.Items, in.Amount); err != nil {
+		return nil, nil, err
+	}
+	if len(in.Shares) > 0 {
+		if len(in.Items) > 0 {
+			return nil, nil, invalid("shares", "itemized expenses are split by their items")
+		}
+		if err := validateShares(in.Shares, in.Amount); err != nil {
+			return nil, nil, err
+		}
+		in.ParticipantIDs = make([]int64, len(in.Shares))
+		for i, share := range in.Shares {
+			in.ParticipantIDs[i] = share.UserID
+		}
+	}
+
+	if _, err := requireMember(ctx, tx, in.GroupID, actorID); err != nil {
+		return nil, nil, err
+	}
+
+	group, err := tx.GetGroup(ctx, in.GroupID)
+	if err != nil {
+		return nil, nil, wrapStorage(err, "get group")
+	}
+
+	expense := &models.Expense{
+		GroupID:     in.GroupID,
+		Description: in.Description,
+		Amount:      in.Amount,
+		PaidBy:      in.PaidBy,
+		CreatedBy:   actorID,
+		CreatedAt:   in.Date,
+	}
+	if err := s.convert(ctx, group, expense); err != nil {
+		return nil, nil, err
+	}
+
+	userIDs, err := resolveParticipants(ctx, tx, in.GroupID, in.PaidBy, in.ParticipantIDs)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := tx.CreateExpense(ctx, expense); err != nil {
+		return nil, nil, fmt.Errorf("create expense: %w", err)
+	}
+
+	items := make([]models.ExpenseItem, len(in.Items))
+	for i, item := range in.Items {
+		items[i] = models.ExpenseItem{
+			ExpenseID: expense.ID,
+			Name:      strings.TrimSpace(item.Name),
+			Price:     item.Price,
+			Quantity:  max(item.Quantity, 1),
+		}
+		if err := tx.CreateExpenseItem(ctx, &items[i]); err != nil {
+			return nil, nil, fmt.Errorf("create expense item: %w", err)
+		}
+	}
+
+	var participants []models.Participant
+	if len(in.Shares) > 0 {
+		participants = make([]models.Participant, len(in.Shares))
+		for i, share := range in.Shares {
+			participants[i] = models.Participant{UserID: share.UserID, Share: share.Share}
+		}
+	} else {
+		participants = s.split(expense, items, userIDs)
+	}
+	for i := range participants {
+		participants[i].ExpenseID = expense.ID
+		if err := tx.CreateParticipant(ctx, &participants[i]); err != nil {
+			return nil, nil, fmt.Errorf("create participant: %w", err)
+		}
+	}
+
+	err = appendEvent(ctx, tx, s.calc, expense.GroupID, actorID, models.EventExpenseAdded,
+		models.ExpenseAddedPayload{Expense: *expense, Participants: participants})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	records := []auditRecord{{
+		groupID: expense.GroupID, actorID: actorID, action: models.AuditCreate,
+		entityType: models.EntityExpense, entityID: expense.ID, after: expense,
+	}}
+	records = append(records, participantRecords(expense.GroupID, actorID, models.AuditCreate, participants)...)
+	for _, item := range items {
+		records = append(records, auditRecord{
+			groupID: expense.GroupID, actorID: actorID, action: models.AuditCreate,
+			entityType: models.EntityExpenseItem, entityID: item.ID, after: item,
+		})
+	}
+	if err := recordAudit(ctx, tx, records...); err != nil {
+		return nil, nil, err
+	}
+	return expense, participants, nil
+}
+
+// validateDescription returns the trimmed description of an expense
+func validateDescription(description string) (string, error) {
+	description = strings.TrimSpace(description)
+	if description == "" {
+		return "", invalid("description", "is required")
+	}
+	if len(description) > maxDescriptionLength {
+		return "", invalid("description", "must be at most %d characters", maxDescriptionLength)
+	}
+	return description, nil
+}
+
+// validateAmount checks the amount of an expense
+func validateAmount(amount money.Money) error {
+	if !amount.IsPositive() {
+		return invalid("amount", "must be positive")
+	}
+	if amount.Currency().Code == "" {
+		return invalid("amount", "currency is required")
+	}
+	return nil
+}
+
+// validateItems checks the line items of an itemized expense
+func validateItems(items []models.ExpenseItem, amount money.Money) error {
+	for _, item := range items {
+		name := strings.TrimSpace(item.Name)
+		if name == "" {
+			return invalid("items", "every item needs a name")
+		}
+		if len(name) > maxDescriptionLength {
+			return invalid("items", "item names must be at most %d characters", maxDescriptionLength)
+		}
+		if !item.Price.IsPositive() {
+			return invalid("items", "price of %q must be positive", name)
+		}
+		if !item.Price.SameCurrency(amount) {
+			return invalid("items", "price of %q must be in %s", name, amount.Currency())
+		}
+		if item.Quantity < 0 {
+			return invalid("items", "quantity of %q must be positive", name)
+		}
+	}
+	return nil
+}
+
+// validateShares checks the explicit shares of an expense
+func validateShares(shares []models.Participant, amount money.Money) error {
+	sum := money.Zero(amount.Currency())
+	for _, share := range shares {
+		if share.Share.IsNegative() {
+			return invalid("shares", "share of user %d must not be negative", share.UserID)
+		}
+		var err error
+		if sum, err = sum.Add(share.Share); err != nil {
+			return invalid("shares", "share of user %d must be in %s", share.UserID, amount.Currency())
+		}
+	}
+	if cmp, _ := sum.Cmp(amount); cmp != 0 {
+		return invalid("shares", "add up to %s instead of %s", sum, amount)
+	}
+	return nil
+}
+
+// split splits an expense between users, by the items they claimed if it is itemized
+func (s *ExpenseService) split(expense *models.Expense, items []models.ExpenseItem, userIDs []int64) []models.Participant {
+	if len(items) == 0 {
+		return s.calc.SplitEqual(expense.Amount, userIDs)
+	}
+	return s.calc.SplitItems(expense.Amount, items, userIDs)
+}
+
+// UpdateExpenseInput holds the changes to apply to an expense.
+// Nil fields are left unchanged.
+type UpdateExpenseInput struct {
+	Description    *string
+	Amount         *money.Money
+	ParticipantIDs []int64 // re-split between these users, nil keeps the current participants
+}
+
+// ExpenseChange describes the effect of editing or deleting an expense
+type ExpenseChange struct {
+	Before       *models.Expense
+	After        *models.Expense // nil if the expense was deleted
+	Participants []models.Participant
+	// Delta is the change of each affected user's balance in the group base currency
+	Delta map[int64]money.Money
+}
+
+// UpdateExpense changes an expense. Its shares are only recomputed if the
+// amount or participants change: new participants split it equally, while a
+// new amount scales the current shares. Itemized expenses are always split
+// by their claimed items. Only the creator of the expense or a group admin
+// may edit it.
+func (s *ExpenseService) UpdateExpense(ctx context.Context, actorID, expenseID int64, in UpdateExpenseInput) (*ExpenseChange, error) {
+	ctx, span := tracer.Start(ctx, "ExpenseService.UpdateExpense")
+	defer span.End()
+
+	if in.Description != nil {
+		description, err := validateDescription(*in.Description)
+		if err != nil {
+			return nil, err
+		}
+		in.Description = &description
+	}
+	if in.Amount != nil {
+		if err := validateAmount(*in.Amount); err != nil {
+			return nil, err
+		}
+	}
+
+	change := &ExpenseChange{}
+	err := s.withExpenseTx(ctx, expenseID, func(ctx context.Context, tx storage.Storage) error {
+		expense, group, err := s.authorizeChange(ctx, tx, actorID, expenseID)
+		if err != nil {
+			return err
+		}
+		before, err := computeBalances(ctx, tx, s.calc, group)
+		if err != nil {
+			return err
+		}
+
+		previous := *expense
+		change.Before = &previous
+
+		items, err := tx.GetExpenseItems(ctx, expense.ID)
+		if err != nil {
+			return fmt.Errorf("get expense items: %w", err)
+		}
+		if in.Description != nil {
+			expense.Description = *in.Description
+		}
+		amountChanged := in.Amount != nil && *in.Amount != expense.Amount
+		if amountChanged {
+			if err := validateItems(items, *in.Amount); err != nil {
+				return err
+			}
+			expense.Amount = *in.Amount
+			if err := s.convert(ctx, group, expense); err != nil {
+				return err
+			}
+		}
+
+		current, err := tx.GetExpenseParticipants(ctx, expenseID)
+		if err != nil {
+			return fmt.Errorf("get expense participants: %w", err)
+		}
+		change.Participants = current
+		if amountChanged || in.ParticipantIDs != nil {
+			next, err := s.resplit(ctx, tx, expense, items, current, in.ParticipantIDs)
+			if err != nil {
+				return err
+			}
+			if change.Participants, err = replaceParticipants(ctx, tx, expense.ID, current, next); err != nil {
+				return err
+			}
+		}
+
+		if err := tx.UpdateExpense(ctx, expense); err != nil {
+			return fmt.Errorf("update expense: %w", err)
+		}
+
+		err = appendEvent(ctx, tx, s.calc, group.ID, actorID, models.EventExpenseEdited, models.ExpenseEditedPayload{
+			Before:             previous,
+			BeforeParticipants: current,
+			After:              *expense,
+			AfterParticipants:  change.Participants,
+		})
+		if err != nil {
+			return err
+		}
+
+		records := []auditRecord{{
+			groupID: group.ID, actorID: actorID, action: models.AuditUpdate,
+			entityType: models.EntityExpense, entityID: expense.ID, before: previous, after: expense,
+		}}
+		if amountChanged || in.ParticipantIDs != nil {
+			records = append(records, participantRecords(group.ID, actorID, models.AuditDelete, current)...)
+			records = append(records, participantRecords(group.ID, actorID, models.AuditCreate, change.Participants)...)
+		}
+		if err := recordAudit(ctx, tx, records...); err != nil {
+			return err
+		}
+
+		after, err := computeBalances(ctx, tx, s.calc, group)
+		if err != nil {
+			return err
+		}
+		change.After = expense
+		change.Delta, err = balanceDelta(before, after)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.logger.InfoContext(ctx, "Expense updated",
+		logger.Int64("expense_id", expenseID),
+		logger.Int64("updated_by", actorID),
+	)
+	return change, nil
+}
+
+// resplit returns the new shares of an edited expense. New participants
+// split it equally; otherwise the current shares are scaled to its amount so
+// unequal splits keep their proportions.
+func (s *ExpenseService) resplit(ctx context.Context, tx storage.Storage, expense *models.Expense, items []models.ExpenseItem, current []models.Participant, participantIDs []int64) ([]models.Participant, error) {
+	userIDs := participantIDs
+	if userIDs == nil {
+		for _, p := range current {
+			userIDs = append(userIDs, p.UserID)
+		}
+	}
+	userIDs, err := resolveParticipants(ctx, tx, expense.GroupID, expense.PaidBy, userIDs)
+	if err != nil {
+		return nil, err
+	}
+	if participantIDs != nil || len(items) > 0 || len(current) == 0 {
+		return s.split(expense, items, userIDs), nil
+	}
+
+	ratios := make([]int64, len(current))
+	for i, p := range current {
+		ratios[i] = p.Share.Amount()
+	}
+	shares := expense.Amount.Allocate(ratios...)
+	next := make([]models.Participant, len(current))
+	for i, p := range current {
+		next[i] = models.Participant{UserID: p.UserID, Share: shares[i]}
+	}
+	return next, nil
+}
+
+// replaceParticipants replaces the participants of an expense so shares always
+// match its current amount and items, and returns the stored new participants
+func replaceParticipants(ctx context.Context, tx storage.Storage, expenseID int64, current, next []models.Participant) ([]models.Participant, error) {
+	for _, p := range current {
+		if err := tx.DeleteParticipant(ctx, p.ID); err != nil {
+			return nil, fmt.Errorf("delete participant: %w", err)
+		}
+	}
+	for i := range next {
+		next[i].ExpenseID = expenseID
+		if err := tx.CreateParticipant(ctx, &next[i]); err != nil {
+			return nil, fmt.Errorf("create participant: %w", err)
+		}
+	}
+	return next, nil
+}
+
+// DeleteExpense deletes an expense with its participants.
+// Only the creator of the expense or a group admin may delete it.
+func (s *ExpenseService) DeleteExpense(ctx context.Context, actorID, expenseID int64) (*ExpenseChange, error) {
+	ctx, span := tracer.Start(ctx, "ExpenseService.DeleteExpense")
+	defer span.End()
+
+	change := &ExpenseChange{}
+	err := s.withExpenseTx(ctx, expenseID, func(ctx context.Context, tx storage.Storage) error {
+		expense, group, err := s.authorizeChange(ctx, tx, actorID, expenseID)
+		if err != nil {
+			return err
+		}
+		before, err := computeBalances(ctx, tx, s.calc, group)
+		if err != nil {
+			return err
+		}
+
+		change.Before = expense
+		change.Participants, err = tx.GetExpenseParticipants(ctx, expenseID)
+		if err != nil {
+			return fmt.Errorf("get expense participants: %w", err)
+		}
+		items, err := tx.GetExpenseItems(ctx, expenseID)
+		if err != nil {
+			return fmt.Errorf("get expense items: %w", err)
+		}
+
+		if err := tx.DeleteExpense(ctx, expenseID); err != nil {
+			return wrapStorage(err, "delete expense")
+		}
+
+		err = appendEvent(ctx, tx, s.calc, group.ID, actorID, models.EventExpenseDeleted,
+			models.ExpenseDeletedPayload{Expense: *expense, Participants: change.Participants})
+		if err != nil {
+			return err
+		}
+
+		records := []auditRecord{{
+			groupID: group.ID, actorID: actorID, action: models.AuditDelete,
+			entityType: models.EntityExpense, entityID: expense.ID, before: expense,
+		}}
+		records = append(records, participantRecords(group.ID, actorID, models.AuditDelete, change.Participants)...)
+		for _, item := range items {
+			records = append(records, auditRecord{
+				groupID: group.ID, actorID: actorID, action: models.AuditDelete,
+				entityType: models.EntityExpenseItem, entityID: item.ID, before: item,
+			})
+		}
+		if err := recordAudit(ctx, tx, records...); err != nil {
+			return err
+		}
+
+		after, err := computeBalances(ctx, tx, s.calc, group)
+		if err != nil {
+			return err
+		}
+		change.Delta, err = balanceDelta(before, after)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.logger.InfoContext(ctx, "Expense deleted",
+		logger.Int64("expense_id", expenseID),
+		logger.Int64("deleted_by", actorID),
+	)
+	return change, nil
+}
+
+// withExpenseTx runs fn in a transaction holding the lock of an expense's
+// group, which never changes
+func (s *ExpenseService) withExpenseTx(ctx context.Context, expenseID int64, fn storage.TxFunc) error {
+	expense, err := s.store.GetExpense(ctx, expenseID)
+	if err != nil {
+		return wrapStorage(err, "get expense")
+	}
+	return withGroupTx(ctx, s.store, expense.GroupID, fn)
+}
+
+// authorizeChange loads an expense and its group and checks that the actor
+// created the expense or is an admin of the group
+func (s *ExpenseService) authorizeChange(ctx context.Context, tx storage.Storage, actorID, expenseID int64) (*models.Expense, *models.Group, error) {
+	expense, err := tx.GetExpense(ctx, expenseID)
+	if err != nil {
+		return nil, nil, wrapStorage(err, "get expense")
+	}
+
+	member, err := requireMember(ctx, tx, expense.GroupID, actorID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if expense.CreatedBy != actorID && member.Role != models.RoleAdmin {
+		return nil, nil, fmt.Errorf("user %d may not change expense %d: %w", actorID, expenseID, ErrForbidden)
+	}
+
+	group, err := tx.GetGroup(ctx, expense.GroupID)
+	if err != nil {
+		return nil, nil, wrapStorage(err, "get group")
+	}
+	return expense, group, nil
+}
+
+// GetExpense returns an expense and its participants
+func (s *ExpenseService) GetExpense(ctx context.Context, actorID, expenseID int64) (*models.Expense, []models.Participant, error) {
+	ctx, span := tracer.Start(ctx, "ExpenseService.GetExpense")
+	defer span.End()
+
+	expense, err := s.store.GetExpense(ctx, expenseID)
+	if err != nil {
+		return nil, nil, wrapStorage(err, "get expense")
+	}
+	if _, err := requireMember(ctx, s.store, expense.GroupID, actorID); err != nil {
+		return nil, nil, err
+	}
+
+	participants, err := s.store.GetExpenseParticipants(ctx, expenseID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("get expense participants: %w", err)
+	}
+	return expense, participants, nil
+}
+
+// ListExpenses returns all expenses of a group
+func (s *ExpenseService) ListExpenses(ctx context.Context, actorID, groupID int64) ([]models.Expense, error) {
+	ctx, span := tracer.Start(ctx, "ExpenseService.ListExpenses")
+	defer span.End()
+
+	if _, err := requireMember(ctx, s.store, groupID, actorID); err != nil {
+		return nil, err
+	}
+
+	expenses, err := s.store.GetGroupExpenses(ctx, groupID)
+	if err != nil {
+		return nil, fmt.Errorf("get group expenses: %w", err)
+	}
+	return expenses, nil
+}
+
+// convert records the exchange rate and base amount of the expense
+func (s *ExpenseService) convert(ctx context.Context, group *models.Group, expense *models.Expense) error {
+	base, err := currency.Lookup(group.BaseCurrency)
+	if err != nil {
+		return fmt.Errorf("group %d base currency: %w", group.ID, err)
+	}
+
+	cur := expense.Amount.Currency()
+	if cur == base {
+		expense.ExchangeRate = "1"
+		expense.BaseAmount = expense.Amount
+		return nil
+	}
+
+	rate, err := s.rates.Rate(ctx, cur.Code, base.Code, time.Now())
+	if errors.Is(err, fx.ErrRateUnavailable) {
+		return invalid("currency", "no exchange rate from %s to %s is available", cur.Code, base.Code)
+	}
+	if err != nil {
+		return fmt.Errorf("get exchange rate: %w", err)
+	}
+
+	expense.ExchangeRate = fx.FormatRate(rate)
+	expense.BaseAmount = fx.Convert(expense.Amount, base, rate)
+	return nil
+}
+
+// resolveParticipants validates the payer and participants of an expense.
+// If no participants are given, all group members participate.
+func resolveParticipants(ctx context.Context, tx storage.Storage, groupID, paidBy int64, participantIDs []int64) ([]int64, error) {
+	members, err := tx.GetGroupMembers(ctx, groupID)
+	if err != nil {
+		return nil, fmt.Errorf("get group members: %w", err)
+	}
+	isMember := make(map[int64]bool, len(members))
+	for _, m := range members {
+		isMember[m.UserID] = true
+	}
+
+	if !isMember[paidBy] {
+		return nil, invalid("paid_by", "user %d is not a group member", paidBy)
+	}
+
+	userIDs := participantIDs
+	if len(userIDs) == 0 {
+		for _, m := range members {
+			userIDs = append(userIDs, m.UserID)
+		}
+	}
+	seen := make(map[int64]bool, len(userIDs))
+	for _, userID := range userIDs {
+		if !isMember[userID] {
+			return nil, invalid("participants", "user %d is not a group member", userID)
+		}
+		if seen[userID] {
+			return nil, invalid("participants", "user %d is listed twice", userID)
+		}
+		seen[userID] = true
+	}
+	return userIDs, nil
+}
@@ -0,0 +1,115 @@
+package service
+
+import (
+	"errors"
+	"maps"
+	"testing"
+
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/currency"
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/models"
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/money"
+)
+
+func TestUpdateExpenseShares(t *testing.T) {
+	description := "lunch"
+
+	tests := []struct {
+		name string
+		in   func(f *fixture) UpdateExpenseInput
+		want func(f *fixture) map[int64]int64
+	}{
+		{
+			name: "description keeps unequal shares",
+			in:   func(f *fixture) UpdateExpenseInput { return UpdateExpenseInput{Description: &description} },
+			want: func(f *fixture) map[int64]int64 {
+				return map[int64]int64{f.users[0].ID: 1000, f.users[1].ID: 2000}
+			},
+		},
+		{
+			name: "same amount keeps unequal shares",
+			in: func(f *fixture) UpdateExpenseInput {
+				amount := eurs(3000)
+				return UpdateExpenseInput{Amount: &amount}
+			},
+			want: func(f *fixture) map[int64]int64 {
+				return map[int64]int64{f.users[0].ID: 1000, f.users[1].ID: 2000}
+			},
+		},
+		{
+			name: "new amount scales shares",
+			in: func(f *fixture) UpdateExpenseInput {
+				amount := eurs(4500)
+				return UpdateExpenseInput{Amount: &amount}
+			},
+			want: func(f *fixture) map[int64]int64 {
+				return map[int64]int64{f.users[0].ID: 1500, f.users[1].ID: 3000}
+			},
+		},
+		{
+			name: "new participants split equally",
+			in: func(f *fixture) UpdateExpenseInput {
+				return UpdateExpenseInput{ParticipantIDs: []int64{f.users[0].ID, f.users[1].ID, f.users[2].ID}}
+			},
+			want: func(f *fixture) map[int64]int64 {
+				return map[int64]int64{f.users[0].ID: 1000, f.users[1].ID: 1000, f.users[2].ID: 1000}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFixture(t)
+			expense := f.expense(t, CreateExpenseInput{
+				Amount: eurs(3000),
+				Shares: []models.Participant{
+					{UserID: f.users[0].ID, Share: eurs(1000)},
+					{UserID: f.users[1].ID, Share: eurs(2000)},
+				},
+			})
+
+			change, err := f.svc.Expenses.UpdateExpense(f.ctx, f.users[0].ID, expense.ID, tt.in(f))
+			if err != nil {
+				t.Fatalf("UpdateExpense() error = %v", err)
+			}
+			want := tt.want(f)
+			if got := f.shares(t, expense.ID); !maps.Equal(got, want) {
+				t.Errorf("shares = %v, want %v", got, want)
+			}
+			if len(change.Participants) != len(want) {
+				t.Errorf("change has %d participants, want %d", len(change.Participants), len(want))
+			}
+		})
+	}
+}
+
+func TestUpdateExpenseValidatesAmount(t *testing.T) {
+	f := newFixture(t)
+	itemized := f.expense(t, CreateExpenseInput{
+		Amount: eurs(1500),
+		Items: []models.ExpenseItem{
+			{Name: "pizza", Price: eurs(1000)},
+			{Name: "beer", Price: eurs(500)},
+		},
+	})
+
+	tests := []struct {
+		name   string
+		amount money.Money
+		field  string
+	}{
+		{name: "no currency", amount: money.Money{}, field: "amount"},
+		{name: "zero", amount: eurs(0), field: "amount"},
+		{name: "negative", amount: eurs(-100), field: "amount"},
+		{name: "items in another currency", amount: money.New(1500, currency.MustLookup("USD")), field: "items"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := f.svc.Expenses.UpdateExpense(f.ctx, f.users[0].ID, itemized.ID, UpdateExpenseInput{Amount: &tt.amount})
+			var ve *ValidationError
+			if !errors.As(err, &ve) || ve.Field != tt.field {
+				t.Errorf("UpdateExpense() error = %v, want invalid %s", err, tt.field)
+			}
+		})
+	}
+}
@@ -0,0 +1,198 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/export"
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/models"
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/storage"
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/pkg/logger"
+)
+
+// ExportService writes the history of groups for reconciliation elsewhere
+type ExportService struct {
+	store  storage.Storage
+	logger logger.Logger
+}
+
+// NewExportService creates a new export service
+func NewExportService(store storage.Storage, log logger.Logger) *ExportService {
+	return &ExportService{store: store, logger: log}
+}
+
+// ExportRange limits an export to records created in [From, To).
+// Zero bounds are open.
+type ExportRange struct {
+	From time.Time
+	To   time.Time
+}
+
+// ParseExportRange parses the bounds of an export given as dates (YYYY-MM-DD)
+// or RFC 3339 times. An end date includes the whole day. Empty bounds are open.
+func ParseExportRange(from, to string) (ExportRange, error) {
+	var period ExportRange
+	var err error
+	if from != "" {
+		if period.From, err = parseBound(from, false); err != nil {
+			return ExportRange{}, invalid("from", "must be a date (YYYY-MM-DD) or RFC 3339 time")
+		}
+	}
+	if to != "" {
+		if period.To, err = parseBound(to, true); err != nil {
+			return ExportRange{}, invalid("to", "must be a date (YYYY-MM-DD) or RFC 3339 time")
+		}
+	}
+	return period, nil
+}
+
+// parseBound parses a range bound, moving end dates to the start of the next day
+func parseBound(v string, end bool) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, nil
+	}
+	day, err := time.Parse(time.DateOnly, v)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if end {
+		day = day.AddDate(0, 0, 1)
+	}
+	return day, nil
+}
+
+// Export writes every expense with its participant shares, followed by every
+// settlement, of a group created in the range. Records are read and encoded
+// one at a time so the history is never loaded at once. The encoder is closed
+// on success.
+func (s *ExportService) Export(ctx context.Context, actorID, groupID int64, period ExportRange, enc export.Encoder) error {
+	ctx, span := tracer.Start(ctx, "ExportService.Export")
+	defer span.End()
+
+	if _, err := requireMember(ctx, s.store, groupID, actorID); err != nil {
+		return err
+	}
+	if !period.From.IsZero() && !period.To.IsZero() && !period.From.Before(period.To) {
+		return invalid("range", "start must be before end")
+	}
+
+	names := &userNames{store: s.store, names: make(map[int64]string)}
+
+	var expenses, settlements int
+	err := s.store.EachGroupExpense(ctx, groupID, period.From, period.To, func(expense models.Expense) error {
+		expenses++
+		return s.writeExpense(ctx, enc, names, expense)
+	})
+	if err != nil {
+		return fmt.Errorf("export expenses: %w", err)
+	}
+
+	err = s.store.EachGroupSettlement(ctx, groupID, period.From, period.To, func(settlement models.Settlement) error {
+		settlements++
+		return enc.Write(export.Row{
+			Record:           export.RecordSettlement,
+			Date:             settlement.CreatedAt,
+			SettlementID:     settlement.ID,
+			UserID:           settlement.FromUser,
+			UserName:         names.get(ctx, settlement.FromUser),
+			CounterpartyID:   settlement.ToUser,
+			CounterpartyName: names.get(ctx, settlement.ToUser),
+			Amount:           settlement.Amount,
+			BaseAmount:       settlement.Amount,
+			Status:           settlement.Status,
+		})
+	})
+	if err != nil {
+		return fmt.Errorf("export settlements: %w", err)
+	}
+
+	if err := enc.Close(); err != nil {
+		return fmt.Errorf("close export: %w", err)
+	}
+
+	s.logger.InfoContext(ctx, "Group exported",
+		logger.Int64("group_id", groupID),
+		logger.Int64("actor_id", actorID),
+		logger.Int("expenses", expenses),
+		logger.Int("settlements", settlements))
+	return nil
+}
+
+// writeExpense writes an expense row followed by one share row per participant.
+// Base amounts of shares are allocated exactly as the balance engine does, so
+// they add up to the expense's base amount.
+func (s *ExportService) writeExpense(ctx context.Context, enc export.Encoder, names *userNames, expense models.Expense) error {
+	participants, err := s.store.GetExpenseParticipants(ctx, expense.ID)
+	if err != nil {
+		return fmt.Errorf("get participants of expense %d: %w", expense.ID, err)
+	}
+
+	payer := names.get(ctx, expense.PaidBy)
+	err = enc.Write(export.Row{
+		Record:       export.RecordExpense,
+		Date:         expense.CreatedAt,
+		ExpenseID:    expense.ID,
+		Description:  expense.Description,
+		UserID:       expense.PaidBy,
+		UserName:     payer,
+		Amount:       expense.Amount,
+		ExchangeRate: expense.ExchangeRate,
+		BaseAmount:   expense.BaseAmount,
+	})
+	if err != nil || len(participants) == 0 {
+		return err
+	}
+
+	weights := make([]int64, len(participants))
+	for i, p := range participants {
+		weights[i] = p.Share.Amount()
+	}
+	for i, base := range expense.BaseAmount.Allocate(weights...) {
+		p := participants[i]
+		err := enc.Write(export.Row{
+			Record:           export.RecordShare,
+			Date:             expense.CreatedAt,
+			ExpenseID:        expense.ID,
+			Description:      expense.Description,
+			UserID:           p.UserID,
+			UserName:         names.get(ctx, p.UserID),
+			CounterpartyID:   expense.PaidBy,
+			CounterpartyName: payer,
+			Amount:           p.Share,
+			ExchangeRate:     expense.ExchangeRate,
+			BaseAmount:       base,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// userNames caches the display names of the users seen during an export
+type userNames struct {
+	store storage.Storage
+	names map[int64]string
+}
+
+// get returns the @username or full name of a user, or an empty string for
+// users that no longer exist
+func (n *userNames) get(ctx context.Context, userID int64) string {
+	if name, ok := n.names[userID]; ok {
+		return name
+	}
+
+	var name string
+	user, err := n.store.GetUser(ctx, userID)
+	switch {
+	case err != nil:
+	case user.Username != "":
+		name = "@" + user.Username
+	default:
+		name = strings.TrimSpace(user.FirstName + " " + user.LastName)
+	}
+	n.names[userID] = name
+	return name
+}
@@ -0,0 +1,295 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/currency"
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/engine"
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/models"
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/storage"
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/pkg/logger"
+)
+
+const maxGroupNameLength = 128
+
+// GroupService manages expense groups and their members
+type GroupService struct {
+	store  storage.Storage
+	calc   *engine.BalanceCalculator
+	logger logger.Logger
+}
+
+// NewGroupService creates a new group service
+func NewGroupService(store storage.Storage, calc *engine.BalanceCalculator, log logger.Logger) *GroupService {
+	return &GroupService{store: store, calc: calc, logger: log}
+}
+
+// CreateGroupInput holds the data needed to create a group
+type CreateGroupInput struct {
+	Name         string
+	Description  string
+	ChatID       int64  // Telegram chat to bind the group to, 0 for none
+	BaseCurrency string // defaults to DefaultCurrency
+}
+
+// CreateGroup creates a new group with the actor as its admin
+func (s *GroupService) CreateGroup(ctx context.Context, actorID int64, in CreateGroupInput) (*models.Group, error) {
+	ctx, span := tracer.Start(ctx, "GroupService.CreateGroup")
+	defer span.End()
+
+	in.Name = strings.TrimSpace(in.Name)
+	if in.Name == "" {
+		return nil, invalid("name", "is required")
+	}
+	if len(in.Name) > maxGroupNameLength {
+		return nil, invalid("name", "must be at most %d characters", maxGroupNameLength)
+	}
+	if in.BaseCurrency == "" {
+		in.BaseCurrency = DefaultCurrency
+	}
+	base, err := currency.Lookup(in.BaseCurrency)
+	if err != nil {
+		return nil, invalid("base_currency", "%v", err)
+	}
+
+	group := &models.Group{
+		Name:         in.Name,
+		Description:  strings.TrimSpace(in.Description),
+		ChatID:       in.ChatID,
+		BaseCurrency: base.Code,
+		CreatedBy:    actorID,
+	}
+
+	err = s.store.WithTx(ctx, func(ctx context.Context, tx storage.Storage) error {
+		if in.ChatID != 0 {
+			_, err := tx.GetGroupByChatID(ctx, in.ChatID)
+			if err == nil {
+				return fmt.Errorf("chat %d already has a group: %w", in.ChatID, ErrConflict)
+			}
+			if !errors.Is(err, storage.ErrNotFound) {
+				return fmt.Errorf("get group by chat: %w", err)
+			}
+		}
+
+		if err := tx.CreateGroup(ctx, group); err != nil {
+			return fmt.Errorf("create group: %w", err)
+		}
+
+		admin := &models.GroupMember{GroupID: group.ID, UserID: actorID, Role: models.RoleAdmin}
+		if err := tx.AddMember(ctx, admin); err != nil {
+			return fmt.Errorf("add admin: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.logger.InfoContext(ctx, "Group created",
+		logger.Int64("group_id", group.ID),
+		logger.Int64("created_by", actorID),
+	)
+	return group, nil
+}
+
+// SetBaseCurrency changes the base currency of a group.
+// Only admins may change it and only while the group has no expenses,
+// since recorded exchange rates are relative to the base currency.
+func (s *GroupService) SetBaseCurrency(ctx context.Context, actorID, groupID int64, code string) (*models.Group, error) {
+	ctx, span := tracer.Start(ctx, "GroupService.SetBaseCurrency")
+	defer span.End()
+
+	base, err := currency.Lookup(code)
+	if err != nil {
+		return nil, invalid("base_currency", "%v", err)
+	}
+
+	var group *models.Group
+	err = withGroupTx(ctx, s.store, groupID, func(ctx context.Context, tx storage.Storage) error {
+		member, err := requireMember(ctx, tx, groupID, actorID)
+		if err != nil {
+			return err
+		}
+		if member.Role != models.RoleAdmin {
+			return fmt.Errorf("user %d is not an admin of group %d: %w", actorID, groupID, ErrForbidden)
+		}
+
+		expenses, err := tx.GetGroupExpenses(ctx, groupID)
+		if err != nil {
+			return fmt.Errorf("get group expenses: %w", err)
+		}
+		if len(expenses) > 0 {
+			return fmt.Errorf("group %d already has expenses: %w", groupID, ErrConflict)
+		}
+
+		group, err = tx.GetGroup(ctx, groupID)
+		if err != nil {
+			return wrapStorage(err, "get group")
+		}
+		group.BaseCurrency = base.Code
+		if err := tx.UpdateGroup(ctx, group); err != nil {
+			return fmt.Errorf("update group: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.logger.InfoContext(ctx, "Group base currency changed",
+		logger.Int64("group_id", groupID),
+		logger.String("base_currency", base.Code),
+	)
+	return group, nil
+}
+
+// GetGroup returns a group the actor is a member of
+func (s *GroupService) GetGroup(ctx context.Context, actorID, groupID int64) (*models.Group, error) {
+	ctx, span := tracer.Start(ctx, "GroupService.GetGroup")
+	defer span.End()
+
+	if _, err := requireMember(ctx, s.store, groupID, actorID); err != nil {
+		return nil, err
+	}
+
+	group, err := s.store.GetGroup(ctx, groupID)
+	if err != nil {
+		return nil, wrapStorage(err, "get group")
+	}
+	return group, nil
+}
+
+// GetGroupByChatID returns the group bound to a Telegram chat
+func (s *GroupService) GetGroupByChatID(ctx context.Context, chatID int64) (*models.Group, error) {
+	ctx, span := tracer.Start(ctx, "GroupService.GetGroupByChatID")
+	defer span.End()
+
+	group, err := s.store.GetGroupByChatID(ctx, chatID)
+	if err != nil {
+		return nil, wrapStorage(err, "get group by chat")
+	}
+	return group, nil
+}
+
+// ListGroups returns all groups the actor is a member of
+func (s *GroupService) ListGroups(ctx context.Context, actorID int64) ([]models.Group, error) {
+	ctx, span := tracer.Start(ctx, "GroupService.ListGroups")
+	defer span.End()
+
+	groups, err := s.store.GetUserGroups(ctx, actorID)
+	if err != nil {
+		return nil, fmt.Errorf("get user groups: %w", err)
+	}
+	return groups, nil
+}
+
+// Join adds the actor to a group as a regular member.
+// Joining a group the actor is already a member of is a no-op.
+func (s *GroupService) Join(ctx context.Context, actorID, groupID int64) (*models.GroupMember, error) {
+	ctx, span := tracer.Start(ctx, "GroupService.Join")
+	defer span.End()
+
+	var member *models.GroupMember
+	err := withGroupTx(ctx, s.store, groupID, func(ctx context.Context, tx storage.Storage) error {
+		if _, err := tx.GetGroup(ctx, groupID); err != nil {
+			return wrapStorage(err, "get group")
+		}
+
+		existing, err := tx.GetMember(ctx, groupID, actorID)
+		if err == nil {
+			member = existing
+			return nil
+		}
+		if !errors.Is(err, storage.ErrNotFound) {
+			return fmt.Errorf("get member: %w", err)
+		}
+
+		member = &models.GroupMember{GroupID: groupID, UserID: actorID, Role: models.RoleMember}
+		if err := tx.AddMember(ctx, member); err != nil {
+			return fmt.Errorf("add member: %w", err)
+		}
+
+		s.logger.InfoContext(ctx, "Member joined group",
+			logger.Int64("group_id", groupID),
+			logger.Int64("user_id", actorID),
+		)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return member, nil
+}
+
+// Leave removes the actor from a group. Members can only leave once their
+// balance is settled, and the last admin cannot leave while others remain.
+func (s *GroupService) Leave(ctx context.Context, actorID, groupID int64) error {
+	ctx, span := tracer.Start(ctx, "GroupService.Leave")
+	defer span.End()
+
+	err := withGroupTx(ctx, s.store, groupID, func(ctx context.Context, tx storage.Storage) error {
+		member, err := requireMember(ctx, tx, groupID, actorID)
+		if err != nil {
+			return err
+		}
+
+		balances, err := balancesAt(ctx, tx, s.calc, groupID, time.Time{})
+		if err != nil {
+			return err
+		}
+		if balance, ok := balances[actorID]; ok && !balance.IsZero() {
+			return fmt.Errorf("user %d has an open balance of %s: %w", actorID, balance, ErrConflict)
+		}
+
+		if member.Role == models.RoleAdmin {
+			members, err := tx.GetGroupMembers(ctx, groupID)
+			if err != nil {
+				return fmt.Errorf("get group members: %w", err)
+			}
+			admins := 0
+			for _, m := range members {
+				if m.Role == models.RoleAdmin {
+					admins++
+				}
+			}
+			if admins == 1 && len(members) > 1 {
+				return fmt.Errorf("user %d is the last admin of group %d: %w", actorID, groupID, ErrConflict)
+			}
+		}
+
+		if err := tx.RemoveMember(ctx, groupID, actorID); err != nil {
+			return wrapStorage(err, "remove member")
+		}
+		return appendEvent(ctx, tx, s.calc, groupID, actorID, models.EventMemberLeft, models.MemberLeftPayload{UserID: actorID})
+	})
+	if err != nil {
+		return err
+	}
+
+	s.logger.InfoContext(ctx, "Member left group",
+		logger.Int64("group_id", groupID),
+		logger.Int64("user_id", actorID),
+	)
+	return nil
+}
+
+// Members returns the members of a group the actor belongs to
+func (s *GroupService) Members(ctx context.Context, actorID, groupID int64) ([]models.GroupMember, error) {
+	ctx, span := tracer.Start(ctx, "GroupService.Members")
+	defer span.End()
+
+	if _, err := requireMember(ctx, s.store, groupID, actorID); err != nil {
+		return nil, err
+	}
+
+	members, err := s.store.GetGroupMembers(ctx, groupID)
+	if err != nil {
+		return nil, fmt.Errorf("get group members: %w", err)
+	}
+	return members, nil
+}
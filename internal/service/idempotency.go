@@ -0,0 +1,116 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/models"
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/storage"
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/pkg/logger"
+)
+
+type idempotencyKey struct{}
+
+// WithIdempotencyKey returns a context whose writes are idempotent: creating
+// an expense or completing a settlement again with the same key and actor
+// returns the original result instead of repeating the change. Keys are
+// kept until they expire, see IdempotencyService.ExpireKeys.
+func WithIdempotencyKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, idempotencyKey{}, key)
+}
+
+// operationKey returns the key an operation of the actor is recorded with,
+// or "" if the context has no idempotency key
+func operationKey(ctx context.Context, operation string, actorID int64) string {
+	key, _ := ctx.Value(idempotencyKey{}).(string)
+	if key == "" {
+		return ""
+	}
+	return operation + ":" + strconv.FormatInt(actorID, 10) + ":" + key
+}
+
+// replayOf returns the ID of the record an operation created or changed if
+// it ran before with the context's key, or 0 if it did not. It must be
+// called inside the transaction that performs the operation.
+func replayOf(ctx context.Context, tx storage.Storage, operation string, actorID int64) (int64, error) {
+	key := operationKey(ctx, operation, actorID)
+	if key == "" {
+		return 0, nil
+	}
+	k, err := tx.GetIdempotencyKey(ctx, key)
+	if errors.Is(err, storage.ErrNotFound) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("get idempotency key: %w", err)
+	}
+	return k.ResultID, nil
+}
+
+// remember records that an operation ran with the context's key so replays
+// return its result. It must be called inside the same transaction as replayOf.
+func remember(ctx context.Context, tx storage.Storage, operation string, actorID, resultID int64) error {
+	key := operationKey(ctx, operation, actorID)
+	if key == "" {
+		return nil
+	}
+	err := tx.CreateIdempotencyKey(ctx, &models.IdempotencyKey{
+		Key:       key,
+		Operation: operation,
+		ResultID:  resultID,
+		CreatedAt: time.Now().UTC(),
+	})
+	if err != nil {
+		return fmt.Errorf("create idempotency key: %w", err)
+	}
+	return nil
+}
+
+// IdempotencyService tracks handled Telegram updates and expires the keys
+// replays are detected with
+type IdempotencyService struct {
+	store  storage.Storage
+	logger logger.Logger
+}
+
+// NewIdempotencyService creates a new idempotency service
+func NewIdempotencyService(store storage.Storage, log logger.Logger) *IdempotencyService {
+	return &IdempotencyService{store: store, logger: log}
+}
+
+// MarkUpdate records a Telegram update as handled and reports whether it
+// was new, i.e. not delivered before within the retention window
+func (s *IdempotencyService) MarkUpdate(ctx context.Context, updateID int64) (bool, error) {
+	err := s.store.CreateIdempotencyKey(ctx, &models.IdempotencyKey{
+		Key:       models.OperationUpdate + ":" + strconv.FormatInt(updateID, 10),
+		Operation: models.OperationUpdate,
+		ResultID:  updateID,
+		CreatedAt: time.Now().UTC(),
+	})
+	if errors.Is(err, storage.ErrAlreadyExists) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("create idempotency key: %w", err)
+	}
+	return true, nil
+}
+
+// ExpireKeys removes handled updates and idempotency keys recorded before
+// the given time, after which replays of them are run again
+func (s *IdempotencyService) ExpireKeys(ctx context.Context, before time.Time) (int, error) {
+	ctx, span := tracer.Start(ctx, "IdempotencyService.ExpireKeys")
+	defer span.End()
+
+	deleted, err := s.store.DeleteIdempotencyKeys(ctx, before)
+	if err != nil {
+		return 0, fmt.Errorf("delete idempotency keys: %w", err)
+	}
+	if deleted > 0 {
+		s.logger.InfoContext(ctx, "Idempotency keys expired", logger.Int("keys", deleted))
+	}
+	return deleted, nil
+}
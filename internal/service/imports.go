@@ -0,0 +1,337 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/engine"
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/importer"
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/models"
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/money"
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/storage"
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/pkg/logger"
+)
+
+// errDryRun rolls back the transaction of an import preview
+var errDryRun = errors.New("dry run")
+
+// ImportService migrates the expense history of groups from other apps.
+// An import is started from a file, the people named in it are matched to
+// group members, and it is previewed and committed in a single transaction.
+type ImportService struct {
+	store    storage.Storage
+	expenses *ExpenseService
+	calc     *engine.BalanceCalculator
+	logger   logger.Logger
+}
+
+// NewImportService creates a new import service
+func NewImportService(store storage.Storage, expenses *ExpenseService, calc *engine.BalanceCalculator, log logger.Logger) *ImportService {
+	return &ImportService{store: store, expenses: expenses, calc: calc, logger: log}
+}
+
+// StartImportInput holds the file to import into a group
+type StartImportInput struct {
+	GroupID int64
+	Source  string           // models.ImportSplitwise or models.ImportCSV
+	Mapping importer.Mapping // columns of models.ImportCSV files
+	File    io.Reader
+}
+
+// Start reads a file into a pending import. People whose name matches the
+// username or name of exactly one member are matched right away. Only group
+// admins may import.
+func (s *ImportService) Start(ctx context.Context, actorID int64, in StartImportInput) (*models.Import, error) {
+	ctx, span := tracer.Start(ctx, "ImportService.Start")
+	defer span.End()
+
+	if err := requireAdmin(ctx, s.store, in.GroupID, actorID); err != nil {
+		return nil, err
+	}
+	group, err := s.store.GetGroup(ctx, in.GroupID)
+	if err != nil {
+		return nil, wrapStorage(err, "get group")
+	}
+
+	var file *importer.File
+	switch in.Source {
+	case models.ImportSplitwise:
+		file, err = importer.ParseSplitwise(in.File)
+	case models.ImportCSV:
+		if in.Mapping.DefaultCurrency == "" {
+			in.Mapping.DefaultCurrency = group.BaseCurrency
+		}
+		file, err = importer.ParseCSV(in.File, in.Mapping)
+	default:
+		return nil, invalid("source", "must be %s or %s", models.ImportSplitwise, models.ImportCSV)
+	}
+	if err != nil {
+		return nil, invalid("file", "%v", err)
+	}
+
+	imp := &models.Import{
+		GroupID:   in.GroupID,
+		CreatedBy: actorID,
+		Source:    in.Source,
+		People:    file.People,
+		Matches:   make([]int64, len(file.People)),
+		Records:   file.Records,
+		Status:    models.ImportPending,
+	}
+	if err := s.autoMatch(ctx, imp); err != nil {
+		return nil, err
+	}
+	if err := s.store.CreateImport(ctx, imp); err != nil {
+		return nil, fmt.Errorf("create import: %w", err)
+	}
+
+	s.logger.InfoContext(ctx, "Import started",
+		logger.Int64("import_id", imp.ID),
+		logger.Int64("group_id", imp.GroupID),
+		logger.String("source", imp.Source),
+		logger.Int("records", len(imp.Records)),
+		logger.Int("people", len(imp.People)),
+	)
+	return imp, nil
+}
+
+// autoMatch matches people to the only member with the same username or name
+func (s *ImportService) autoMatch(ctx context.Context, imp *models.Import) error {
+	members, err := s.store.GetGroupMembers(ctx, imp.GroupID)
+	if err != nil {
+		return fmt.Errorf("get group members: %w", err)
+	}
+
+	candidates := make(map[string][]int64)
+	for _, m := range members {
+		user, err := s.store.GetUser(ctx, m.UserID)
+		if err != nil {
+			return wrapStorage(err, "get user")
+		}
+		names := []string{user.Username, "@" + user.Username, user.FirstName, user.FirstName + " " + user.LastName}
+		seen := make(map[string]bool)
+		for _, name := range names {
+			key := normalizeName(name)
+			if key == "" || key == "@" || seen[key] {
+				continue
+			}
+			seen[key] = true
+			candidates[key] = append(candidates[key], user.ID)
+		}
+	}
+
+	for i, person := range imp.People {
+		if ids := candidates[normalizeName(person)]; len(ids) == 1 {
+			imp.Matches[i] = ids[0]
+		}
+	}
+	return nil
+}
+
+func normalizeName(name string) string {
+	return strings.ToLower(strings.Join(strings.Fields(name), " "))
+}
+
+// Match matches the person at the given index of a pending import to a member
+func (s *ImportService) Match(ctx context.Context, actorID, importID int64, person int, userID int64) (*models.Import, error) {
+	ctx, span := tracer.Start(ctx, "ImportService.Match")
+	defer span.End()
+
+	var imp *models.Import
+	err := s.withImportTx(ctx, importID, func(ctx context.Context, tx storage.Storage) error {
+		var err error
+		imp, err = s.authorize(ctx, tx, actorID, importID)
+		if err != nil {
+			return err
+		}
+		if person < 0 || person >= len(imp.People) {
+			return invalid("person", "no person %d in import %d", person, importID)
+		}
+		if _, err := tx.GetMember(ctx, imp.GroupID, userID); errors.Is(err, storage.ErrNotFound) {
+			return invalid("user", "user %d is not a group member", userID)
+		} else if err != nil {
+			return fmt.Errorf("get member: %w", err)
+		}
+
+		imp.Matches[person] = userID
+		if err := tx.UpdateImport(ctx, imp); err != nil {
+			return fmt.Errorf("update import: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return imp, nil
+}
+
+// ImportResult describes the outcome of an import
+type ImportResult struct {
+	Import   *models.Import
+	Expenses int
+	// Balances are the group's balances after the import in its base currency
+	Balances map[int64]money.Money
+	// Delta is the change of each affected user's balance
+	Delta map[int64]money.Money
+}
+
+// Preview imports a fully matched import in a transaction that is rolled
+// back, returning the balances the group would end up with
+func (s *ImportService) Preview(ctx context.Context, actorID, importID int64) (*ImportResult, error) {
+	ctx, span := tracer.Start(ctx, "ImportService.Preview")
+	defer span.End()
+
+	return s.run(ctx, actorID, importID, true)
+}
+
+// Commit imports a fully matched import. All its records are created as
+// expenses in a single transaction, so either all or none are imported.
+func (s *ImportService) Commit(ctx context.Context, actorID, importID int64) (*ImportResult, error) {
+	ctx, span := tracer.Start(ctx, "ImportService.Commit")
+	defer span.End()
+
+	result, err := s.run(ctx, actorID, importID, false)
+	if err != nil {
+		return nil, err
+	}
+
+	s.logger.InfoContext(ctx, "Import committed",
+		logger.Int64("import_id", importID),
+		logger.Int64("group_id", result.Import.GroupID),
+		logger.Int("expenses", result.Expenses),
+	)
+	return result, nil
+}
+
+// run creates the expenses of an import, rolling them back again on a dry run
+func (s *ImportService) run(ctx context.Context, actorID, importID int64, dryRun bool) (*ImportResult, error) {
+	result := &ImportResult{}
+	err := s.withImportTx(ctx, importID, func(ctx context.Context, tx storage.Storage) error {
+		imp, err := s.authorize(ctx, tx, actorID, importID)
+		if err != nil {
+			return err
+		}
+		if n := imp.Unmatched(); n >= 0 {
+			return invalid("people", "%q is not matched to a member yet", imp.People[n])
+		}
+		result.Import = imp
+
+		group, err := tx.GetGroup(ctx, imp.GroupID)
+		if err != nil {
+			return wrapStorage(err, "get group")
+		}
+		before, err := computeBalances(ctx, tx, s.calc, group)
+		if err != nil {
+			return err
+		}
+
+		userOf := make(map[string]int64, len(imp.People))
+		for i, person := range imp.People {
+			userOf[person] = imp.Matches[i]
+		}
+		for _, record := range imp.Records {
+			in := CreateExpenseInput{
+				GroupID:     imp.GroupID,
+				PaidBy:      userOf[record.PaidBy],
+				Description: record.Description,
+				Amount:      record.Amount,
+				Shares:      importShares(record, userOf),
+				Date:        record.Date,
+			}
+			if _, _, err := s.expenses.createExpense(ctx, tx, actorID, in); err != nil {
+				var ve *ValidationError
+				if errors.As(err, &ve) {
+					return invalid(ve.Field, "line %d: %s", record.Line, ve.Message)
+				}
+				return fmt.Errorf("import line %d: %w", record.Line, err)
+			}
+			result.Expenses++
+		}
+
+		if result.Balances, err = computeBalances(ctx, tx, s.calc, group); err != nil {
+			return err
+		}
+		if result.Delta, err = balanceDelta(before, result.Balances); err != nil {
+			return err
+		}
+		if dryRun {
+			return errDryRun
+		}
+
+		imp.Status = models.ImportCommitted
+		if err := tx.UpdateImport(ctx, imp); err != nil {
+			return fmt.Errorf("update import: %w", err)
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, errDryRun) {
+		return nil, err
+	}
+	return result, nil
+}
+
+// importShares returns the shares of a record by user. People matched to the
+// same user have their shares added up.
+func importShares(record models.ImportRecord, userOf map[string]int64) []models.Participant {
+	var shares []models.Participant
+	index := make(map[int64]int)
+	for _, share := range record.Shares {
+		userID := userOf[share.Person]
+		if i, ok := index[userID]; ok {
+			if sum, err := shares[i].Share.Add(share.Amount); err == nil {
+				shares[i].Share = sum
+			}
+			continue
+		}
+		index[userID] = len(shares)
+		shares = append(shares, models.Participant{UserID: userID, Share: share.Amount})
+	}
+	return shares
+}
+
+// Cancel discards a pending import
+func (s *ImportService) Cancel(ctx context.Context, actorID, importID int64) error {
+	ctx, span := tracer.Start(ctx, "ImportService.Cancel")
+	defer span.End()
+
+	return s.withImportTx(ctx, importID, func(ctx context.Context, tx storage.Storage) error {
+		imp, err := s.authorize(ctx, tx, actorID, importID)
+		if err != nil {
+			return err
+		}
+		imp.Status = models.ImportCancelled
+		if err := tx.UpdateImport(ctx, imp); err != nil {
+			return fmt.Errorf("update import: %w", err)
+		}
+		return nil
+	})
+}
+
+// withImportTx runs fn in a transaction holding the lock of an import's
+// group, which never changes
+func (s *ImportService) withImportTx(ctx context.Context, importID int64, fn storage.TxFunc) error {
+	imp, err := s.store.GetImport(ctx, importID)
+	if err != nil {
+		return wrapStorage(err, "get import")
+	}
+	return withGroupTx(ctx, s.store, imp.GroupID, fn)
+}
+
+// authorize returns an import if it is pending and the actor, who must be a
+// group admin, may work on it
+func (s *ImportService) authorize(ctx context.Context, tx storage.Storage, actorID, importID int64) (*models.Import, error) {
+	imp, err := tx.GetImport(ctx, importID)
+	if err != nil {
+		return nil, wrapStorage(err, "get import")
+	}
+	if err := requireAdmin(ctx, tx, imp.GroupID, actorID); err != nil {
+		return nil, err
+	}
+	if imp.Status != models.ImportPending {
+		return nil, fmt.Errorf("import %d is %s: %w", importID, imp.Status, ErrConflict)
+	}
+	return imp, nil
+}
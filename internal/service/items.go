@@ -0,0 +1,141 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/models"
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/storage"
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/pkg/logger"
+)
+
+// ItemClaim describes the effect of claiming or unclaiming an expense item
+type ItemClaim struct {
+	Item    *models.ExpenseItem
+	Claimed bool // whether the actor had the item after the change
+	Change  *ExpenseChange
+}
+
+// GetExpenseItems returns an expense with its items and participants
+func (s *ExpenseService) GetExpenseItems(ctx context.Context, actorID, expenseID int64) (*models.Expense, []models.ExpenseItem, []models.Participant, error) {
+	ctx, span := tracer.Start(ctx, "ExpenseService.GetExpenseItems")
+	defer span.End()
+
+	expense, participants, err := s.GetExpense(ctx, actorID, expenseID)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	items, err := s.store.GetExpenseItems(ctx, expenseID)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("get expense items: %w", err)
+	}
+	return expense, items, participants, nil
+}
+
+// ToggleItemClaim marks an item as had by the actor, or unmarks it if the
+// actor already claimed it, and re-splits the expense by the claimed items.
+// Any group member may claim items for themselves.
+func (s *ExpenseService) ToggleItemClaim(ctx context.Context, actorID, itemID int64) (*ItemClaim, error) {
+	ctx, span := tracer.Start(ctx, "ExpenseService.ToggleItemClaim")
+	defer span.End()
+
+	item, err := s.store.GetExpenseItem(ctx, itemID)
+	if err != nil {
+		return nil, wrapStorage(err, "get expense item")
+	}
+
+	claim := &ItemClaim{Change: &ExpenseChange{}}
+	err = s.withExpenseTx(ctx, item.ExpenseID, func(ctx context.Context, tx storage.Storage) error {
+		item, err := tx.GetExpenseItem(ctx, itemID)
+		if err != nil {
+			return wrapStorage(err, "get expense item")
+		}
+		expense, err := tx.GetExpense(ctx, item.ExpenseID)
+		if err != nil {
+			return wrapStorage(err, "get expense")
+		}
+		if _, err := requireMember(ctx, tx, expense.GroupID, actorID); err != nil {
+			return err
+		}
+		group, err := tx.GetGroup(ctx, expense.GroupID)
+		if err != nil {
+			return wrapStorage(err, "get group")
+		}
+		before, err := computeBalances(ctx, tx, s.calc, group)
+		if err != nil {
+			return err
+		}
+
+		previous := *item
+		previous.ClaimedBy = slices.Clone(item.ClaimedBy)
+		if i := slices.Index(item.ClaimedBy, actorID); i >= 0 {
+			item.ClaimedBy = slices.Delete(item.ClaimedBy, i, i+1)
+		} else {
+			item.ClaimedBy = append(item.ClaimedBy, actorID)
+			claim.Claimed = true
+		}
+		if err := tx.UpdateExpenseItem(ctx, item); err != nil {
+			return fmt.Errorf("update expense item: %w", err)
+		}
+
+		current, err := tx.GetExpenseParticipants(ctx, expense.ID)
+		if err != nil {
+			return fmt.Errorf("get expense participants: %w", err)
+		}
+		items, err := tx.GetExpenseItems(ctx, expense.ID)
+		if err != nil {
+			return fmt.Errorf("get expense items: %w", err)
+		}
+		userIDs := make([]int64, 0, len(current))
+		for _, p := range current {
+			userIDs = append(userIDs, p.UserID)
+		}
+		next, err := replaceParticipants(ctx, tx, expense.ID, current, s.split(expense, items, userIDs))
+		if err != nil {
+			return err
+		}
+
+		// The expense itself is unchanged, only its split is
+		err = appendEvent(ctx, tx, s.calc, group.ID, actorID, models.EventExpenseEdited, models.ExpenseEditedPayload{
+			Before:             *expense,
+			BeforeParticipants: current,
+			After:              *expense,
+			AfterParticipants:  next,
+		})
+		if err != nil {
+			return err
+		}
+
+		records := []auditRecord{{
+			groupID: group.ID, actorID: actorID, action: models.AuditUpdate,
+			entityType: models.EntityExpenseItem, entityID: item.ID, before: previous, after: item,
+		}}
+		records = append(records, participantRecords(group.ID, actorID, models.AuditDelete, current)...)
+		records = append(records, participantRecords(group.ID, actorID, models.AuditCreate, next)...)
+		if err := recordAudit(ctx, tx, records...); err != nil {
+			return err
+		}
+
+		after, err := computeBalances(ctx, tx, s.calc, group)
+		if err != nil {
+			return err
+		}
+		claim.Item = item
+		claim.Change.Before, claim.Change.After = expense, expense
+		claim.Change.Participants = next
+		claim.Change.Delta, err = balanceDelta(before, after)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.logger.InfoContext(ctx, "Expense item claim changed",
+		logger.Int64("item_id", itemID),
+		logger.Int64("user_id", actorID),
+		logger.Bool("claimed", claim.Claimed),
+	)
+	return claim, nil
+}
@@ -0,0 +1,96 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/engine"
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/models"
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/money"
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/storage"
+)
+
+// snapshotInterval is the number of ledger events between balance snapshots
+const snapshotInterval = 50
+
+// appendEvent records a domain event in the group's ledger. It must be called
+// inside the transaction that updates the projections so both stay in sync.
+// Every snapshotInterval events the resulting balances are snapshotted.
+func appendEvent(ctx context.Context, tx storage.Storage, calc *engine.BalanceCalculator, groupID, actorID int64, eventType string, payload any) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("encode %s event: %w", eventType, err)
+	}
+
+	event := &models.LedgerEvent{
+		GroupID:    groupID,
+		Type:       eventType,
+		Payload:    data,
+		ActorID:    actorID,
+		OccurredAt: time.Now().UTC(),
+	}
+	if err := tx.AppendEvent(ctx, event); err != nil {
+		return fmt.Errorf("append %s event: %w", eventType, err)
+	}
+
+	if event.Sequence%snapshotInterval != 0 {
+		return nil
+	}
+	balances, err := balancesAt(ctx, tx, calc, groupID, time.Time{})
+	if err != nil {
+		return err
+	}
+	snapshot := &models.BalanceSnapshot{
+		GroupID:  groupID,
+		Sequence: event.Sequence,
+		At:       event.OccurredAt,
+		Balances: balances,
+	}
+	if err := tx.SaveSnapshot(ctx, snapshot); err != nil {
+		return fmt.Errorf("save snapshot: %w", err)
+	}
+	return nil
+}
+
+// balancesAt returns the group's balances as of at, or its current balances
+// if at is zero. Current balances are replayed from the newest snapshot.
+// Balances as of a time replay the whole ledger, since backdated expenses
+// recorded after a snapshot may still count before it.
+func balancesAt(ctx context.Context, store storage.Storage, calc *engine.BalanceCalculator, groupID int64, at time.Time) (map[int64]money.Money, error) {
+	if !at.IsZero() {
+		events, err := store.GetGroupEvents(ctx, groupID, 0)
+		if err != nil {
+			return nil, fmt.Errorf("get group events: %w", err)
+		}
+		balances, err := calc.ReplayAsOf(events, at)
+		if err != nil {
+			return nil, fmt.Errorf("replay ledger: %w", err)
+		}
+		return balances, nil
+	}
+
+	snapshot, err := store.GetLatestSnapshot(ctx, groupID, time.Time{})
+	if errors.Is(err, storage.ErrNotFound) {
+		snapshot = nil
+	} else if err != nil {
+		return nil, fmt.Errorf("get latest snapshot: %w", err)
+	}
+
+	var after int64
+	if snapshot != nil {
+		after = snapshot.Sequence
+	}
+	events, err := store.GetGroupEvents(ctx, groupID, after)
+	if err != nil {
+		return nil, fmt.Errorf("get group events: %w", err)
+	}
+
+	balances, err := calc.Replay(snapshot, events)
+	if err != nil {
+		return nil, fmt.Errorf("replay ledger: %w", err)
+	}
+	return balances, nil
+}
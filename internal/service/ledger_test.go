@@ -0,0 +1,129 @@
+package service
+
+import (
+	"maps"
+	"testing"
+	"time"
+
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/money"
+)
+
+func TestSnapshotReplayMatchesFullReplay(t *testing.T) {
+	f := newFixture(t)
+	alice, bob, carol := f.users[0].ID, f.users[1].ID, f.users[2].ID
+
+	// Enough events for several snapshots, with edits, deletions and settlements
+	for i := 0; i < 3*snapshotInterval; i++ {
+		expense := f.expense(t, CreateExpenseInput{Amount: eurs(int64(1000 + i)), PaidBy: []int64{alice, bob, carol}[i%3]})
+		switch i % 7 {
+		case 3:
+			amount := eurs(int64(2000 + i))
+			if _, err := f.svc.Expenses.UpdateExpense(f.ctx, alice, expense.ID, UpdateExpenseInput{Amount: &amount}); err != nil {
+				t.Fatalf("UpdateExpense() error = %v", err)
+			}
+		case 5:
+			if _, err := f.svc.Expenses.DeleteExpense(f.ctx, alice, expense.ID); err != nil {
+				t.Fatalf("DeleteExpense() error = %v", err)
+			}
+		case 6:
+			planned, err := f.svc.Settlements.PlanSettlements(f.ctx, alice, f.group.ID)
+			if err != nil {
+				t.Fatalf("PlanSettlements() error = %v", err)
+			}
+			if len(planned) > 0 {
+				if _, err := f.svc.Settlements.CompleteSettlement(f.ctx, planned[0].FromUser, planned[0].ID); err != nil {
+					t.Fatalf("CompleteSettlement() error = %v", err)
+				}
+			}
+		}
+	}
+
+	events, err := f.store.GetGroupEvents(f.ctx, f.group.ID, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) < 2*snapshotInterval {
+		t.Fatalf("only %d events, want snapshots to be taken", len(events))
+	}
+	if _, err := f.store.GetLatestSnapshot(f.ctx, f.group.ID, time.Time{}); err != nil {
+		t.Fatalf("GetLatestSnapshot() error = %v", err)
+	}
+
+	full, err := f.svc.Settlements.calc.Replay(nil, events)
+	if err != nil {
+		t.Fatalf("Replay() error = %v", err)
+	}
+	fromSnapshot, err := balancesAt(f.ctx, f.store, f.svc.Settlements.calc, f.group.ID, time.Time{})
+	if err != nil {
+		t.Fatalf("balancesAt() error = %v", err)
+	}
+	if !maps.Equal(fromSnapshot, full) {
+		t.Errorf("balances from snapshot = %v, full replay = %v", fromSnapshot, full)
+	}
+	asOfNow, err := f.svc.Settlements.calc.ReplayAsOf(events, time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatalf("ReplayAsOf() error = %v", err)
+	}
+	if !maps.Equal(asOfNow, full) {
+		t.Errorf("balances as of now = %v, full replay = %v", asOfNow, full)
+	}
+
+	recomputed, err := f.svc.Maintenance.RecomputeBalances(f.ctx, f.group.ID)
+	if err != nil {
+		t.Fatalf("RecomputeBalances() error = %v", err)
+	}
+	if !maps.Equal(recomputed, full) {
+		t.Errorf("recomputed balances = %v, full replay = %v", recomputed, full)
+	}
+
+	var sum int64
+	for _, balance := range full {
+		sum += balance.Amount()
+	}
+	if sum != 0 {
+		t.Errorf("balances sum to %d, want 0", sum)
+	}
+}
+
+func TestBalancesAtCountsExpensesByTheirDate(t *testing.T) {
+	f := newFixture(t)
+	alice, bob := f.users[0].ID, f.users[1].ID
+	march1 := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	// Recorded now but incurred on March 1, e.g. imported
+	backdated := f.expense(t, CreateExpenseInput{Amount: eurs(3000), Date: march1, ParticipantIDs: []int64{alice, bob}})
+	f.expense(t, CreateExpenseInput{Amount: eurs(1000), ParticipantIDs: []int64{alice, bob}})
+
+	tests := []struct {
+		name string
+		at   time.Time
+		want map[int64]money.Money
+	}{
+		{name: "before the backdated expense", at: march1.Add(-time.Hour), want: map[int64]money.Money{}},
+		{name: "after the backdated expense", at: march1.Add(time.Hour), want: map[int64]money.Money{alice: eurs(1500), bob: eurs(-1500)}},
+		{name: "now", at: time.Now().Add(time.Hour), want: map[int64]money.Money{alice: eurs(2000), bob: eurs(-2000)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := f.svc.Settlements.BalancesAt(f.ctx, alice, f.group.ID, tt.at)
+			if err != nil {
+				t.Fatalf("BalancesAt() error = %v", err)
+			}
+			if !maps.Equal(got, tt.want) {
+				t.Errorf("BalancesAt() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	// Deleting the backdated expense today takes it out of March too
+	if _, err := f.svc.Expenses.DeleteExpense(f.ctx, alice, backdated.ID); err != nil {
+		t.Fatalf("DeleteExpense() error = %v", err)
+	}
+	got, err := f.svc.Settlements.BalancesAt(f.ctx, alice, f.group.ID, march1.Add(time.Hour))
+	if err != nil {
+		t.Fatalf("BalancesAt() error = %v", err)
+	}
+	if len(got) != 0 {
+		t.Errorf("BalancesAt() after deletion = %v, want none", got)
+	}
+}
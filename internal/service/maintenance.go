@@ -0,0 +1,195 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/currency"
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/engine"
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/models"
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/money"
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/storage"
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/pkg/logger"
+)
+
+// MaintenanceService checks and repairs the stored balances of groups.
+// It is meant for operators and does not check group membership.
+type MaintenanceService struct {
+	store  storage.Storage
+	calc   *engine.BalanceCalculator
+	logger logger.Logger
+}
+
+// NewMaintenanceService creates a new maintenance service
+func NewMaintenanceService(store storage.Storage, calc *engine.BalanceCalculator, log logger.Logger) *MaintenanceService {
+	return &MaintenanceService{store: store, calc: calc, logger: log}
+}
+
+// BalanceCheck holds a group's balances derived in three independent ways.
+// In a consistent group all of them are equal and sum to zero.
+type BalanceCheck struct {
+	GroupID int64
+	// Ledger are the balances as the bot computes them, replayed from the newest snapshot
+	Ledger map[int64]money.Money
+	// Replayed are the balances replayed from the first ledger event, ignoring snapshots
+	Replayed map[int64]money.Money
+	// Projected are the balances calculated from the stored expenses and completed settlements
+	Projected map[int64]money.Money
+	Problems  []string
+}
+
+// OK reports whether the check found no problems
+func (c *BalanceCheck) OK() bool {
+	return len(c.Problems) == 0
+}
+
+// CheckBalances derives a group's balances from its snapshots, its full
+// ledger and its projections and reports where they disagree
+func (s *MaintenanceService) CheckBalances(ctx context.Context, groupID int64) (*BalanceCheck, error) {
+	ctx, span := tracer.Start(ctx, "MaintenanceService.CheckBalances")
+	defer span.End()
+
+	group, err := s.store.GetGroup(ctx, groupID)
+	if err != nil {
+		return nil, wrapStorage(err, "get group")
+	}
+	check := &BalanceCheck{GroupID: groupID}
+
+	if check.Ledger, err = computeBalances(ctx, s.store, s.calc, group); err != nil {
+		return nil, err
+	}
+
+	events, err := s.store.GetGroupEvents(ctx, groupID, 0)
+	if err != nil {
+		return nil, fmt.Errorf("get group events: %w", err)
+	}
+	if check.Replayed, err = s.calc.Replay(nil, events); err != nil {
+		return nil, fmt.Errorf("replay ledger: %w", err)
+	}
+
+	base, err := currency.Lookup(group.BaseCurrency)
+	if err != nil {
+		return nil, fmt.Errorf("group %d: %w", groupID, err)
+	}
+	expenses, err := s.store.GetGroupExpenses(ctx, groupID)
+	if err != nil {
+		return nil, fmt.Errorf("get group expenses: %w", err)
+	}
+	participants, err := s.store.GetGroupParticipants(ctx, groupID)
+	if err != nil {
+		return nil, fmt.Errorf("get group participants: %w", err)
+	}
+	settlements, err := s.store.GetGroupSettlements(ctx, groupID)
+	if err != nil {
+		return nil, fmt.Errorf("get group settlements: %w", err)
+	}
+	if check.Projected, err = s.calc.CalculateBalances(base, expenses, participants); err != nil {
+		return nil, fmt.Errorf("calculate balances: %w", err)
+	}
+	if check.Projected, err = s.calc.ApplySettlements(check.Projected, settlements); err != nil {
+		return nil, fmt.Errorf("apply settlements: %w", err)
+	}
+
+	for _, derived := range []struct {
+		name     string
+		balances map[int64]money.Money
+	}{
+		{"ledger", check.Ledger},
+		{"replayed", check.Replayed},
+		{"projected", check.Projected},
+	} {
+		sum := money.Zero(base)
+		for _, balance := range derived.balances {
+			if sum, err = sum.Add(balance); err != nil {
+				return nil, fmt.Errorf("sum %s balances: %w", derived.name, err)
+			}
+		}
+		if !sum.IsZero() {
+			check.Problems = append(check.Problems, fmt.Sprintf("%s balances sum to %s instead of zero", derived.name, sum))
+		}
+	}
+	for _, userID := range unionKeys(check.Ledger, check.Replayed, check.Projected) {
+		ledger, replayed, projected := balanceOf(check.Ledger, userID, base), balanceOf(check.Replayed, userID, base), balanceOf(check.Projected, userID, base)
+		if ledger != replayed || ledger != projected {
+			check.Problems = append(check.Problems, fmt.Sprintf("user %d: ledger %s, replayed %s, projected %s", userID, ledger, replayed, projected))
+		}
+	}
+	return check, nil
+}
+
+// RecomputeBalances discards a group's balance snapshots and takes them anew
+// by replaying the whole ledger, returning the resulting balances
+func (s *MaintenanceService) RecomputeBalances(ctx context.Context, groupID int64) (map[int64]money.Money, error) {
+	ctx, span := tracer.Start(ctx, "MaintenanceService.RecomputeBalances")
+	defer span.End()
+
+	var balances map[int64]money.Money
+	var snapshots int
+	err := withGroupTx(ctx, s.store, groupID, func(ctx context.Context, tx storage.Storage) error {
+		if _, err := tx.GetGroup(ctx, groupID); err != nil {
+			return wrapStorage(err, "get group")
+		}
+		events, err := tx.GetGroupEvents(ctx, groupID, 0)
+		if err != nil {
+			return fmt.Errorf("get group events: %w", err)
+		}
+		if err := tx.DeleteSnapshots(ctx, groupID); err != nil {
+			return fmt.Errorf("delete snapshots: %w", err)
+		}
+
+		balances = make(map[int64]money.Money)
+		for _, event := range events {
+			if err := s.calc.ApplyEvent(balances, event); err != nil {
+				return err
+			}
+			if event.Sequence%snapshotInterval != 0 {
+				continue
+			}
+			snapshot := &models.BalanceSnapshot{
+				GroupID:  groupID,
+				Sequence: event.Sequence,
+				At:       event.OccurredAt,
+				Balances: balances,
+			}
+			if err := tx.SaveSnapshot(ctx, snapshot); err != nil {
+				return fmt.Errorf("save snapshot: %w", err)
+			}
+			snapshots++
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.logger.InfoContext(ctx, "Balances recomputed",
+		logger.Int64("group_id", groupID),
+		logger.Int("snapshots", snapshots),
+	)
+	return balances, nil
+}
+
+// unionKeys returns the users having a balance in any of the maps in order
+func unionKeys(maps ...map[int64]money.Money) []int64 {
+	seen := make(map[int64]bool)
+	var keys []int64
+	for _, m := range maps {
+		for k := range m {
+			if !seen[k] {
+				seen[k] = true
+				keys = append(keys, k)
+			}
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+	return keys
+}
+
+// balanceOf returns a user's balance, which is zero if the user has none
+func balanceOf(balances map[int64]money.Money, userID int64, base currency.Currency) money.Money {
+	if balance, ok := balances[userID]; ok {
+		return balance
+	}
+	return money.Zero(base)
+}
@@ -0,0 +1,266 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/currency"
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/models"
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/receipt"
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/storage"
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/pkg/logger"
+)
+
+// ReceiptService reads line items and totals from receipt photos and adds
+// them as expenses once their sender confirmed them
+type ReceiptService struct {
+	store    storage.Storage
+	expenses *ExpenseService
+	ocr      receipt.OCR
+	logger   logger.Logger
+}
+
+// NewReceiptService creates a new receipt service
+func NewReceiptService(store storage.Storage, expenses *ExpenseService, ocr receipt.OCR, log logger.Logger) *ReceiptService {
+	return &ReceiptService{store: store, expenses: expenses, ocr: ocr, logger: log}
+}
+
+// StartReceiptInput holds a receipt photo to scan for a group
+type StartReceiptInput struct {
+	GroupID     int64
+	Image       io.Reader
+	Currency    string // ISO 4217 code of the amounts, empty for the group base currency
+	Description string // description of the expense added on confirmation
+}
+
+// Start scans a receipt photo into a pending receipt. Nothing is added to
+// the group until its sender confirmed what was read.
+func (s *ReceiptService) Start(ctx context.Context, actorID int64, in StartReceiptInput) (*models.Receipt, error) {
+	ctx, span := tracer.Start(ctx, "ReceiptService.Start")
+	defer span.End()
+
+	description, err := validateDescription(in.Description)
+	if err != nil {
+		return nil, err
+	}
+	r, err := s.Scan(ctx, actorID, in.GroupID, in.Image, in.Currency)
+	if err != nil {
+		return nil, err
+	}
+
+	pending := &models.Receipt{
+		GroupID:     in.GroupID,
+		CreatedBy:   actorID,
+		Description: description,
+		Items:       make([]models.ReceiptItem, len(r.Items)),
+		Tax:         r.Tax,
+		Tip:         r.Tip,
+		Total:       r.Total,
+		Status:      models.ReceiptPending,
+	}
+	for i, item := range r.Items {
+		pending.Items[i] = models.ReceiptItem{Name: item.Name, Quantity: item.Quantity, Price: item.Price}
+	}
+	if err := s.store.CreateReceipt(ctx, pending); err != nil {
+		return nil, fmt.Errorf("create receipt: %w", err)
+	}
+
+	s.logger.InfoContext(ctx, "Receipt pending confirmation",
+		logger.Int64("receipt_id", pending.ID),
+		logger.Int64("group_id", pending.GroupID),
+		logger.Bool("mismatch", pending.Mismatch()),
+	)
+	return pending, nil
+}
+
+// ToggleItem excludes an item of a pending receipt from the expense, e.g.
+// because it was misread, or includes it again
+func (s *ReceiptService) ToggleItem(ctx context.Context, actorID, receiptID int64, index int) (*models.Receipt, error) {
+	ctx, span := tracer.Start(ctx, "ReceiptService.ToggleItem")
+	defer span.End()
+
+	return s.update(ctx, actorID, receiptID, func(pending *models.Receipt) error {
+		if index < 0 || index >= len(pending.Items) {
+			return invalid("item", "receipt %d has no item %d", receiptID, index)
+		}
+		pending.Items[index].Excluded = !pending.Items[index].Excluded
+		return nil
+	})
+}
+
+// UseCharges replaces the total of a pending receipt with its included
+// items, tax and tip added up, for totals that were misread
+func (s *ReceiptService) UseCharges(ctx context.Context, actorID, receiptID int64) (*models.Receipt, error) {
+	ctx, span := tracer.Start(ctx, "ReceiptService.UseCharges")
+	defer span.End()
+
+	return s.update(ctx, actorID, receiptID, func(pending *models.Receipt) error {
+		if len(pending.IncludedItems()) == 0 {
+			return invalid("items", "the receipt has no items left to add up")
+		}
+		pending.Total = pending.Charges()
+		return nil
+	})
+}
+
+// Confirm adds a pending receipt as an expense paid by its sender. The
+// expense starts split equally and is re-split as members claim its items.
+// Receipts whose items, tax and tip do not add up to the total are rejected
+// until they are corrected.
+func (s *ReceiptService) Confirm(ctx context.Context, actorID, receiptID int64) (*models.Expense, []models.Participant, error) {
+	ctx, span := tracer.Start(ctx, "ReceiptService.Confirm")
+	defer span.End()
+
+	var expense *models.Expense
+	var participants []models.Participant
+	err := s.withReceiptTx(ctx, receiptID, func(ctx context.Context, tx storage.Storage) error {
+		pending, err := s.authorize(ctx, tx, actorID, receiptID)
+		if err != nil {
+			return err
+		}
+		if pending.Mismatch() {
+			return invalid("total", "the items add up to %s but the total is %s", pending.Charges(), pending.Total)
+		}
+
+		included := pending.IncludedItems()
+		items := make([]models.ExpenseItem, len(included))
+		for i, item := range included {
+			items[i] = models.ExpenseItem{Name: item.Name, Price: item.Price, Quantity: item.Quantity}
+		}
+		expense, participants, err = s.expenses.createExpense(ctx, tx, actorID, CreateExpenseInput{
+			GroupID:     pending.GroupID,
+			Description: pending.Description,
+			Amount:      pending.Total,
+			Items:       items,
+		})
+		if err != nil {
+			return err
+		}
+
+		pending.Status = models.ReceiptConfirmed
+		pending.ExpenseID = expense.ID
+		if err := tx.UpdateReceipt(ctx, pending); err != nil {
+			return fmt.Errorf("update receipt: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	s.logger.InfoContext(ctx, "Receipt confirmed",
+		logger.Int64("receipt_id", receiptID),
+		logger.Int64("expense_id", expense.ID),
+		logger.Stringer("amount", expense.Amount),
+	)
+	return expense, participants, nil
+}
+
+// Cancel discards a pending receipt
+func (s *ReceiptService) Cancel(ctx context.Context, actorID, receiptID int64) error {
+	ctx, span := tracer.Start(ctx, "ReceiptService.Cancel")
+	defer span.End()
+
+	_, err := s.update(ctx, actorID, receiptID, func(pending *models.Receipt) error {
+		pending.Status = models.ReceiptCancelled
+		return nil
+	})
+	return err
+}
+
+// update changes a pending receipt with fn and stores it
+func (s *ReceiptService) update(ctx context.Context, actorID, receiptID int64, fn func(pending *models.Receipt) error) (*models.Receipt, error) {
+	var pending *models.Receipt
+	err := s.withReceiptTx(ctx, receiptID, func(ctx context.Context, tx storage.Storage) error {
+		var err error
+		if pending, err = s.authorize(ctx, tx, actorID, receiptID); err != nil {
+			return err
+		}
+		if err := fn(pending); err != nil {
+			return err
+		}
+		if err := tx.UpdateReceipt(ctx, pending); err != nil {
+			return fmt.Errorf("update receipt: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return pending, nil
+}
+
+// withReceiptTx runs fn in a transaction holding the lock of a receipt's
+// group, which never changes
+func (s *ReceiptService) withReceiptTx(ctx context.Context, receiptID int64, fn storage.TxFunc) error {
+	pending, err := s.store.GetReceipt(ctx, receiptID)
+	if err != nil {
+		return wrapStorage(err, "get receipt")
+	}
+	return withGroupTx(ctx, s.store, pending.GroupID, fn)
+}
+
+// authorize returns a receipt if it is pending and the actor, who must still
+// be a member, sent it
+func (s *ReceiptService) authorize(ctx context.Context, tx storage.Storage, actorID, receiptID int64) (*models.Receipt, error) {
+	pending, err := tx.GetReceipt(ctx, receiptID)
+	if err != nil {
+		return nil, wrapStorage(err, "get receipt")
+	}
+	if _, err := requireMember(ctx, tx, pending.GroupID, actorID); err != nil {
+		return nil, err
+	}
+	if pending.CreatedBy != actorID {
+		return nil, fmt.Errorf("receipt %d was sent by user %d: %w", receiptID, pending.CreatedBy, ErrForbidden)
+	}
+	if pending.Status != models.ReceiptPending {
+		return nil, fmt.Errorf("receipt %d is %s: %w", receiptID, pending.Status, ErrConflict)
+	}
+	return pending, nil
+}
+
+// Scan recognizes a receipt photo taken for a group. Amounts are read in the
+// given currency, or the group base currency if code is empty.
+func (s *ReceiptService) Scan(ctx context.Context, actorID, groupID int64, image io.Reader, code string) (*receipt.Receipt, error) {
+	ctx, span := tracer.Start(ctx, "ReceiptService.Scan")
+	defer span.End()
+
+	if _, err := requireMember(ctx, s.store, groupID, actorID); err != nil {
+		return nil, err
+	}
+
+	if code == "" {
+		group, err := s.store.GetGroup(ctx, groupID)
+		if err != nil {
+			return nil, wrapStorage(err, "get group")
+		}
+		code = group.BaseCurrency
+	}
+	cur, err := currency.Lookup(strings.ToUpper(code))
+	if err != nil {
+		return nil, invalid("currency", "%v", err)
+	}
+
+	text, err := s.ocr.Recognize(ctx, image)
+	if err != nil {
+		return nil, fmt.Errorf("recognize receipt: %w", err)
+	}
+
+	r, err := receipt.Parse(text, cur)
+	if errors.Is(err, receipt.ErrUnreadable) {
+		return nil, invalid("receipt", "no items or total could be read from the photo")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("parse receipt: %w", err)
+	}
+
+	s.logger.InfoContext(ctx, "Receipt scanned",
+		logger.Int64("group_id", groupID),
+		logger.Int("items", len(r.Items)),
+		logger.Stringer("total", r.Total),
+	)
+	return r, nil
+}
@@ -0,0 +1,191 @@
+package service
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/models"
+)
+
+// scan starts a receipt whose photo the fake OCR reads as text
+func (f *fixture) scan(t *testing.T, text string) *models.Receipt {
+	t.Helper()
+	f.ocr.Text = text
+	pending, err := f.svc.Receipts.Start(f.ctx, f.users[0].ID, StartReceiptInput{
+		GroupID:     f.group.ID,
+		Image:       strings.NewReader("photo"),
+		Description: "lunch",
+	})
+	if err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	return pending
+}
+
+// expenses returns the number of expenses of the fixture's group
+func (f *fixture) expenses(t *testing.T) int {
+	t.Helper()
+	expenses, err := f.store.GetGroupExpenses(f.ctx, f.group.ID)
+	if err != nil {
+		t.Fatalf("GetGroupExpenses() error = %v", err)
+	}
+	return len(expenses)
+}
+
+func TestReceiptConfirm(t *testing.T) {
+	f := newFixture(t)
+	pending := f.scan(t, "2 x Beer 9.00\nMargherita 11.50\nTax 1.50\nTotal 22.00")
+
+	if pending.Status != models.ReceiptPending || pending.Mismatch() {
+		t.Fatalf("Start() = %+v, want a pending receipt that adds up", pending)
+	}
+	if n := f.expenses(t); n != 0 {
+		t.Fatalf("expenses before confirmation = %d, want 0", n)
+	}
+
+	expense, participants, err := f.svc.Receipts.Confirm(f.ctx, f.users[0].ID, pending.ID)
+	if err != nil {
+		t.Fatalf("Confirm() error = %v", err)
+	}
+	if expense.Amount != eurs(2200) || expense.Description != "lunch" || expense.PaidBy != f.users[0].ID {
+		t.Errorf("Confirm() expense = %+v, want lunch of 22.00 paid by the sender", expense)
+	}
+	if len(participants) != len(f.users) {
+		t.Errorf("Confirm() participants = %d, want %d", len(participants), len(f.users))
+	}
+	items, err := f.store.GetExpenseItems(f.ctx, expense.ID)
+	if err != nil {
+		t.Fatalf("GetExpenseItems() error = %v", err)
+	}
+	if len(items) != 2 || items[0].Name != "Beer" || items[0].Quantity != 2 || items[0].Price != eurs(900) {
+		t.Errorf("expense items = %+v, want Beer and Margherita", items)
+	}
+
+	// A receipt is added only once
+	if _, _, err := f.svc.Receipts.Confirm(f.ctx, f.users[0].ID, pending.ID); !errors.Is(err, ErrConflict) {
+		t.Errorf("second Confirm() error = %v, want ErrConflict", err)
+	}
+	if n := f.expenses(t); n != 1 {
+		t.Errorf("expenses = %d, want 1", n)
+	}
+}
+
+func TestReceiptMismatch(t *testing.T) {
+	f := newFixture(t)
+	// The soup was misread as 45.00 instead of 4.50
+	pending := f.scan(t, "Soup 45.00\nBread 2.00\nTotal 6.50")
+	if !pending.Mismatch() {
+		t.Fatalf("Mismatch() = false for items of %s and a total of %s", pending.Charges(), pending.Total)
+	}
+
+	_, _, err := f.svc.Receipts.Confirm(f.ctx, f.users[0].ID, pending.ID)
+	var ve *ValidationError
+	if !errors.As(err, &ve) || ve.Field != "total" {
+		t.Fatalf("Confirm() error = %v, want a validation error of the total", err)
+	}
+	if n := f.expenses(t); n != 0 {
+		t.Fatalf("expenses after rejected confirmation = %d, want 0", n)
+	}
+
+	// Leaving the soup out still does not add up
+	if pending, err = f.svc.Receipts.ToggleItem(f.ctx, f.users[0].ID, pending.ID, 0); err != nil {
+		t.Fatalf("ToggleItem() error = %v", err)
+	}
+	if !pending.Items[0].Excluded || !pending.Mismatch() {
+		t.Fatalf("after ToggleItem() items = %+v, mismatch = %v", pending.Items, pending.Mismatch())
+	}
+	// Keeping it again and using the sum of the items as the total does
+	if pending, err = f.svc.Receipts.ToggleItem(f.ctx, f.users[0].ID, pending.ID, 0); err != nil {
+		t.Fatalf("ToggleItem() error = %v", err)
+	}
+	if pending, err = f.svc.Receipts.UseCharges(f.ctx, f.users[0].ID, pending.ID); err != nil {
+		t.Fatalf("UseCharges() error = %v", err)
+	}
+	if pending.Mismatch() || pending.Total != eurs(4700) {
+		t.Fatalf("after UseCharges() total = %s, mismatch = %v", pending.Total, pending.Mismatch())
+	}
+
+	expense, _, err := f.svc.Receipts.Confirm(f.ctx, f.users[0].ID, pending.ID)
+	if err != nil {
+		t.Fatalf("Confirm() error = %v", err)
+	}
+	if expense.Amount != eurs(4700) {
+		t.Errorf("expense amount = %s, want 47.00", expense.Amount)
+	}
+}
+
+func TestReceiptExcludedItemsAreLeftOut(t *testing.T) {
+	f := newFixture(t)
+	// The table number was read as an item
+	pending := f.scan(t, "Table 7 3.00\nPasta 12.00\nWine 6.00\nTotal 18.00")
+	if !pending.Mismatch() {
+		t.Fatal("Mismatch() = false, want the table line to break the sum")
+	}
+
+	pending, err := f.svc.Receipts.ToggleItem(f.ctx, f.users[0].ID, pending.ID, 0)
+	if err != nil {
+		t.Fatalf("ToggleItem() error = %v", err)
+	}
+	if pending.Mismatch() {
+		t.Fatalf("Mismatch() = true after leaving out the table line, charges %s", pending.Charges())
+	}
+
+	expense, _, err := f.svc.Receipts.Confirm(f.ctx, f.users[0].ID, pending.ID)
+	if err != nil {
+		t.Fatalf("Confirm() error = %v", err)
+	}
+	items, err := f.store.GetExpenseItems(f.ctx, expense.ID)
+	if err != nil {
+		t.Fatalf("GetExpenseItems() error = %v", err)
+	}
+	if len(items) != 2 || items[0].Name != "Pasta" || items[1].Name != "Wine" {
+		t.Errorf("expense items = %+v, want Pasta and Wine", items)
+	}
+}
+
+func TestReceiptOnlySenderDecides(t *testing.T) {
+	f := newFixture(t)
+	pending := f.scan(t, "Total 10.00")
+
+	if _, _, err := f.svc.Receipts.Confirm(f.ctx, f.users[1].ID, pending.ID); !errors.Is(err, ErrForbidden) {
+		t.Errorf("Confirm() by another member error = %v, want ErrForbidden", err)
+	}
+	if err := f.svc.Receipts.Cancel(f.ctx, f.users[1].ID, pending.ID); !errors.Is(err, ErrForbidden) {
+		t.Errorf("Cancel() by another member error = %v, want ErrForbidden", err)
+	}
+
+	if err := f.svc.Receipts.Cancel(f.ctx, f.users[0].ID, pending.ID); err != nil {
+		t.Fatalf("Cancel() error = %v", err)
+	}
+	if _, _, err := f.svc.Receipts.Confirm(f.ctx, f.users[0].ID, pending.ID); !errors.Is(err, ErrConflict) {
+		t.Errorf("Confirm() after Cancel() error = %v, want ErrConflict", err)
+	}
+	if n := f.expenses(t); n != 0 {
+		t.Errorf("expenses = %d, want 0", n)
+	}
+}
+
+func TestReceiptStartErrors(t *testing.T) {
+	f := newFixture(t)
+
+	f.ocr.Text = "no prices here"
+	_, err := f.svc.Receipts.Start(f.ctx, f.users[0].ID, StartReceiptInput{
+		GroupID:     f.group.ID,
+		Image:       strings.NewReader("photo"),
+		Description: "lunch",
+	})
+	var ve *ValidationError
+	if !errors.As(err, &ve) || ve.Field != "receipt" {
+		t.Errorf("Start() of an unreadable receipt error = %v, want a validation error", err)
+	}
+
+	f.ocr.Err = errors.New("ocr failed")
+	if _, err := f.svc.Receipts.Start(f.ctx, f.users[0].ID, StartReceiptInput{
+		GroupID:     f.group.ID,
+		Image:       strings.NewReader("photo"),
+		Description: "lunch",
+	}); !errors.Is(err, f.ocr.Err) {
+		t.Errorf("Start() error = %v, want the OCR error", err)
+	}
+}
@@ -0,0 +1,285 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/models"
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/money"
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/recurrence"
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/storage"
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/pkg/logger"
+)
+
+// maxCatchUp bounds how many missed occurrences of a recurring expense are
+// created in a single run, e.g. after a long downtime
+const maxCatchUp = 31
+
+// RecurringService manages recurring expenses and creates their occurrences
+type RecurringService struct {
+	store    storage.Storage
+	expenses *ExpenseService
+	logger   logger.Logger
+}
+
+// NewRecurringService creates a new recurring expense service
+func NewRecurringService(store storage.Storage, expenses *ExpenseService, log logger.Logger) *RecurringService {
+	return &RecurringService{store: store, expenses: expenses, logger: log}
+}
+
+// CreateRecurringInput holds the data needed to create a recurring expense
+type CreateRecurringInput struct {
+	GroupID     int64
+	PaidBy      int64 // defaults to the actor
+	Description string
+	Amount      money.Money
+	Rule        string    // RRULE-like schedule, see recurrence.Parse
+	Start       time.Time // first possible occurrence, defaults to today
+}
+
+// Create creates a recurring expense. Its occurrences are split equally
+// between everyone who is a member of the group at that time.
+func (s *RecurringService) Create(ctx context.Context, actorID int64, in CreateRecurringInput) (*models.RecurringExpense, error) {
+	ctx, span := tracer.Start(ctx, "RecurringService.Create")
+	defer span.End()
+
+	in.Description = strings.TrimSpace(in.Description)
+	if in.Description == "" {
+		return nil, invalid("description", "is required")
+	}
+	if len(in.Description) > maxDescriptionLength {
+		return nil, invalid("description", "must be at most %d characters", maxDescriptionLength)
+	}
+	if !in.Amount.IsPositive() {
+		return nil, invalid("amount", "must be positive")
+	}
+	if in.PaidBy == 0 {
+		in.PaidBy = actorID
+	}
+	if in.Start.IsZero() {
+		in.Start = time.Now()
+	}
+
+	rule, err := recurrence.Parse(in.Rule)
+	if err != nil {
+		return nil, invalid("rule", "%v", err)
+	}
+	rule, first, ok := rule.First(in.Start)
+	if !ok {
+		return nil, invalid("rule", "ends before its first occurrence")
+	}
+
+	recurring := &models.RecurringExpense{
+		GroupID:     in.GroupID,
+		Description: in.Description,
+		Amount:      in.Amount,
+		PaidBy:      in.PaidBy,
+		Rule:        rule.String(),
+		NextRunAt:   first,
+		Active:      true,
+		CreatedBy:   actorID,
+	}
+
+	err = withGroupTx(ctx, s.store, in.GroupID, func(ctx context.Context, tx storage.Storage) error {
+		if _, err := requireMember(ctx, tx, in.GroupID, actorID); err != nil {
+			return err
+		}
+		if _, err := resolveParticipants(ctx, tx, in.GroupID, in.PaidBy, nil); err != nil {
+			return err
+		}
+		if err := tx.CreateRecurringExpense(ctx, recurring); err != nil {
+			return fmt.Errorf("create recurring expense: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.logger.InfoContext(ctx, "Recurring expense created",
+		logger.Int64("recurring_id", recurring.ID),
+		logger.Int64("group_id", recurring.GroupID),
+		logger.String("rule", recurring.Rule),
+	)
+	return recurring, nil
+}
+
+// List returns all recurring expenses of a group
+func (s *RecurringService) List(ctx context.Context, actorID, groupID int64) ([]models.RecurringExpense, error) {
+	ctx, span := tracer.Start(ctx, "RecurringService.List")
+	defer span.End()
+
+	if _, err := requireMember(ctx, s.store, groupID, actorID); err != nil {
+		return nil, err
+	}
+
+	recurring, err := s.store.GetGroupRecurringExpenses(ctx, groupID)
+	if err != nil {
+		return nil, fmt.Errorf("get group recurring expenses: %w", err)
+	}
+	return recurring, nil
+}
+
+// Cancel stops a recurring expense. Expenses it already created are kept.
+// Only the creator of the recurring expense or a group admin may cancel it.
+func (s *RecurringService) Cancel(ctx context.Context, actorID, recurringID int64) (*models.RecurringExpense, error) {
+	ctx, span := tracer.Start(ctx, "RecurringService.Cancel")
+	defer span.End()
+
+	var recurring *models.RecurringExpense
+
+	err := s.withRecurringTx(ctx, recurringID, func(ctx context.Context, tx storage.Storage) error {
+		var err error
+		recurring, err = tx.GetRecurringExpense(ctx, recurringID)
+		if err != nil {
+			return wrapStorage(err, "get recurring expense")
+		}
+
+		member, err := requireMember(ctx, tx, recurring.GroupID, actorID)
+		if err != nil {
+			return err
+		}
+		if recurring.CreatedBy != actorID && member.Role != models.RoleAdmin {
+			return fmt.Errorf("user %d may not cancel recurring expense %d: %w", actorID, recurringID, ErrForbidden)
+		}
+		if !recurring.Active {
+			return fmt.Errorf("recurring expense %d is not active: %w", recurringID, ErrConflict)
+		}
+
+		recurring.Active = false
+		if err := tx.UpdateRecurringExpense(ctx, recurring); err != nil {
+			return fmt.Errorf("update recurring expense: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.logger.InfoContext(ctx, "Recurring expense cancelled",
+		logger.Int64("recurring_id", recurringID),
+		logger.Int64("cancelled_by", actorID),
+	)
+	return recurring, nil
+}
+
+// RecurringRun is the outcome of materializing one recurring expense
+type RecurringRun struct {
+	Recurring models.RecurringExpense // state after the run
+	Group     models.Group
+	Expenses  []models.Expense // expenses created by the run
+	// Stopped is set if the recurring expense was deactivated because it can
+	// no longer be applied, e.g. because its creator left the group
+	Stopped error
+}
+
+// MaterializeDue creates the expenses of all recurring expenses due at now.
+// Each recurring expense is processed in its own transaction that also
+// advances its next run, so running it again for the same time creates
+// nothing twice. Failures are logged and retried on the next run.
+func (s *RecurringService) MaterializeDue(ctx context.Context, now time.Time) ([]RecurringRun, error) {
+	ctx, span := tracer.Start(ctx, "RecurringService.MaterializeDue")
+	defer span.End()
+
+	due, err := s.store.GetDueRecurringExpenses(ctx, now)
+	if err != nil {
+		return nil, fmt.Errorf("get due recurring expenses: %w", err)
+	}
+
+	var runs []RecurringRun
+	var errs []error
+	for _, recurring := range due {
+		run, err := s.materialize(ctx, recurring.ID, now)
+		if err != nil {
+			s.logger.ErrorContext(ctx, "Failed to materialize recurring expense",
+				logger.Int64("recurring_id", recurring.ID),
+				logger.Error(err),
+			)
+			errs = append(errs, fmt.Errorf("recurring expense %d: %w", recurring.ID, err))
+			continue
+		}
+		if run != nil {
+			runs = append(runs, *run)
+		}
+	}
+	return runs, errors.Join(errs...)
+}
+
+// withRecurringTx runs fn in a transaction holding the lock of a recurring
+// expense's group, which never changes
+func (s *RecurringService) withRecurringTx(ctx context.Context, recurringID int64, fn storage.TxFunc) error {
+	recurring, err := s.store.GetRecurringExpense(ctx, recurringID)
+	if err != nil {
+		return wrapStorage(err, "get recurring expense")
+	}
+	return withGroupTx(ctx, s.store, recurring.GroupID, fn)
+}
+
+// materialize creates the due occurrences of a single recurring expense
+func (s *RecurringService) materialize(ctx context.Context, recurringID int64, now time.Time) (*RecurringRun, error) {
+	var run *RecurringRun
+
+	err := s.withRecurringTx(ctx, recurringID, func(ctx context.Context, tx storage.Storage) error {
+		// Reload under the group lock, a concurrent run may already have advanced it
+		recurring, err := tx.GetRecurringExpense(ctx, recurringID)
+		if err != nil {
+			return wrapStorage(err, "get recurring expense")
+		}
+		if !recurring.Active || recurring.NextRunAt.After(now) {
+			return nil
+		}
+
+		group, err := tx.GetGroup(ctx, recurring.GroupID)
+		if err != nil {
+			return wrapStorage(err, "get group")
+		}
+		rule, err := recurrence.Parse(recurring.Rule)
+		if err != nil {
+			return fmt.Errorf("parse rule: %w", err)
+		}
+
+		run = &RecurringRun{Group: *group}
+		for i := 0; i < maxCatchUp && recurring.Active && !recurring.NextRunAt.After(now); i++ {
+			expense, _, err := s.expenses.createExpense(ctx, tx, recurring.CreatedBy, CreateExpenseInput{
+				GroupID:     recurring.GroupID,
+				PaidBy:      recurring.PaidBy,
+				Description: recurring.Description,
+				Amount:      recurring.Amount,
+			})
+			if errors.Is(err, ErrForbidden) || IsValidationError(err) {
+				recurring.Active = false
+				run.Stopped = err
+				break
+			}
+			if err != nil {
+				return err
+			}
+			run.Expenses = append(run.Expenses, *expense)
+
+			next, ok := rule.Next(recurring.NextRunAt)
+			recurring.NextRunAt = next
+			recurring.Active = ok
+		}
+
+		if err := tx.UpdateRecurringExpense(ctx, recurring); err != nil {
+			return fmt.Errorf("update recurring expense: %w", err)
+		}
+		run.Recurring = *recurring
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if run != nil {
+		s.logger.InfoContext(ctx, "Recurring expense materialized",
+			logger.Int64("recurring_id", recurringID),
+			logger.Int("expenses", len(run.Expenses)),
+			logger.Bool("active", run.Recurring.Active),
+		)
+	}
+	return run, nil
+}
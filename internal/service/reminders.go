@@ -0,0 +1,245 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/models"
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/storage"
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/pkg/logger"
+)
+
+// ReminderPolicy controls when debtors are reminded of pending settlements
+type ReminderPolicy struct {
+	After        time.Duration // age of a pending settlement before the first reminder
+	Every        time.Duration // minimum time between two reminders of a settlement
+	FirmAfter    int           // number of gentle reminders before they turn firm
+	MaxReminders int           // reminders per settlement, 0 for no limit
+	ItemsAfter   time.Duration // age of an unclaimed expense item before the group is reminded once
+	// QuietHoursStart and QuietHoursEnd are the local quiet hours of users
+	// who did not set their own
+	QuietHoursStart int
+	QuietHoursEnd   int
+}
+
+// DefaultReminderPolicy returns the reminder policy used unless configured otherwise
+func DefaultReminderPolicy() ReminderPolicy {
+	return ReminderPolicy{
+		After:           72 * time.Hour,
+		Every:           72 * time.Hour,
+		FirmAfter:       1,
+		MaxReminders:    4,
+		ItemsAfter:      24 * time.Hour,
+		QuietHoursStart: 22,
+		QuietHoursEnd:   9,
+	}
+}
+
+// ReminderService finds debtors who should be reminded of pending settlements
+type ReminderService struct {
+	store  storage.Storage
+	policy ReminderPolicy
+	logger logger.Logger
+}
+
+// NewReminderService creates a new reminder service
+func NewReminderService(store storage.Storage, policy ReminderPolicy, log logger.Logger) *ReminderService {
+	return &ReminderService{store: store, policy: policy, logger: log}
+}
+
+// DueReminder is a reminder that should be sent to the debtor of a settlement
+type DueReminder struct {
+	Settlement models.Settlement
+	Group      models.Group
+	Debtor     models.User
+	Creditor   models.User
+	Level      int // models.ReminderGentle or models.ReminderFirm
+}
+
+// Due returns the reminders that should be sent at now. Debtors who opted out
+// or are in their quiet hours are skipped; the latter are picked up again
+// once their quiet hours are over.
+func (s *ReminderService) Due(ctx context.Context, now time.Time) ([]DueReminder, error) {
+	ctx, span := tracer.Start(ctx, "ReminderService.Due")
+	defer span.End()
+
+	pending, err := s.store.GetPendingSettlements(ctx, now.Add(-s.policy.After))
+	if err != nil {
+		return nil, fmt.Errorf("get pending settlements: %w", err)
+	}
+
+	var due []DueReminder
+	for _, settlement := range pending {
+		debtor, err := s.store.GetUser(ctx, settlement.FromUser)
+		if err != nil {
+			return nil, wrapStorage(err, "get debtor")
+		}
+		if debtor.RemindersOff || s.inQuietHours(debtor, now) {
+			continue
+		}
+
+		sent, err := s.store.GetSettlementReminders(ctx, settlement.ID)
+		if err != nil {
+			return nil, fmt.Errorf("get settlement reminders: %w", err)
+		}
+		if s.policy.MaxReminders > 0 && len(sent) >= s.policy.MaxReminders {
+			continue
+		}
+		if len(sent) > 0 && now.Sub(sent[len(sent)-1].SentAt) < s.policy.Every {
+			continue
+		}
+
+		creditor, err := s.store.GetUser(ctx, settlement.ToUser)
+		if err != nil {
+			return nil, wrapStorage(err, "get creditor")
+		}
+		group, err := s.store.GetGroup(ctx, settlement.GroupID)
+		if err != nil {
+			return nil, wrapStorage(err, "get group")
+		}
+
+		level := models.ReminderGentle
+		if len(sent) >= s.policy.FirmAfter {
+			level = models.ReminderFirm
+		}
+		due = append(due, DueReminder{
+			Settlement: settlement,
+			Group:      *group,
+			Debtor:     *debtor,
+			Creditor:   *creditor,
+			Level:      level,
+		})
+	}
+	return due, nil
+}
+
+// MarkSent records that a reminder was sent so it is not repeated too soon
+func (s *ReminderService) MarkSent(ctx context.Context, due DueReminder, now time.Time) error {
+	ctx, span := tracer.Start(ctx, "ReminderService.MarkSent")
+	defer span.End()
+
+	reminder := &models.Reminder{
+		SettlementID: due.Settlement.ID,
+		UserID:       due.Debtor.ID,
+		Level:        due.Level,
+		SentAt:       now,
+	}
+	if err := s.store.CreateReminder(ctx, reminder); err != nil {
+		return fmt.Errorf("create reminder: %w", err)
+	}
+
+	s.logger.InfoContext(ctx, "Payment reminder sent",
+		logger.Int64("settlement_id", due.Settlement.ID),
+		logger.Int64("user_id", due.Debtor.ID),
+		logger.Int("level", due.Level),
+	)
+	return nil
+}
+
+// UnclaimedItems are the items of an expense nobody claimed yet
+type UnclaimedItems struct {
+	Group   models.Group
+	Expense models.Expense
+	Items   []models.ExpenseItem
+}
+
+// DueItemClaims returns the itemized expenses whose group should be reminded
+// at now to claim the remaining items. Each item is reminded of only once.
+func (s *ReminderService) DueItemClaims(ctx context.Context, now time.Time) ([]UnclaimedItems, error) {
+	ctx, span := tracer.Start(ctx, "ReminderService.DueItemClaims")
+	defer span.End()
+
+	items, err := s.store.GetUnclaimedExpenseItems(ctx, now.Add(-s.policy.ItemsAfter))
+	if err != nil {
+		return nil, fmt.Errorf("get unclaimed expense items: %w", err)
+	}
+
+	var due []UnclaimedItems
+	byExpense := make(map[int64]int)
+	for _, item := range items {
+		if item.RemindedAt != nil {
+			continue
+		}
+		if i, ok := byExpense[item.ExpenseID]; ok {
+			due[i].Items = append(due[i].Items, item)
+			continue
+		}
+
+		expense, err := s.store.GetExpense(ctx, item.ExpenseID)
+		if err != nil {
+			return nil, wrapStorage(err, "get expense")
+		}
+		group, err := s.store.GetGroup(ctx, expense.GroupID)
+		if err != nil {
+			return nil, wrapStorage(err, "get group")
+		}
+		byExpense[item.ExpenseID] = len(due)
+		due = append(due, UnclaimedItems{Group: *group, Expense: *expense, Items: []models.ExpenseItem{item}})
+	}
+	return due, nil
+}
+
+// MarkItemsReminded records that the group was reminded of unclaimed items
+func (s *ReminderService) MarkItemsReminded(ctx context.Context, due UnclaimedItems, now time.Time) error {
+	ctx, span := tracer.Start(ctx, "ReminderService.MarkItemsReminded")
+	defer span.End()
+
+	// The items are reloaded so claims made since they were due are kept
+	err := withGroupTx(ctx, s.store, due.Group.ID, func(ctx context.Context, tx storage.Storage) error {
+		for _, unclaimed := range due.Items {
+			item, err := tx.GetExpenseItem(ctx, unclaimed.ID)
+			if err != nil {
+				return wrapStorage(err, "get expense item")
+			}
+			item.RemindedAt = &now
+			if err := tx.UpdateExpenseItem(ctx, item); err != nil {
+				return wrapStorage(err, "update expense item")
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	s.logger.InfoContext(ctx, "Unclaimed items reminder sent",
+		logger.Int64("expense_id", due.Expense.ID),
+		logger.Int("items", len(due.Items)),
+	)
+	return nil
+}
+
+// QuietHours returns the user's quiet hours, falling back to the policy default
+func (s *ReminderService) QuietHours(user *models.User) (start, end int) {
+	if user.QuietHoursStart != nil && user.QuietHoursEnd != nil {
+		return *user.QuietHoursStart, *user.QuietHoursEnd
+	}
+	return s.policy.QuietHoursStart, s.policy.QuietHoursEnd
+}
+
+// inQuietHours reports whether now falls into the user's local quiet hours
+func (s *ReminderService) inQuietHours(user *models.User, now time.Time) bool {
+	start, end := s.QuietHours(user)
+	hour := now.In(Location(user)).Hour()
+	switch {
+	case start == end:
+		return false
+	case start < end:
+		return hour >= start && hour < end
+	default: // wraps around midnight
+		return hour >= start || hour < end
+	}
+}
+
+// Location returns the user's time zone, UTC if unset or unknown
+func Location(user *models.User) *time.Location {
+	if user.Timezone == "" {
+		return time.UTC
+	}
+	loc, err := time.LoadLocation(user.Timezone)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
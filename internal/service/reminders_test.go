@@ -0,0 +1,177 @@
+package service
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/clock"
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/models"
+)
+
+// settlement creates a pending settlement from bob to alice and returns a fake
+// clock set to the day after it became due for reminders, at midnight UTC
+func (f *fixture) settlement(t *testing.T, policy ReminderPolicy) (*models.Settlement, *clock.Fake) {
+	t.Helper()
+	settlement := &models.Settlement{
+		GroupID:  f.group.ID,
+		FromUser: f.users[1].ID,
+		ToUser:   f.users[0].ID,
+		Amount:   eurs(1500),
+		Status:   models.SettlementPending,
+	}
+	if err := f.store.CreateSettlement(f.ctx, settlement); err != nil {
+		t.Fatalf("CreateSettlement() error = %v", err)
+	}
+	due := settlement.CreatedAt.Add(policy.After).UTC()
+	return settlement, clock.NewFake(due.Truncate(24 * time.Hour).Add(24 * time.Hour))
+}
+
+// remind sends every reminder due at the clock's time and returns their levels
+func remind(t *testing.T, f *fixture, reminders *ReminderService, clk clock.Clock) []int {
+	t.Helper()
+	due, err := reminders.Due(f.ctx, clk.Now())
+	if err != nil {
+		t.Fatalf("Due() error = %v", err)
+	}
+	var levels []int
+	for _, d := range due {
+		if err := reminders.MarkSent(f.ctx, d, clk.Now()); err != nil {
+			t.Fatalf("MarkSent() error = %v", err)
+		}
+		levels = append(levels, d.Level)
+	}
+	return levels
+}
+
+func TestReminderEscalation(t *testing.T) {
+	f := newFixture(t)
+	policy := DefaultReminderPolicy()
+	policy.FirmAfter = 2
+	policy.MaxReminders = 3
+	policy.QuietHoursStart, policy.QuietHoursEnd = 0, 0
+	reminders := NewReminderService(f.store, policy, f.svc.Reminders.logger)
+
+	_, clk := f.settlement(t, policy)
+
+	steps := []struct {
+		name    string
+		advance time.Duration
+		want    []int
+	}{
+		{name: "first reminder is gentle", want: []int{models.ReminderGentle}},
+		{name: "not repeated too soon", advance: policy.Every - time.Minute},
+		{name: "second reminder is gentle", advance: time.Minute, want: []int{models.ReminderGentle}},
+		{name: "third reminder is firm", advance: policy.Every, want: []int{models.ReminderFirm}},
+		{name: "no more than max reminders", advance: policy.Every},
+		{name: "still none much later", advance: 30 * policy.Every},
+	}
+	for _, step := range steps {
+		clk.Advance(step.advance)
+		got := remind(t, f, reminders, clk)
+		if !slices.Equal(got, step.want) {
+			t.Fatalf("%s: reminder levels = %v, want %v", step.name, got, step.want)
+		}
+	}
+}
+
+func TestReminderNotDueBeforeAfter(t *testing.T) {
+	f := newFixture(t)
+	policy := DefaultReminderPolicy()
+	policy.QuietHoursStart, policy.QuietHoursEnd = 0, 0
+	reminders := NewReminderService(f.store, policy, f.svc.Reminders.logger)
+
+	settlement, _ := f.settlement(t, policy)
+	clk := clock.NewFake(settlement.CreatedAt)
+
+	clk.Advance(policy.After - time.Minute)
+	if got := remind(t, f, reminders, clk); len(got) != 0 {
+		t.Fatalf("reminder levels before After = %v, want none", got)
+	}
+	clk.Advance(2 * time.Minute)
+	if got := remind(t, f, reminders, clk); !slices.Equal(got, []int{models.ReminderGentle}) {
+		t.Fatalf("reminder levels after After = %v, want gentle", got)
+	}
+}
+
+func TestReminderQuietHours(t *testing.T) {
+	tests := []struct {
+		name     string
+		timezone string
+		start    *int // the debtor's own quiet hours, nil for the policy's 22-9
+		end      *int
+		hour     int // UTC hour of the clock
+		want     bool
+	}{
+		{name: "policy quiet hours at night", hour: 23},
+		{name: "policy quiet hours after midnight", hour: 3},
+		{name: "policy quiet hours end", hour: 9, want: true},
+		{name: "policy quiet hours start", hour: 22},
+		{name: "daytime", hour: 14, want: true},
+		{name: "local night in debtor's time zone", timezone: "Asia/Tokyo", hour: 14},
+		{name: "local morning in debtor's time zone", timezone: "Asia/Tokyo", hour: 1, want: true},
+		{name: "unknown time zone is UTC", timezone: "Mars/Olympus", hour: 14, want: true},
+		{name: "own quiet hours", start: intPtr(12), end: intPtr(15), hour: 14},
+		{name: "outside own quiet hours", start: intPtr(12), end: intPtr(15), hour: 23, want: true},
+		{name: "own quiet hours disabled", start: intPtr(0), end: intPtr(0), hour: 3, want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFixture(t)
+			policy := DefaultReminderPolicy()
+			reminders := NewReminderService(f.store, policy, f.svc.Reminders.logger)
+
+			debtor := f.users[1]
+			debtor.Timezone = tt.timezone
+			debtor.QuietHoursStart, debtor.QuietHoursEnd = tt.start, tt.end
+			if err := f.store.UpdateUser(f.ctx, debtor); err != nil {
+				t.Fatalf("UpdateUser() error = %v", err)
+			}
+
+			_, clk := f.settlement(t, policy)
+			clk.Advance(time.Duration(tt.hour) * time.Hour)
+			got := remind(t, f, reminders, clk)
+			if sent := len(got) > 0; sent != tt.want {
+				t.Errorf("reminded at %s = %v, want %v", clk.Now().Format(time.Kitchen), sent, tt.want)
+			}
+		})
+	}
+}
+
+func TestReminderAfterQuietHours(t *testing.T) {
+	f := newFixture(t)
+	policy := DefaultReminderPolicy()
+	reminders := NewReminderService(f.store, policy, f.svc.Reminders.logger)
+
+	// Due at midnight, in the quiet hours until 9
+	_, clk := f.settlement(t, policy)
+	for hour := 0; hour < 9; hour++ {
+		if got := remind(t, f, reminders, clk); len(got) != 0 {
+			t.Fatalf("reminder levels at %d:00 = %v, want none", hour, got)
+		}
+		clk.Advance(time.Hour)
+	}
+	if got := remind(t, f, reminders, clk); !slices.Equal(got, []int{models.ReminderGentle}) {
+		t.Fatalf("reminder levels at 9:00 = %v, want gentle", got)
+	}
+}
+
+func TestReminderOptOut(t *testing.T) {
+	f := newFixture(t)
+	policy := DefaultReminderPolicy()
+	policy.QuietHoursStart, policy.QuietHoursEnd = 0, 0
+	reminders := NewReminderService(f.store, policy, f.svc.Reminders.logger)
+
+	if _, err := f.svc.Users.SetRemindersOff(f.ctx, f.users[1].ID, true); err != nil {
+		t.Fatalf("SetRemindersOff() error = %v", err)
+	}
+	_, clk := f.settlement(t, policy)
+	if got := remind(t, f, reminders, clk); len(got) != 0 {
+		t.Fatalf("reminder levels = %v, want none", got)
+	}
+}
+
+func intPtr(i int) *int {
+	return &i
+}
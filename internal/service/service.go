@@ -0,0 +1,107 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/engine"
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/fx"
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/models"
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/receipt"
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/storage"
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/pkg/logger"
+	"go.opentelemetry.io/otel"
+)
+
+// tracer starts a span for every service call
+var tracer = otel.Tracer("github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/service")
+
+// DefaultCurrency is the base currency of groups created without one
+const DefaultCurrency = "EUR"
+
+// Service bundles the domain services used by the Telegram handlers and the HTTP API
+type Service struct {
+	Users       *UserService
+	Groups      *GroupService
+	Expenses    *ExpenseService
+	Settlements *SettlementService
+	Recurring   *RecurringService
+	Reminders   *ReminderService
+	Audit       *AuditService
+	Receipts    *ReceiptService
+	Export      *ExportService
+	Imports     *ImportService
+	Maintenance *MaintenanceService
+	Idempotency *IdempotencyService
+}
+
+// New creates all domain services on top of the given storage
+func New(store storage.Storage, calc *engine.BalanceCalculator, rates fx.RateProvider, reminders ReminderPolicy, ocr receipt.OCR, log logger.Logger) *Service {
+	log = log.With(logger.String("component", "service"))
+
+	expenses := NewExpenseService(store, calc, rates, log)
+
+	return &Service{
+		Users:       NewUserService(store, log),
+		Groups:      NewGroupService(store, calc, log),
+		Expenses:    expenses,
+		Settlements: NewSettlementService(store, calc, log),
+		Recurring:   NewRecurringService(store, expenses, log),
+		Reminders:   NewReminderService(store, reminders, log),
+		Audit:       NewAuditService(store, log),
+		Receipts:    NewReceiptService(store, expenses, ocr, log),
+		Export:      NewExportService(store, log),
+		Imports:     NewImportService(store, expenses, calc, log),
+		Maintenance: NewMaintenanceService(store, calc, log),
+		Idempotency: NewIdempotencyService(store, log),
+	}
+}
+
+// withGroupTx runs fn in a transaction holding the lock of a group. The lock
+// is taken before the transaction starts, so waiting for it holds none open.
+// Records read before may be stale, so fn reads again what it changes.
+func withGroupTx(ctx context.Context, store storage.Storage, groupID int64, fn storage.TxFunc) error {
+	unlock, err := store.LockGroup(ctx, groupID)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	return store.WithTx(ctx, fn)
+}
+
+// requireMember returns the actor's membership in a group or ErrForbidden
+func requireMember(ctx context.Context, store storage.Storage, groupID, userID int64) (*models.GroupMember, error) {
+	if _, err := store.GetGroup(ctx, groupID); err != nil {
+		return nil, wrapStorage(err, "get group")
+	}
+
+	member, err := store.GetMember(ctx, groupID, userID)
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, fmt.Errorf("user %d is not a member of group %d: %w", userID, groupID, ErrForbidden)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get member: %w", err)
+	}
+	return member, nil
+}
+
+// requireAdmin returns ErrForbidden unless the actor is an admin of the group
+func requireAdmin(ctx context.Context, store storage.Storage, groupID, userID int64) error {
+	member, err := requireMember(ctx, store, groupID, userID)
+	if err != nil {
+		return err
+	}
+	if member.Role != models.RoleAdmin {
+		return fmt.Errorf("user %d is not an admin of group %d: %w", userID, groupID, ErrForbidden)
+	}
+	return nil
+}
+
+// wrapStorage translates storage errors into service errors
+func wrapStorage(err error, op string) error {
+	if errors.Is(err, storage.ErrNotFound) {
+		return fmt.Errorf("%s: %w", op, ErrNotFound)
+	}
+	return fmt.Errorf("%s: %w", op, err)
+}
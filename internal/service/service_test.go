@@ -0,0 +1,87 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/currency"
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/engine"
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/fx"
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/models"
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/money"
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/receipt"
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/storage/memory"
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/pkg/logger"
+)
+
+var eur = currency.MustLookup("EUR")
+
+// fixture is a group of three members on an in-memory store
+type fixture struct {
+	ctx   context.Context
+	store *memory.Store
+	svc   *Service
+	ocr   *receipt.Fake
+	users []*models.User
+	group *models.Group
+}
+
+func newFixture(t *testing.T) *fixture {
+	t.Helper()
+	log, err := logger.New(logger.Config{Level: "error", Environment: "production", OutputPath: "stderr"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f := &fixture{ctx: context.Background(), store: memory.New(), ocr: &receipt.Fake{}}
+	f.svc = New(f.store, engine.NewBalanceCalculator(), fx.NewStaticProvider(), DefaultReminderPolicy(), f.ocr, log)
+	for i, name := range []string{"alice", "bob", "carol"} {
+		user, err := f.svc.Users.EnsureUser(f.ctx, models.User{TelegramID: int64(i + 1), Username: name})
+		if err != nil {
+			t.Fatalf("EnsureUser() error = %v", err)
+		}
+		f.users = append(f.users, user)
+	}
+	f.group, err = f.svc.Groups.CreateGroup(f.ctx, f.users[0].ID, CreateGroupInput{Name: "trip"})
+	if err != nil {
+		t.Fatalf("CreateGroup() error = %v", err)
+	}
+	for _, user := range f.users[1:] {
+		if _, err := f.svc.Groups.Join(f.ctx, user.ID, f.group.ID); err != nil {
+			t.Fatalf("Join() error = %v", err)
+		}
+	}
+	return f
+}
+
+// expense creates an expense paid by the first member
+func (f *fixture) expense(t *testing.T, in CreateExpenseInput) *models.Expense {
+	t.Helper()
+	in.GroupID = f.group.ID
+	if in.Description == "" {
+		in.Description = "dinner"
+	}
+	expense, _, err := f.svc.Expenses.CreateExpense(f.ctx, f.users[0].ID, in)
+	if err != nil {
+		t.Fatalf("CreateExpense() error = %v", err)
+	}
+	return expense
+}
+
+// shares returns the share of every participant of an expense in minor units
+func (f *fixture) shares(t *testing.T, expenseID int64) map[int64]int64 {
+	t.Helper()
+	participants, err := f.store.GetExpenseParticipants(f.ctx, expenseID)
+	if err != nil {
+		t.Fatalf("GetExpenseParticipants() error = %v", err)
+	}
+	shares := make(map[int64]int64, len(participants))
+	for _, p := range participants {
+		shares[p.UserID] = p.Share.Amount()
+	}
+	return shares
+}
+
+func eurs(minor int64) money.Money {
+	return money.New(minor, eur)
+}
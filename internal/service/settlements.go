@@ -0,0 +1,252 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/engine"
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/models"
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/money"
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/storage"
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/pkg/logger"
+)
+
+// SettlementService computes balances and manages settlements between members
+type SettlementService struct {
+	store  storage.Storage
+	calc   *engine.BalanceCalculator
+	logger logger.Logger
+}
+
+// NewSettlementService creates a new settlement service
+func NewSettlementService(store storage.Storage, calc *engine.BalanceCalculator, log logger.Logger) *SettlementService {
+	return &SettlementService{store: store, calc: calc, logger: log}
+}
+
+// Balances returns the current balance of every user in a group in the group
+// base currency. Completed settlements are taken into account and users
+// without an open balance are omitted.
+func (s *SettlementService) Balances(ctx context.Context, actorID, groupID int64) (map[int64]money.Money, error) {
+	ctx, span := tracer.Start(ctx, "SettlementService.Balances")
+	defer span.End()
+
+	if _, err := requireMember(ctx, s.store, groupID, actorID); err != nil {
+		return nil, err
+	}
+
+	group, err := s.store.GetGroup(ctx, groupID)
+	if err != nil {
+		return nil, wrapStorage(err, "get group")
+	}
+	return computeBalances(ctx, s.store, s.calc, group)
+}
+
+// BalancesAt returns the balances of a group as of the given time by
+// replaying its ledger, counting expenses by the date they were incurred and
+// settlements by when they were completed
+func (s *SettlementService) BalancesAt(ctx context.Context, actorID, groupID int64, at time.Time) (map[int64]money.Money, error) {
+	ctx, span := tracer.Start(ctx, "SettlementService.BalancesAt")
+	defer span.End()
+
+	if _, err := requireMember(ctx, s.store, groupID, actorID); err != nil {
+		return nil, err
+	}
+	if at.IsZero() {
+		return nil, invalid("at", "is required")
+	}
+	return balancesAt(ctx, s.store, s.calc, groupID, at)
+}
+
+// computeBalances returns the current balances of a group derived from its ledger
+func computeBalances(ctx context.Context, store storage.Storage, calc *engine.BalanceCalculator, group *models.Group) (map[int64]money.Money, error) {
+	return balancesAt(ctx, store, calc, group.ID, time.Time{})
+}
+
+// balanceDelta returns after - before for every user whose balance changed
+func balanceDelta(before, after map[int64]money.Money) (map[int64]money.Money, error) {
+	delta := make(map[int64]money.Money)
+	for userID, a := range after {
+		b, ok := before[userID]
+		if !ok {
+			b = money.Zero(a.Currency())
+		}
+		d, err := a.Sub(b)
+		if err != nil {
+			return nil, err
+		}
+		if !d.IsZero() {
+			delta[userID] = d
+		}
+	}
+	for userID, b := range before {
+		if _, ok := after[userID]; !ok && !b.IsZero() {
+			delta[userID] = b.Neg()
+		}
+	}
+	return delta, nil
+}
+
+// PlanSettlements replaces the group's pending settlements with the minimal
+// set of transfers that clears all current balances.
+func (s *SettlementService) PlanSettlements(ctx context.Context, actorID, groupID int64) ([]models.Settlement, error) {
+	ctx, span := tracer.Start(ctx, "SettlementService.PlanSettlements")
+	defer span.End()
+
+	var planned []models.Settlement
+
+	err := withGroupTx(ctx, s.store, groupID, func(ctx context.Context, tx storage.Storage) error {
+		if _, err := requireMember(ctx, tx, groupID, actorID); err != nil {
+			return err
+		}
+
+		existing, err := tx.GetGroupSettlements(ctx, groupID)
+		if err != nil {
+			return fmt.Errorf("get group settlements: %w", err)
+		}
+		var records []auditRecord
+		for i := range existing {
+			if existing[i].Status != models.SettlementPending {
+				continue
+			}
+			previous := existing[i]
+			existing[i].Status = models.SettlementCancelled
+			if err := tx.UpdateSettlement(ctx, &existing[i]); err != nil {
+				return fmt.Errorf("cancel settlement: %w", err)
+			}
+			records = append(records, auditRecord{
+				groupID: groupID, actorID: actorID, action: models.AuditUpdate,
+				entityType: models.EntitySettlement, entityID: previous.ID, before: previous, after: existing[i],
+			})
+		}
+
+		group, err := tx.GetGroup(ctx, groupID)
+		if err != nil {
+			return wrapStorage(err, "get group")
+		}
+
+		balances, err := computeBalances(ctx, tx, s.calc, group)
+		if err != nil {
+			return err
+		}
+
+		planned = s.calc.OptimizeSettlements(balances)
+		for i := range planned {
+			planned[i].GroupID = groupID
+			if err := tx.CreateSettlement(ctx, &planned[i]); err != nil {
+				return fmt.Errorf("create settlement: %w", err)
+			}
+			records = append(records, auditRecord{
+				groupID: groupID, actorID: actorID, action: models.AuditCreate,
+				entityType: models.EntitySettlement, entityID: planned[i].ID, after: planned[i],
+			})
+		}
+		return recordAudit(ctx, tx, records...)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.logger.InfoContext(ctx, "Settlements planned",
+		logger.Int64("group_id", groupID),
+		logger.Int("settlements", len(planned)),
+	)
+	return planned, nil
+}
+
+// ListSettlements returns all settlements of a group
+func (s *SettlementService) ListSettlements(ctx context.Context, actorID, groupID int64) ([]models.Settlement, error) {
+	ctx, span := tracer.Start(ctx, "SettlementService.ListSettlements")
+	defer span.End()
+
+	if _, err := requireMember(ctx, s.store, groupID, actorID); err != nil {
+		return nil, err
+	}
+
+	settlements, err := s.store.GetGroupSettlements(ctx, groupID)
+	if err != nil {
+		return nil, fmt.Errorf("get group settlements: %w", err)
+	}
+	return settlements, nil
+}
+
+// CompleteSettlement marks a pending settlement as paid.
+// Only the two parties of the settlement or a group admin may complete it.
+// Replays with the idempotency key of an earlier call return the settlement
+// instead of failing because it is completed already.
+func (s *SettlementService) CompleteSettlement(ctx context.Context, actorID, settlementID int64) (*models.Settlement, error) {
+	ctx, span := tracer.Start(ctx, "SettlementService.CompleteSettlement")
+	defer span.End()
+
+	var replayed bool
+
+	// The settlement is read again under the lock of its group, which never
+	// changes, since it may have changed in the meantime
+	settlement, err := s.store.GetSettlement(ctx, settlementID)
+	if err != nil {
+		return nil, wrapStorage(err, "get settlement")
+	}
+	err = withGroupTx(ctx, s.store, settlement.GroupID, func(ctx context.Context, tx storage.Storage) error {
+		var err error
+		if settlement, err = tx.GetSettlement(ctx, settlementID); err != nil {
+			return wrapStorage(err, "get settlement")
+		}
+
+		completedID, err := replayOf(ctx, tx, models.OperationCompleteSettlement, actorID)
+		if err != nil {
+			return err
+		}
+		switch completedID {
+		case 0:
+		case settlementID:
+			replayed = true
+			return nil
+		default:
+			return fmt.Errorf("idempotency key was used for settlement %d: %w", completedID, ErrConflict)
+		}
+
+		member, err := requireMember(ctx, tx, settlement.GroupID, actorID)
+		if err != nil {
+			return err
+		}
+		if actorID != settlement.FromUser && actorID != settlement.ToUser && member.Role != models.RoleAdmin {
+			return fmt.Errorf("user %d is not a party of settlement %d: %w", actorID, settlementID, ErrForbidden)
+		}
+		if settlement.Status != models.SettlementPending {
+			return fmt.Errorf("settlement %d is %s: %w", settlementID, settlement.Status, ErrConflict)
+		}
+
+		previous := *settlement
+		settlement.Status = models.SettlementCompleted
+		if err := tx.UpdateSettlement(ctx, settlement); err != nil {
+			return fmt.Errorf("update settlement: %w", err)
+		}
+		err = appendEvent(ctx, tx, s.calc, settlement.GroupID, actorID, models.EventSettlementCompleted,
+			models.SettlementCompletedPayload{Settlement: *settlement})
+		if err != nil {
+			return err
+		}
+		err = recordAudit(ctx, tx, auditRecord{
+			groupID: settlement.GroupID, actorID: actorID, action: models.AuditUpdate,
+			entityType: models.EntitySettlement, entityID: settlement.ID, before: previous, after: settlement,
+		})
+		if err != nil {
+			return err
+		}
+		return remember(ctx, tx, models.OperationCompleteSettlement, actorID, settlement.ID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if replayed {
+		s.logger.InfoContext(ctx, "Settlement completion replayed", logger.Int64("settlement_id", settlement.ID))
+		return settlement, nil
+	}
+
+	s.logger.InfoContext(ctx, "Settlement completed",
+		logger.Int64("settlement_id", settlement.ID),
+		logger.Int64("group_id", settlement.GroupID),
+		logger.Int64("completed_by", actorID),
+	)
+	return settlement, nil
+}
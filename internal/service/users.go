@@ -0,0 +1,177 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/models"
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/storage"
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/pkg/logger"
+)
+
+// UserService resolves Telegram users to application users
+type UserService struct {
+	store  storage.Storage
+	logger logger.Logger
+}
+
+// NewUserService creates a new user service
+func NewUserService(store storage.Storage, log logger.Logger) *UserService {
+	return &UserService{store: store, logger: log}
+}
+
+// EnsureUser returns the user with the profile's Telegram ID, creating it if
+// it does not exist and refreshing the stored profile if it changed.
+func (s *UserService) EnsureUser(ctx context.Context, profile models.User) (*models.User, error) {
+	ctx, span := tracer.Start(ctx, "UserService.EnsureUser")
+	defer span.End()
+
+	if profile.TelegramID == 0 {
+		return nil, invalid("telegram_id", "is required")
+	}
+
+	var user *models.User
+	err := s.store.WithTx(ctx, func(ctx context.Context, tx storage.Storage) error {
+		existing, err := tx.GetUserByTelegramID(ctx, profile.TelegramID)
+		if errors.Is(err, storage.ErrNotFound) {
+			user = &profile
+			if err := tx.CreateUser(ctx, user); err != nil {
+				return fmt.Errorf("create user: %w", err)
+			}
+			s.logger.InfoContext(ctx, "User created",
+				logger.Int64("user_id", user.ID),
+				logger.Int64("telegram_id", user.TelegramID),
+			)
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("get user: %w", err)
+		}
+
+		user = existing
+		if existing.Username == profile.Username &&
+			existing.FirstName == profile.FirstName &&
+			existing.LastName == profile.LastName &&
+			existing.LanguageCode == profile.LanguageCode {
+			return nil
+		}
+
+		user.Username = profile.Username
+		user.FirstName = profile.FirstName
+		user.LastName = profile.LastName
+		user.LanguageCode = profile.LanguageCode
+		if err := tx.UpdateUser(ctx, user); err != nil {
+			return fmt.Errorf("update user: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// GetUser returns a user by ID
+func (s *UserService) GetUser(ctx context.Context, id int64) (*models.User, error) {
+	ctx, span := tracer.Start(ctx, "UserService.GetUser")
+	defer span.End()
+
+	user, err := s.store.GetUser(ctx, id)
+	if err != nil {
+		return nil, wrapStorage(err, "get user")
+	}
+	return user, nil
+}
+
+// SetRemindersOff opts the user out of or back into payment reminders
+func (s *UserService) SetRemindersOff(ctx context.Context, userID int64, off bool) (*models.User, error) {
+	ctx, span := tracer.Start(ctx, "UserService.SetRemindersOff")
+	defer span.End()
+
+	return s.update(ctx, userID, func(user *models.User) error {
+		user.RemindersOff = off
+		return nil
+	})
+}
+
+// SetQuietHours sets the local hours during which the user gets no reminders.
+// Equal hours disable quiet hours.
+func (s *UserService) SetQuietHours(ctx context.Context, userID int64, start, end int) (*models.User, error) {
+	ctx, span := tracer.Start(ctx, "UserService.SetQuietHours")
+	defer span.End()
+
+	if start < 0 || start > 23 || end < 0 || end > 23 {
+		return nil, invalid("quiet_hours", "hours must be between 0 and 23")
+	}
+	return s.update(ctx, userID, func(user *models.User) error {
+		user.QuietHoursStart, user.QuietHoursEnd = &start, &end
+		return nil
+	})
+}
+
+// SetTimezone sets the user's IANA time zone, e.g. "Europe/Sofia"
+func (s *UserService) SetTimezone(ctx context.Context, userID int64, name string) (*models.User, error) {
+	ctx, span := tracer.Start(ctx, "UserService.SetTimezone")
+	defer span.End()
+
+	if _, err := time.LoadLocation(name); err != nil || name == "" || name == "Local" {
+		return nil, invalid("timezone", "unknown time zone %q", name)
+	}
+	return s.update(ctx, userID, func(user *models.User) error {
+		user.Timezone = name
+		return nil
+	})
+}
+
+// anonymousName is the name anonymized users are shown with
+const anonymousName = "Deleted user"
+
+// Anonymize erases the personal data of a user while keeping their expenses
+// and balances intact. The user is detached from their Telegram account, so
+// the account gets a new user if it comes back.
+func (s *UserService) Anonymize(ctx context.Context, userID int64) (*models.User, error) {
+	ctx, span := tracer.Start(ctx, "UserService.Anonymize")
+	defer span.End()
+
+	user, err := s.update(ctx, userID, func(user *models.User) error {
+		*user = models.User{
+			ID:           user.ID,
+			FirstName:    anonymousName,
+			RemindersOff: true,
+			CreatedAt:    user.CreatedAt,
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.logger.InfoContext(ctx, "User anonymized", logger.Int64("user_id", userID))
+	return user, nil
+}
+
+// update applies fn to a stored user and saves it
+func (s *UserService) update(ctx context.Context, userID int64, fn func(user *models.User) error) (*models.User, error) {
+	var user *models.User
+	err := s.store.WithTx(ctx, func(ctx context.Context, tx storage.Storage) error {
+		var err error
+		user, err = tx.GetUser(ctx, userID)
+		if err != nil {
+			return wrapStorage(err, "get user")
+		}
+		if err := fn(user); err != nil {
+			return err
+		}
+		if err := tx.UpdateUser(ctx, user); err != nil {
+			return fmt.Errorf("update user: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
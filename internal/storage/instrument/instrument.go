@@ -0,0 +1,412 @@
+// Package instrument decorates a storage so every operation can be observed,
+// e.g. to record metrics or trace spans
+package instrument
+
+import (
+	"context"
+	"time"
+
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/models"
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/storage"
+)
+
+// Observer is called when a storage operation starts. It returns the context
+// the operation runs with and a function called when the operation is done.
+type Observer func(ctx context.Context, operation string) (context.Context, func())
+
+// Storage passes every operation on to the next storage, observing it
+type Storage struct {
+	next    storage.Storage
+	observe Observer
+}
+
+// New returns a storage observing every operation of next, including those
+// run in transactions
+func New(next storage.Storage, observe Observer) *Storage {
+	return &Storage{next: next, observe: observe}
+}
+
+// WithTx observes the whole transaction and passes fn an observed transaction
+func (s *Storage) WithTx(ctx context.Context, fn storage.TxFunc) error {
+	ctx, done := s.observe(ctx, "WithTx")
+	defer done()
+	return s.next.WithTx(ctx, func(ctx context.Context, tx storage.Storage) error {
+		return fn(ctx, New(tx, s.observe))
+	})
+}
+
+func (s *Storage) LockGroup(ctx context.Context, groupID int64) (func(), error) {
+	ctx, done := s.observe(ctx, "LockGroup")
+	defer done()
+	return s.next.LockGroup(ctx, groupID)
+}
+
+func (s *Storage) Ping(ctx context.Context) error {
+	return s.next.Ping(ctx)
+}
+
+func (s *Storage) CreateUser(ctx context.Context, user *models.User) error {
+	ctx, done := s.observe(ctx, "CreateUser")
+	defer done()
+	return s.next.CreateUser(ctx, user)
+}
+
+func (s *Storage) GetUser(ctx context.Context, id int64) (*models.User, error) {
+	ctx, done := s.observe(ctx, "GetUser")
+	defer done()
+	return s.next.GetUser(ctx, id)
+}
+
+func (s *Storage) GetUserByTelegramID(ctx context.Context, telegramID int64) (*models.User, error) {
+	ctx, done := s.observe(ctx, "GetUserByTelegramID")
+	defer done()
+	return s.next.GetUserByTelegramID(ctx, telegramID)
+}
+
+func (s *Storage) UpdateUser(ctx context.Context, user *models.User) error {
+	ctx, done := s.observe(ctx, "UpdateUser")
+	defer done()
+	return s.next.UpdateUser(ctx, user)
+}
+
+func (s *Storage) CreateGroup(ctx context.Context, group *models.Group) error {
+	ctx, done := s.observe(ctx, "CreateGroup")
+	defer done()
+	return s.next.CreateGroup(ctx, group)
+}
+
+func (s *Storage) GetGroup(ctx context.Context, id int64) (*models.Group, error) {
+	ctx, done := s.observe(ctx, "GetGroup")
+	defer done()
+	return s.next.GetGroup(ctx, id)
+}
+
+func (s *Storage) GetGroupByChatID(ctx context.Context, chatID int64) (*models.Group, error) {
+	ctx, done := s.observe(ctx, "GetGroupByChatID")
+	defer done()
+	return s.next.GetGroupByChatID(ctx, chatID)
+}
+
+func (s *Storage) GetUserGroups(ctx context.Context, userID int64) ([]models.Group, error) {
+	ctx, done := s.observe(ctx, "GetUserGroups")
+	defer done()
+	return s.next.GetUserGroups(ctx, userID)
+}
+
+func (s *Storage) ListGroups(ctx context.Context) ([]models.Group, error) {
+	ctx, done := s.observe(ctx, "ListGroups")
+	defer done()
+	return s.next.ListGroups(ctx)
+}
+
+func (s *Storage) UpdateGroup(ctx context.Context, group *models.Group) error {
+	ctx, done := s.observe(ctx, "UpdateGroup")
+	defer done()
+	return s.next.UpdateGroup(ctx, group)
+}
+
+func (s *Storage) DeleteGroup(ctx context.Context, id int64) error {
+	ctx, done := s.observe(ctx, "DeleteGroup")
+	defer done()
+	return s.next.DeleteGroup(ctx, id)
+}
+
+func (s *Storage) AddMember(ctx context.Context, member *models.GroupMember) error {
+	ctx, done := s.observe(ctx, "AddMember")
+	defer done()
+	return s.next.AddMember(ctx, member)
+}
+
+func (s *Storage) GetMember(ctx context.Context, groupID, userID int64) (*models.GroupMember, error) {
+	ctx, done := s.observe(ctx, "GetMember")
+	defer done()
+	return s.next.GetMember(ctx, groupID, userID)
+}
+
+func (s *Storage) GetGroupMembers(ctx context.Context, groupID int64) ([]models.GroupMember, error) {
+	ctx, done := s.observe(ctx, "GetGroupMembers")
+	defer done()
+	return s.next.GetGroupMembers(ctx, groupID)
+}
+
+func (s *Storage) RemoveMember(ctx context.Context, groupID, userID int64) error {
+	ctx, done := s.observe(ctx, "RemoveMember")
+	defer done()
+	return s.next.RemoveMember(ctx, groupID, userID)
+}
+
+func (s *Storage) CreateExpense(ctx context.Context, expense *models.Expense) error {
+	ctx, done := s.observe(ctx, "CreateExpense")
+	defer done()
+	return s.next.CreateExpense(ctx, expense)
+}
+
+func (s *Storage) GetExpense(ctx context.Context, id int64) (*models.Expense, error) {
+	ctx, done := s.observe(ctx, "GetExpense")
+	defer done()
+	return s.next.GetExpense(ctx, id)
+}
+
+func (s *Storage) GetGroupExpenses(ctx context.Context, groupID int64) ([]models.Expense, error) {
+	ctx, done := s.observe(ctx, "GetGroupExpenses")
+	defer done()
+	return s.next.GetGroupExpenses(ctx, groupID)
+}
+
+func (s *Storage) EachGroupExpense(ctx context.Context, groupID int64, from, to time.Time, fn func(models.Expense) error) error {
+	ctx, done := s.observe(ctx, "EachGroupExpense")
+	defer done()
+	return s.next.EachGroupExpense(ctx, groupID, from, to, fn)
+}
+
+func (s *Storage) UpdateExpense(ctx context.Context, expense *models.Expense) error {
+	ctx, done := s.observe(ctx, "UpdateExpense")
+	defer done()
+	return s.next.UpdateExpense(ctx, expense)
+}
+
+func (s *Storage) DeleteExpense(ctx context.Context, id int64) error {
+	ctx, done := s.observe(ctx, "DeleteExpense")
+	defer done()
+	return s.next.DeleteExpense(ctx, id)
+}
+
+func (s *Storage) CreateParticipant(ctx context.Context, participant *models.Participant) error {
+	ctx, done := s.observe(ctx, "CreateParticipant")
+	defer done()
+	return s.next.CreateParticipant(ctx, participant)
+}
+
+func (s *Storage) GetExpenseParticipants(ctx context.Context, expenseID int64) ([]models.Participant, error) {
+	ctx, done := s.observe(ctx, "GetExpenseParticipants")
+	defer done()
+	return s.next.GetExpenseParticipants(ctx, expenseID)
+}
+
+func (s *Storage) GetGroupParticipants(ctx context.Context, groupID int64) ([]models.Participant, error) {
+	ctx, done := s.observe(ctx, "GetGroupParticipants")
+	defer done()
+	return s.next.GetGroupParticipants(ctx, groupID)
+}
+
+func (s *Storage) UpdateParticipant(ctx context.Context, participant *models.Participant) error {
+	ctx, done := s.observe(ctx, "UpdateParticipant")
+	defer done()
+	return s.next.UpdateParticipant(ctx, participant)
+}
+
+func (s *Storage) DeleteParticipant(ctx context.Context, id int64) error {
+	ctx, done := s.observe(ctx, "DeleteParticipant")
+	defer done()
+	return s.next.DeleteParticipant(ctx, id)
+}
+
+func (s *Storage) CreateExpenseItem(ctx context.Context, item *models.ExpenseItem) error {
+	ctx, done := s.observe(ctx, "CreateExpenseItem")
+	defer done()
+	return s.next.CreateExpenseItem(ctx, item)
+}
+
+func (s *Storage) GetExpenseItem(ctx context.Context, id int64) (*models.ExpenseItem, error) {
+	ctx, done := s.observe(ctx, "GetExpenseItem")
+	defer done()
+	return s.next.GetExpenseItem(ctx, id)
+}
+
+func (s *Storage) GetExpenseItems(ctx context.Context, expenseID int64) ([]models.ExpenseItem, error) {
+	ctx, done := s.observe(ctx, "GetExpenseItems")
+	defer done()
+	return s.next.GetExpenseItems(ctx, expenseID)
+}
+
+func (s *Storage) GetUnclaimedExpenseItems(ctx context.Context, createdBefore time.Time) ([]models.ExpenseItem, error) {
+	ctx, done := s.observe(ctx, "GetUnclaimedExpenseItems")
+	defer done()
+	return s.next.GetUnclaimedExpenseItems(ctx, createdBefore)
+}
+
+func (s *Storage) UpdateExpenseItem(ctx context.Context, item *models.ExpenseItem) error {
+	ctx, done := s.observe(ctx, "UpdateExpenseItem")
+	defer done()
+	return s.next.UpdateExpenseItem(ctx, item)
+}
+
+func (s *Storage) CreateSettlement(ctx context.Context, settlement *models.Settlement) error {
+	ctx, done := s.observe(ctx, "CreateSettlement")
+	defer done()
+	return s.next.CreateSettlement(ctx, settlement)
+}
+
+func (s *Storage) GetSettlement(ctx context.Context, id int64) (*models.Settlement, error) {
+	ctx, done := s.observe(ctx, "GetSettlement")
+	defer done()
+	return s.next.GetSettlement(ctx, id)
+}
+
+func (s *Storage) GetGroupSettlements(ctx context.Context, groupID int64) ([]models.Settlement, error) {
+	ctx, done := s.observe(ctx, "GetGroupSettlements")
+	defer done()
+	return s.next.GetGroupSettlements(ctx, groupID)
+}
+
+func (s *Storage) EachGroupSettlement(ctx context.Context, groupID int64, from, to time.Time, fn func(models.Settlement) error) error {
+	ctx, done := s.observe(ctx, "EachGroupSettlement")
+	defer done()
+	return s.next.EachGroupSettlement(ctx, groupID, from, to, fn)
+}
+
+func (s *Storage) GetPendingSettlements(ctx context.Context, createdBefore time.Time) ([]models.Settlement, error) {
+	ctx, done := s.observe(ctx, "GetPendingSettlements")
+	defer done()
+	return s.next.GetPendingSettlements(ctx, createdBefore)
+}
+
+func (s *Storage) UpdateSettlement(ctx context.Context, settlement *models.Settlement) error {
+	ctx, done := s.observe(ctx, "UpdateSettlement")
+	defer done()
+	return s.next.UpdateSettlement(ctx, settlement)
+}
+
+func (s *Storage) CreateReminder(ctx context.Context, reminder *models.Reminder) error {
+	ctx, done := s.observe(ctx, "CreateReminder")
+	defer done()
+	return s.next.CreateReminder(ctx, reminder)
+}
+
+func (s *Storage) GetSettlementReminders(ctx context.Context, settlementID int64) ([]models.Reminder, error) {
+	ctx, done := s.observe(ctx, "GetSettlementReminders")
+	defer done()
+	return s.next.GetSettlementReminders(ctx, settlementID)
+}
+
+func (s *Storage) CreateRecurringExpense(ctx context.Context, recurring *models.RecurringExpense) error {
+	ctx, done := s.observe(ctx, "CreateRecurringExpense")
+	defer done()
+	return s.next.CreateRecurringExpense(ctx, recurring)
+}
+
+func (s *Storage) GetRecurringExpense(ctx context.Context, id int64) (*models.RecurringExpense, error) {
+	ctx, done := s.observe(ctx, "GetRecurringExpense")
+	defer done()
+	return s.next.GetRecurringExpense(ctx, id)
+}
+
+func (s *Storage) GetGroupRecurringExpenses(ctx context.Context, groupID int64) ([]models.RecurringExpense, error) {
+	ctx, done := s.observe(ctx, "GetGroupRecurringExpenses")
+	defer done()
+	return s.next.GetGroupRecurringExpenses(ctx, groupID)
+}
+
+func (s *Storage) GetDueRecurringExpenses(ctx context.Context, now time.Time) ([]models.RecurringExpense, error) {
+	ctx, done := s.observe(ctx, "GetDueRecurringExpenses")
+	defer done()
+	return s.next.GetDueRecurringExpenses(ctx, now)
+}
+
+func (s *Storage) UpdateRecurringExpense(ctx context.Context, recurring *models.RecurringExpense) error {
+	ctx, done := s.observe(ctx, "UpdateRecurringExpense")
+	defer done()
+	return s.next.UpdateRecurringExpense(ctx, recurring)
+}
+
+func (s *Storage) CreateImport(ctx context.Context, imp *models.Import) error {
+	ctx, done := s.observe(ctx, "CreateImport")
+	defer done()
+	return s.next.CreateImport(ctx, imp)
+}
+
+func (s *Storage) GetImport(ctx context.Context, id int64) (*models.Import, error) {
+	ctx, done := s.observe(ctx, "GetImport")
+	defer done()
+	return s.next.GetImport(ctx, id)
+}
+
+func (s *Storage) UpdateImport(ctx context.Context, imp *models.Import) error {
+	ctx, done := s.observe(ctx, "UpdateImport")
+	defer done()
+	return s.next.UpdateImport(ctx, imp)
+}
+
+func (s *Storage) CreateReceipt(ctx context.Context, receipt *models.Receipt) error {
+	ctx, done := s.observe(ctx, "CreateReceipt")
+	defer done()
+	return s.next.CreateReceipt(ctx, receipt)
+}
+
+func (s *Storage) GetReceipt(ctx context.Context, id int64) (*models.Receipt, error) {
+	ctx, done := s.observe(ctx, "GetReceipt")
+	defer done()
+	return s.next.GetReceipt(ctx, id)
+}
+
+func (s *Storage) UpdateReceipt(ctx context.Context, receipt *models.Receipt) error {
+	ctx, done := s.observe(ctx, "UpdateReceipt")
+	defer done()
+	return s.next.UpdateReceipt(ctx, receipt)
+}
+
+func (s *Storage) AppendAuditEntry(ctx context.Context, entry *models.AuditEntry) error {
+	ctx, done := s.observe(ctx, "AppendAuditEntry")
+	defer done()
+	return s.next.AppendAuditEntry(ctx, entry)
+}
+
+func (s *Storage) GetLastAuditEntry(ctx context.Context, groupID int64) (*models.AuditEntry, error) {
+	ctx, done := s.observe(ctx, "GetLastAuditEntry")
+	defer done()
+	return s.next.GetLastAuditEntry(ctx, groupID)
+}
+
+func (s *Storage) GetGroupAuditEntries(ctx context.Context, groupID int64) ([]models.AuditEntry, error) {
+	ctx, done := s.observe(ctx, "GetGroupAuditEntries")
+	defer done()
+	return s.next.GetGroupAuditEntries(ctx, groupID)
+}
+
+func (s *Storage) AppendEvent(ctx context.Context, event *models.LedgerEvent) error {
+	ctx, done := s.observe(ctx, "AppendEvent")
+	defer done()
+	return s.next.AppendEvent(ctx, event)
+}
+
+func (s *Storage) GetGroupEvents(ctx context.Context, groupID, afterSequence int64) ([]models.LedgerEvent, error) {
+	ctx, done := s.observe(ctx, "GetGroupEvents")
+	defer done()
+	return s.next.GetGroupEvents(ctx, groupID, afterSequence)
+}
+
+func (s *Storage) SaveSnapshot(ctx context.Context, snapshot *models.BalanceSnapshot) error {
+	ctx, done := s.observe(ctx, "SaveSnapshot")
+	defer done()
+	return s.next.SaveSnapshot(ctx, snapshot)
+}
+
+func (s *Storage) GetLatestSnapshot(ctx context.Context, groupID int64, at time.Time) (*models.BalanceSnapshot, error) {
+	ctx, done := s.observe(ctx, "GetLatestSnapshot")
+	defer done()
+	return s.next.GetLatestSnapshot(ctx, groupID, at)
+}
+
+func (s *Storage) DeleteSnapshots(ctx context.Context, groupID int64) error {
+	ctx, done := s.observe(ctx, "DeleteSnapshots")
+	defer done()
+	return s.next.DeleteSnapshots(ctx, groupID)
+}
+
+func (s *Storage) CreateIdempotencyKey(ctx context.Context, key *models.IdempotencyKey) error {
+	ctx, done := s.observe(ctx, "CreateIdempotencyKey")
+	defer done()
+	return s.next.CreateIdempotencyKey(ctx, key)
+}
+
+func (s *Storage) GetIdempotencyKey(ctx context.Context, key string) (*models.IdempotencyKey, error) {
+	ctx, done := s.observe(ctx, "GetIdempotencyKey")
+	defer done()
+	return s.next.GetIdempotencyKey(ctx, key)
+}
+
+func (s *Storage) DeleteIdempotencyKeys(ctx context.Context, createdBefore time.Time) (int, error) {
+	ctx, done := s.observe(ctx, "DeleteIdempotencyKeys")
+	defer done()
+	return s.next.DeleteIdempotencyKeys(ctx, createdBefore)
+}
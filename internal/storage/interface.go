@@ -2,13 +2,23 @@ package storage
 
 import (
 	"context"
+	"errors"
+	"time"
 
 	"github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/models"
 )
 
+var (
+	// ErrNotFound is returned when a requested record does not exist
+	ErrNotFound = errors.New("record not found")
+	// ErrAlreadyExists is returned when a record with the same unique key exists
+	ErrAlreadyExists = errors.New("record already exists")
+)
+
 // UserRepository defines the interface for user data operations
 type UserRepository interface {
 	CreateUser(ctx context.Context, user *models.User) error
+	GetUser(ctx context.Context, id int64) (*models.User, error)
 	GetUserByTelegramID(ctx context.Context, telegramID int64) (*models.User, error)
 	UpdateUser(ctx context.Context, user *models.User) error
 }
@@ -17,16 +27,31 @@ type UserRepository interface {
 type GroupRepository interface {
 	CreateGroup(ctx context.Context, group *models.Group) error
 	GetGroup(ctx context.Context, id int64) (*models.Group, error)
+	GetGroupByChatID(ctx context.Context, chatID int64) (*models.Group, error)
 	GetUserGroups(ctx context.Context, userID int64) ([]models.Group, error)
+	// ListGroups returns all groups ordered by ID
+	ListGroups(ctx context.Context) ([]models.Group, error)
 	UpdateGroup(ctx context.Context, group *models.Group) error
 	DeleteGroup(ctx context.Context, id int64) error
 }
 
+// MemberRepository defines the interface for group membership operations
+type MemberRepository interface {
+	AddMember(ctx context.Context, member *models.GroupMember) error
+	GetMember(ctx context.Context, groupID, userID int64) (*models.GroupMember, error)
+	GetGroupMembers(ctx context.Context, groupID int64) ([]models.GroupMember, error)
+	RemoveMember(ctx context.Context, groupID, userID int64) error
+}
+
 // ExpenseRepository defines the interface for expense data operations
 type ExpenseRepository interface {
 	CreateExpense(ctx context.Context, expense *models.Expense) error
 	GetExpense(ctx context.Context, id int64) (*models.Expense, error)
 	GetGroupExpenses(ctx context.Context, groupID int64) ([]models.Expense, error)
+	// EachGroupExpense calls fn for every expense of a group created in
+	// [from, to) in ID order, zero bounds being open. It stops at the first
+	// error returned by fn and returns it.
+	EachGroupExpense(ctx context.Context, groupID int64, from, to time.Time, fn func(models.Expense) error) error
 	UpdateExpense(ctx context.Context, expense *models.Expense) error
 	DeleteExpense(ctx context.Context, id int64) error
 }
@@ -35,23 +60,146 @@ type ExpenseRepository interface {
 type ParticipantRepository interface {
 	CreateParticipant(ctx context.Context, participant *models.Participant) error
 	GetExpenseParticipants(ctx context.Context, expenseID int64) ([]models.Participant, error)
+	GetGroupParticipants(ctx context.Context, groupID int64) ([]models.Participant, error)
 	UpdateParticipant(ctx context.Context, participant *models.Participant) error
 	DeleteParticipant(ctx context.Context, id int64) error
 }
 
+// ExpenseItemRepository defines the interface for expense line item data operations
+type ExpenseItemRepository interface {
+	CreateExpenseItem(ctx context.Context, item *models.ExpenseItem) error
+	GetExpenseItem(ctx context.Context, id int64) (*models.ExpenseItem, error)
+	GetExpenseItems(ctx context.Context, expenseID int64) ([]models.ExpenseItem, error)
+	// GetUnclaimedExpenseItems returns the items of all groups that nobody has
+	// claimed and that were created before the given time
+	GetUnclaimedExpenseItems(ctx context.Context, createdBefore time.Time) ([]models.ExpenseItem, error)
+	UpdateExpenseItem(ctx context.Context, item *models.ExpenseItem) error
+}
+
 // SettlementRepository defines the interface for settlement data operations
 type SettlementRepository interface {
 	CreateSettlement(ctx context.Context, settlement *models.Settlement) error
 	GetSettlement(ctx context.Context, id int64) (*models.Settlement, error)
 	GetGroupSettlements(ctx context.Context, groupID int64) ([]models.Settlement, error)
+	// EachGroupSettlement calls fn for every settlement of a group created in
+	// [from, to) in ID order, zero bounds being open. It stops at the first
+	// error returned by fn and returns it.
+	EachGroupSettlement(ctx context.Context, groupID int64, from, to time.Time, fn func(models.Settlement) error) error
+	// GetPendingSettlements returns pending settlements of all groups created before the given time
+	GetPendingSettlements(ctx context.Context, createdBefore time.Time) ([]models.Settlement, error)
 	UpdateSettlement(ctx context.Context, settlement *models.Settlement) error
 }
 
+// ReminderRepository defines the interface for payment reminder data operations
+type ReminderRepository interface {
+	CreateReminder(ctx context.Context, reminder *models.Reminder) error
+	GetSettlementReminders(ctx context.Context, settlementID int64) ([]models.Reminder, error)
+}
+
+// RecurringExpenseRepository defines the interface for recurring expense data operations
+type RecurringExpenseRepository interface {
+	CreateRecurringExpense(ctx context.Context, recurring *models.RecurringExpense) error
+	GetRecurringExpense(ctx context.Context, id int64) (*models.RecurringExpense, error)
+	GetGroupRecurringExpenses(ctx context.Context, groupID int64) ([]models.RecurringExpense, error)
+	// GetDueRecurringExpenses returns active recurring expenses whose next run is at or before now
+	GetDueRecurringExpenses(ctx context.Context, now time.Time) ([]models.RecurringExpense, error)
+	UpdateRecurringExpense(ctx context.Context, recurring *models.RecurringExpense) error
+}
+
+// ImportRepository defines the interface for expense import data operations
+type ImportRepository interface {
+	CreateImport(ctx context.Context, imp *models.Import) error
+	GetImport(ctx context.Context, id int64) (*models.Import, error)
+	UpdateImport(ctx context.Context, imp *models.Import) error
+}
+
+// ReceiptRepository defines the interface for scanned receipt data operations
+type ReceiptRepository interface {
+	CreateReceipt(ctx context.Context, receipt *models.Receipt) error
+	GetReceipt(ctx context.Context, id int64) (*models.Receipt, error)
+	UpdateReceipt(ctx context.Context, receipt *models.Receipt) error
+}
+
+// AuditRepository defines the interface for the append-only audit log.
+// Entries can only be appended, never updated or deleted.
+type AuditRepository interface {
+	AppendAuditEntry(ctx context.Context, entry *models.AuditEntry) error
+	GetLastAuditEntry(ctx context.Context, groupID int64) (*models.AuditEntry, error)
+	GetGroupAuditEntries(ctx context.Context, groupID int64) ([]models.AuditEntry, error)
+}
+
+// LedgerRepository defines the interface for the append-only event ledger and
+// its balance snapshots. Expenses, participants and settlements are projections
+// of the ledger kept in sync by the service layer within the same transaction.
+type LedgerRepository interface {
+	// AppendEvent assigns the event its ID and next sequence number in the group
+	AppendEvent(ctx context.Context, event *models.LedgerEvent) error
+	// GetGroupEvents returns the group's events after the given sequence number in order
+	GetGroupEvents(ctx context.Context, groupID, afterSequence int64) ([]models.LedgerEvent, error)
+	SaveSnapshot(ctx context.Context, snapshot *models.BalanceSnapshot) error
+	// GetLatestSnapshot returns the newest snapshot taken at or before at,
+	// or the newest snapshot if at is zero
+	GetLatestSnapshot(ctx context.Context, groupID int64, at time.Time) (*models.BalanceSnapshot, error)
+	// DeleteSnapshots removes all snapshots of a group so they can be rebuilt
+	// from the ledger
+	DeleteSnapshots(ctx context.Context, groupID int64) error
+}
+
+// IdempotencyRepository defines the interface for idempotency keys of
+// operations that must not run twice, such as handling a Telegram update
+type IdempotencyRepository interface {
+	// CreateIdempotencyKey stores a key or returns ErrAlreadyExists if it is
+	// stored already
+	CreateIdempotencyKey(ctx context.Context, key *models.IdempotencyKey) error
+	GetIdempotencyKey(ctx context.Context, key string) (*models.IdempotencyKey, error)
+	// DeleteIdempotencyKeys removes keys created before the given time and
+	// returns how many were removed
+	DeleteIdempotencyKeys(ctx context.Context, createdBefore time.Time) (int, error)
+}
+
+// TxFunc is a unit of work executed inside a storage transaction.
+// The Storage passed to it must be used for all operations that
+// should be part of the transaction.
+type TxFunc func(ctx context.Context, tx Storage) error
+
+// Transactor runs units of work atomically
+type Transactor interface {
+	// WithTx runs fn in a transaction. The transaction is committed if fn
+	// returns nil and rolled back otherwise.
+	WithTx(ctx context.Context, fn TxFunc) error
+}
+
+// GroupLocker serializes writes to a group across transactions
+type GroupLocker interface {
+	// LockGroup waits until the group is locked and returns the function
+	// unlocking it. The lock is taken before the transaction writing to the
+	// group starts and released after it ended, so no transaction is held
+	// open while waiting and the next holder reads what was committed.
+	LockGroup(ctx context.Context, groupID int64) (unlock func(), err error)
+}
+
+// Pinger checks the connection to the storage, e.g. for readiness probes
+type Pinger interface {
+	Ping(ctx context.Context) error
+}
+
 // Storage aggregates all repository interfaces
 type Storage interface {
 	UserRepository
 	GroupRepository
+	MemberRepository
 	ExpenseRepository
 	ParticipantRepository
+	ExpenseItemRepository
 	SettlementRepository
+	ReminderRepository
+	RecurringExpenseRepository
+	ImportRepository
+	ReceiptRepository
+	AuditRepository
+	LedgerRepository
+	IdempotencyRepository
+	Transactor
+	GroupLocker
+	Pinger
 }
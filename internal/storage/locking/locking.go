@@ -0,0 +1,74 @@
+// Package locking decorates a storage so its group locks are taken with a
+// lock.Locker
+package locking
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/lock"
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/storage"
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/pkg/logger"
+)
+
+// Storage passes every operation on to the next storage and locks groups
+// with the locker
+type Storage struct {
+	storage.Storage
+	locker  lock.Locker
+	timeout time.Duration
+	logger  logger.Logger
+}
+
+// New returns a storage locking groups with locker. A write waits at most
+// timeout for a group lock, zero waiting as long as its context allows.
+func New(next storage.Storage, locker lock.Locker, timeout time.Duration, log logger.Logger) *Storage {
+	return &Storage{
+		Storage: next,
+		locker:  locker,
+		timeout: timeout,
+		logger:  log.With(logger.String("component", "storage")),
+	}
+}
+
+// LockGroup takes the group's lock in the locker and then in the next
+// storage. The returned function releases both even if ctx is cancelled by
+// then, since the locks would block other writers.
+func (s *Storage) LockGroup(ctx context.Context, groupID int64) (func(), error) {
+	wait := ctx
+	if s.timeout > 0 {
+		var cancel context.CancelFunc
+		wait, cancel = context.WithTimeout(ctx, s.timeout)
+		defer cancel()
+	}
+	l, err := s.locker.Lock(wait, groupName(groupID))
+	if err != nil {
+		return nil, fmt.Errorf("lock group %d: %w", groupID, err)
+	}
+
+	ctx = context.WithoutCancel(ctx)
+	release := func() {
+		if err := l.Unlock(ctx); err != nil {
+			s.logger.ErrorContext(ctx, "Failed to release group lock",
+				logger.Int64("group_id", groupID),
+				logger.Error(err),
+			)
+		}
+	}
+	unlock, err := s.Storage.LockGroup(wait, groupID)
+	if err != nil {
+		release()
+		return nil, err
+	}
+	return func() {
+		unlock()
+		release()
+	}, nil
+}
+
+// groupName is the name of a group's lock
+func groupName(groupID int64) string {
+	return "group:" + strconv.FormatInt(groupID, 10)
+}
@@ -0,0 +1,97 @@
+package locking
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/lock"
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/models"
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/storage"
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/storage/memory"
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/pkg/logger"
+)
+
+func newStorage(t *testing.T, locker lock.Locker, timeout time.Duration) *Storage {
+	t.Helper()
+	log, err := logger.New(logger.Config{Level: "error", Environment: "production", OutputPath: "stderr"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return New(memory.New(), locker, timeout, log)
+}
+
+func TestLockGroupWaitsForHolder(t *testing.T) {
+	ctx := context.Background()
+	s := newStorage(t, lock.NewMemory(), 50*time.Millisecond)
+
+	unlock, err := s.LockGroup(ctx, 1)
+	if err != nil {
+		t.Fatalf("LockGroup() error = %v", err)
+	}
+
+	if _, err := s.LockGroup(ctx, 1); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("LockGroup() of a held group error = %v, want a timeout", err)
+	}
+	other, err := s.LockGroup(ctx, 2)
+	if err != nil {
+		t.Fatalf("LockGroup() of another group error = %v", err)
+	}
+	other()
+
+	acquired := make(chan error)
+	go func() {
+		unlock, err := s.LockGroup(context.Background(), 1)
+		if err == nil {
+			unlock()
+		}
+		acquired <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+	unlock()
+	if err := <-acquired; err != nil {
+		t.Fatalf("LockGroup() after release error = %v", err)
+	}
+}
+
+func TestWaitingHoldsNoTransaction(t *testing.T) {
+	ctx := context.Background()
+	s := newStorage(t, lock.NewMemory(), 0)
+
+	unlock, err := s.LockGroup(ctx, 1)
+	if err != nil {
+		t.Fatalf("LockGroup() error = %v", err)
+	}
+	defer unlock()
+
+	// A writer waiting for the group's lock must not keep others from
+	// running transactions
+	waitCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	waiting := make(chan error)
+	go func() {
+		_, err := s.LockGroup(waitCtx, 1)
+		waiting <- err
+	}()
+
+	done := make(chan error)
+	go func() {
+		done <- s.WithTx(ctx, func(ctx context.Context, tx storage.Storage) error {
+			return tx.CreateUser(ctx, &models.User{TelegramID: 1, Username: "alice"})
+		})
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("WithTx() error = %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("WithTx() blocked by a writer waiting for a group lock")
+	}
+
+	cancel()
+	if err := <-waiting; !errors.Is(err, context.Canceled) {
+		t.Fatalf("LockGroup() error = %v, want context.Canceled", err)
+	}
+}
@@ -0,0 +1,28 @@
+//go:build unix
+
+package memory
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// lockFile takes an exclusive lock of the file at path, creating it if
+// needed. The lock is released by the returned function or when the process
+// exits, so a crashed process leaves no stale lock behind.
+func lockFile(path string) (func() error, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		f.Close()
+		if errors.Is(err, syscall.EWOULDBLOCK) {
+			return nil, ErrFileLocked
+		}
+		return nil, err
+	}
+	// Closing the file releases the lock
+	return f.Close, nil
+}
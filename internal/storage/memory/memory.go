@@ -0,0 +1,1014 @@
+package memory
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/models"
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/money"
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/storage"
+)
+
+// Store is an in-memory implementation of storage.Storage.
+// It is intended for development and for running the bot without a database.
+type Store struct {
+	mu     sync.RWMutex
+	state  *state
+	path   string       // data file the store was opened from, if any
+	unlock func() error // releases the data file lock
+}
+
+// state holds all records and ID sequences of the store
+type state struct {
+	seq          map[string]int64
+	users        map[int64]models.User
+	groups       map[int64]models.Group
+	members      map[int64]map[int64]models.GroupMember // group ID -> user ID -> member
+	expenses     map[int64]models.Expense
+	participants map[int64]models.Participant
+	items        map[int64]models.ExpenseItem
+	recurring    map[int64]models.RecurringExpense
+	settlements  map[int64]models.Settlement
+	reminders    map[int64]models.Reminder
+	imports      map[int64]models.Import
+	receipts     map[int64]models.Receipt
+	audit        map[int64][]models.AuditEntry  // group ID -> entries in append order
+	events       map[int64][]models.LedgerEvent // group ID -> events in sequence order
+	snapshots    map[int64][]models.BalanceSnapshot
+	idempotency  map[string]models.IdempotencyKey
+}
+
+// New creates a new empty in-memory store
+func New() *Store {
+	return &Store{state: newState()}
+}
+
+func newState() *state {
+	return &state{
+		seq:          make(map[string]int64),
+		users:        make(map[int64]models.User),
+		groups:       make(map[int64]models.Group),
+		members:      make(map[int64]map[int64]models.GroupMember),
+		expenses:     make(map[int64]models.Expense),
+		participants: make(map[int64]models.Participant),
+		items:        make(map[int64]models.ExpenseItem),
+		settlements:  make(map[int64]models.Settlement),
+		recurring:    make(map[int64]models.RecurringExpense),
+		reminders:    make(map[int64]models.Reminder),
+		imports:      make(map[int64]models.Import),
+		receipts:     make(map[int64]models.Receipt),
+		audit:        make(map[int64][]models.AuditEntry),
+		events:       make(map[int64][]models.LedgerEvent),
+		snapshots:    make(map[int64][]models.BalanceSnapshot),
+		idempotency:  make(map[string]models.IdempotencyKey),
+	}
+}
+
+// clone returns a deep copy of the state
+func (s *state) clone() *state {
+	c := newState()
+	for k, v := range s.seq {
+		c.seq[k] = v
+	}
+	for k, v := range s.users {
+		c.users[k] = v
+	}
+	for k, v := range s.groups {
+		c.groups[k] = v
+	}
+	for groupID, members := range s.members {
+		m := make(map[int64]models.GroupMember, len(members))
+		for k, v := range members {
+			m[k] = v
+		}
+		c.members[groupID] = m
+	}
+	for k, v := range s.expenses {
+		c.expenses[k] = v
+	}
+	for k, v := range s.participants {
+		c.participants[k] = v
+	}
+	for k, v := range s.items {
+		c.items[k] = copyItem(v)
+	}
+	for k, v := range s.settlements {
+		c.settlements[k] = v
+	}
+	for k, v := range s.recurring {
+		c.recurring[k] = v
+	}
+	for k, v := range s.reminders {
+		c.reminders[k] = v
+	}
+	for k, v := range s.imports {
+		c.imports[k] = copyImport(v)
+	}
+	for k, v := range s.receipts {
+		c.receipts[k] = copyReceipt(v)
+	}
+	for k, v := range s.audit {
+		c.audit[k] = append([]models.AuditEntry(nil), v...)
+	}
+	for k, v := range s.events {
+		c.events[k] = append([]models.LedgerEvent(nil), v...)
+	}
+	for k, v := range s.snapshots {
+		c.snapshots[k] = append([]models.BalanceSnapshot(nil), v...)
+	}
+	for k, v := range s.idempotency {
+		c.idempotency[k] = v
+	}
+	return c
+}
+
+// nextID returns the next ID of the given sequence
+func (s *state) nextID(name string) int64 {
+	s.seq[name]++
+	return s.seq[name]
+}
+
+// WithTx runs fn against a copy of the store and commits the copy if fn succeeds.
+// Transactions are serialized with all other writes.
+func (s *Store) WithTx(ctx context.Context, fn storage.TxFunc) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tx := &Store{state: s.state.clone()}
+	if err := fn(ctx, tx); err != nil {
+		return err
+	}
+
+	s.state = tx.state
+	return nil
+}
+
+// LockGroup does nothing since transactions are serialized already
+func (s *Store) LockGroup(ctx context.Context, groupID int64) (func(), error) {
+	return func() {}, nil
+}
+
+// CreateUser stores a new user and assigns its ID
+func (s *Store) CreateUser(ctx context.Context, user *models.User) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	user.ID = s.state.nextID("users")
+	user.CreatedAt, user.UpdatedAt = now, now
+	s.state.users[user.ID] = *user
+	return nil
+}
+
+// GetUser returns a user by ID
+func (s *Store) GetUser(ctx context.Context, id int64) (*models.User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	user, ok := s.state.users[id]
+	if !ok {
+		return nil, storage.ErrNotFound
+	}
+	return &user, nil
+}
+
+// GetUserByTelegramID returns a user by Telegram ID
+func (s *Store) GetUserByTelegramID(ctx context.Context, telegramID int64) (*models.User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, user := range s.state.users {
+		if user.TelegramID == telegramID {
+			return &user, nil
+		}
+	}
+	return nil, storage.ErrNotFound
+}
+
+// UpdateUser updates an existing user
+func (s *Store) UpdateUser(ctx context.Context, user *models.User) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.state.users[user.ID]; !ok {
+		return storage.ErrNotFound
+	}
+	user.UpdatedAt = time.Now()
+	s.state.users[user.ID] = *user
+	return nil
+}
+
+// CreateGroup stores a new group and assigns its ID
+func (s *Store) CreateGroup(ctx context.Context, group *models.Group) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	group.ID = s.state.nextID("groups")
+	group.CreatedAt, group.UpdatedAt = now, now
+	s.state.groups[group.ID] = *group
+	return nil
+}
+
+// GetGroup returns a group by ID
+func (s *Store) GetGroup(ctx context.Context, id int64) (*models.Group, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	group, ok := s.state.groups[id]
+	if !ok {
+		return nil, storage.ErrNotFound
+	}
+	return &group, nil
+}
+
+// GetGroupByChatID returns the group bound to a Telegram chat
+func (s *Store) GetGroupByChatID(ctx context.Context, chatID int64) (*models.Group, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, group := range s.state.groups {
+		if group.ChatID == chatID {
+			return &group, nil
+		}
+	}
+	return nil, storage.ErrNotFound
+}
+
+// GetUserGroups returns all groups the user is a member of
+func (s *Store) GetUserGroups(ctx context.Context, userID int64) ([]models.Group, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var groups []models.Group
+	for groupID, members := range s.state.members {
+		if _, ok := members[userID]; ok {
+			groups = append(groups, s.state.groups[groupID])
+		}
+	}
+	sort.Slice(groups, func(i, j int) bool { return groups[i].ID < groups[j].ID })
+	return groups, nil
+}
+
+// ListGroups returns all groups ordered by ID
+func (s *Store) ListGroups(ctx context.Context) ([]models.Group, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	groups := make([]models.Group, 0, len(s.state.groups))
+	for _, group := range s.state.groups {
+		groups = append(groups, group)
+	}
+	sort.Slice(groups, func(i, j int) bool { return groups[i].ID < groups[j].ID })
+	return groups, nil
+}
+
+// UpdateGroup updates an existing group
+func (s *Store) UpdateGroup(ctx context.Context, group *models.Group) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.state.groups[group.ID]; !ok {
+		return storage.ErrNotFound
+	}
+	group.UpdatedAt = time.Now()
+	s.state.groups[group.ID] = *group
+	return nil
+}
+
+// DeleteGroup deletes a group together with its members
+func (s *Store) DeleteGroup(ctx context.Context, id int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.state.groups[id]; !ok {
+		return storage.ErrNotFound
+	}
+	delete(s.state.groups, id)
+	delete(s.state.members, id)
+	return nil
+}
+
+// AddMember adds a user to a group, replacing an existing membership
+func (s *Store) AddMember(ctx context.Context, member *models.GroupMember) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.state.groups[member.GroupID]; !ok {
+		return storage.ErrNotFound
+	}
+	if member.JoinedAt.IsZero() {
+		member.JoinedAt = time.Now()
+	}
+	if s.state.members[member.GroupID] == nil {
+		s.state.members[member.GroupID] = make(map[int64]models.GroupMember)
+	}
+	s.state.members[member.GroupID][member.UserID] = *member
+	return nil
+}
+
+// GetMember returns a user's membership in a group
+func (s *Store) GetMember(ctx context.Context, groupID, userID int64) (*models.GroupMember, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	member, ok := s.state.members[groupID][userID]
+	if !ok {
+		return nil, storage.ErrNotFound
+	}
+	return &member, nil
+}
+
+// GetGroupMembers returns all members of a group ordered by join time
+func (s *Store) GetGroupMembers(ctx context.Context, groupID int64) ([]models.GroupMember, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	members := make([]models.GroupMember, 0, len(s.state.members[groupID]))
+	for _, member := range s.state.members[groupID] {
+		members = append(members, member)
+	}
+	sort.Slice(members, func(i, j int) bool {
+		if members[i].JoinedAt.Equal(members[j].JoinedAt) {
+			return members[i].UserID < members[j].UserID
+		}
+		return members[i].JoinedAt.Before(members[j].JoinedAt)
+	})
+	return members, nil
+}
+
+// RemoveMember removes a user from a group
+func (s *Store) RemoveMember(ctx context.Context, groupID, userID int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.state.members[groupID][userID]; !ok {
+		return storage.ErrNotFound
+	}
+	delete(s.state.members[groupID], userID)
+	return nil
+}
+
+// CreateExpense stores a new expense and assigns its ID
+func (s *Store) CreateExpense(ctx context.Context, expense *models.Expense) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	expense.ID = s.state.nextID("expenses")
+	// Imported expenses keep the date they were incurred on
+	if expense.CreatedAt.IsZero() {
+		expense.CreatedAt = now
+	}
+	expense.UpdatedAt = now
+	s.state.expenses[expense.ID] = *expense
+	return nil
+}
+
+// GetExpense returns an expense by ID
+func (s *Store) GetExpense(ctx context.Context, id int64) (*models.Expense, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	expense, ok := s.state.expenses[id]
+	if !ok {
+		return nil, storage.ErrNotFound
+	}
+	return &expense, nil
+}
+
+// GetGroupExpenses returns all expenses of a group ordered by ID
+func (s *Store) GetGroupExpenses(ctx context.Context, groupID int64) ([]models.Expense, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var expenses []models.Expense
+	for _, expense := range s.state.expenses {
+		if expense.GroupID == groupID {
+			expenses = append(expenses, expense)
+		}
+	}
+	sort.Slice(expenses, func(i, j int) bool { return expenses[i].ID < expenses[j].ID })
+	return expenses, nil
+}
+
+// EachGroupExpense calls fn for every expense of a group created in [from, to).
+// The matching expenses are copied before fn is called so it may use the store.
+func (s *Store) EachGroupExpense(ctx context.Context, groupID int64, from, to time.Time, fn func(models.Expense) error) error {
+	s.mu.RLock()
+	var expenses []models.Expense
+	for _, expense := range s.state.expenses {
+		if expense.GroupID == groupID && inRange(expense.CreatedAt, from, to) {
+			expenses = append(expenses, expense)
+		}
+	}
+	s.mu.RUnlock()
+
+	sort.Slice(expenses, func(i, j int) bool { return expenses[i].ID < expenses[j].ID })
+	for _, expense := range expenses {
+		if err := fn(expense); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// UpdateExpense updates an existing expense
+func (s *Store) UpdateExpense(ctx context.Context, expense *models.Expense) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.state.expenses[expense.ID]; !ok {
+		return storage.ErrNotFound
+	}
+	expense.UpdatedAt = time.Now()
+	s.state.expenses[expense.ID] = *expense
+	return nil
+}
+
+// DeleteExpense deletes an expense together with its participants and items
+func (s *Store) DeleteExpense(ctx context.Context, id int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.state.expenses[id]; !ok {
+		return storage.ErrNotFound
+	}
+	delete(s.state.expenses, id)
+	for participantID, participant := range s.state.participants {
+		if participant.ExpenseID == id {
+			delete(s.state.participants, participantID)
+		}
+	}
+	for itemID, item := range s.state.items {
+		if item.ExpenseID == id {
+			delete(s.state.items, itemID)
+		}
+	}
+	return nil
+}
+
+// CreateParticipant stores a new participant and assigns its ID
+func (s *Store) CreateParticipant(ctx context.Context, participant *models.Participant) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.state.expenses[participant.ExpenseID]; !ok {
+		return storage.ErrNotFound
+	}
+	participant.ID = s.state.nextID("participants")
+	s.state.participants[participant.ID] = *participant
+	return nil
+}
+
+// GetExpenseParticipants returns all participants of an expense ordered by ID
+func (s *Store) GetExpenseParticipants(ctx context.Context, expenseID int64) ([]models.Participant, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var participants []models.Participant
+	for _, participant := range s.state.participants {
+		if participant.ExpenseID == expenseID {
+			participants = append(participants, participant)
+		}
+	}
+	sort.Slice(participants, func(i, j int) bool { return participants[i].ID < participants[j].ID })
+	return participants, nil
+}
+
+// GetGroupParticipants returns the participants of all expenses in a group ordered by ID
+func (s *Store) GetGroupParticipants(ctx context.Context, groupID int64) ([]models.Participant, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var participants []models.Participant
+	for _, participant := range s.state.participants {
+		if s.state.expenses[participant.ExpenseID].GroupID == groupID {
+			participants = append(participants, participant)
+		}
+	}
+	sort.Slice(participants, func(i, j int) bool { return participants[i].ID < participants[j].ID })
+	return participants, nil
+}
+
+// UpdateParticipant updates an existing participant
+func (s *Store) UpdateParticipant(ctx context.Context, participant *models.Participant) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.state.participants[participant.ID]; !ok {
+		return storage.ErrNotFound
+	}
+	s.state.participants[participant.ID] = *participant
+	return nil
+}
+
+// DeleteParticipant deletes a participant
+func (s *Store) DeleteParticipant(ctx context.Context, id int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.state.participants[id]; !ok {
+		return storage.ErrNotFound
+	}
+	delete(s.state.participants, id)
+	return nil
+}
+
+// copyItem returns a copy of an item that shares no memory with it
+func copyItem(item models.ExpenseItem) models.ExpenseItem {
+	item.ClaimedBy = append([]int64(nil), item.ClaimedBy...)
+	if item.RemindedAt != nil {
+		at := *item.RemindedAt
+		item.RemindedAt = &at
+	}
+	return item
+}
+
+// CreateExpenseItem stores a new expense item and assigns its ID
+func (s *Store) CreateExpenseItem(ctx context.Context, item *models.ExpenseItem) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.state.expenses[item.ExpenseID]; !ok {
+		return storage.ErrNotFound
+	}
+	now := time.Now()
+	item.ID = s.state.nextID("items")
+	item.CreatedAt, item.UpdatedAt = now, now
+	s.state.items[item.ID] = copyItem(*item)
+	return nil
+}
+
+// GetExpenseItem returns an expense item by ID
+func (s *Store) GetExpenseItem(ctx context.Context, id int64) (*models.ExpenseItem, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	item, ok := s.state.items[id]
+	if !ok {
+		return nil, storage.ErrNotFound
+	}
+	item = copyItem(item)
+	return &item, nil
+}
+
+// GetExpenseItems returns all items of an expense ordered by ID
+func (s *Store) GetExpenseItems(ctx context.Context, expenseID int64) ([]models.ExpenseItem, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var items []models.ExpenseItem
+	for _, item := range s.state.items {
+		if item.ExpenseID == expenseID {
+			items = append(items, copyItem(item))
+		}
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].ID < items[j].ID })
+	return items, nil
+}
+
+// GetUnclaimedExpenseItems returns unclaimed items created before the given time ordered by ID
+func (s *Store) GetUnclaimedExpenseItems(ctx context.Context, createdBefore time.Time) ([]models.ExpenseItem, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var items []models.ExpenseItem
+	for _, item := range s.state.items {
+		if len(item.ClaimedBy) == 0 && item.CreatedAt.Before(createdBefore) {
+			items = append(items, copyItem(item))
+		}
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].ID < items[j].ID })
+	return items, nil
+}
+
+// UpdateExpenseItem updates an existing expense item
+func (s *Store) UpdateExpenseItem(ctx context.Context, item *models.ExpenseItem) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.state.items[item.ID]; !ok {
+		return storage.ErrNotFound
+	}
+	item.UpdatedAt = time.Now()
+	s.state.items[item.ID] = copyItem(*item)
+	return nil
+}
+
+// CreateSettlement stores a new settlement and assigns its ID
+func (s *Store) CreateSettlement(ctx context.Context, settlement *models.Settlement) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	settlement.ID = s.state.nextID("settlements")
+	settlement.CreatedAt, settlement.UpdatedAt = now, now
+	s.state.settlements[settlement.ID] = *settlement
+	return nil
+}
+
+// GetSettlement returns a settlement by ID
+func (s *Store) GetSettlement(ctx context.Context, id int64) (*models.Settlement, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	settlement, ok := s.state.settlements[id]
+	if !ok {
+		return nil, storage.ErrNotFound
+	}
+	return &settlement, nil
+}
+
+// GetGroupSettlements returns all settlements of a group ordered by ID
+func (s *Store) GetGroupSettlements(ctx context.Context, groupID int64) ([]models.Settlement, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var settlements []models.Settlement
+	for _, settlement := range s.state.settlements {
+		if settlement.GroupID == groupID {
+			settlements = append(settlements, settlement)
+		}
+	}
+	sort.Slice(settlements, func(i, j int) bool { return settlements[i].ID < settlements[j].ID })
+	return settlements, nil
+}
+
+// EachGroupSettlement calls fn for every settlement of a group created in [from, to).
+// The matching settlements are copied before fn is called so it may use the store.
+func (s *Store) EachGroupSettlement(ctx context.Context, groupID int64, from, to time.Time, fn func(models.Settlement) error) error {
+	s.mu.RLock()
+	var settlements []models.Settlement
+	for _, settlement := range s.state.settlements {
+		if settlement.GroupID == groupID && inRange(settlement.CreatedAt, from, to) {
+			settlements = append(settlements, settlement)
+		}
+	}
+	s.mu.RUnlock()
+
+	sort.Slice(settlements, func(i, j int) bool { return settlements[i].ID < settlements[j].ID })
+	for _, settlement := range settlements {
+		if err := fn(settlement); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetPendingSettlements returns pending settlements of all groups created before the given time
+func (s *Store) GetPendingSettlements(ctx context.Context, createdBefore time.Time) ([]models.Settlement, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var settlements []models.Settlement
+	for _, settlement := range s.state.settlements {
+		if settlement.Status == models.SettlementPending && settlement.CreatedAt.Before(createdBefore) {
+			settlements = append(settlements, settlement)
+		}
+	}
+	sort.Slice(settlements, func(i, j int) bool { return settlements[i].ID < settlements[j].ID })
+	return settlements, nil
+}
+
+// UpdateSettlement updates an existing settlement
+func (s *Store) UpdateSettlement(ctx context.Context, settlement *models.Settlement) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.state.settlements[settlement.ID]; !ok {
+		return storage.ErrNotFound
+	}
+	settlement.UpdatedAt = time.Now()
+	s.state.settlements[settlement.ID] = *settlement
+	return nil
+}
+
+// CreateReminder stores a sent reminder and assigns its ID
+func (s *Store) CreateReminder(ctx context.Context, reminder *models.Reminder) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	reminder.ID = s.state.nextID("reminders")
+	s.state.reminders[reminder.ID] = *reminder
+	return nil
+}
+
+// GetSettlementReminders returns the reminders sent for a settlement in the order they were sent
+func (s *Store) GetSettlementReminders(ctx context.Context, settlementID int64) ([]models.Reminder, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var reminders []models.Reminder
+	for _, reminder := range s.state.reminders {
+		if reminder.SettlementID == settlementID {
+			reminders = append(reminders, reminder)
+		}
+	}
+	sort.Slice(reminders, func(i, j int) bool { return reminders[i].ID < reminders[j].ID })
+	return reminders, nil
+}
+
+// CreateRecurringExpense stores a new recurring expense and assigns its ID
+func (s *Store) CreateRecurringExpense(ctx context.Context, recurring *models.RecurringExpense) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	recurring.ID = s.state.nextID("recurring")
+	recurring.CreatedAt, recurring.UpdatedAt = now, now
+	s.state.recurring[recurring.ID] = *recurring
+	return nil
+}
+
+// GetRecurringExpense returns a recurring expense by ID
+func (s *Store) GetRecurringExpense(ctx context.Context, id int64) (*models.RecurringExpense, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	recurring, ok := s.state.recurring[id]
+	if !ok {
+		return nil, storage.ErrNotFound
+	}
+	return &recurring, nil
+}
+
+// GetGroupRecurringExpenses returns all recurring expenses of a group
+func (s *Store) GetGroupRecurringExpenses(ctx context.Context, groupID int64) ([]models.RecurringExpense, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var result []models.RecurringExpense
+	for _, recurring := range s.state.recurring {
+		if recurring.GroupID == groupID {
+			result = append(result, recurring)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].ID < result[j].ID })
+	return result, nil
+}
+
+// GetDueRecurringExpenses returns active recurring expenses due at or before now
+func (s *Store) GetDueRecurringExpenses(ctx context.Context, now time.Time) ([]models.RecurringExpense, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var result []models.RecurringExpense
+	for _, recurring := range s.state.recurring {
+		if recurring.Active && !recurring.NextRunAt.After(now) {
+			result = append(result, recurring)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].ID < result[j].ID })
+	return result, nil
+}
+
+// UpdateRecurringExpense updates an existing recurring expense
+func (s *Store) UpdateRecurringExpense(ctx context.Context, recurring *models.RecurringExpense) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.state.recurring[recurring.ID]; !ok {
+		return storage.ErrNotFound
+	}
+	recurring.UpdatedAt = time.Now()
+	s.state.recurring[recurring.ID] = *recurring
+	return nil
+}
+
+// copyImport returns a deep copy of an import
+func copyImport(imp models.Import) models.Import {
+	imp.People = append([]string(nil), imp.People...)
+	imp.Matches = append([]int64(nil), imp.Matches...)
+	records := make([]models.ImportRecord, len(imp.Records))
+	for i, record := range imp.Records {
+		record.Shares = append([]models.ImportShare(nil), record.Shares...)
+		records[i] = record
+	}
+	imp.Records = records
+	return imp
+}
+
+// CreateImport stores a new import and assigns its ID
+func (s *Store) CreateImport(ctx context.Context, imp *models.Import) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	imp.ID = s.state.nextID("imports")
+	imp.CreatedAt, imp.UpdatedAt = now, now
+	s.state.imports[imp.ID] = copyImport(*imp)
+	return nil
+}
+
+// GetImport returns an import by ID
+func (s *Store) GetImport(ctx context.Context, id int64) (*models.Import, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	imp, ok := s.state.imports[id]
+	if !ok {
+		return nil, storage.ErrNotFound
+	}
+	imp = copyImport(imp)
+	return &imp, nil
+}
+
+// UpdateImport updates an existing import
+func (s *Store) UpdateImport(ctx context.Context, imp *models.Import) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.state.imports[imp.ID]; !ok {
+		return storage.ErrNotFound
+	}
+	imp.UpdatedAt = time.Now()
+	s.state.imports[imp.ID] = copyImport(*imp)
+	return nil
+}
+
+// copyReceipt returns a deep copy of a receipt
+func copyReceipt(receipt models.Receipt) models.Receipt {
+	receipt.Items = append([]models.ReceiptItem(nil), receipt.Items...)
+	return receipt
+}
+
+// CreateReceipt stores a new receipt and assigns its ID
+func (s *Store) CreateReceipt(ctx context.Context, receipt *models.Receipt) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	receipt.ID = s.state.nextID("receipts")
+	receipt.CreatedAt, receipt.UpdatedAt = now, now
+	s.state.receipts[receipt.ID] = copyReceipt(*receipt)
+	return nil
+}
+
+// GetReceipt returns a receipt by ID
+func (s *Store) GetReceipt(ctx context.Context, id int64) (*models.Receipt, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	receipt, ok := s.state.receipts[id]
+	if !ok {
+		return nil, storage.ErrNotFound
+	}
+	receipt = copyReceipt(receipt)
+	return &receipt, nil
+}
+
+// UpdateReceipt updates an existing receipt
+func (s *Store) UpdateReceipt(ctx context.Context, receipt *models.Receipt) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.state.receipts[receipt.ID]; !ok {
+		return storage.ErrNotFound
+	}
+	receipt.UpdatedAt = time.Now()
+	s.state.receipts[receipt.ID] = copyReceipt(*receipt)
+	return nil
+}
+
+// AppendAuditEntry appends an entry to the group's audit log and assigns its ID
+func (s *Store) AppendAuditEntry(ctx context.Context, entry *models.AuditEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry.ID = s.state.nextID("audit")
+	s.state.audit[entry.GroupID] = append(s.state.audit[entry.GroupID], *entry)
+	return nil
+}
+
+// GetLastAuditEntry returns the most recent audit entry of a group
+func (s *Store) GetLastAuditEntry(ctx context.Context, groupID int64) (*models.AuditEntry, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	entries := s.state.audit[groupID]
+	if len(entries) == 0 {
+		return nil, storage.ErrNotFound
+	}
+	entry := entries[len(entries)-1]
+	return &entry, nil
+}
+
+// GetGroupAuditEntries returns the audit log of a group from oldest to newest
+func (s *Store) GetGroupAuditEntries(ctx context.Context, groupID int64) ([]models.AuditEntry, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return append([]models.AuditEntry(nil), s.state.audit[groupID]...), nil
+}
+
+// AppendEvent appends an event to the group's ledger and assigns its ID and sequence number
+func (s *Store) AppendEvent(ctx context.Context, event *models.LedgerEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	event.ID = s.state.nextID("events")
+	event.Sequence = int64(len(s.state.events[event.GroupID])) + 1
+	s.state.events[event.GroupID] = append(s.state.events[event.GroupID], *event)
+	return nil
+}
+
+// GetGroupEvents returns the group's events after the given sequence number
+func (s *Store) GetGroupEvents(ctx context.Context, groupID, afterSequence int64) ([]models.LedgerEvent, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	events := s.state.events[groupID]
+	if afterSequence >= int64(len(events)) {
+		return nil, nil
+	}
+	return append([]models.LedgerEvent(nil), events[max(afterSequence, 0):]...), nil
+}
+
+// SaveSnapshot stores a balance snapshot of a group
+func (s *Store) SaveSnapshot(ctx context.Context, snapshot *models.BalanceSnapshot) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	balances := make(map[int64]money.Money, len(snapshot.Balances))
+	for k, v := range snapshot.Balances {
+		balances[k] = v
+	}
+	stored := *snapshot
+	stored.Balances = balances
+	s.state.snapshots[snapshot.GroupID] = append(s.state.snapshots[snapshot.GroupID], stored)
+	return nil
+}
+
+// GetLatestSnapshot returns the newest snapshot of a group taken at or before at
+func (s *Store) GetLatestSnapshot(ctx context.Context, groupID int64, at time.Time) (*models.BalanceSnapshot, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	snapshots := s.state.snapshots[groupID]
+	for i := len(snapshots) - 1; i >= 0; i-- {
+		if at.IsZero() || !snapshots[i].At.After(at) {
+			snapshot := snapshots[i]
+			return &snapshot, nil
+		}
+	}
+	return nil, storage.ErrNotFound
+}
+
+// DeleteSnapshots removes all snapshots of a group
+func (s *Store) DeleteSnapshots(ctx context.Context, groupID int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.state.snapshots, groupID)
+	return nil
+}
+
+// CreateIdempotencyKey stores a key unless it is stored already
+func (s *Store) CreateIdempotencyKey(ctx context.Context, key *models.IdempotencyKey) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.state.idempotency[key.Key]; ok {
+		return storage.ErrAlreadyExists
+	}
+	s.state.idempotency[key.Key] = *key
+	return nil
+}
+
+// GetIdempotencyKey retrieves a key
+func (s *Store) GetIdempotencyKey(ctx context.Context, key string) (*models.IdempotencyKey, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	k, ok := s.state.idempotency[key]
+	if !ok {
+		return nil, storage.ErrNotFound
+	}
+	return &k, nil
+}
+
+// DeleteIdempotencyKeys removes keys created before the given time
+func (s *Store) DeleteIdempotencyKeys(ctx context.Context, createdBefore time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var deleted int
+	for k, v := range s.state.idempotency {
+		if v.CreatedAt.Before(createdBefore) {
+			delete(s.state.idempotency, k)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+// Ensure Store implements storage.Storage
+var _ storage.Storage = (*Store)(nil)
+
+// inRange reports whether t lies in [from, to), zero bounds being open
+func inRange(t, from, to time.Time) bool {
+	return (from.IsZero() || !t.Before(from)) && (to.IsZero() || t.Before(to))
+}
@@ -0,0 +1,362 @@
+package memory
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/models"
+)
+
+// FormatVersion is the version of the data file format written by Dump
+const FormatVersion = 1
+
+// migrations upgrade a decoded data file from the version they are keyed by
+// to the next one. A migration is added whenever FormatVersion is raised.
+var migrations = map[int]func(data map[string]json.RawMessage) error{}
+
+// dump is the data file form of the store's state. Records are sorted so
+// that dumping the same state twice yields the same file.
+type dump struct {
+	Version      int                       `json:"version"`
+	Sequences    map[string]int64          `json:"sequences"`
+	Users        []models.User             `json:"users"`
+	Groups       []models.Group            `json:"groups"`
+	Members      []models.GroupMember      `json:"members"`
+	Expenses     []models.Expense          `json:"expenses"`
+	Participants []models.Participant      `json:"participants"`
+	Items        []models.ExpenseItem      `json:"items"`
+	Recurring    []models.RecurringExpense `json:"recurring"`
+	Settlements  []models.Settlement       `json:"settlements"`
+	Reminders    []models.Reminder         `json:"reminders"`
+	Imports      []models.Import           `json:"imports"`
+	Receipts     []models.Receipt          `json:"receipts"`
+	Audit        []models.AuditEntry       `json:"audit"`
+	Events       []models.LedgerEvent      `json:"events"`
+	Snapshots    []models.BalanceSnapshot  `json:"snapshots"`
+	Idempotency  []models.IdempotencyKey   `json:"idempotency_keys"`
+}
+
+// ErrFileLocked is returned by Open if another process has the data file open
+var ErrFileLocked = errors.New("data file is in use by another process")
+
+// Open returns a store holding the data file at path, migrated to the
+// current format. A missing file yields an empty store. The data file stays
+// locked until the store is closed, so a second bot process or grouppayctl
+// cannot open it and overwrite what the store saves.
+func Open(path string) (*Store, error) {
+	unlock, err := lockFile(path + ".lock")
+	if err != nil {
+		return nil, fmt.Errorf("lock %s: %w", path, err)
+	}
+	s := New()
+	s.path, s.unlock = path, unlock
+
+	f, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		s.Close()
+		return nil, err
+	}
+	defer f.Close()
+
+	if err := s.Restore(f); err != nil {
+		s.Close()
+		return nil, fmt.Errorf("read %s: %w", path, err)
+	}
+	return s, nil
+}
+
+// Close releases the lock of the data file the store was opened from
+func (s *Store) Close() error {
+	if s.unlock == nil {
+		return nil
+	}
+	err := s.unlock()
+	s.unlock = nil
+	return err
+}
+
+// Ping checks that the data file the store was opened from can be saved,
+// which needs a new file in its directory
+func (s *Store) Ping(ctx context.Context) error {
+	if s.path == "" {
+		return nil
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("data file is not writable: %w", err)
+	}
+	tmp.Close()
+	return os.Remove(tmp.Name())
+}
+
+// FileVersion returns the format version of the data file at path
+func FileVersion(path string) (int, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	var header struct {
+		Version int `json:"version"`
+	}
+	if err := json.Unmarshal(data, &header); err != nil {
+		return 0, err
+	}
+	return header.Version, nil
+}
+
+// Save atomically replaces the data file at path with the store's state
+func (s *Store) Save(path string) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := s.Dump(tmp); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// Dump writes the store's state as a data file
+func (s *Store) Dump(w io.Writer) error {
+	s.mu.RLock()
+	d := s.state.dump()
+	s.mu.RUnlock()
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", " ")
+	return enc.Encode(d)
+}
+
+// Restore replaces the store's state with a data file written by Dump,
+// migrating files of older format versions
+func (s *Store) Restore(r io.Reader) error {
+	var raw map[string]json.RawMessage
+	if err := json.NewDecoder(r).Decode(&raw); err != nil {
+		return fmt.Errorf("decode data file: %w", err)
+	}
+
+	var version int
+	if err := json.Unmarshal(raw["version"], &version); err != nil {
+		return fmt.Errorf("decode data file version: %w", err)
+	}
+	if version > FormatVersion {
+		return fmt.Errorf("data file version %d is newer than supported version %d", version, FormatVersion)
+	}
+	for ; version < FormatVersion; version++ {
+		migrate, ok := migrations[version]
+		if !ok {
+			return fmt.Errorf("no migration from data file version %d", version)
+		}
+		if err := migrate(raw); err != nil {
+			return fmt.Errorf("migrate data file from version %d: %w", version, err)
+		}
+	}
+
+	data, err := json.Marshal(raw)
+	if err != nil {
+		return err
+	}
+	var d dump
+	if err := json.Unmarshal(data, &d); err != nil {
+		return fmt.Errorf("decode data file: %w", err)
+	}
+
+	st := newState()
+	if err := st.restore(&d); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.state = st
+	s.mu.Unlock()
+	return nil
+}
+
+// dump returns the state as a data file
+func (st *state) dump() *dump {
+	d := &dump{Version: FormatVersion, Sequences: make(map[string]int64, len(st.seq))}
+	for k, v := range st.seq {
+		d.Sequences[k] = v
+	}
+	for _, v := range st.users {
+		d.Users = append(d.Users, v)
+	}
+	sort.Slice(d.Users, func(i, j int) bool { return d.Users[i].ID < d.Users[j].ID })
+	for _, v := range st.groups {
+		d.Groups = append(d.Groups, v)
+	}
+	sort.Slice(d.Groups, func(i, j int) bool { return d.Groups[i].ID < d.Groups[j].ID })
+	for _, members := range st.members {
+		for _, v := range members {
+			d.Members = append(d.Members, v)
+		}
+	}
+	sort.Slice(d.Members, func(i, j int) bool {
+		if d.Members[i].GroupID != d.Members[j].GroupID {
+			return d.Members[i].GroupID < d.Members[j].GroupID
+		}
+		return d.Members[i].UserID < d.Members[j].UserID
+	})
+	for _, v := range st.expenses {
+		d.Expenses = append(d.Expenses, v)
+	}
+	sort.Slice(d.Expenses, func(i, j int) bool { return d.Expenses[i].ID < d.Expenses[j].ID })
+	for _, v := range st.participants {
+		d.Participants = append(d.Participants, v)
+	}
+	sort.Slice(d.Participants, func(i, j int) bool { return d.Participants[i].ID < d.Participants[j].ID })
+	for _, v := range st.items {
+		d.Items = append(d.Items, copyItem(v))
+	}
+	sort.Slice(d.Items, func(i, j int) bool { return d.Items[i].ID < d.Items[j].ID })
+	for _, v := range st.recurring {
+		d.Recurring = append(d.Recurring, v)
+	}
+	sort.Slice(d.Recurring, func(i, j int) bool { return d.Recurring[i].ID < d.Recurring[j].ID })
+	for _, v := range st.settlements {
+		d.Settlements = append(d.Settlements, v)
+	}
+	sort.Slice(d.Settlements, func(i, j int) bool { return d.Settlements[i].ID < d.Settlements[j].ID })
+	for _, v := range st.reminders {
+		d.Reminders = append(d.Reminders, v)
+	}
+	sort.Slice(d.Reminders, func(i, j int) bool { return d.Reminders[i].ID < d.Reminders[j].ID })
+	for _, v := range st.imports {
+		d.Imports = append(d.Imports, copyImport(v))
+	}
+	sort.Slice(d.Imports, func(i, j int) bool { return d.Imports[i].ID < d.Imports[j].ID })
+	for _, v := range st.receipts {
+		d.Receipts = append(d.Receipts, copyReceipt(v))
+	}
+	sort.Slice(d.Receipts, func(i, j int) bool { return d.Receipts[i].ID < d.Receipts[j].ID })
+
+	// Per-group logs keep their order within the group
+	for _, groupID := range sortedKeys(st.audit) {
+		d.Audit = append(d.Audit, st.audit[groupID]...)
+	}
+	for _, groupID := range sortedKeys(st.events) {
+		d.Events = append(d.Events, st.events[groupID]...)
+	}
+	for _, groupID := range sortedKeys(st.snapshots) {
+		d.Snapshots = append(d.Snapshots, st.snapshots[groupID]...)
+	}
+	for _, v := range st.idempotency {
+		d.Idempotency = append(d.Idempotency, v)
+	}
+	sort.Slice(d.Idempotency, func(i, j int) bool { return d.Idempotency[i].Key < d.Idempotency[j].Key })
+	return d
+}
+
+// restore fills an empty state from a data file
+func (st *state) restore(d *dump) error {
+	for k, v := range d.Sequences {
+		st.seq[k] = v
+	}
+	for _, v := range d.Users {
+		st.users[v.ID] = v
+	}
+	for _, v := range d.Groups {
+		st.groups[v.ID] = v
+	}
+	for _, v := range d.Members {
+		if st.members[v.GroupID] == nil {
+			st.members[v.GroupID] = make(map[int64]models.GroupMember)
+		}
+		st.members[v.GroupID][v.UserID] = v
+	}
+	for _, v := range d.Expenses {
+		st.expenses[v.ID] = v
+	}
+	for _, v := range d.Participants {
+		st.participants[v.ID] = v
+	}
+	for _, v := range d.Items {
+		st.items[v.ID] = copyItem(v)
+	}
+	for _, v := range d.Recurring {
+		st.recurring[v.ID] = v
+	}
+	for _, v := range d.Settlements {
+		st.settlements[v.ID] = v
+	}
+	for _, v := range d.Reminders {
+		st.reminders[v.ID] = v
+	}
+	for _, v := range d.Imports {
+		st.imports[v.ID] = copyImport(v)
+	}
+	for _, v := range d.Receipts {
+		st.receipts[v.ID] = copyReceipt(v)
+	}
+	for _, v := range d.Audit {
+		st.audit[v.GroupID] = append(st.audit[v.GroupID], v)
+	}
+	for _, v := range d.Events {
+		events := st.events[v.GroupID]
+		if v.Sequence != int64(len(events))+1 {
+			return fmt.Errorf("ledger of group %d: event %d has sequence %d, want %d", v.GroupID, v.ID, v.Sequence, len(events)+1)
+		}
+		st.events[v.GroupID] = append(events, v)
+	}
+	for _, v := range d.Snapshots {
+		st.snapshots[v.GroupID] = append(st.snapshots[v.GroupID], v)
+	}
+	for _, v := range d.Idempotency {
+		st.idempotency[v.Key] = v
+	}
+
+	// IDs assigned after the restore must not collide with restored records
+	for name, maxID := range map[string]int64{
+		"users":        maxKey(st.users),
+		"groups":       maxKey(st.groups),
+		"expenses":     maxKey(st.expenses),
+		"participants": maxKey(st.participants),
+		"items":        maxKey(st.items),
+		"recurring":    maxKey(st.recurring),
+		"settlements":  maxKey(st.settlements),
+		"reminders":    maxKey(st.reminders),
+		"imports":      maxKey(st.imports),
+	} {
+		if st.seq[name] < maxID {
+			return fmt.Errorf("sequence %q is %d but records up to ID %d exist", name, st.seq[name], maxID)
+		}
+	}
+	return nil
+}
+
+func sortedKeys[V any](m map[int64]V) []int64 {
+	keys := make([]int64, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+	return keys
+}
+
+func maxKey[V any](m map[int64]V) int64 {
+	var highest int64
+	for k := range m {
+		highest = max(highest, k)
+	}
+	return highest
+}
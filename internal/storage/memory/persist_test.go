@@ -0,0 +1,63 @@
+package memory
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/models"
+)
+
+func TestOpenLocksDataFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data.json")
+
+	s, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	if _, err := Open(path); !errors.Is(err, ErrFileLocked) {
+		t.Fatalf("second Open() error = %v, want ErrFileLocked", err)
+	}
+
+	if err := s.CreateUser(context.Background(), &models.User{TelegramID: 1, Username: "alice"}); err != nil {
+		t.Fatalf("CreateUser() error = %v", err)
+	}
+	if err := s.Save(path); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	reopened, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open() after Close() error = %v", err)
+	}
+	defer reopened.Close()
+	if _, err := reopened.GetUserByTelegramID(context.Background(), 1); err != nil {
+		t.Errorf("GetUserByTelegramID() error = %v, want the saved user", err)
+	}
+}
+
+func TestPingChecksDataFileDirectory(t *testing.T) {
+	ctx := context.Background()
+	if err := New().Ping(ctx); err != nil {
+		t.Errorf("Ping() without data file error = %v", err)
+	}
+
+	dir := t.TempDir()
+	s, err := Open(filepath.Join(dir, "data.json"))
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer s.Close()
+	if err := s.Ping(ctx); err != nil {
+		t.Errorf("Ping() error = %v", err)
+	}
+
+	s.path = filepath.Join(dir, "missing", "data.json")
+	if err := s.Ping(ctx); err == nil {
+		t.Error("Ping() error = nil for a data file in a missing directory")
+	}
+}
@@ -2,8 +2,16 @@ package telegram
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"time"
 
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/config"
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/metrics"
 	"github.com/MichaelGenchev/telegram-grouppay-miniapp/pkg/logger"
 	"github.com/go-telegram/bot"
 	"github.com/go-telegram/bot/models"
@@ -11,29 +19,78 @@ import (
 
 // Client wraps the telegram bot client with our configuration
 type Client struct {
-	bot    *bot.Bot
-	token  string
-	logger logger.Logger
+	bot   *bot.Bot
+	token config.Secret
+	// webhookSecret is registered with the webhook so Telegram sends it along
+	webhookSecret config.Secret
+	api           *apiClient
+	metrics       *metrics.Metrics
+	// commands are the bot commands and callback prefixes handlers are
+	// registered for, used as metric labels
+	commands map[string]bool
+	// markUpdate records handled updates to drop redeliveries, if set
+	markUpdate MarkFunc
+	// throttle limits inbound commands if set
+	throttle *throttle
+	// webhookServing is set while updates are received through the webhook
+	webhookServing atomic.Bool
+	// handlerCtx is cancelled by AbortHandlers to cut off running handlers
+	handlerCtx    context.Context
+	abortHandlers context.CancelFunc
+	logger        logger.Logger
 }
 
-// New creates a new telegram client
-func New(token string, log logger.Logger) (*Client, error) {
-	if token == "" {
+// webhookShutdownTimeout bounds how long in-flight webhook requests may take
+// to finish on shutdown. They only queue the update, so this is short.
+const webhookShutdownTimeout = 10 * time.Second
+
+// handlerWorkers is how many updates are handled at the same time
+const handlerWorkers = 16
+
+// New creates a new telegram client. The webhook secret token, if any, is
+// required on every update delivered to the webhook. Updates and Bot API
+// requests are recorded in the metrics, which may be nil.
+func New(token, webhookSecret config.Secret, m *metrics.Metrics, log logger.Logger) (*Client, error) {
+	if token.IsZero() {
 		return nil, fmt.Errorf("bot token is required")
 	}
 
 	client := &Client{
-		token:  token,
-		logger: log.With(logger.String("component", "telegram")),
+		token:    token,
+		api:      newAPIClient(DefaultLimits(), m),
+		metrics:  m,
+		commands: make(map[string]bool),
+		logger:   log.With(logger.String("component", "telegram")),
 	}
+	client.handlerCtx, client.abortHandlers = context.WithCancel(context.Background())
 
-	b, err := bot.New(token, bot.WithDefaultHandler(func(ctx context.Context, b *bot.Bot, update *models.Update) {
-		// Default handler for unhandled updates
-		client.logger.Debug("Unhandled update received",
-			logger.Any("update", update),
-			logger.Int64("chat_id", update.Message.Chat.ID),
-		)
-	}))
+	opts := []bot.Option{
+		// Every update is handled in its own trace with its IDs in the
+		// context for logging. Redeliveries are dropped before they count
+		// against the throttle.
+		bot.WithMiddlewares(client.detach, client.traceUpdate, correlate, client.observe, client.dedupe, client.throttleUpdates),
+		// Handlers run on the workers rather than in goroutines of their
+		// own, so stopping the bot waits for the handlers in flight
+		bot.WithNotAsyncHandlers(),
+		bot.WithWorkers(handlerWorkers),
+		bot.WithHTTPClient(pollTimeout, client.api),
+		bot.WithDefaultHandler(func(ctx context.Context, b *bot.Bot, update *models.Update) {
+			// Default handler for unhandled updates; the logger redacts
+			// phone numbers and payment payloads in them
+			client.logger.DebugContext(ctx, "Unhandled update received", logger.Any("update", update))
+		}),
+		// Errors of the library go through the logger too, so tokens in
+		// request URLs are redacted
+		bot.WithErrorsHandler(func(err error) {
+			client.logger.Error("Telegram bot error", logger.Error(err))
+		}),
+	}
+	if !webhookSecret.IsZero() {
+		opts = append(opts, bot.WithWebhookSecretToken(webhookSecret.Value()))
+	}
+	client.webhookSecret = webhookSecret
+
+	b, err := bot.New(token.Value(), opts...)
 	if err != nil {
 		return nil, fmt.Errorf("create bot client: %w", err)
 	}
@@ -44,18 +101,99 @@ func New(token string, log logger.Logger) (*Client, error) {
 	return client, nil
 }
 
-// Start starts the bot with the given context
+// RunOutbox sends queued Bot API requests as the rate limits allow until
+// ctx is cancelled. Messages to chats are only sent while it runs, so it
+// should be stopped after the bot and background jobs.
+func (c *Client) RunOutbox(ctx context.Context) {
+	c.api.outbox.run(ctx)
+}
+
+// Start polls for updates until ctx is cancelled. It returns once the
+// handlers in flight have finished.
 func (c *Client) Start(ctx context.Context) {
 	c.logger.Info("Starting Telegram bot")
 	c.bot.Start(ctx)
 	c.logger.Info("Telegram bot stopped")
 }
 
+// StartWebhook registers the webhook URL with Telegram and serves it on the
+// listen address, handling updates until the context is cancelled. It
+// returns once the handlers in flight have finished.
+func (c *Client) StartWebhook(ctx context.Context, webhookURL, listen string) error {
+	u, err := url.Parse(webhookURL)
+	if err != nil {
+		return fmt.Errorf("parse webhook URL: %w", err)
+	}
+	path := u.Path
+	if path == "" {
+		path = "/"
+	}
+
+	_, err = c.bot.SetWebhook(ctx, &bot.SetWebhookParams{URL: webhookURL, SecretToken: c.webhookSecret.Value()})
+	if err != nil {
+		return fmt.Errorf("set webhook: %w", err)
+	}
+	c.webhookServing.Store(true)
+	defer c.webhookServing.Store(false)
+
+	mux := http.NewServeMux()
+	mux.Handle("POST "+path, c.bot.WebhookHandler())
+	server := &http.Server{Addr: listen, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		c.bot.StartWebhook(ctx)
+	}()
+
+	errCh := make(chan error, 1)
+	go func() {
+		c.logger.Info("Serving Telegram webhook", logger.String("addr", listen), logger.String("path", path))
+		errCh <- server.ListenAndServe()
+	}()
+
+	select {
+	case err = <-errCh:
+	case <-ctx.Done():
+		shutdownCtx, stop := context.WithTimeout(context.Background(), webhookShutdownTimeout)
+		defer stop()
+		err = server.Shutdown(shutdownCtx)
+		if serveErr := <-errCh; !errors.Is(serveErr, http.ErrServerClosed) {
+			err = serveErr
+		}
+	}
+	cancel()
+	<-done
+
+	c.logger.Info("Telegram webhook stopped")
+	return err
+}
+
+// AbortHandlers cancels the contexts of the handlers still running, e.g.
+// when waiting for them on shutdown takes too long
+func (c *Client) AbortHandlers() {
+	c.abortHandlers()
+}
+
 // RegisterHandler registers a command handler with the bot
 func (c *Client) RegisterHandler(handlerType bot.HandlerType, pattern string, matchType bot.MatchType, handler bot.HandlerFunc) {
+	if matchType == bot.MatchTypeCommandStartOnly || handlerType == bot.HandlerTypeCallbackQueryData {
+		c.commands[strings.TrimSuffix(pattern, ":")] = true
+	}
 	c.bot.RegisterHandler(handlerType, pattern, matchType, handler)
 }
 
+// Ready reports whether updates are being received: either the webhook is
+// served or the polling loop is running and its last request succeeded
+func (c *Client) Ready(ctx context.Context) error {
+	if c.webhookServing.Load() {
+		return nil
+	}
+	return c.api.pollHealth(time.Now())
+}
+
 // Bot returns the underlying bot instance for direct access when needed
 func (c *Client) Bot() *bot.Bot {
 	return c.bot
@@ -0,0 +1,201 @@
+package telegram
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/pkg/logger"
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// correlate stores the update, a fresh request ID and the sender and chat of
+// the update in the context, so every log entry written while handling it
+// can be correlated
+func correlate(next bot.HandlerFunc) bot.HandlerFunc {
+	return func(ctx context.Context, b *bot.Bot, update *models.Update) {
+		ctx = logger.WithRequestID(ctx, logger.NewRequestID())
+		ctx = logger.WithUpdateID(ctx, update.ID)
+		userID, chatID := updateOrigin(update)
+		if userID != 0 {
+			ctx = logger.WithUserID(ctx, userID)
+		}
+		if chatID != 0 {
+			ctx = logger.WithChatID(ctx, chatID)
+		}
+		next(ctx, b, update)
+	}
+}
+
+// detach lets handlers finish when the bot stops: their context is not
+// cancelled with the one updates are received with, only by AbortHandlers
+func (c *Client) detach(next bot.HandlerFunc) bot.HandlerFunc {
+	return func(ctx context.Context, b *bot.Bot, update *models.Update) {
+		ctx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+		defer cancel()
+		stop := context.AfterFunc(c.handlerCtx, cancel)
+		defer stop()
+		next(ctx, b, update)
+	}
+}
+
+// traceUpdate starts the root span of every update
+func (c *Client) traceUpdate(next bot.HandlerFunc) bot.HandlerFunc {
+	return func(ctx context.Context, b *bot.Bot, update *models.Update) {
+		ctx, span := tracer.Start(ctx, "telegram.update",
+			trace.WithNewRoot(),
+			trace.WithSpanKind(trace.SpanKindConsumer),
+			trace.WithAttributes(
+				attribute.Int64("telegram.update_id", update.ID),
+				attribute.String("telegram.update_type", updateType(update)),
+				attribute.String("telegram.command", c.command(update)),
+			),
+		)
+		defer span.End()
+		next(ctx, b, update)
+	}
+}
+
+// observe records every update and how long handling it took in the metrics
+func (c *Client) observe(next bot.HandlerFunc) bot.HandlerFunc {
+	return func(ctx context.Context, b *bot.Bot, update *models.Update) {
+		start := time.Now()
+		next(ctx, b, update)
+		c.metrics.ObserveUpdate(updateType(update), c.command(update), time.Since(start))
+	}
+}
+
+// MarkFunc records an update as handled and reports whether it was new
+type MarkFunc func(ctx context.Context, updateID int64) (bool, error)
+
+// Deduplicate drops updates mark reports as handled already, such as those
+// Telegram redelivers after a webhook request timed out. Updates are handled
+// anyway if marking them fails. It must be called before the bot starts.
+func (c *Client) Deduplicate(mark MarkFunc) {
+	c.markUpdate = mark
+}
+
+// dedupe drops updates that were handled already
+func (c *Client) dedupe(next bot.HandlerFunc) bot.HandlerFunc {
+	return func(ctx context.Context, b *bot.Bot, update *models.Update) {
+		if c.markUpdate != nil {
+			fresh, err := c.markUpdate(ctx, update.ID)
+			if err != nil {
+				c.logger.ErrorContext(ctx, "Failed to mark update as handled", logger.Error(err))
+			} else if !fresh {
+				c.metrics.ObserveDropped("redelivered")
+				c.logger.InfoContext(ctx, "Redelivered update dropped")
+				return
+			}
+		}
+		next(ctx, b, update)
+	}
+}
+
+// command returns the bot command of a message or the callback prefix of a
+// callback query. Only commands with registered handlers are returned so
+// arbitrary user input does not become a metric label.
+func (c *Client) command(update *models.Update) string {
+	var name string
+	switch {
+	case update.Message != nil:
+		text := update.Message.Text
+		if text == "" {
+			text = update.Message.Caption
+		}
+		if !strings.HasPrefix(text, "/") {
+			return ""
+		}
+		name, _, _ = strings.Cut(strings.Fields(text)[0][1:], "@")
+	case update.CallbackQuery != nil:
+		name, _, _ = strings.Cut(update.CallbackQuery.Data, ":")
+	}
+	if !c.commands[name] {
+		return ""
+	}
+	return name
+}
+
+// updateType returns the kind of an update as named by the Bot API
+func updateType(update *models.Update) string {
+	switch {
+	case update.Message != nil:
+		return "message"
+	case update.EditedMessage != nil:
+		return "edited_message"
+	case update.ChannelPost != nil:
+		return "channel_post"
+	case update.EditedChannelPost != nil:
+		return "edited_channel_post"
+	case update.CallbackQuery != nil:
+		return "callback_query"
+	case update.InlineQuery != nil:
+		return "inline_query"
+	case update.ChosenInlineResult != nil:
+		return "chosen_inline_result"
+	case update.ShippingQuery != nil:
+		return "shipping_query"
+	case update.PreCheckoutQuery != nil:
+		return "pre_checkout_query"
+	case update.PollAnswer != nil:
+		return "poll_answer"
+	case update.MyChatMember != nil:
+		return "my_chat_member"
+	case update.ChatMember != nil:
+		return "chat_member"
+	case update.ChatJoinRequest != nil:
+		return "chat_join_request"
+	}
+	return "other"
+}
+
+// updateOrigin returns the Telegram IDs of the user and chat an update comes
+// from, or zero where the update carries none
+func updateOrigin(update *models.Update) (userID, chatID int64) {
+	switch {
+	case update.Message != nil:
+		return messageOrigin(update.Message)
+	case update.EditedMessage != nil:
+		return messageOrigin(update.EditedMessage)
+	case update.ChannelPost != nil:
+		return messageOrigin(update.ChannelPost)
+	case update.EditedChannelPost != nil:
+		return messageOrigin(update.EditedChannelPost)
+	case update.CallbackQuery != nil:
+		query := update.CallbackQuery
+		switch {
+		case query.Message.Message != nil:
+			chatID = query.Message.Message.Chat.ID
+		case query.Message.InaccessibleMessage != nil:
+			chatID = query.Message.InaccessibleMessage.Chat.ID
+		}
+		return query.From.ID, chatID
+	case update.InlineQuery != nil && update.InlineQuery.From != nil:
+		return update.InlineQuery.From.ID, 0
+	case update.ChosenInlineResult != nil:
+		return update.ChosenInlineResult.From.ID, 0
+	case update.ShippingQuery != nil && update.ShippingQuery.From != nil:
+		return update.ShippingQuery.From.ID, 0
+	case update.PreCheckoutQuery != nil && update.PreCheckoutQuery.From != nil:
+		return update.PreCheckoutQuery.From.ID, 0
+	case update.PollAnswer != nil && update.PollAnswer.User != nil:
+		return update.PollAnswer.User.ID, 0
+	case update.MyChatMember != nil:
+		return update.MyChatMember.From.ID, update.MyChatMember.Chat.ID
+	case update.ChatMember != nil:
+		return update.ChatMember.From.ID, update.ChatMember.Chat.ID
+	case update.ChatJoinRequest != nil:
+		return update.ChatJoinRequest.From.ID, update.ChatJoinRequest.Chat.ID
+	}
+	return 0, 0
+}
+
+func messageOrigin(msg *models.Message) (userID, chatID int64) {
+	if msg.From != nil {
+		userID = msg.From.ID
+	}
+	return userID, msg.Chat.ID
+}
@@ -0,0 +1,269 @@
+package telegram
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/metrics"
+)
+
+// Priority orders outbound requests waiting for the rate limits
+type Priority int
+
+const (
+	// PriorityInteractive is for replies to users and the default
+	PriorityInteractive Priority = iota
+	// PriorityBackground is for broadcasts such as reminders. They are only
+	// sent while no interactive request can be.
+	PriorityBackground
+	numPriorities
+)
+
+// String returns the name of the priority as used in metrics
+func (p Priority) String() string {
+	if p == PriorityBackground {
+		return "background"
+	}
+	return "interactive"
+}
+
+type priorityKey struct{}
+
+// WithPriority returns a context whose Bot API requests are sent with the
+// given priority
+func WithPriority(ctx context.Context, p Priority) context.Context {
+	return context.WithValue(ctx, priorityKey{}, p)
+}
+
+func priorityFrom(ctx context.Context) Priority {
+	if p, ok := ctx.Value(priorityKey{}).(Priority); ok && p >= 0 && p < numPriorities {
+		return p
+	}
+	return PriorityInteractive
+}
+
+// Rate allows Burst messages at once and Burst more every Per
+type Rate struct {
+	Burst int
+	Per   time.Duration
+}
+
+// Limits are the rates messages are sent at
+type Limits struct {
+	Global  Rate // all chats together
+	Private Rate // each private chat
+	Group   Rate // each group or channel
+}
+
+// DefaultLimits stays within the limits of Telegram: about 30 messages a
+// second in total, one a second per private chat and 20 a minute per group
+func DefaultLimits() Limits {
+	return Limits{
+		Global:  Rate{Burst: 30, Per: time.Second},
+		Private: Rate{Burst: 1, Per: time.Second},
+		Group:   Rate{Burst: 20, Per: time.Minute},
+	}
+}
+
+// bucket is a token bucket refilled at its rate
+type bucket struct {
+	rate   Rate
+	tokens float64
+	last   time.Time
+	// blockedUntil is set when Telegram asks to retry after some time
+	blockedUntil time.Time
+}
+
+func newBucket(rate Rate, now time.Time) *bucket {
+	return &bucket{rate: rate, tokens: float64(rate.Burst), last: now}
+}
+
+func (b *bucket) refill(now time.Time) {
+	if elapsed := now.Sub(b.last); elapsed > 0 {
+		b.tokens = min(float64(b.rate.Burst), b.tokens+elapsed.Seconds()*float64(b.rate.Burst)/b.rate.Per.Seconds())
+		b.last = now
+	}
+}
+
+// wait returns how long it takes until a token is available
+func (b *bucket) wait(now time.Time) time.Duration {
+	b.refill(now)
+	if now.Before(b.blockedUntil) {
+		return b.blockedUntil.Sub(now)
+	}
+	if b.tokens >= 1 {
+		return 0
+	}
+	return time.Duration((1 - b.tokens) * float64(b.rate.Per) / float64(b.rate.Burst))
+}
+
+// idle reports whether the bucket is full and can be dropped
+func (b *bucket) idle(now time.Time) bool {
+	b.refill(now)
+	return b.tokens >= float64(b.rate.Burst) && !now.Before(b.blockedUntil)
+}
+
+// ticket is a request waiting in the outbox
+type ticket struct {
+	chat  string
+	ready chan struct{}
+}
+
+// pruneEvery is how often buckets of idle chats are dropped
+const pruneEvery = time.Minute
+
+// errOutboxStopped is returned for requests waiting when the outbox stops
+var errOutboxStopped = errors.New("outbound queue stopped")
+
+// outbox holds outbound requests until the global and per chat rate limits
+// allow them to be sent. Requests of higher priority go first; requests of
+// the same priority to a chat go in order.
+type outbox struct {
+	limits  Limits
+	metrics *metrics.Metrics
+
+	mu        sync.Mutex
+	queues    [numPriorities][]*ticket
+	global    *bucket
+	chats     map[string]*bucket
+	lastPrune time.Time
+	wake      chan struct{}
+	// stopped is closed when run returns
+	stopped chan struct{}
+}
+
+func newOutbox(limits Limits, m *metrics.Metrics) *outbox {
+	now := time.Now()
+	o := &outbox{
+		limits:    limits,
+		metrics:   m,
+		global:    newBucket(limits.Global, now),
+		chats:     make(map[string]*bucket),
+		lastPrune: now,
+		wake:      make(chan struct{}, 1),
+		stopped:   make(chan struct{}),
+	}
+	return o
+}
+
+// wait blocks until a request to the chat may be sent, ctx is done or the
+// outbox stops
+func (o *outbox) wait(ctx context.Context, chat string, p Priority) error {
+	t := &ticket{chat: chat, ready: make(chan struct{})}
+	o.mu.Lock()
+	o.queues[p] = append(o.queues[p], t)
+	o.metrics.SetOutboxDepth(p.String(), len(o.queues[p]))
+	o.mu.Unlock()
+	o.notify()
+
+	var err error
+	select {
+	case <-t.ready:
+		return nil
+	case <-ctx.Done():
+		err = ctx.Err()
+	case <-o.stopped:
+		err = errOutboxStopped
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	for i, queued := range o.queues[p] {
+		if queued == t {
+			o.queues[p] = append(o.queues[p][:i], o.queues[p][i+1:]...)
+			o.metrics.SetOutboxDepth(p.String(), len(o.queues[p]))
+			break
+		}
+	}
+	return err
+}
+
+// block holds back all requests to the chat for the given time, as asked by
+// Telegram with retry_after
+func (o *outbox) block(chat string, d time.Duration) {
+	o.mu.Lock()
+	now := time.Now()
+	if b := o.bucket(chat, now); b.blockedUntil.Before(now.Add(d)) {
+		b.blockedUntil = now.Add(d)
+	}
+	o.mu.Unlock()
+	o.notify()
+}
+
+func (o *outbox) notify() {
+	select {
+	case o.wake <- struct{}{}:
+	default:
+	}
+}
+
+// run releases waiting requests as tokens become available until ctx is
+// cancelled. Requests still waiting then fail.
+func (o *outbox) run(ctx context.Context) {
+	defer close(o.stopped)
+	timer := time.NewTimer(pruneEvery)
+	defer timer.Stop()
+	for {
+		timer.Reset(o.dispatch(time.Now()))
+		select {
+		case <-ctx.Done():
+			return
+		case <-o.wake:
+		case <-timer.C:
+		}
+	}
+}
+
+// dispatch releases every request that may be sent now and returns how long
+// until the next one may be
+func (o *outbox) dispatch(now time.Time) time.Duration {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	next := pruneEvery
+	for p := range o.queues {
+		kept := o.queues[p][:0]
+		for _, t := range o.queues[p] {
+			chat := o.bucket(t.chat, now)
+			wait := max(o.global.wait(now), chat.wait(now))
+			if wait > 0 {
+				next = min(next, wait)
+				kept = append(kept, t)
+				continue
+			}
+			o.global.tokens--
+			chat.tokens--
+			close(t.ready)
+		}
+		clear(o.queues[p][len(kept):])
+		o.queues[p] = kept
+		o.metrics.SetOutboxDepth(Priority(p).String(), len(kept))
+	}
+
+	if now.Sub(o.lastPrune) >= pruneEvery {
+		for chat, b := range o.chats {
+			if b.idle(now) {
+				delete(o.chats, chat)
+			}
+		}
+		o.lastPrune = now
+	}
+	return next
+}
+
+// bucket returns the token bucket of a chat. Chat IDs of groups and
+// channels are negative or, for public channels, @usernames.
+func (o *outbox) bucket(chat string, now time.Time) *bucket {
+	b, ok := o.chats[chat]
+	if !ok {
+		rate := o.limits.Private
+		if chat[0] == '-' || chat[0] == '@' {
+			rate = o.limits.Group
+		}
+		b = newBucket(rate, now)
+		o.chats[chat] = b
+	}
+	return b
+}
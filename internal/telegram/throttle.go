@@ -0,0 +1,200 @@
+package telegram
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/pkg/logger"
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+)
+
+// ThrottleLimits are the budgets of commands and button presses users and
+// chats may send
+type ThrottleLimits struct {
+	User Rate // per user across all chats, a zero Burst disables it
+	Chat Rate // per chat, a zero Burst disables it
+	// DuplicateWindow is how long identical commands of a user in a chat are
+	// collapsed into the first one
+	DuplicateWindow time.Duration
+}
+
+// ThrottledFunc tells the sender of a throttled update how long to wait
+// before trying again
+type ThrottledFunc func(ctx context.Context, b *bot.Bot, update *models.Update, wait time.Duration)
+
+// verdict is what happens to an update
+type verdict int
+
+const (
+	admitted verdict = iota
+	// duplicated updates repeat one that is handled already
+	duplicated
+	// throttled updates exceed a budget and their sender is told so
+	throttled
+	// muted updates exceed a budget whose cooldown the sender was told about
+	muted
+)
+
+// throttle keeps the budgets of users and chats
+type throttle struct {
+	limits ThrottleLimits
+	notify ThrottledFunc
+
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	// notified holds when the cooldowns senders were told about end
+	notified map[string]time.Time
+	// seen holds when commands were last admitted, to collapse duplicates
+	seen      map[string]time.Time
+	lastPrune time.Time
+}
+
+// Throttle limits how often users and chats may send commands and press
+// buttons. The first update over a budget is passed to notify; further ones
+// are dropped until the cooldown ends. It must be called before the bot starts.
+func (c *Client) Throttle(limits ThrottleLimits, notify ThrottledFunc) {
+	c.throttle = &throttle{
+		limits:    limits,
+		notify:    notify,
+		buckets:   make(map[string]*bucket),
+		notified:  make(map[string]time.Time),
+		seen:      make(map[string]time.Time),
+		lastPrune: time.Now(),
+	}
+}
+
+// throttleUpdates drops duplicate updates and those over the budgets
+func (c *Client) throttleUpdates(next bot.HandlerFunc) bot.HandlerFunc {
+	return func(ctx context.Context, b *bot.Bot, update *models.Update) {
+		if c.throttle == nil {
+			next(ctx, b, update)
+			return
+		}
+
+		v, wait := c.throttle.check(update, time.Now())
+		switch v {
+		case admitted:
+			next(ctx, b, update)
+			return
+		case throttled:
+			c.metrics.ObserveDropped("throttled")
+			c.logger.InfoContext(ctx, "Update throttled", logger.Duration("wait", wait))
+			c.throttle.notify(ctx, b, update, wait)
+			return
+		case muted:
+			c.metrics.ObserveDropped("throttled")
+		case duplicated:
+			c.metrics.ObserveDropped("duplicate")
+			c.logger.DebugContext(ctx, "Duplicate update collapsed")
+		}
+
+		// Stop the spinner of dropped button presses
+		if update.CallbackQuery != nil {
+			_, err := b.AnswerCallbackQuery(ctx, &bot.AnswerCallbackQueryParams{CallbackQueryID: update.CallbackQuery.ID})
+			if err != nil {
+				c.logger.ErrorContext(ctx, "Failed to answer callback query", logger.Error(err))
+			}
+		}
+	}
+}
+
+// check decides what happens to an update and, for throttled ones, how long
+// the sender has to wait. Budgets are only spent by admitted updates.
+func (t *throttle) check(update *models.Update, now time.Time) (verdict, time.Duration) {
+	request := throttledRequest(update)
+	userID, chatID := updateOrigin(update)
+	if request == "" || userID == 0 {
+		return admitted, 0
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.prune(now)
+
+	duplicateKey := strconv.FormatInt(chatID, 10) + ":" + strconv.FormatInt(userID, 10) + ":" + request
+	if seen, ok := t.seen[duplicateKey]; ok && now.Sub(seen) < t.limits.DuplicateWindow {
+		return duplicated, 0
+	}
+
+	var wait time.Duration
+	var waitKey string
+	var spend []*bucket
+	for _, budget := range []struct {
+		key  string
+		rate Rate
+	}{
+		{"user:" + strconv.FormatInt(userID, 10), t.limits.User},
+		{"chat:" + strconv.FormatInt(chatID, 10), t.limits.Chat},
+	} {
+		if budget.rate.Burst <= 0 || budget.rate.Per <= 0 {
+			continue
+		}
+		b, ok := t.buckets[budget.key]
+		if !ok {
+			b = newBucket(budget.rate, now)
+			t.buckets[budget.key] = b
+		}
+		if w := b.wait(now); w > wait {
+			wait, waitKey = w, budget.key
+		}
+		spend = append(spend, b)
+	}
+
+	if wait > 0 {
+		if now.Before(t.notified[waitKey]) {
+			return muted, wait
+		}
+		t.notified[waitKey] = now.Add(wait)
+		return throttled, wait
+	}
+	for _, b := range spend {
+		b.tokens--
+	}
+	t.seen[duplicateKey] = now
+	return admitted, 0
+}
+
+// prune drops state that no longer affects any decision
+func (t *throttle) prune(now time.Time) {
+	if now.Sub(t.lastPrune) < pruneEvery {
+		return
+	}
+	for key, b := range t.buckets {
+		if b.idle(now) {
+			delete(t.buckets, key)
+		}
+	}
+	for key, until := range t.notified {
+		if now.After(until) {
+			delete(t.notified, key)
+		}
+	}
+	for key, seen := range t.seen {
+		if now.Sub(seen) >= t.limits.DuplicateWindow {
+			delete(t.seen, key)
+		}
+	}
+	t.lastPrune = now
+}
+
+// throttledRequest returns the command or button press of an update that
+// counts against the budgets, or "" if it has none
+func throttledRequest(update *models.Update) string {
+	switch {
+	case update.Message != nil:
+		text := update.Message.Text
+		if text == "" {
+			text = update.Message.Caption
+		}
+		if text = strings.TrimSpace(text); strings.HasPrefix(text, "/") {
+			return text
+		}
+	case update.CallbackQuery != nil:
+		return "callback:" + update.CallbackQuery.Data
+	}
+	return ""
+}
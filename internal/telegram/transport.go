@@ -0,0 +1,287 @@
+package telegram
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/metrics"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracer starts a span for every Bot API request
+var tracer = otel.Tracer("github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/telegram")
+
+// pollTimeout is how long a getUpdates long poll may take
+const pollTimeout = time.Minute
+
+// Retries of failed Bot API requests
+const (
+	maxAttempts = 4
+	// maxRetryAfter is the longest retry_after that is waited for; a reply
+	// any later is pointless
+	maxRetryAfter = time.Minute
+	retryBackoff  = 500 * time.Millisecond
+	// maxRetriedBody is the largest request body kept to be resent. Larger
+	// ones are file uploads, which are streamed and not retried.
+	maxRetriedBody = 64 << 10
+)
+
+// apiClient makes the requests of the bot to the Bot API. Messages are queued
+// to stay within the rate limits of Telegram, and requests that were rate
+// limited or hit a server error are retried, except for file uploads. Requests are recorded in the
+// metrics, and the polling loop is tracked for readiness checks.
+type apiClient struct {
+	http    *http.Client
+	outbox  *outbox
+	metrics *metrics.Metrics
+
+	mu sync.Mutex
+	// pollStarted is when the last getUpdates request was made, pollErr how
+	// it failed, if it did
+	pollStarted time.Time
+	pollErr     error
+}
+
+func newAPIClient(limits Limits, m *metrics.Metrics) *apiClient {
+	return &apiClient{
+		http:    &http.Client{Timeout: pollTimeout},
+		outbox:  newOutbox(limits, m),
+		metrics: m,
+	}
+}
+
+// Do implements bot.HttpClient
+func (c *apiClient) Do(req *http.Request) (*http.Response, error) {
+	// The path is /bot<token>/<method>; only the method is recorded
+	method := path.Base(req.URL.Path)
+	ctx, span := tracer.Start(req.Context(), "telegram.api "+method,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attribute.String("telegram.method", method)),
+	)
+	defer span.End()
+
+	// Long polls are retried by the library itself
+	if method == "getUpdates" {
+		return c.send(req.WithContext(ctx), method, span)
+	}
+
+	// The body is streamed by the library; keep it to be able to resend it
+	// unless it is too large. The chat is one of the first form fields, so
+	// it is read before any file.
+	var body []byte
+	if req.Body != nil {
+		var err error
+		body, err = io.ReadAll(io.LimitReader(req.Body, maxRetriedBody+1))
+		if err != nil {
+			req.Body.Close()
+			return nil, fmt.Errorf("read request body: %w", err)
+		}
+	}
+	var chat string
+	if rateLimited(method) {
+		chat = formValue(req.Header.Get("Content-Type"), body, "chat_id")
+	}
+
+	if len(body) > maxRetriedBody {
+		return c.upload(ctx, req, body, method, chat, span)
+	}
+	if req.Body != nil {
+		req.Body.Close()
+	}
+
+	for attempt := 1; ; attempt++ {
+		if chat != "" {
+			if err := c.outbox.wait(ctx, chat, priorityFrom(ctx)); err != nil {
+				return nil, err
+			}
+		}
+
+		retry := req.Clone(ctx)
+		retry.Body = io.NopCloser(bytes.NewReader(body))
+		retry.ContentLength = int64(len(body))
+		resp, err := c.send(retry, method, span)
+		if err != nil || attempt == maxAttempts {
+			return resp, err
+		}
+		delay, ok := retryDelay(resp, attempt)
+		if !ok {
+			if attempt > 1 && resp.StatusCode == http.StatusOK {
+				span.SetStatus(codes.Ok, "")
+			}
+			return resp, nil
+		}
+
+		resp.Body.Close()
+		c.metrics.ObserveAPIRetry(method)
+		span.AddEvent("retry", trace.WithAttributes(
+			attribute.Int("http.response.status_code", resp.StatusCode),
+			attribute.String("retry_after", delay.String()),
+		))
+		if chat != "" && resp.StatusCode == http.StatusTooManyRequests {
+			// Hold back every message to the chat, not just this one
+			c.outbox.block(chat, delay)
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(delay):
+		}
+	}
+}
+
+// upload sends a request with a large body, such as a file, while the
+// library still writes it, so it is never held in memory. The body cannot be
+// read again, so the request is not retried.
+func (c *apiClient) upload(ctx context.Context, req *http.Request, head []byte, method, chat string, span trace.Span) (*http.Response, error) {
+	if chat != "" {
+		if err := c.outbox.wait(ctx, chat, priorityFrom(ctx)); err != nil {
+			req.Body.Close()
+			return nil, err
+		}
+	}
+	upload := req.Clone(ctx)
+	upload.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(head), req.Body), req.Body}
+	resp, err := c.send(upload, method, span)
+	if err == nil && chat != "" && resp.StatusCode == http.StatusTooManyRequests {
+		// Hold back the messages that follow
+		delay, _ := retryDelay(resp, 1)
+		c.outbox.block(chat, delay)
+	}
+	return resp, err
+}
+
+// send makes a single request
+func (c *apiClient) send(req *http.Request, method string, span trace.Span) (*http.Response, error) {
+	polling := method == "getUpdates"
+	if polling {
+		c.mu.Lock()
+		c.pollStarted = time.Now()
+		c.mu.Unlock()
+	}
+
+	resp, err := c.http.Do(req)
+	if resp != nil {
+		span.SetAttributes(attribute.Int("http.response.status_code", resp.StatusCode))
+	}
+	if req.Context().Err() != nil {
+		// Cancelled on shutdown, not a failure of the API
+		return resp, err
+	}
+
+	var failure error
+	code := 0
+	switch {
+	case err != nil:
+		// The error names the URL, which holds the bot token
+		failure = errors.New("request failed")
+	case resp.StatusCode != http.StatusOK:
+		code = resp.StatusCode
+		failure = fmt.Errorf("status %d", code)
+	}
+	c.metrics.ObserveAPIRequest(method, failure != nil, code)
+	if failure != nil {
+		span.SetStatus(codes.Error, failure.Error())
+	}
+
+	if polling {
+		c.mu.Lock()
+		c.pollErr = failure
+		c.mu.Unlock()
+	}
+	return resp, err
+}
+
+// retryDelay returns how long to wait before retrying a failed request, and
+// whether to retry it at all. Rate limited requests are retried after the
+// time Telegram asks for and server errors with exponential backoff. The
+// response body is left readable.
+func retryDelay(resp *http.Response, attempt int) (time.Duration, bool) {
+	switch {
+	case resp.StatusCode == http.StatusTooManyRequests:
+		data, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		resp.Body = io.NopCloser(bytes.NewReader(data))
+
+		var result struct {
+			Parameters struct {
+				RetryAfter int `json:"retry_after"`
+			} `json:"parameters"`
+		}
+		delay := time.Second
+		if json.Unmarshal(data, &result) == nil && result.Parameters.RetryAfter > 0 {
+			delay = time.Duration(result.Parameters.RetryAfter) * time.Second
+		}
+		return delay, delay <= maxRetryAfter
+	case resp.StatusCode >= http.StatusInternalServerError:
+		return retryBackoff << (attempt - 1), true
+	}
+	return 0, false
+}
+
+// rateLimited reports whether a Bot API method posts to a chat and counts
+// against the message rate limits
+func rateLimited(method string) bool {
+	for _, prefix := range []string{"send", "forward", "copy", "edit"} {
+		if strings.HasPrefix(method, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// formValue returns a field of a multipart form body, or "" if it has none
+func formValue(contentType string, body []byte, name string) string {
+	_, params, err := mime.ParseMediaType(contentType)
+	if err != nil || params["boundary"] == "" {
+		return ""
+	}
+	form := multipart.NewReader(bytes.NewReader(body), params["boundary"])
+	for {
+		part, err := form.NextPart()
+		if err != nil {
+			return ""
+		}
+		if part.FormName() == name {
+			value, err := io.ReadAll(io.LimitReader(part, 256))
+			if err != nil {
+				return ""
+			}
+			return string(value)
+		}
+	}
+}
+
+// pollHealth reports whether the polling loop is running and its last
+// request succeeded
+func (c *apiClient) pollHealth(now time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	switch {
+	case c.pollStarted.IsZero():
+		return errors.New("polling has not started")
+	case c.pollErr != nil:
+		return fmt.Errorf("last poll failed: %w", c.pollErr)
+	case now.Sub(c.pollStarted) > 2*pollTimeout:
+		return fmt.Errorf("no poll since %s", c.pollStarted.Format(time.RFC3339))
+	}
+	return nil
+}
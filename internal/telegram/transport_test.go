@@ -0,0 +1,126 @@
+package telegram
+
+import (
+	"context"
+	"errors"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// uploadRequest returns a sendDocument request whose body is written while
+// it is read, like the library does, with a document of size bytes. before
+// is called once half of the document was written.
+func uploadRequest(t *testing.T, url string, size int, before func() error) *http.Request {
+	t.Helper()
+	pr, pw := io.Pipe()
+	form := multipart.NewWriter(pw)
+	go func() {
+		if err := form.WriteField("chat_id", "-100"); err != nil {
+			pw.CloseWithError(err)
+			return
+		}
+		doc, err := form.CreateFormFile("document", "export.csv")
+		if err != nil {
+			pw.CloseWithError(err)
+			return
+		}
+		chunk := strings.Repeat("x", size/2)
+		if _, err := io.WriteString(doc, chunk); err != nil {
+			pw.CloseWithError(err)
+			return
+		}
+		if before != nil {
+			if err := before(); err != nil {
+				pw.CloseWithError(err)
+				return
+			}
+		}
+		if _, err := io.WriteString(doc, chunk); err != nil {
+			pw.CloseWithError(err)
+			return
+		}
+		pw.CloseWithError(form.Close())
+	}()
+
+	req, err := http.NewRequest(http.MethodPost, url+"/bot1:token/sendDocument", pr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	return req
+}
+
+func newTestAPIClient(t *testing.T) *apiClient {
+	t.Helper()
+	c := newAPIClient(DefaultLimits(), nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	go c.outbox.run(ctx)
+	t.Cleanup(cancel)
+	return c
+}
+
+func TestUploadIsStreamed(t *testing.T) {
+	const size = 4 * maxRetriedBody
+	// The second half of the document is only written once the server got
+	// more of it than the client keeps to resend, which it cannot if the
+	// client reads the whole body first
+	received := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, err := io.CopyN(io.Discard, r.Body, 2*maxRetriedBody); err == nil {
+			close(received)
+		}
+		if _, err := io.Copy(io.Discard, r.Body); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		io.WriteString(w, `{"ok":true,"result":{}}`)
+	}))
+	defer server.Close()
+
+	c := newTestAPIClient(t)
+	req := uploadRequest(t, server.URL, size, func() error {
+		select {
+		case <-received:
+			return nil
+		case <-time.After(5 * time.Second):
+			return errors.New("the upload was held back until it was complete")
+		}
+	})
+	resp, err := c.Do(req)
+	if err != nil {
+		t.Fatalf("Do() error = %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Do() status = %d", resp.StatusCode)
+	}
+}
+
+func TestUploadIsNotRetried(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		io.Copy(io.Discard, r.Body)
+		http.Error(w, `{"ok":false}`, http.StatusBadGateway)
+	}))
+	defer server.Close()
+
+	c := newTestAPIClient(t)
+	resp, err := c.Do(uploadRequest(t, server.URL, 2*maxRetriedBody, nil))
+	if err != nil {
+		t.Fatalf("Do() error = %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadGateway {
+		t.Errorf("Do() status = %d, want the server error", resp.StatusCode)
+	}
+	if n := requests.Load(); n != 1 {
+		t.Errorf("requests = %d, want 1", n)
+	}
+}
@@ -0,0 +1,74 @@
+// Package tracing sets up OpenTelemetry tracing. Spans are started for every
+// update, handler, service call, storage operation and Bot API request and
+// exported as JSON to stdout or a file, so traces can be inspected offline.
+package tracing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/config"
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/storage"
+	"github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/storage/instrument"
+)
+
+// Setup installs the global tracer provider of the service. The returned
+// function flushes pending spans and must be called on shutdown. Without an
+// exporter no spans are recorded.
+func Setup(cfg config.TracingConfig, serviceName string) (func(context.Context) error, error) {
+	var out io.Writer
+	closeOut := func() error { return nil }
+	switch cfg.Exporter {
+	case config.TracingNone, "":
+		return func(context.Context) error { return nil }, nil
+	case config.TracingStdout:
+		out = os.Stdout
+	case config.TracingFile:
+		f, err := os.OpenFile(cfg.File, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			return nil, fmt.Errorf("open trace file: %w", err)
+		}
+		out, closeOut = f, f.Close
+	default:
+		return nil, fmt.Errorf("unknown trace exporter %q", cfg.Exporter)
+	}
+
+	exporter, err := stdouttrace.New(stdouttrace.WithWriter(out))
+	if err != nil {
+		closeOut()
+		return nil, fmt.Errorf("create trace exporter: %w", err)
+	}
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.SampleRatio))),
+		sdktrace.WithResource(resource.NewSchemaless(attribute.String("service.name", serviceName))),
+	)
+	otel.SetTracerProvider(provider)
+
+	return func(ctx context.Context) error {
+		return errors.Join(provider.Shutdown(ctx), closeOut())
+	}, nil
+}
+
+// InstrumentStorage returns a storage starting a span for every operation of
+// s, including those run in transactions
+func InstrumentStorage(s storage.Storage) storage.Storage {
+	tracer := otel.Tracer("github.com/MichaelGenchev/telegram-grouppay-miniapp/internal/storage")
+	return instrument.New(s, func(ctx context.Context, operation string) (context.Context, func()) {
+		ctx, span := tracer.Start(ctx, "storage."+operation,
+			trace.WithSpanKind(trace.SpanKindClient),
+			trace.WithAttributes(attribute.String("db.operation.name", operation)),
+		)
+		return ctx, func() { span.End() }
+	})
+}
@@ -0,0 +1,103 @@
+package logger
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+// Context keys of the values the *Context logging methods add to every entry
+type (
+	userIDKey    struct{}
+	chatIDKey    struct{}
+	requestIDKey struct{}
+	updateIDKey  struct{}
+)
+
+// WithUserID returns a context carrying the Telegram ID of the user a
+// request or update comes from
+func WithUserID(ctx context.Context, userID int64) context.Context {
+	return context.WithValue(ctx, userIDKey{}, userID)
+}
+
+// WithChatID returns a context carrying the Telegram chat an update belongs to
+func WithChatID(ctx context.Context, chatID int64) context.Context {
+	return context.WithValue(ctx, chatIDKey{}, chatID)
+}
+
+// WithRequestID returns a context carrying the ID correlating all log
+// entries of one update or HTTP request
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, requestID)
+}
+
+// WithUpdateID returns a context carrying the ID of the Telegram update being handled
+func WithUpdateID(ctx context.Context, updateID int64) context.Context {
+	return context.WithValue(ctx, updateIDKey{}, updateID)
+}
+
+// UserIDFrom returns the user ID stored in the context, if any
+func UserIDFrom(ctx context.Context) (int64, bool) {
+	userID, ok := ctx.Value(userIDKey{}).(int64)
+	return userID, ok
+}
+
+// ChatIDFrom returns the chat ID stored in the context, if any
+func ChatIDFrom(ctx context.Context) (int64, bool) {
+	chatID, ok := ctx.Value(chatIDKey{}).(int64)
+	return chatID, ok
+}
+
+// RequestIDFrom returns the request ID stored in the context, if any
+func RequestIDFrom(ctx context.Context) (string, bool) {
+	requestID, ok := ctx.Value(requestIDKey{}).(string)
+	return requestID, ok && requestID != ""
+}
+
+// UpdateIDFrom returns the update ID stored in the context, if any
+func UpdateIDFrom(ctx context.Context) (int64, bool) {
+	updateID, ok := ctx.Value(updateIDKey{}).(int64)
+	return updateID, ok
+}
+
+// NewRequestID returns a random request ID
+func NewRequestID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "unknown"
+	}
+	return hex.EncodeToString(b)
+}
+
+// contextFields appends the correlation IDs stored in the context, and the
+// IDs of the current trace span, to the fields. Fields given explicitly take precedence over the context.
+func contextFields(ctx context.Context, fields []Field) []Field {
+	add := func(f Field) {
+		for _, existing := range fields {
+			if existing.Key == f.Key {
+				return
+			}
+		}
+		fields = append(fields, f)
+	}
+	if requestID, ok := RequestIDFrom(ctx); ok {
+		add(zap.String("request_id", requestID))
+	}
+	if updateID, ok := UpdateIDFrom(ctx); ok {
+		add(zap.Int64("update_id", updateID))
+	}
+	if userID, ok := UserIDFrom(ctx); ok {
+		add(zap.Int64("user_id", userID))
+	}
+	if chatID, ok := ChatIDFrom(ctx); ok {
+		add(zap.Int64("chat_id", chatID))
+	}
+	if span := trace.SpanContextFromContext(ctx); span.IsValid() {
+		add(zap.String("trace_id", span.TraceID().String()))
+		add(zap.String("span_id", span.SpanID().String()))
+	}
+	return fields
+}
@@ -0,0 +1,45 @@
+package logger
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// levelPayload is the body of requests and responses of LevelHandler
+type levelPayload struct {
+	Level string `json:"level"`
+}
+
+// LevelHandler serves the minimum level of a logger so it can be changed
+// without a restart. GET returns {"level":"info"}; PUT takes the same body
+// and changes the level of the logger and every logger derived from it.
+func LevelHandler(l Logger) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.Method {
+		case http.MethodGet:
+		case http.MethodPut:
+			var req levelPayload
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				writeLevelError(w, http.StatusBadRequest, "invalid request body")
+				return
+			}
+			previous := l.Level()
+			if err := l.SetLevel(req.Level); err != nil {
+				writeLevelError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+			l.Info("Log level changed", String("from", previous), String("to", l.Level()))
+		default:
+			w.Header().Set("Allow", "GET, PUT")
+			writeLevelError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		_ = json.NewEncoder(w).Encode(levelPayload{Level: l.Level()})
+	})
+}
+
+func writeLevelError(w http.ResponseWriter, status int, message string) {
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(map[string]string{"error": message})
+}
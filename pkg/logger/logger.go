@@ -3,6 +3,8 @@ package logger
 import (
 	"context"
 	"fmt"
+	"os"
+	"time"
 
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
@@ -25,6 +27,12 @@ type Logger interface {
 	// With creates a child logger with additional fields
 	With(fields ...Field) Logger
 
+	// Level returns the minimum level entries are logged at
+	Level() string
+	// SetLevel changes the minimum level at runtime, for this logger and
+	// every logger it was derived from or derives
+	SetLevel(level string) error
+
 	// Sync flushes any buffered log entries
 	Sync() error
 }
@@ -35,13 +43,35 @@ type Field = zap.Field
 // ZapLogger wraps zap.Logger to implement our Logger interface
 type ZapLogger struct {
 	logger *zap.Logger
+	// level is shared with every logger derived through With
+	level zap.AtomicLevel
 }
 
 // Config holds logger configuration
 type Config struct {
-	Level       string `json:"level"`       // debug, info, warn, error
-	Environment string `json:"environment"` // development, production
-	OutputPath  string `json:"output_path"` // stdout, stderr, or file path
+	Level       string         `json:"level" yaml:"level"`             // debug, info, warn, error
+	Environment string         `json:"environment" yaml:"environment"` // development, production
+	OutputPath  string         `json:"output_path" yaml:"output_path"` // stdout, stderr, or file path
+	Rotation    RotationConfig `json:"rotation" yaml:"rotation"`
+	Sampling    SamplingConfig `json:"sampling" yaml:"sampling"`
+}
+
+// SamplingConfig caps the volume of repeated entries, such as debug logs of
+// busy handlers. Per Tick, the first Initial entries with the same level and
+// message are logged and then every Thereafter-th. Zero Initial disables it.
+type SamplingConfig struct {
+	Initial    int           `json:"initial" yaml:"initial"`
+	Thereafter int           `json:"thereafter" yaml:"thereafter"` // 0 drops all but the first Initial
+	Tick       time.Duration `json:"tick" yaml:"tick"`             // 0 uses one second
+}
+
+// DefaultConfig returns the configuration NewDefault uses
+func DefaultConfig() Config {
+	return Config{
+		Level:       "info",
+		Environment: "development",
+		OutputPath:  "stdout",
+	}
 }
 
 // New creates a new logger instance
@@ -50,49 +80,53 @@ func New(cfg Config) (Logger, error) {
 	if err != nil {
 		return nil, fmt.Errorf("invalid log level: %w", err)
 	}
+	atomicLevel := zap.NewAtomicLevelAt(level)
 
-	var zapConfig zap.Config
-
+	var encoder zapcore.Encoder
+	var opts []zap.Option
 	switch cfg.Environment {
-	case "development":
-		zapConfig = zap.NewDevelopmentConfig()
-		zapConfig.EncoderConfig.EncodeLevel = zapcore.CapitalColorLevelEncoder
 	case "production":
-		zapConfig = zap.NewProductionConfig()
+		encoder = zapcore.NewJSONEncoder(zap.NewProductionEncoderConfig())
 	default:
-		zapConfig = zap.NewDevelopmentConfig()
+		encoderConfig := zap.NewDevelopmentEncoderConfig()
+		encoderConfig.EncodeLevel = zapcore.CapitalColorLevelEncoder
+		encoder = zapcore.NewConsoleEncoder(encoderConfig)
+		opts = append(opts, zap.Development())
 	}
 
-	zapConfig.Level = zap.NewAtomicLevelAt(level)
+	out, err := openOutput(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build logger: %w", err)
+	}
 
-	if cfg.OutputPath != "" {
-		zapConfig.OutputPaths = []string{cfg.OutputPath}
+	// Keep secrets and personal data out of logs. The sampler goes outside
+	// the redacting core so it sees every entry before it is written.
+	core := newRedactingCore(zapcore.NewCore(encoder, out, atomicLevel))
+	if cfg.Sampling.Initial > 0 {
+		tick := cfg.Sampling.Tick
+		if tick <= 0 {
+			tick = time.Second
+		}
+		core = zapcore.NewSamplerWithOptions(core, tick, cfg.Sampling.Initial, cfg.Sampling.Thereafter)
 	}
 
-	logger, err := zapConfig.Build(
+	opts = append(opts,
+		zap.AddCaller(),
 		zap.AddCallerSkip(1), // Skip the wrapper function
 		zap.AddStacktrace(zapcore.ErrorLevel),
+		zap.ErrorOutput(zapcore.Lock(os.Stderr)),
 	)
-	if err != nil {
-		return nil, fmt.Errorf("failed to build logger: %w", err)
-	}
-
-	return &ZapLogger{logger: logger}, nil
+	return &ZapLogger{logger: zap.New(core, opts...), level: atomicLevel}, nil
 }
 
 // NewDefault creates a logger with sensible defaults
 func NewDefault() Logger {
-	cfg := Config{
-		Level:       "info",
-		Environment: "development",
-		OutputPath:  "stdout",
-	}
-
-	logger, err := New(cfg)
+	logger, err := New(DefaultConfig())
 	if err != nil {
 		// Fallback to a basic logger if configuration fails
-		zapLogger, _ := zap.NewDevelopment()
-		return &ZapLogger{logger: zapLogger}
+		level := zap.NewAtomicLevelAt(zapcore.InfoLevel)
+		core := zapcore.NewCore(zapcore.NewConsoleEncoder(zap.NewDevelopmentEncoderConfig()), zapcore.Lock(os.Stderr), level)
+		return &ZapLogger{logger: zap.New(newRedactingCore(core)), level: level}
 	}
 
 	return logger
@@ -125,31 +159,46 @@ func (l *ZapLogger) Fatal(msg string, fields ...Field) {
 
 // DebugContext logs a debug message with context
 func (l *ZapLogger) DebugContext(ctx context.Context, msg string, fields ...Field) {
-	fields = append(fields, contextFields(ctx)...)
+	fields = contextFields(ctx, fields)
 	l.logger.Debug(msg, fields...)
 }
 
 // InfoContext logs an info message with context
 func (l *ZapLogger) InfoContext(ctx context.Context, msg string, fields ...Field) {
-	fields = append(fields, contextFields(ctx)...)
+	fields = contextFields(ctx, fields)
 	l.logger.Info(msg, fields...)
 }
 
 // WarnContext logs a warning message with context
 func (l *ZapLogger) WarnContext(ctx context.Context, msg string, fields ...Field) {
-	fields = append(fields, contextFields(ctx)...)
+	fields = contextFields(ctx, fields)
 	l.logger.Warn(msg, fields...)
 }
 
 // ErrorContext logs an error message with context
 func (l *ZapLogger) ErrorContext(ctx context.Context, msg string, fields ...Field) {
-	fields = append(fields, contextFields(ctx)...)
+	fields = contextFields(ctx, fields)
 	l.logger.Error(msg, fields...)
 }
 
 // With creates a child logger with additional fields
 func (l *ZapLogger) With(fields ...Field) Logger {
-	return &ZapLogger{logger: l.logger.With(fields...)}
+	return &ZapLogger{logger: l.logger.With(fields...), level: l.level}
+}
+
+// Level returns the minimum level entries are logged at
+func (l *ZapLogger) Level() string {
+	return l.level.Level().String()
+}
+
+// SetLevel changes the minimum level at runtime
+func (l *ZapLogger) SetLevel(level string) error {
+	lvl, err := parseLevel(level)
+	if err != nil {
+		return err
+	}
+	l.level.SetLevel(lvl)
+	return nil
 }
 
 // Sync flushes any buffered log entries
@@ -174,29 +223,10 @@ func parseLevel(level string) (zapcore.Level, error) {
 	}
 }
 
-// contextFields extracts logging fields from context
-func contextFields(ctx context.Context) []Field {
-	var fields []Field
-
-	// Extract common context values for logging
-	if userID := ctx.Value("user_id"); userID != nil {
-		fields = append(fields, zap.Any("user_id", userID))
-	}
-
-	if chatID := ctx.Value("chat_id"); chatID != nil {
-		fields = append(fields, zap.Any("chat_id", chatID))
-	}
-
-	if requestID := ctx.Value("request_id"); requestID != nil {
-		fields = append(fields, zap.String("request_id", requestID.(string)))
-	}
-
-	return fields
-}
-
 // Convenience field constructors (re-export zap functions for ease of use)
 var (
 	String   = zap.String
+	Stringer = zap.Stringer
 	Int      = zap.Int
 	Int64    = zap.Int64
 	Float64  = zap.Float64
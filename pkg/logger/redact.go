@@ -0,0 +1,149 @@
+package logger
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// Redacted replaces sensitive values in logs
+const Redacted = "[REDACTED]"
+
+var (
+	// botToken matches Telegram bot tokens, e.g. in Bot API request URLs
+	botToken = regexp.MustCompile(`\d{5,12}:[A-Za-z0-9_-]{30,}`)
+	// phoneNumber matches international phone numbers in free text
+	phoneNumber = regexp.MustCompile(`\+\d[\d ()-]{6,18}\d`)
+)
+
+// sensitiveKeys are field and JSON object keys whose values are always
+// redacted, such as the contact and payment fields of Telegram updates
+var sensitiveKeys = map[string]bool{
+	"token":                      true,
+	"bot_token":                  true,
+	"provider_token":             true,
+	"secret_token":               true,
+	"password":                   true,
+	"phone_number":               true,
+	"invoice_payload":            true,
+	"telegram_payment_charge_id": true,
+	"provider_payment_charge_id": true,
+	"order_info":                 true,
+	"shipping_address":           true,
+	"credentials":                true,
+}
+
+func sensitiveKey(key string) bool {
+	return sensitiveKeys[strings.ToLower(key)]
+}
+
+// redactingCore scrubs tokens, phone numbers and payment payloads from the
+// message and fields of every entry before passing it on
+type redactingCore struct {
+	zapcore.Core
+}
+
+func newRedactingCore(core zapcore.Core) zapcore.Core {
+	return redactingCore{core}
+}
+
+func (c redactingCore) With(fields []zapcore.Field) zapcore.Core {
+	return redactingCore{c.Core.With(redactFields(fields))}
+}
+
+func (c redactingCore) Check(entry zapcore.Entry, checked *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(entry.Level) {
+		return checked.AddCore(entry, c)
+	}
+	return checked
+}
+
+func (c redactingCore) Write(entry zapcore.Entry, fields []zapcore.Field) error {
+	entry.Message = RedactString(entry.Message)
+	return c.Core.Write(entry, redactFields(fields))
+}
+
+func redactFields(fields []zapcore.Field) []zapcore.Field {
+	redacted := make([]zapcore.Field, len(fields))
+	for i, f := range fields {
+		redacted[i] = redactField(f)
+	}
+	return redacted
+}
+
+// redactField returns the field with sensitive values replaced. Structured
+// values are encoded to JSON and scrubbed key by key.
+func redactField(f zapcore.Field) zapcore.Field {
+	if sensitiveKey(f.Key) {
+		return zap.String(f.Key, Redacted)
+	}
+
+	switch f.Type {
+	case zapcore.StringType:
+		f.String = RedactString(f.String)
+	case zapcore.ErrorType:
+		if err, ok := f.Interface.(error); ok {
+			return zap.String(f.Key, RedactString(err.Error()))
+		}
+	case zapcore.StringerType:
+		if s, ok := f.Interface.(fmt.Stringer); ok {
+			return zap.String(f.Key, RedactString(s.String()))
+		}
+	case zapcore.ReflectType:
+		return zap.Any(f.Key, redactJSON(f.Interface))
+	case zapcore.ObjectMarshalerType, zapcore.ArrayMarshalerType:
+		enc := zapcore.NewMapObjectEncoder()
+		f.AddTo(enc)
+		return zap.Any(f.Key, redactJSON(enc.Fields[f.Key]))
+	}
+	return f
+}
+
+// redactJSON returns v as generic JSON values with sensitive keys and strings
+// scrubbed. Values that cannot be encoded are dropped.
+func redactJSON(v any) any {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return Redacted
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var generic any
+	if err := dec.Decode(&generic); err != nil {
+		return Redacted
+	}
+	return redactValue(generic)
+}
+
+func redactValue(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for key, value := range v {
+			if sensitiveKey(key) {
+				v[key] = Redacted
+			} else {
+				v[key] = redactValue(value)
+			}
+		}
+		return v
+	case []any:
+		for i, value := range v {
+			v[i] = redactValue(value)
+		}
+		return v
+	case string:
+		return RedactString(v)
+	}
+	return v
+}
+
+// RedactString replaces bot tokens and phone numbers in free text
+func RedactString(s string) string {
+	s = botToken.ReplaceAllString(s, Redacted)
+	return phoneNumber.ReplaceAllString(s, Redacted)
+}
@@ -0,0 +1,64 @@
+package logger
+
+import (
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+// RotationConfig rotates a log file by size and time and prunes old files.
+// It applies only when the output is a file; the zero value never rotates.
+type RotationConfig struct {
+	MaxSizeMB  int           `json:"max_size_mb" yaml:"max_size_mb"`   // rotate when the file exceeds this size, 0 uses 100 MB
+	Every      time.Duration `json:"every" yaml:"every"`               // also rotate at this interval, e.g. 24h
+	MaxBackups int           `json:"max_backups" yaml:"max_backups"`   // rotated files kept, 0 keeps all
+	MaxAgeDays int           `json:"max_age_days" yaml:"max_age_days"` // days rotated files are kept, 0 keeps all
+	Compress   bool          `json:"compress" yaml:"compress"`         // gzip rotated files
+}
+
+// Enabled reports whether any rotation or retention is configured
+func (r RotationConfig) Enabled() bool {
+	return r.MaxSizeMB > 0 || r.Every > 0 || r.MaxBackups > 0 || r.MaxAgeDays > 0 || r.Compress
+}
+
+// openOutput opens the output of the logger: stdout, stderr or a file,
+// rotated if configured
+func openOutput(cfg Config) (zapcore.WriteSyncer, error) {
+	path := cfg.OutputPath
+	if path == "" {
+		path = "stderr"
+	}
+	if path == "stdout" || path == "stderr" || !cfg.Rotation.Enabled() {
+		out, _, err := zap.Open(path)
+		if err != nil {
+			return nil, fmt.Errorf("open log output: %w", err)
+		}
+		return out, nil
+	}
+
+	file := &lumberjack.Logger{
+		Filename:   path,
+		MaxSize:    cfg.Rotation.MaxSizeMB,
+		MaxBackups: cfg.Rotation.MaxBackups,
+		MaxAge:     cfg.Rotation.MaxAgeDays,
+		Compress:   cfg.Rotation.Compress,
+		LocalTime:  true,
+	}
+	if cfg.Rotation.Every > 0 {
+		go rotateEvery(file, cfg.Rotation.Every)
+	}
+	return zapcore.AddSync(file), nil
+}
+
+// rotateEvery rotates the file at every multiple of the interval, e.g. at
+// midnight for 24h, for the lifetime of the process
+func rotateEvery(file *lumberjack.Logger, every time.Duration) {
+	for {
+		now := time.Now()
+		time.Sleep(now.Truncate(every).Add(every).Sub(now))
+		_ = file.Rotate()
+	}
+}